@@ -8,55 +8,116 @@ import (
 	"github.com/mayurrawte/gotrust"
 )
 
-// EchoContext wraps echo.Context to implement gotrust.HTTPContext
+// EchoContext wraps echo.Context to implement gotrust.HTTPContext.
+// Bind uses echo.Context's Bind; the auth handlers apply
+// Config.MaxRequestBodyBytes themselves, other routes can use Echo's
+// middleware.BodyLimit.
 type EchoContext struct {
-	echo.Context
+	ctx echo.Context
+}
+
+// NewEchoContext creates a new Echo context wrapper
+func NewEchoContext(c echo.Context) *EchoContext {
+	return &EchoContext{ctx: c}
+}
+
+// EchoContext returns the underlying echo.Context
+func (e *EchoContext) EchoContext() echo.Context {
+	return e.ctx
+}
+
+// Request returns the underlying request
+func (e *EchoContext) Request() *http.Request {
+	return e.ctx.Request()
 }
 
 // Context returns the request context
 func (e *EchoContext) Context() context.Context {
-	return e.Request().Context()
+	return e.ctx.Request().Context()
 }
 
 // GetHeader gets a request header
 func (e *EchoContext) GetHeader(key string) string {
-	return e.Request().Header.Get(key)
+	return e.ctx.Request().Header.Get(key)
 }
 
 // GetQueryParam gets a query parameter
 func (e *EchoContext) GetQueryParam(key string) string {
-	return e.QueryParam(key)
+	return e.ctx.QueryParam(key)
 }
 
 // GetFormValue gets a form value
 func (e *EchoContext) GetFormValue(key string) string {
-	return e.FormValue(key)
+	return e.ctx.FormValue(key)
+}
+
+// Bind decodes the request body
+func (e *EchoContext) Bind(dest interface{}) error {
+	return e.ctx.Bind(dest)
 }
 
 // SetHeader sets a response header
 func (e *EchoContext) SetHeader(key, value string) {
-	e.Response().Header().Set(key, value)
+	e.ctx.Response().Header().Set(key, value)
 }
 
 // SetStatus sets the response status code
 func (e *EchoContext) SetStatus(code int) {
-	e.Response().Status = code
+	e.ctx.Response().Status = code
+}
+
+// JSON sends a JSON response
+func (e *EchoContext) JSON(code int, data interface{}) error {
+	return e.ctx.JSON(code, data)
+}
+
+// Redirect sends a redirect response
+func (e *EchoContext) Redirect(code int, url string) error {
+	return e.ctx.Redirect(code, url)
+}
+
+// String sends a text response
+func (e *EchoContext) String(code int, text string) error {
+	return e.ctx.String(code, text)
 }
 
 // GetCookie gets a cookie
 func (e *EchoContext) GetCookie(name string) (*http.Cookie, error) {
-	return e.Cookie(name)
+	return e.ctx.Cookie(name)
 }
 
 // SetCookie sets a cookie
 func (e *EchoContext) SetCookie(cookie *http.Cookie) {
-	e.Context.SetCookie(cookie)
+	if value := gotrust.CookieHeader(cookie); value != "" {
+		e.ctx.Response().Header().Add("Set-Cookie", value)
+	}
+}
+
+// Set sets a context value
+func (e *EchoContext) Set(key string, value interface{}) {
+	e.ctx.Set(key, value)
+}
+
+// Get gets a context value
+func (e *EchoContext) Get(key string) interface{} {
+	return e.ctx.Get(key)
+}
+
+// GetClaims returns the token claims set by the gotrust auth middleware
+func GetClaims(c echo.Context) (*gotrust.TokenClaims, bool) {
+	return gotrust.GetClaims(NewEchoContext(c))
+}
+
+// GetRolesFromContext returns the authenticated user's roles set by the
+// gotrust auth middleware
+func GetRolesFromContext(c echo.Context) []string {
+	return gotrust.GetRolesFromContext(NewEchoContext(c))
 }
 
 // WrapHandler converts a gotrust.HTTPHandler to echo.HandlerFunc
 func WrapHandler(handler gotrust.HTTPHandler) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		ctx := &EchoContext{Context: c}
+		ctx := NewEchoContext(c)
 		return handler(ctx)
 	}
 }
@@ -68,13 +129,13 @@ func WrapMiddleware(middleware gotrust.HTTPMiddleware) echo.MiddlewareFunc {
 			nextHandler := func(ctx gotrust.HTTPContext) error {
 				// Extract echo context and call next
 				if echoCtx, ok := ctx.(*EchoContext); ok {
-					return next(echoCtx.Context)
+					return next(echoCtx.ctx)
 				}
 				return next(c)
 			}
 			
 			wrappedNext := middleware(nextHandler)
-			ctx := &EchoContext{Context: c}
+			ctx := NewEchoContext(c)
 			return wrappedNext(ctx)
 		}
 	}
@@ -117,6 +178,15 @@ func (r *EchoRouter) PUT(path string, handler gotrust.HTTPHandler, middleware ..
 	r.group.PUT(path, WrapHandler(handler), echoMiddleware...)
 }
 
+// PATCH registers a PATCH route
+func (r *EchoRouter) PATCH(path string, handler gotrust.HTTPHandler, middleware ...gotrust.HTTPMiddleware) {
+	echoMiddleware := make([]echo.MiddlewareFunc, len(middleware))
+	for i, m := range middleware {
+		echoMiddleware[i] = WrapMiddleware(m)
+	}
+	r.group.PATCH(path, WrapHandler(handler), echoMiddleware...)
+}
+
 // DELETE registers a DELETE route
 func (r *EchoRouter) DELETE(path string, handler gotrust.HTTPHandler, middleware ...gotrust.HTTPMiddleware) {
 	echoMiddleware := make([]echo.MiddlewareFunc, len(middleware))
@@ -137,20 +207,41 @@ func (r *EchoRouter) Group(prefix string, middleware ...gotrust.HTTPMiddleware)
 }
 
 // RegisterRoutes registers all auth routes on an Echo instance
-func RegisterRoutes(e *echo.Echo, basePath string, handlers *gotrust.GenericAuthHandlers) {
+func RegisterRoutes(e *echo.Echo, basePath string, handlers *gotrust.GenericAuthHandlers, opts ...gotrust.RouteOptions) {
 	auth := e.Group(basePath)
-	router := NewEchoRouter(auth)
+	router := gotrust.WithRouteOptions(NewEchoRouter(auth), opts...)
 	
 	// Local auth
 	router.POST("/signup", handlers.SignUpHandler)
 	router.POST("/signin", handlers.SignInHandler)
+	router.POST("/guest", handlers.GuestHandler)
+	router.POST("/guest/upgrade", handlers.UpgradeGuestHandler, handlers.AuthMiddleware())
 	router.POST("/refresh", handlers.RefreshTokenHandler)
+	router.POST("/verify-email", handlers.VerifyEmailHandler)
+	router.POST("/resend-verification", handlers.ResendVerificationHandler)
 	router.POST("/logout", handlers.LogoutHandler, handlers.OptionalAuthMiddleware())
+	router.POST("/logout-all", handlers.LogoutAllHandler, handlers.AuthMiddleware())
+	router.GET("/refresh-tokens", handlers.ListRefreshTokensHandler, handlers.AuthMiddleware())
+	router.POST("/refresh-tokens/revoke", handlers.RevokeRefreshTokenHandler, handlers.AuthMiddleware())
+	router.GET("/account/export", handlers.ExportUserDataHandler, handlers.AuthMiddleware())
+	router.POST("/claims/refresh", handlers.RefreshClaimsHandler, handlers.AuthMiddleware())
 	router.GET("/user", handlers.GetUserHandler, handlers.AuthMiddleware())
+	router.GET("/me", handlers.MeHandler, handlers.AuthMiddleware())
+	router.POST("/session/token", handlers.SessionTokenHandler, handlers.SessionMiddleware())
+	router.GET("/userinfo", handlers.UserInfoHandler, handlers.AuthMiddleware())
+	if patch, ok := router.(gotrust.PatchRouter); ok {
+		patch.PATCH("/profile", handlers.UpdateProfileHandler, handlers.AuthMiddleware())
+	}
+	router.POST("/email/change", handlers.RequestEmailChangeHandler, handlers.AuthMiddleware())
+	router.POST("/email/confirm", handlers.ConfirmEmailChangeHandler)
+	router.GET("/audit", handlers.AuditLogHandler, handlers.AuthMiddleware(), handlers.RequireAuditAccess())
 	
 	// OAuth
-	router.GET("/google", handlers.OAuthHandler("google"))
-	router.GET("/google/callback", handlers.OAuthCallbackHandler("google"))
-	router.GET("/github", handlers.OAuthHandler("github"))
-	router.GET("/github/callback", handlers.OAuthCallbackHandler("github"))
+	for _, provider := range gotrust.OAuthProviders() {
+		name := string(provider)
+		router.GET("/"+name, handlers.OAuthHandler(name))
+		router.GET("/"+name+"/callback", handlers.OAuthCallbackHandler(name))
+		router.POST("/oauth/"+name+"/token", handlers.OAuthTokenHandler(name))
+	}
+	router.POST("/oauth/link", handlers.ConfirmAccountLinkHandler)
 }
\ No newline at end of file
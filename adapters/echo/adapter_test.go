@@ -0,0 +1,53 @@
+package echo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mayurrawte/gotrust"
+	"github.com/mayurrawte/gotrust/testutil"
+)
+
+func TestContextConformance(t *testing.T) {
+	e := echo.New()
+	testutil.RunHTTPContextConformance(t, func(w http.ResponseWriter, r *http.Request) gotrust.HTTPContext {
+		return NewEchoContext(e.NewContext(r, w))
+	})
+}
+
+func TestGetRolesFromContext(t *testing.T) {
+	config := gotrust.NewConfig()
+	config.JWTSecret = "test-secret-that-is-long-enough-for-hs256"
+	authService := gotrust.NewAuthService(config, gotrust.NewMemoryUserStore(), gotrust.NewMemorySessionStore())
+	handlers := gotrust.NewGenericAuthHandlers(authService, config)
+	user := &gotrust.User{ID: "user-1", Email: "jane@example.com", Roles: []string{"admin", "editor"}}
+
+	tests := []struct {
+		name       string
+		middleware gotrust.HTTPMiddleware
+	}{
+		{name: "AuthMiddleware", middleware: handlers.AuthMiddleware()},
+		{name: "OptionalAuthMiddleware", middleware: handlers.OptionalAuthMiddleware()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var roles []string
+			e := echo.New()
+			e.GET("/me", func(c echo.Context) error {
+				roles = GetRolesFromContext(c)
+				return nil
+			}, WrapMiddleware(tt.middleware))
+
+			req := testutil.NewAuthenticatedRequest(t, authService, user, http.MethodGet, "/me", nil)
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			if strings.Join(roles, ",") != "admin,editor" {
+				t.Errorf("GetRolesFromContext() = %v, want [admin editor]", roles)
+			}
+		})
+	}
+}
@@ -10,65 +10,82 @@ import (
 
 // GinContext wraps gin.Context to implement gotrust.HTTPContext
 type GinContext struct {
-	*gin.Context
+	ctx *gin.Context
+}
+
+// NewGinContext creates a new Gin context wrapper
+func NewGinContext(c *gin.Context) *GinContext {
+	return &GinContext{ctx: c}
+}
+
+// GinContext returns the underlying gin.Context
+func (g *GinContext) GinContext() *gin.Context {
+	return g.ctx
+}
+
+// Request returns the underlying request
+func (g *GinContext) Request() *http.Request {
+	return g.ctx.Request
 }
 
 // Context returns the request context
 func (g *GinContext) Context() context.Context {
-	return g.Request.Context()
+	return g.ctx.Request.Context()
 }
 
 // GetHeader gets a request header
 func (g *GinContext) GetHeader(key string) string {
-	return g.GetHeader(key)
+	return g.ctx.GetHeader(key)
 }
 
 // GetQueryParam gets a query parameter
 func (g *GinContext) GetQueryParam(key string) string {
-	return g.Query(key)
+	return g.ctx.Query(key)
 }
 
 // GetFormValue gets a form value
 func (g *GinContext) GetFormValue(key string) string {
-	return g.PostForm(key)
+	return g.ctx.PostForm(key)
 }
 
-// Bind decodes request body
+// Bind decodes request body. Gin does not limit body size; the auth handlers
+// apply Config.MaxRequestBodyBytes, and other routes can wrap c.Request.Body
+// with http.MaxBytesReader in a middleware.
 func (g *GinContext) Bind(dest interface{}) error {
-	return g.ShouldBindJSON(dest)
+	return g.ctx.ShouldBindJSON(dest)
 }
 
 // SetHeader sets a response header
 func (g *GinContext) SetHeader(key, value string) {
-	g.Header(key, value)
+	g.ctx.Header(key, value)
 }
 
 // SetStatus sets the response status code
 func (g *GinContext) SetStatus(code int) {
-	g.Status(code)
+	g.ctx.Status(code)
 }
 
 // JSON sends a JSON response
 func (g *GinContext) JSON(code int, data interface{}) error {
-	g.Context.JSON(code, data)
+	g.ctx.JSON(code, data)
 	return nil
 }
 
 // Redirect sends a redirect response
 func (g *GinContext) Redirect(code int, url string) error {
-	g.Context.Redirect(code, url)
+	g.ctx.Redirect(code, url)
 	return nil
 }
 
 // String sends a text response
 func (g *GinContext) String(code int, text string) error {
-	g.Context.String(code, text)
+	g.ctx.String(code, text)
 	return nil
 }
 
 // GetCookie gets a cookie
 func (g *GinContext) GetCookie(name string) (*http.Cookie, error) {
-	value, err := g.Cookie(name)
+	value, err := g.ctx.Cookie(name)
 	if err != nil {
 		return nil, err
 	}
@@ -77,21 +94,38 @@ func (g *GinContext) GetCookie(name string) (*http.Cookie, error) {
 
 // SetCookie sets a cookie
 func (g *GinContext) SetCookie(cookie *http.Cookie) {
-	g.Context.SetCookie(
-		cookie.Name,
-		cookie.Value,
-		cookie.MaxAge,
-		cookie.Path,
-		cookie.Domain,
-		cookie.Secure,
-		cookie.HttpOnly,
-	)
+	// gin's SetCookie drops Expires and Partitioned, so write the header directly
+	if value := gotrust.CookieHeader(cookie); value != "" {
+		g.ctx.Writer.Header().Add("Set-Cookie", value)
+	}
+}
+
+// Set sets a context value
+func (g *GinContext) Set(key string, value interface{}) {
+	g.ctx.Set(key, value)
+}
+
+// Get gets a context value
+func (g *GinContext) Get(key string) interface{} {
+	value, _ := g.ctx.Get(key)
+	return value
+}
+
+// GetClaims returns the token claims set by the gotrust auth middleware
+func GetClaims(c *gin.Context) (*gotrust.TokenClaims, bool) {
+	return gotrust.GetClaims(NewGinContext(c))
+}
+
+// GetRolesFromContext returns the authenticated user's roles set by the
+// gotrust auth middleware
+func GetRolesFromContext(c *gin.Context) []string {
+	return gotrust.GetRolesFromContext(NewGinContext(c))
 }
 
 // WrapHandler converts a gotrust.HTTPHandler to gin.HandlerFunc
 func WrapHandler(handler gotrust.HTTPHandler) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx := &GinContext{Context: c}
+		ctx := NewGinContext(c)
 		if err := handler(ctx); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
@@ -101,7 +135,7 @@ func WrapHandler(handler gotrust.HTTPHandler) gin.HandlerFunc {
 // WrapMiddleware converts a gotrust.HTTPMiddleware to gin.HandlerFunc
 func WrapMiddleware(middleware gotrust.HTTPMiddleware) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx := &GinContext{Context: c}
+		ctx := NewGinContext(c)
 		
 		nextHandler := func(httpCtx gotrust.HTTPContext) error {
 			c.Next()
@@ -156,6 +190,16 @@ func (r *GinRouter) PUT(path string, handler gotrust.HTTPHandler, middleware ...
 	r.group.PUT(path, handlers...)
 }
 
+// PATCH registers a PATCH route
+func (r *GinRouter) PATCH(path string, handler gotrust.HTTPHandler, middleware ...gotrust.HTTPMiddleware) {
+	handlers := make([]gin.HandlerFunc, len(middleware)+1)
+	for i, m := range middleware {
+		handlers[i] = WrapMiddleware(m)
+	}
+	handlers[len(middleware)] = WrapHandler(handler)
+	r.group.PATCH(path, handlers...)
+}
+
 // DELETE registers a DELETE route
 func (r *GinRouter) DELETE(path string, handler gotrust.HTTPHandler, middleware ...gotrust.HTTPMiddleware) {
 	handlers := make([]gin.HandlerFunc, len(middleware)+1)
@@ -177,20 +221,41 @@ func (r *GinRouter) Group(prefix string, middleware ...gotrust.HTTPMiddleware) g
 }
 
 // RegisterRoutes registers all auth routes on a Gin engine
-func RegisterRoutes(router *gin.Engine, basePath string, handlers *gotrust.GenericAuthHandlers) {
+func RegisterRoutes(router *gin.Engine, basePath string, handlers *gotrust.GenericAuthHandlers, opts ...gotrust.RouteOptions) {
 	auth := router.Group(basePath)
-	r := NewGinRouter(auth)
+	r := gotrust.WithRouteOptions(NewGinRouter(auth), opts...)
 	
 	// Local auth
 	r.POST("/signup", handlers.SignUpHandler)
 	r.POST("/signin", handlers.SignInHandler)
+	r.POST("/guest", handlers.GuestHandler)
+	r.POST("/guest/upgrade", handlers.UpgradeGuestHandler, handlers.AuthMiddleware())
 	r.POST("/refresh", handlers.RefreshTokenHandler)
+	r.POST("/verify-email", handlers.VerifyEmailHandler)
+	r.POST("/resend-verification", handlers.ResendVerificationHandler)
 	r.POST("/logout", handlers.LogoutHandler, handlers.OptionalAuthMiddleware())
+	r.POST("/logout-all", handlers.LogoutAllHandler, handlers.AuthMiddleware())
+	r.GET("/refresh-tokens", handlers.ListRefreshTokensHandler, handlers.AuthMiddleware())
+	r.POST("/refresh-tokens/revoke", handlers.RevokeRefreshTokenHandler, handlers.AuthMiddleware())
+	r.GET("/account/export", handlers.ExportUserDataHandler, handlers.AuthMiddleware())
+	r.POST("/claims/refresh", handlers.RefreshClaimsHandler, handlers.AuthMiddleware())
 	r.GET("/user", handlers.GetUserHandler, handlers.AuthMiddleware())
+	r.GET("/me", handlers.MeHandler, handlers.AuthMiddleware())
+	r.POST("/session/token", handlers.SessionTokenHandler, handlers.SessionMiddleware())
+	r.GET("/userinfo", handlers.UserInfoHandler, handlers.AuthMiddleware())
+	if patch, ok := r.(gotrust.PatchRouter); ok {
+		patch.PATCH("/profile", handlers.UpdateProfileHandler, handlers.AuthMiddleware())
+	}
+	r.POST("/email/change", handlers.RequestEmailChangeHandler, handlers.AuthMiddleware())
+	r.POST("/email/confirm", handlers.ConfirmEmailChangeHandler)
+	r.GET("/audit", handlers.AuditLogHandler, handlers.AuthMiddleware(), handlers.RequireAuditAccess())
 	
 	// OAuth
-	r.GET("/google", handlers.OAuthHandler("google"))
-	r.GET("/google/callback", handlers.OAuthCallbackHandler("google"))
-	r.GET("/github", handlers.OAuthHandler("github"))
-	r.GET("/github/callback", handlers.OAuthCallbackHandler("github"))
+	for _, provider := range gotrust.OAuthProviders() {
+		name := string(provider)
+		r.GET("/"+name, handlers.OAuthHandler(name))
+		r.GET("/"+name+"/callback", handlers.OAuthCallbackHandler(name))
+		r.POST("/oauth/"+name+"/token", handlers.OAuthTokenHandler(name))
+	}
+	r.POST("/oauth/link", handlers.ConfirmAccountLinkHandler)
 }
\ No newline at end of file
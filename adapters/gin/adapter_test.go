@@ -0,0 +1,55 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mayurrawte/gotrust"
+	"github.com/mayurrawte/gotrust/testutil"
+)
+
+func TestContextConformance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutil.RunHTTPContextConformance(t, func(w http.ResponseWriter, r *http.Request) gotrust.HTTPContext {
+		c, _ := gin.CreateTestContext(w)
+		c.Request = r
+		return NewGinContext(c)
+	})
+}
+
+func TestGetRolesFromContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := gotrust.NewConfig()
+	config.JWTSecret = "test-secret-that-is-long-enough-for-hs256"
+	authService := gotrust.NewAuthService(config, gotrust.NewMemoryUserStore(), gotrust.NewMemorySessionStore())
+	handlers := gotrust.NewGenericAuthHandlers(authService, config)
+	user := &gotrust.User{ID: "user-1", Email: "jane@example.com", Roles: []string{"admin", "editor"}}
+
+	tests := []struct {
+		name       string
+		middleware gotrust.HTTPMiddleware
+	}{
+		{name: "AuthMiddleware", middleware: handlers.AuthMiddleware()},
+		{name: "OptionalAuthMiddleware", middleware: handlers.OptionalAuthMiddleware()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var roles []string
+			router := gin.New()
+			router.GET("/me", WrapMiddleware(tt.middleware), func(c *gin.Context) {
+				roles = GetRolesFromContext(c)
+			})
+
+			req := testutil.NewAuthenticatedRequest(t, authService, user, http.MethodGet, "/me", nil)
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if strings.Join(roles, ",") != "admin,editor" {
+				t.Errorf("GetRolesFromContext() = %v, want [admin editor]", roles)
+			}
+		})
+	}
+}
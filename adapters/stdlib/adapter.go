@@ -5,51 +5,70 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/mayurrawte/gotrust"
 )
 
 // StdContext wraps http.Request and http.ResponseWriter to implement gotrust.HTTPContext
 type StdContext struct {
-	Request  *http.Request
+	request  *http.Request
 	Response http.ResponseWriter
 	values   map[string]interface{}
 	status   int
+	
+	// MaxBodyBytes limits the body read by Bind. Zero uses
+	// gotrust.DefaultMaxRequestBodyBytes, a negative value disables the limit.
+	MaxBodyBytes int64
 }
 
 // NewStdContext creates a new standard library context
 func NewStdContext(w http.ResponseWriter, r *http.Request) *StdContext {
 	return &StdContext{
-		Request:  r,
+		request:  r,
 		Response: w,
 		values:   make(map[string]interface{}),
 		status:   http.StatusOK,
 	}
 }
 
+// Request returns the underlying request
+func (c *StdContext) Request() *http.Request {
+	return c.request
+}
+
 // Context returns the request context
 func (c *StdContext) Context() context.Context {
-	return c.Request.Context()
+	return c.request.Context()
 }
 
 // GetHeader gets a request header
 func (c *StdContext) GetHeader(key string) string {
-	return c.Request.Header.Get(key)
+	return c.request.Header.Get(key)
 }
 
 // GetQueryParam gets a query parameter
 func (c *StdContext) GetQueryParam(key string) string {
-	return c.Request.URL.Query().Get(key)
+	return c.request.URL.Query().Get(key)
 }
 
 // GetFormValue gets a form value
 func (c *StdContext) GetFormValue(key string) string {
-	return c.Request.FormValue(key)
+	return c.request.FormValue(key)
 }
 
-// Bind decodes JSON request body
+// Bind decodes JSON request body. Bodies larger than MaxBodyBytes fail with
+// an *http.MaxBytesError, which the auth handlers report as 413.
 func (c *StdContext) Bind(dest interface{}) error {
-	decoder := json.NewDecoder(c.Request.Body)
+	limit := c.MaxBodyBytes
+	if limit == 0 {
+		limit = gotrust.DefaultMaxRequestBodyBytes
+	}
+	if limit > 0 {
+		c.request.Body = http.MaxBytesReader(c.Response, c.request.Body, limit)
+	}
+	
+	decoder := json.NewDecoder(c.request.Body)
 	return decoder.Decode(dest)
 }
 
@@ -73,7 +92,7 @@ func (c *StdContext) JSON(code int, data interface{}) error {
 
 // Redirect sends a redirect response
 func (c *StdContext) Redirect(code int, url string) error {
-	http.Redirect(c.Response, c.Request, url, code)
+	http.Redirect(c.Response, c.request, url, code)
 	return nil
 }
 
@@ -87,12 +106,14 @@ func (c *StdContext) String(code int, text string) error {
 
 // GetCookie gets a cookie
 func (c *StdContext) GetCookie(name string) (*http.Cookie, error) {
-	return c.Request.Cookie(name)
+	return c.request.Cookie(name)
 }
 
 // SetCookie sets a cookie
 func (c *StdContext) SetCookie(cookie *http.Cookie) {
-	http.SetCookie(c.Response, cookie)
+	if value := gotrust.CookieHeader(cookie); value != "" {
+		c.Response.Header().Add("Set-Cookie", value)
+	}
 }
 
 // Set sets a context value
@@ -141,6 +162,7 @@ type Router struct {
 	mux        *http.ServeMux
 	prefix     string
 	middleware []gotrust.HTTPMiddleware
+	routes     *routeTable // set when path normalization is enabled
 }
 
 // NewRouter creates a new standard library router
@@ -151,6 +173,77 @@ func NewRouter(mux *http.ServeMux) *Router {
 	}
 }
 
+// SetNormalizePaths makes routes registered afterwards on the router and its
+// groups also match paths differing in case or by a trailing slash, like
+// /SignIn or /signin/ for /signin. It registers a catch-all for the router's
+// prefix (e.g. /auth/) on the ServeMux, answering 404 for unknown paths.
+// Exact paths are always matched; disabling it restores strict matching for
+// routes registered afterwards.
+func (r *Router) SetNormalizePaths(enabled bool) {
+	if !enabled {
+		r.routes = nil
+		return
+	}
+	if r.routes == nil {
+		r.routes = &routeTable{
+			pattern:  r.prefix + "/",
+			handlers: make(map[string]map[string]http.HandlerFunc),
+		}
+	}
+}
+
+// routeTable matches requests to the routes of a Router by normalized path
+type routeTable struct {
+	mu         sync.RWMutex
+	pattern    string
+	registered bool
+	handlers   map[string]map[string]http.HandlerFunc // by normalized path, then method
+}
+
+// normalizePath lowercases a path and strips trailing slashes
+func normalizePath(path string) string {
+	normalized := strings.TrimRight(strings.ToLower(path), "/")
+	if normalized == "" {
+		return "/"
+	}
+	return normalized
+}
+
+// add registers a route, and the table's catch-all on the mux on first use
+func (t *routeTable) add(mux *http.ServeMux, method, path string, handler http.HandlerFunc) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	
+	key := normalizePath(path)
+	if t.handlers[key] == nil {
+		t.handlers[key] = make(map[string]http.HandlerFunc)
+	}
+	t.handlers[key][method] = handler
+	
+	if !t.registered {
+		t.registered = true
+		mux.HandleFunc(t.pattern, t.serve)
+	}
+}
+
+// serve dispatches requests the mux did not match exactly
+func (t *routeTable) serve(w http.ResponseWriter, req *http.Request) {
+	t.mu.RLock()
+	methods, ok := t.handlers[normalizePath(req.URL.Path)]
+	handler := methods[req.Method]
+	t.mu.RUnlock()
+	
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if handler == nil {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	handler(w, req)
+}
+
 // handle registers a route with middleware chain
 func (r *Router) handle(method, path string, handler gotrust.HTTPHandler, middleware ...gotrust.HTTPMiddleware) {
 	fullPath := r.prefix + path
@@ -162,17 +255,24 @@ func (r *Router) handle(method, path string, handler gotrust.HTTPHandler, middle
 		finalHandler = allMiddleware[i](finalHandler)
 	}
 	
+	serve := func(w http.ResponseWriter, req *http.Request) {
+		ctx := NewStdContext(w, req)
+		if err := finalHandler(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+	
 	r.mux.HandleFunc(fullPath, func(w http.ResponseWriter, req *http.Request) {
 		if req.Method != method {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		
-		ctx := NewStdContext(w, req)
-		if err := finalHandler(ctx); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		serve(w, req)
 	})
+	
+	if r.routes != nil {
+		r.routes.add(r.mux, method, fullPath, serve)
+	}
 }
 
 // GET registers a GET route
@@ -190,6 +290,11 @@ func (r *Router) PUT(path string, handler gotrust.HTTPHandler, middleware ...got
 	r.handle("PUT", path, handler, middleware...)
 }
 
+// PATCH registers a PATCH route
+func (r *Router) PATCH(path string, handler gotrust.HTTPHandler, middleware ...gotrust.HTTPMiddleware) {
+	r.handle("PATCH", path, handler, middleware...)
+}
+
 // DELETE registers a DELETE route
 func (r *Router) DELETE(path string, handler gotrust.HTTPHandler, middleware ...gotrust.HTTPMiddleware) {
 	r.handle("DELETE", path, handler, middleware...)
@@ -201,28 +306,70 @@ func (r *Router) Group(prefix string, middleware ...gotrust.HTTPMiddleware) gotr
 		mux:        r.mux,
 		prefix:     r.prefix + prefix,
 		middleware: append(r.middleware, middleware...),
+		routes:     r.routes,
 	}
 }
 
 // RegisterRoutes registers all auth routes on a ServeMux
-func RegisterRoutes(mux *http.ServeMux, basePath string, handlers *gotrust.GenericAuthHandlers) {
-	router := &Router{
+func RegisterRoutes(mux *http.ServeMux, basePath string, handlers *gotrust.GenericAuthHandlers, opts ...gotrust.RouteOptions) {
+	stdRouter := &Router{
 		mux:    mux,
 		prefix: basePath,
 	}
+	for _, opt := range opts {
+		if opt.NormalizePaths {
+			stdRouter.SetNormalizePaths(true)
+		}
+	}
+	router := gotrust.WithRouteOptions(stdRouter, opts...)
 	
 	// Local auth
 	router.POST("/signup", handlers.SignUpHandler)
 	router.POST("/signin", handlers.SignInHandler)
+	router.POST("/guest", handlers.GuestHandler)
+	router.POST("/guest/upgrade", handlers.UpgradeGuestHandler, handlers.AuthMiddleware())
 	router.POST("/refresh", handlers.RefreshTokenHandler)
+	router.POST("/verify-email", handlers.VerifyEmailHandler)
+	router.POST("/resend-verification", handlers.ResendVerificationHandler)
 	router.POST("/logout", handlers.LogoutHandler, handlers.OptionalAuthMiddleware())
+	router.POST("/logout-all", handlers.LogoutAllHandler, handlers.AuthMiddleware())
+	router.GET("/refresh-tokens", handlers.ListRefreshTokensHandler, handlers.AuthMiddleware())
+	router.POST("/refresh-tokens/revoke", handlers.RevokeRefreshTokenHandler, handlers.AuthMiddleware())
+	router.GET("/account/export", handlers.ExportUserDataHandler, handlers.AuthMiddleware())
+	router.POST("/claims/refresh", handlers.RefreshClaimsHandler, handlers.AuthMiddleware())
 	router.GET("/user", handlers.GetUserHandler, handlers.AuthMiddleware())
+	router.GET("/me", handlers.MeHandler, handlers.AuthMiddleware())
+	router.POST("/session/token", handlers.SessionTokenHandler, handlers.SessionMiddleware())
+	router.GET("/userinfo", handlers.UserInfoHandler, handlers.AuthMiddleware())
+	if patch, ok := router.(gotrust.PatchRouter); ok {
+		patch.PATCH("/profile", handlers.UpdateProfileHandler, handlers.AuthMiddleware())
+	}
+	router.POST("/email/change", handlers.RequestEmailChangeHandler, handlers.AuthMiddleware())
+	router.POST("/email/confirm", handlers.ConfirmEmailChangeHandler)
+	router.GET("/audit", handlers.AuditLogHandler, handlers.AuthMiddleware(), handlers.RequireAuditAccess())
 	
 	// OAuth
-	router.GET("/google", handlers.OAuthHandler("google"))
-	router.GET("/google/callback", handlers.OAuthCallbackHandler("google"))
-	router.GET("/github", handlers.OAuthHandler("github"))
-	router.GET("/github/callback", handlers.OAuthCallbackHandler("github"))
+	for _, provider := range gotrust.OAuthProviders() {
+		name := string(provider)
+		router.GET("/"+name, handlers.OAuthHandler(name))
+		router.GET("/"+name+"/callback", handlers.OAuthCallbackHandler(name))
+		router.POST("/oauth/"+name+"/token", handlers.OAuthTokenHandler(name))
+	}
+	router.POST("/oauth/link", handlers.ConfirmAccountLinkHandler)
+}
+
+// GetClaims returns the token claims placed in the request context by AuthMiddleware
+func GetClaims(r *http.Request) (*gotrust.TokenClaims, bool) {
+	return gotrust.ClaimsFromContext(r.Context())
+}
+
+// GetRolesFromContext returns the authenticated user's roles placed in the
+// request context by AuthMiddleware
+func GetRolesFromContext(r *http.Request) []string {
+	if claims, ok := gotrust.ClaimsFromContext(r.Context()); ok {
+		return claims.Roles
+	}
+	return nil
 }
 
 // AuthMiddleware is a convenience function for using auth middleware with standard http
@@ -231,23 +378,8 @@ func AuthMiddleware(handlers *gotrust.GenericAuthHandlers) func(http.HandlerFunc
 		return func(w http.ResponseWriter, r *http.Request) {
 			ctx := NewStdContext(w, r)
 			
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error": "Authorization header is required",
-				})
-				return
-			}
-			
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			if tokenString == authHeader {
-				ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error": "Bearer token is required",
-				})
-				return
-			}
-			
-			// Validate token using the auth service
+			// Validate token using the auth service; rejections are written
+			// by the middleware, including the WWW-Authenticate challenge
 			authMiddleware := handlers.AuthMiddleware()
 			nextHandler := func(httpCtx gotrust.HTTPContext) error {
 				next(w, r)
@@ -260,4 +392,4 @@ func AuthMiddleware(handlers *gotrust.GenericAuthHandlers) func(http.HandlerFunc
 			}
 		}
 	}
-}
\ No newline at end of file
+}
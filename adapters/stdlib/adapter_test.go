@@ -0,0 +1,243 @@
+package stdlib
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mayurrawte/gotrust"
+	"github.com/mayurrawte/gotrust/testutil"
+)
+
+func TestContextConformance(t *testing.T) {
+	testutil.RunHTTPContextConformance(t, func(w http.ResponseWriter, r *http.Request) gotrust.HTTPContext {
+		return NewStdContext(w, r)
+	})
+}
+
+func TestBindBodyLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int64
+		size    int
+		wantErr bool
+	}{
+		{name: "under the default limit", size: 1024},
+		{name: "over the default limit", size: int(gotrust.DefaultMaxRequestBodyBytes) + 1, wantErr: true},
+		{name: "over a custom limit", limit: 100, size: 200, wantErr: true},
+		{name: "limit disabled", limit: -1, size: int(gotrust.DefaultMaxRequestBodyBytes) + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"name": "` + strings.Repeat("x", tt.size) + `"}`
+			ctx := NewStdContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+			ctx.MaxBodyBytes = tt.limit
+
+			var dest struct{ Name string }
+			err := ctx.Bind(&dest)
+			var maxBytesErr *http.MaxBytesError
+			if got := errors.As(err, &maxBytesErr); got != tt.wantErr {
+				t.Errorf("Bind() error = %v, want body limit error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisterRoutesMiddleware(t *testing.T) {
+	config := gotrust.NewConfig()
+	config.JWTSecret = "test-secret-that-is-long-enough-for-hs256"
+	authService := gotrust.NewAuthService(config, gotrust.NewMemoryUserStore(), gotrust.NewMemorySessionStore())
+	handlers := gotrust.NewGenericAuthHandlers(authService, config)
+
+	marker := func(next gotrust.HTTPHandler) gotrust.HTTPHandler {
+		return func(ctx gotrust.HTTPContext) error {
+			ctx.SetHeader("X-Marker", "ran")
+			return next(ctx)
+		}
+	}
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, "/auth", handlers, gotrust.RouteOptions{
+		Middleware: map[string][]gotrust.HTTPMiddleware{"/signup": {marker}},
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantMarker bool
+	}{
+		{name: "configured route", method: http.MethodPost, target: "/auth/signup", wantMarker: true},
+		{name: "other route", method: http.MethodPost, target: "/auth/signin"},
+		{name: "authenticated route", method: http.MethodGet, target: "/auth/me"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader("{}")))
+
+			if got := rec.Header().Get("X-Marker") == "ran"; got != tt.wantMarker {
+				t.Errorf("%s %s ran marker = %v, want %v", tt.method, tt.target, got, tt.wantMarker)
+			}
+		})
+	}
+}
+
+func TestGetRolesFromContext(t *testing.T) {
+	config := gotrust.NewConfig()
+	config.JWTSecret = "test-secret-that-is-long-enough-for-hs256"
+	authService := gotrust.NewAuthService(config, gotrust.NewMemoryUserStore(), gotrust.NewMemorySessionStore())
+	handlers := gotrust.NewGenericAuthHandlers(authService, config)
+	user := &gotrust.User{ID: "user-1", Email: "jane@example.com", Roles: []string{"admin", "editor"}}
+
+	tests := []struct {
+		name   string
+		handle func(record func(*http.Request)) http.Handler
+	}{
+		{
+			name: "AuthMiddleware",
+			handle: func(record func(*http.Request)) http.Handler {
+				return AuthMiddleware(handlers)(func(w http.ResponseWriter, r *http.Request) { record(r) })
+			},
+		},
+		{
+			name: "router middleware",
+			handle: func(record func(*http.Request)) http.Handler {
+				mux := http.NewServeMux()
+				NewRouter(mux).GET("/me", func(ctx gotrust.HTTPContext) error {
+					record(ctx.Request())
+					return nil
+				}, handlers.AuthMiddleware())
+				return mux
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var roles []string
+			handler := tt.handle(func(r *http.Request) { roles = GetRolesFromContext(r) })
+
+			req := testutil.NewAuthenticatedRequest(t, authService, user, http.MethodGet, "/me", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if strings.Join(roles, ",") != "admin,editor" {
+				t.Errorf("GetRolesFromContext() = %v, want [admin editor]", roles)
+			}
+		})
+	}
+}
+
+func TestAuthenticatedRequestHelpers(t *testing.T) {
+	config := gotrust.NewConfig()
+	config.JWTSecret = "test-secret-that-is-long-enough-for-hs256"
+	authService := gotrust.NewAuthService(config, gotrust.NewMemoryUserStore(), gotrust.NewMemorySessionStore())
+	handlers := gotrust.NewGenericAuthHandlers(authService, config)
+	user := &gotrust.User{ID: "user-1", Email: "jane@example.com"}
+
+	protected := AuthMiddleware(handlers)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name       string
+		request    *http.Request
+		wantStatus int
+	}{
+		{name: "authenticated request", request: testutil.NewAuthenticatedRequest(t, authService, user, http.MethodGet, "/protected", nil), wantStatus: http.StatusNoContent},
+		{name: "expired token request", request: testutil.NewExpiredTokenRequest(t, authService, user, http.MethodGet, "/protected", nil), wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			protected.ServeHTTP(rec, tt.request)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSignInFormAndJSON(t *testing.T) {
+	config := gotrust.NewConfig()
+	config.JWTSecret = "test-secret-that-is-long-enough-for-hs256"
+	authService := gotrust.NewAuthService(config, gotrust.NewMemoryUserStore(), gotrust.NewMemorySessionStore())
+	handlers := gotrust.NewGenericAuthHandlers(authService, config)
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, "/auth", handlers)
+
+	form := url.Values{"email": {"jane@example.com"}, "password": {"password123"}}
+	signup := httptest.NewRequest(http.MethodPost, "/auth/signup", strings.NewReader(form.Encode()))
+	signup.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, signup)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("form sign-up status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{name: "JSON", contentType: "application/json", body: `{"email": "jane@example.com", "password": "password123"}`},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: form.Encode()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/auth/signin", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "access_token") {
+				t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestNormalizePaths(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalize  bool
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{name: "exact path", method: http.MethodPost, target: "/auth/signin", wantStatus: http.StatusBadRequest},
+		{name: "trailing slash, strict", method: http.MethodPost, target: "/auth/signin/", wantStatus: http.StatusNotFound},
+		{name: "mixed case, strict", method: http.MethodPost, target: "/auth/SignIn", wantStatus: http.StatusNotFound},
+		{name: "exact path, normalized", normalize: true, method: http.MethodPost, target: "/auth/signin", wantStatus: http.StatusBadRequest},
+		{name: "trailing slash", normalize: true, method: http.MethodPost, target: "/auth/signin/", wantStatus: http.StatusBadRequest},
+		{name: "mixed case", normalize: true, method: http.MethodPost, target: "/auth/SignIn", wantStatus: http.StatusBadRequest},
+		{name: "mixed case and trailing slash", normalize: true, method: http.MethodGet, target: "/auth/ME/", wantStatus: http.StatusUnauthorized},
+		{name: "unknown path", normalize: true, method: http.MethodPost, target: "/auth/signinx", wantStatus: http.StatusNotFound},
+		{name: "wrong method", normalize: true, method: http.MethodGet, target: "/auth/SignIn", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := gotrust.NewConfig()
+			config.JWTSecret = "test-secret-that-is-long-enough-for-hs256"
+			authService := gotrust.NewAuthService(config, gotrust.NewMemoryUserStore(), gotrust.NewMemorySessionStore())
+			handlers := gotrust.NewGenericAuthHandlers(authService, config)
+			mux := http.NewServeMux()
+			RegisterRoutes(mux, "/auth", handlers, gotrust.RouteOptions{NormalizePaths: tt.normalize})
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader("{}")))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.target, rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -4,4 +4,13 @@ go 1.21
 
 require github.com/mayurrawte/gotrust v1.0.0
 
-replace github.com/mayurrawte/gotrust => ../..
\ No newline at end of file
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.0 // indirect
+	github.com/redis/go-redis/v9 v9.4.0 // indirect
+	golang.org/x/crypto v0.18.0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
+)
+
+replace github.com/mayurrawte/gotrust => ../..
@@ -0,0 +1,233 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AuditEventType identifies the kind of auth event recorded
+type AuditEventType string
+
+const (
+	AuditSignUp              AuditEventType = "sign_up"
+	AuditSignIn              AuditEventType = "sign_in"
+	AuditOAuthSignIn         AuditEventType = "oauth_sign_in"
+	AuditRefresh             AuditEventType = "refresh"
+	AuditLogout              AuditEventType = "logout"
+	AuditLogoutAll           AuditEventType = "logout_all"
+	AuditPasswordChange      AuditEventType = "password_change"
+	AuditCredentialsRevoked  AuditEventType = "credentials_revoked"
+	AuditProfileUpdate       AuditEventType = "profile_update"
+	AuditEmailChange         AuditEventType = "email_change"
+	AuditEmailAdded          AuditEventType = "email_added"
+	AuditEmailRemoved        AuditEventType = "email_removed"
+	AuditRefreshTokenRevoked AuditEventType = "refresh_token_revoked"
+	AuditClaimsRefreshed     AuditEventType = "claims_refreshed"
+)
+
+// Audit event results
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// AuditEvent is a single entry of the auth audit trail
+type AuditEvent struct {
+	ID        string         `json:"id"`
+	Type      AuditEventType `json:"type"`
+	UserID    string         `json:"user_id,omitempty"`
+	Email     string         `json:"email,omitempty"`
+	IP        string         `json:"ip,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+	Result    string         `json:"result"`
+	Reason    string         `json:"reason,omitempty"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// AuditFilter selects audit events. Zero-valued fields match everything.
+type AuditFilter struct {
+	UserID string
+	Type   AuditEventType
+	Result string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+// Matches reports whether the event satisfies the filter, ignoring pagination
+func (f *AuditFilter) Matches(event *AuditEvent) bool {
+	if f.UserID != "" && event.UserID != f.UserID {
+		return false
+	}
+	if f.Type != "" && event.Type != f.Type {
+		return false
+	}
+	if f.Result != "" && event.Result != f.Result {
+		return false
+	}
+	if !f.Since.IsZero() && event.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && event.Timestamp.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// AuditStore persists an append-only trail of auth events
+type AuditStore interface {
+	Record(ctx context.Context, event AuditEvent) error
+	// Query returns matching events, newest first
+	Query(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
+}
+
+// MemoryAuditStore is an in-memory AuditStore, for development and testing
+type MemoryAuditStore struct {
+	mu     sync.RWMutex
+	events []AuditEvent
+}
+
+func NewMemoryAuditStore() *MemoryAuditStore {
+	return &MemoryAuditStore{}
+}
+
+func (m *MemoryAuditStore) Record(ctx context.Context, event AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *MemoryAuditStore) Query(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matched []AuditEvent
+	for i := len(m.events) - 1; i >= 0; i-- {
+		if filter.Matches(&m.events[i]) {
+			matched = append(matched, m.events[i])
+		}
+	}
+
+	// Events may be recorded with explicit, out-of-order timestamps
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Timestamp.After(matched[j].Timestamp)
+	})
+
+	return paginate(matched, filter.Offset, filter.Limit), nil
+}
+
+// paginate applies offset and limit to a slice of events
+func paginate(events []AuditEvent, offset, limit int) []AuditEvent {
+	if offset >= len(events) {
+		return []AuditEvent{}
+	}
+	if offset > 0 {
+		events = events[offset:]
+	}
+	if limit > 0 && limit < len(events) {
+		events = events[:limit]
+	}
+	return events
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns a copy of ctx carrying the client IP
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the client IP carried by ctx, if any
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+type userAgentKey struct{}
+
+// WithUserAgent returns a copy of ctx carrying the client's User-Agent
+func WithUserAgent(ctx context.Context, userAgent string) context.Context {
+	return context.WithValue(ctx, userAgentKey{}, userAgent)
+}
+
+// UserAgentFromContext returns the User-Agent carried by ctx, if any
+func UserAgentFromContext(ctx context.Context) string {
+	userAgent, _ := ctx.Value(userAgentKey{}).(string)
+	return userAgent
+}
+
+// remoteIP returns the host part of the request's remote address
+func remoteIP(ctx HTTPContext) string {
+	if ctx.Request() == nil {
+		return ""
+	}
+	addr := ctx.Request().RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// RecordAuditEvent records an event in the configured AuditStore, filling in
+// the ID, timestamp, IP and request ID. Applications can use it for events
+// handled outside GoTrust, such as password changes. It is a no-op when no
+// AuditStore is configured.
+func (a *AuthService) RecordAuditEvent(ctx context.Context, event AuditEvent) {
+	store := a.config.AuditStore
+	if store == nil {
+		return
+	}
+
+	if event.ID == "" {
+		event.ID = generateRandomString(16)
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.IP == "" {
+		event.IP = ClientIPFromContext(ctx)
+	}
+	if event.RequestID == "" {
+		event.RequestID = RequestIDFromContext(ctx)
+	}
+	if event.Result == "" {
+		event.Result = AuditResultSuccess
+	}
+	if a.config.RedactAuditEmails {
+		event.Email = MaskEmail(event.Email, a.config.redactionLevel())
+	}
+
+	// Auditing never fails the operation being audited
+	if err := store.Record(ctx, event); err != nil {
+		logf(ctx, "Failed to record audit event %s: %v", event.Type, err)
+	}
+}
+
+// audit records the outcome of an auth operation
+func (a *AuthService) audit(ctx context.Context, eventType AuditEventType, userID, email string, err error) {
+	event := AuditEvent{
+		Type:   eventType,
+		UserID: userID,
+		Email:  email,
+	}
+	if err != nil {
+		event.Result = AuditResultFailure
+		event.Reason = err.Error()
+	}
+	a.RecordAuditEvent(ctx, event)
+}
+
+// QueryAuditLog returns audit events matching the filter
+func (a *AuthService) QueryAuditLog(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	if a.config.AuditStore == nil {
+		return nil, fmt.Errorf("audit log is not enabled")
+	}
+	return a.config.AuditStore.Query(ctx, filter)
+}
@@ -0,0 +1,184 @@
+package gotrust
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAuditTrail(t *testing.T) {
+	audit := NewMemoryAuditStore()
+	a, _, _ := newTestService(t, func(c *Config) { c.AuditStore = audit })
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+
+	jane, err := a.SignUp(ctx, &SignUpRequest{Email: "jane@example.com", Password: testPassword, Name: "Jane"})
+	if err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+	john := signUp(t, a, "john@example.com")
+
+	if _, err := a.SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: "wrong-password"}); err == nil {
+		t.Fatalf("SignIn() accepted a wrong password")
+	}
+	if _, err := a.SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword}); err != nil {
+		t.Fatalf("SignIn() error = %v", err)
+	}
+	if _, err := a.RefreshToken(ctx, jane.RefreshToken); err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	a.RecordAuditEvent(ctx, AuditEvent{Type: AuditPasswordChange, UserID: jane.User.ID})
+	if _, err := a.LogoutAllSessions(ctx, jane.User.ID); err != nil {
+		t.Fatalf("LogoutAllSessions() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []AuditEventType
+	}{
+		{
+			name:   "by user",
+			filter: AuditFilter{UserID: jane.User.ID},
+			want:   []AuditEventType{AuditLogoutAll, AuditPasswordChange, AuditRefresh, AuditSignIn, AuditSignIn, AuditSignUp},
+		},
+		{
+			name:   "by other user",
+			filter: AuditFilter{UserID: john.User.ID},
+			want:   []AuditEventType{AuditSignUp},
+		},
+		{
+			name:   "by type",
+			filter: AuditFilter{Type: AuditSignUp},
+			want:   []AuditEventType{AuditSignUp, AuditSignUp},
+		},
+		{
+			name:   "by user and type",
+			filter: AuditFilter{UserID: jane.User.ID, Type: AuditSignIn},
+			want:   []AuditEventType{AuditSignIn, AuditSignIn},
+		},
+		{
+			name:   "failures",
+			filter: AuditFilter{Result: AuditResultFailure},
+			want:   []AuditEventType{AuditSignIn},
+		},
+		{
+			name:   "paginated",
+			filter: AuditFilter{UserID: jane.User.ID, Offset: 1, Limit: 2},
+			want:   []AuditEventType{AuditPasswordChange, AuditRefresh},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := a.QueryAuditLog(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("QueryAuditLog() error = %v", err)
+			}
+			if len(events) != len(tt.want) {
+				t.Fatalf("QueryAuditLog() returned %d events, want %d: %+v", len(events), len(tt.want), events)
+			}
+			for i, event := range events {
+				if event.Type != tt.want[i] {
+					t.Errorf("event %d type = %s, want %s", i, event.Type, tt.want[i])
+				}
+				if event.ID == "" || event.Timestamp.IsZero() {
+					t.Errorf("event %d = %+v, want an ID and timestamp", i, event)
+				}
+			}
+		})
+	}
+
+	failures, _ := a.QueryAuditLog(context.Background(), AuditFilter{Result: AuditResultFailure})
+	if failure := failures[0]; failure.IP != "203.0.113.7" || failure.Reason == "" || failure.UserID != jane.User.ID {
+		t.Errorf("failed sign-in event = %+v", failure)
+	}
+}
+
+func TestMemoryAuditStoreTimeRange(t *testing.T) {
+	store := NewMemoryAuditStore()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Recorded out of order; queries return newest first
+	for _, hours := range []int{2, 0, 3, 1} {
+		event := AuditEvent{ID: strconv.Itoa(hours), Type: AuditSignIn, Timestamp: base.Add(time.Duration(hours) * time.Hour)}
+		if err := store.Record(context.Background(), event); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []string
+	}{
+		{name: "all", want: []string{"3", "2", "1", "0"}},
+		{name: "since", filter: AuditFilter{Since: base.Add(2 * time.Hour)}, want: []string{"3", "2"}},
+		{name: "until", filter: AuditFilter{Until: base.Add(time.Hour)}, want: []string{"1", "0"}},
+		{name: "offset past the end", filter: AuditFilter{Offset: 10}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := store.Query(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(events) != len(tt.want) {
+				t.Fatalf("Query() returned %d events, want %d", len(events), len(tt.want))
+			}
+			for i, event := range events {
+				if event.ID != tt.want[i] {
+					t.Errorf("event %d = %s, want %s", i, event.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAuditLogHandler(t *testing.T) {
+	h, a := newTestHandlers(t, func(c *Config) { c.AuditStore = NewMemoryAuditStore() })
+	signUp(t, a, "jane@example.com")
+	signUp(t, a, "john@example.com")
+
+	tokenWithRoles := func(roles ...string) string {
+		token, err := a.jwtManager.GenerateToken(TokenClaims{UserID: "user-1", Roles: roles})
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		query      string
+		wantStatus int
+		wantEvents int
+	}{
+		{name: "admin", token: tokenWithRoles("admin"), wantStatus: http.StatusOK, wantEvents: 2},
+		{name: "admin with filter", token: tokenWithRoles("admin"), query: "?type=sign_up&limit=1", wantStatus: http.StatusOK, wantEvents: 1},
+		{name: "admin with no matches", token: tokenWithRoles("admin"), query: "?type=logout", wantStatus: http.StatusOK},
+		{name: "invalid limit", token: tokenWithRoles("admin"), query: "?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "invalid since", token: tokenWithRoles("admin"), query: "?since=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "not an admin", token: tokenWithRoles("viewer"), wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodGet, "/auth/audit"+tt.query, "").withBearer(tt.token)
+			serve(t, ctx, h.AuditLogHandler, h.AuthMiddleware(), h.RequireAuditAccess())
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			events, _ := ctx.body(t)["events"].([]interface{})
+			if len(events) != tt.wantEvents {
+				t.Errorf("%d events, want %d", len(events), tt.wantEvents)
+			}
+		})
+	}
+}
@@ -2,13 +2,17 @@ package gotrust
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
-// UserStore interface for user persistence
+// UserStore interface for user persistence. GetUserByEmail and UserExists
+// must match a user's SecondaryEmails as well as Email, and stores should
+// enforce uniqueness across all of them. Lookups of missing users should
+// return an error wrapping ErrUserNotFound, so they can be told apart from
+// store failures.
 type UserStore interface {
 	CreateUser(ctx context.Context, user *User, hashedPassword string) error
 	GetUserByEmail(ctx context.Context, email string) (*User, string, error) // returns user and hashed password
@@ -17,30 +21,121 @@ type UserStore interface {
 	UserExists(ctx context.Context, email string) (bool, error)
 }
 
+// UserDeleter is implemented by user stores that can delete users
+type UserDeleter interface {
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+// ClaimsProvider supplies custom claims kept outside the User, such as org
+// memberships or feature flags. It is called each time tokens are issued,
+// at sign-in and on refresh. User stores may implement it, or it can be set
+// as Config.ClaimsProvider.
+type ClaimsProvider interface {
+	Claims(ctx context.Context, userID string) (map[string]interface{}, error)
+}
+
+// userStoreWrapper is implemented by user stores wrapping another, such as
+// CachedUserStore. Their optional methods pass through to the wrapped store,
+// so they are only usable when it implements them too.
+type userStoreWrapper interface {
+	wrappedUserStore() UserStore
+}
+
+// userStoreAs returns store as the optional interface T, if store and every
+// store it wraps implement T
+func userStoreAs[T any](store UserStore) (T, bool) {
+	var zero T
+	optional, ok := store.(T)
+	if !ok {
+		return zero, false
+	}
+	for {
+		wrapper, ok := store.(userStoreWrapper)
+		if !ok {
+			return optional, true
+		}
+		store = wrapper.wrappedUserStore()
+		if _, ok := store.(T); !ok {
+			return zero, false
+		}
+	}
+}
+
 // AuthService handles authentication operations
 type AuthService struct {
-	config         *Config
-	userStore      UserStore
-	sessionManager *SessionManager
-	jwtManager     *JWTManager
-	oauthManager   *OAuthManager
+	config          *Config
+	userStore       UserStore
+	sessionStore    SessionStore
+	sessionManager  *SessionManager
+	refreshTokens   *RefreshTokenManager
+	jwtManager      *JWTManager
+	oauthManager    *OAuthManager
+	hasher          PasswordHasher
+	validationCache *validationCache // nil unless Config.ValidationCacheTTL is set
+	revokedBefore   issuedBeforeCache
+	now             func() time.Time // the clock of session lifetime checks
 }
 
 // NewAuthService creates a new authentication service
 func NewAuthService(config *Config, userStore UserStore, sessionStore SessionStore) *AuthService {
-	return &AuthService{
+	jwtManager := NewJWTManager(config.JWTSecret, config.JWTIssuer, config.JWTExpiration)
+	jwtManager.SetTokenTypes(config.JWTAccessTokenType, config.JWTRefreshTokenType)
+	jwtManager.SetCompactClaims(config.JWTCompactClaims)
+	jwtManager.SetLeeway(config.TokenLeeway)
+	jwtManager.SetAudience(config.JWTAudience)
+	jwtManager.SetKeyDerivation(config.DeriveKeys)
+	jwtManager.SetEncryptionKey(config.TokenEncryptionKey)
+	if err := jwtManager.SetSigningKeys(config.JWTSigningKeys, config.JWTActiveKeyID); err != nil {
+		logf(context.Background(), "Ignoring JWT signing keys: %v", err)
+	}
+	if config.JWKSURL != "" {
+		jwtManager.SetKeySet(NewRemoteKeySet(config.JWKSURL, config.JWKSRefreshInterval))
+	}
+	
+	service := &AuthService{
 		config:         config,
 		userStore:      userStore,
+		sessionStore:   sessionStore,
 		sessionManager: NewSessionManager(sessionStore, "session"),
-		jwtManager:     NewJWTManager(config.JWTSecret, config.JWTIssuer, config.JWTExpiration),
+		refreshTokens:  NewRefreshTokenManager(sessionStore, "refresh"),
+		jwtManager:     jwtManager,
 		oauthManager:   NewOAuthManager(config, sessionStore),
+		hasher:         config.passwordHasher(),
+		now:            time.Now,
 	}
+	if err := service.sessionManager.SetIDFormat(config.SessionIDFormat); err != nil {
+		logf(context.Background(), "Ignoring session ID format: %v", err)
+	}
+	if config.ValidationCacheTTL > 0 {
+		service.validationCache = newValidationCache(config.ValidationCacheTTL)
+	}
+	return service
+}
+
+// checkPasswordConfirmation enforces Config.RequirePasswordConfirmation
+func (a *AuthService) checkPasswordConfirmation(req *SignUpRequest) error {
+	if a.config.RequirePasswordConfirmation && req.PasswordConfirmation != req.Password {
+		return ErrPasswordMismatch
+	}
+	return nil
 }
 
 // SignUp registers a new user with email and password
 func (a *AuthService) SignUp(ctx context.Context, req *SignUpRequest) (*AuthResponse, error) {
 	if !a.config.AllowSignup {
-		return nil, fmt.Errorf("signup is disabled")
+		return nil, ErrSignupDisabled
+	}
+	
+	if err := a.verifyCaptcha(ctx, req.CaptchaToken); err != nil {
+		return nil, err
+	}
+	
+	if err := a.checkPasswordConfirmation(req); err != nil {
+		return nil, err
+	}
+	
+	if err := a.CheckPassword(ctx, req.Password); err != nil {
+		return nil, err
 	}
 	
 	// Check if user already exists
@@ -50,11 +145,11 @@ func (a *AuthService) SignUp(ctx context.Context, req *SignUpRequest) (*AuthResp
 	}
 	
 	if exists {
-		return nil, fmt.Errorf("user already exists")
+		return nil, ErrUserExists
 	}
 	
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), a.config.BCryptCost)
+	hashedPassword, err := a.hasher.Hash(req.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -69,35 +164,151 @@ func (a *AuthService) SignUp(ctx context.Context, req *SignUpRequest) (*AuthResp
 		UpdatedAt: time.Now(),
 	}
 	
-	if err := a.userStore.CreateUser(ctx, user, string(hashedPassword)); err != nil {
+	if err := a.userStore.CreateUser(ctx, user, hashedPassword); err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 	
+	a.audit(ctx, AuditSignUp, user.ID, user.Email, nil)
+	
+	if a.config.VerificationSender != nil {
+		if err := a.SendVerification(ctx, user); err != nil {
+			// The user can request another email later
+			logf(ctx, "Failed to send verification email: %v", err)
+		}
+	}
+	
 	// Generate tokens
-	return a.generateAuthResponse(ctx, user)
+	return a.newUserResponse(ctx, user)
+}
+
+// newUserResponse generates the auth response of a user created by the
+// request, marked with IsNewUser
+func (a *AuthService) newUserResponse(ctx context.Context, user *User) (*AuthResponse, error) {
+	response, err := a.generateAuthResponse(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	response.IsNewUser = true
+	return response, nil
 }
 
 // SignIn authenticates a user with email and password
 func (a *AuthService) SignIn(ctx context.Context, req *SignInRequest) (*AuthResponse, error) {
+	if err := a.verifyCaptcha(ctx, req.CaptchaToken); err != nil {
+		a.audit(ctx, AuditSignIn, "", req.Email, err)
+		return nil, err
+	}
+	
 	// Get user and password hash
 	user, hashedPassword, err := a.userStore.GetUserByEmail(ctx, req.Email)
 	if err != nil {
+		a.audit(ctx, AuditSignIn, "", req.Email, fmt.Errorf("unknown user"))
 		return nil, fmt.Errorf("invalid credentials")
 	}
 	
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
+	if err := a.verifyPassword(ctx, user, hashedPassword, req.Password); err != nil {
+		if errors.Is(err, ErrHashingBusy) {
+			return nil, err
+		}
+		a.audit(ctx, AuditSignIn, user.ID, req.Email, fmt.Errorf("invalid password"))
 		return nil, fmt.Errorf("invalid credentials")
 	}
 	
+	a.audit(ctx, AuditSignIn, user.ID, user.Email, nil)
+	
 	// Generate tokens
 	return a.generateAuthResponse(ctx, user)
 }
 
+// VerifyPassword checks a user's password without signing them in, e.g. to
+// confirm a sensitive action. It creates no session or tokens. Users without
+// a password, such as OAuth-only accounts, get an error saying so.
+func (a *AuthService) VerifyPassword(ctx context.Context, userID, password string) error {
+	user, err := a.userStore.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+	
+	// The store only returns password hashes by email
+	stored, hashedPassword, err := a.userStore.GetUserByEmail(ctx, user.Email)
+	if err != nil || stored.ID != user.ID {
+		return fmt.Errorf("user not found")
+	}
+	
+	if hashedPassword == "" {
+		return fmt.Errorf("account has no password; it signs in with %s", user.Provider)
+	}
+	
+	if err := a.verifyPassword(ctx, user, hashedPassword, password); err != nil {
+		if errors.Is(err, ErrHashingBusy) {
+			return err
+		}
+		return fmt.Errorf("invalid password")
+	}
+	return nil
+}
+
+// verifyPassword checks a password against the stored hash, replacing the
+// hash when the hasher reports it as outdated and the store supports it
+func (a *AuthService) verifyPassword(ctx context.Context, user *User, hashedPassword, password string) error {
+	if hashedPassword == "" {
+		return fmt.Errorf("no password set")
+	}
+	
+	verifier, ok := a.hasher.(PasswordVerifier)
+	if !ok {
+		return a.hasher.Compare(hashedPassword, password)
+	}
+	
+	needsRehash, err := verifier.Verify(hashedPassword, password)
+	if err != nil {
+		return err
+	}
+	
+	if updater, ok := userStoreAs[PasswordUpdater](a.userStore); ok && needsRehash {
+		if newHash, err := a.hasher.Hash(password); err != nil {
+			logf(ctx, "Failed to rehash password: %v", err)
+		} else if err := updater.UpdatePassword(ctx, user.ID, newHash); err != nil {
+			logf(ctx, "Failed to store rehashed password: %v", err)
+		}
+	}
+	
+	return nil
+}
+
 // OAuthSignIn handles OAuth authentication
 func (a *AuthService) OAuthSignIn(ctx context.Context, provider OAuthProvider, state, code string) (*AuthResponse, error) {
+	response, _, err := a.OAuthSignInWithRedirect(ctx, provider, state, code)
+	return response, err
+}
+
+// OAuthSignInWithRedirect handles OAuth authentication and also returns the
+// redirect URI stored in the OAuth state
+func (a *AuthService) OAuthSignInWithRedirect(ctx context.Context, provider OAuthProvider, state, code string) (*AuthResponse, string, error) {
 	// Validate OAuth callback
-	oauthUser, _, err := a.oauthManager.ValidateCallback(provider, state, code)
+	oauthUser, redirectURI, err := a.oauthManager.ValidateCallback(provider, state, code)
+	if err != nil {
+		return nil, "", fmt.Errorf("oauth validation failed: %w", err)
+	}
+	
+	if oauthUser.Email == "" {
+		return nil, "", fmt.Errorf("email is required from OAuth provider")
+	}
+	
+	response, err := a.signInOAuthUser(ctx, provider, oauthUser)
+	if err != nil {
+		return nil, "", err
+	}
+	
+	return response, redirectURI, nil
+}
+
+// OAuthSignInWithToken signs in with a token a native app obtained from the
+// provider's SDK (see OAuthManager.UserInfoFromToken), creating or updating
+// the user like the redirect flow
+func (a *AuthService) OAuthSignInWithToken(ctx context.Context, provider OAuthProvider, accessToken, idToken string) (*AuthResponse, error) {
+	oauthUser, err := a.oauthManager.UserInfoFromToken(ctx, provider, accessToken, idToken)
 	if err != nil {
 		return nil, fmt.Errorf("oauth validation failed: %w", err)
 	}
@@ -106,13 +317,26 @@ func (a *AuthService) OAuthSignIn(ctx context.Context, provider OAuthProvider, s
 		return nil, fmt.Errorf("email is required from OAuth provider")
 	}
 	
+	return a.signInOAuthUser(ctx, provider, oauthUser)
+}
+
+// signInOAuthUser creates or updates the user for a verified OAuth identity
+// and issues tokens
+func (a *AuthService) signInOAuthUser(ctx context.Context, provider OAuthProvider, oauthUser *OAuthUserInfo) (*AuthResponse, error) {
 	// Check if user exists
 	user, _, err := a.userStore.GetUserByEmail(ctx, oauthUser.Email)
-	if err != nil {
+	created := err != nil
+	if created {
+		if !a.config.oauthSignupAllowed() {
+			a.audit(ctx, AuditOAuthSignIn, "", oauthUser.Email, fmt.Errorf("signup disabled"))
+			return nil, fmt.Errorf("account does not exist")
+		}
+		
 		// Create new user from OAuth
 		user = &User{
 			ID:        fmt.Sprintf("%s_%s", provider, oauthUser.ID),
 			Email:     oauthUser.Email,
+			EmailVerified: oauthUser.EmailVerified,
 			Name:      oauthUser.Name,
 			AvatarURL: oauthUser.AvatarURL,
 			Provider:  oauthUser.Provider,
@@ -124,6 +348,14 @@ func (a *AuthService) OAuthSignIn(ctx context.Context, provider OAuthProvider, s
 			return nil, fmt.Errorf("failed to create OAuth user: %w", err)
 		}
 	} else {
+		// Attaching a new provider to an existing account depends on the linking mode
+		if !user.HasProvider(oauthUser.Provider) {
+			if err := a.checkAccountLink(ctx, user, oauthUser); err != nil {
+				return nil, err
+			}
+			user.LinkedProviders = append(user.LinkedProviders, oauthUser.Provider)
+		}
+		
 		// Update existing user
 		user.Name = oauthUser.Name
 		user.AvatarURL = oauthUser.AvatarURL
@@ -131,56 +363,324 @@ func (a *AuthService) OAuthSignIn(ctx context.Context, provider OAuthProvider, s
 		
 		if err := a.userStore.UpdateUser(ctx, user); err != nil {
 			// Log error but continue
-			fmt.Printf("Failed to update user: %v\n", err)
+			logf(ctx, "Failed to update user: %v", err)
 		}
 	}
 	
+	a.audit(ctx, AuditOAuthSignIn, user.ID, user.Email, nil)
+	
 	// Generate tokens
+	if created {
+		return a.newUserResponse(ctx, user)
+	}
 	return a.generateAuthResponse(ctx, user)
 }
 
 // RefreshToken generates new access token from refresh token
 func (a *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*AuthResponse, error) {
+	response, userID, err := a.refreshToken(ctx, refreshToken)
+	a.audit(ctx, AuditRefresh, userID, "", err)
+	return response, err
+}
+
+// refreshToken performs the refresh, also returning the token's user ID for auditing
+func (a *AuthService) refreshToken(ctx context.Context, refreshToken string) (*AuthResponse, string, error) {
 	// Validate refresh token
-	userID, err := a.jwtManager.ValidateRefreshToken(refreshToken)
+	refreshClaims, err := a.jwtManager.ParseRefreshToken(refreshToken)
 	if err != nil {
-		return nil, fmt.Errorf("invalid refresh token: %w", err)
+		return nil, "", fmt.Errorf("invalid refresh token: %w", err)
+	}
+	userID := refreshClaims.UserID
+	
+	if err := a.checkIssuedAt(ctx, refreshClaims.IssuedAt); err != nil {
+		return nil, userID, fmt.Errorf("invalid refresh token: %w", err)
+	}
+	
+	// Absolute session timeout, counted from the original login
+	if max := a.config.MaxSessionLifetime; max > 0 && a.now().Sub(refreshClaims.AuthTime) > max {
+		if err := a.refreshTokens.Revoke(ctx, userID, refreshClaims.TokenID); err != nil {
+			logf(ctx, "Failed to revoke expired refresh token: %v", err)
+		}
+		return nil, userID, fmt.Errorf("invalid refresh token: session lifetime exceeded, please sign in again")
+	}
+	
+	// Tokens issued before refresh tokens were tracked carry no ID, so they
+	// cannot be looked up, rotated or revoked individually
+	legacy := refreshClaims.TokenID == ""
+	if legacy && !a.config.AcceptLegacyRefreshTokens {
+		return nil, userID, fmt.Errorf("invalid refresh token: token has been revoked")
+	}
+	
+	if a.config.RotateRefreshTokens && !legacy {
+		// Serialize concurrent refreshes of the same token
+		unlock, err := a.refreshTokens.lock(ctx, refreshClaims.TokenID)
+		if err != nil {
+			return nil, userID, err
+		}
+		defer unlock()
+		
+		// A concurrent request already rotated this token
+		if response, ok := a.refreshTokens.GraceResponse(ctx, refreshClaims.TokenID); ok {
+			return response, userID, nil
+		}
+	}
+	
+	// Check the token has not been revoked
+	active, err := a.refreshTokens.IsActive(ctx, refreshClaims.TokenID)
+	if err != nil {
+		return nil, userID, fmt.Errorf("failed to check refresh token: %w", err)
+	}
+	if !active && !legacy {
+		if a.config.RotateRefreshTokens {
+			if rotated, _ := a.refreshTokens.WasRotated(ctx, refreshClaims.TokenID); rotated {
+				// A rotated token was replayed: revoke the whole family
+				if _, err := a.refreshTokens.RevokeUserTokens(ctx, refreshClaims.UserID); err != nil {
+					logf(ctx, "Failed to revoke refresh tokens after reuse: %v", err)
+				}
+				return nil, userID, fmt.Errorf("invalid refresh token: token reuse detected")
+			}
+		}
+		return nil, userID, fmt.Errorf("invalid refresh token: token has been revoked")
+	}
+	
+	// Custom claims granted at sign-in carry over to the new tokens
+	var extra map[string]interface{}
+	if record, err := a.refreshTokens.Get(ctx, refreshClaims.TokenID); err == nil {
+		extra = record.Claims
+		
+		// Rotated tokens are replaced below; others stay in use
+		if !a.config.RotateRefreshTokens {
+			if err := a.refreshTokens.Touch(ctx, record); err != nil {
+				logf(ctx, "Failed to record refresh token use: %v", err)
+			}
+		}
 	}
 	
 	// Get user
-	user, err := a.userStore.GetUserByID(ctx, userID)
+	user, err := a.userStore.GetUserByID(ctx, refreshClaims.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		// Retrying cannot succeed; stop honoring the token
+		if err := a.refreshTokens.Revoke(ctx, userID, refreshClaims.TokenID); err != nil {
+			logf(ctx, "Failed to revoke refresh token of deleted user: %v", err)
+		}
+		return nil, userID, ErrUserDeleted
+	}
 	if err != nil {
-		return nil, fmt.Errorf("user not found: %w", err)
+		return nil, userID, fmt.Errorf("%w: %v", ErrUserStoreUnavailable, err)
 	}
 	
-	// Generate new tokens
-	return a.generateAuthResponse(ctx, user)
+	// Generate new tokens, keeping the original login time
+	response, err := a.generateAuthResponseAt(ctx, user, refreshClaims.AuthTime, extra)
+	if err != nil {
+		return nil, userID, err
+	}
+	
+	if a.config.RotateRefreshTokens && !legacy {
+		if err := a.refreshTokens.Rotate(ctx, refreshClaims, response, a.config.RefreshTokenGracePeriod); err != nil {
+			return nil, userID, err
+		}
+	}
+	
+	return response, userID, nil
 }
 
 // ValidateToken validates an access token and returns claims
 func (a *AuthService) ValidateToken(token string) (*TokenClaims, error) {
-	return a.jwtManager.ValidateToken(token)
+	return a.ValidateTokenContext(context.Background(), token)
+}
+
+// ValidateTokenContext validates an access token and, when tokens are bound
+// to sessions, checks that its session still exists
+func (a *AuthService) ValidateTokenContext(ctx context.Context, token string) (*TokenClaims, error) {
+	claims, err := a.jwtManager.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	
+	if err := a.checkTokenClaims(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkTokenClaims checks a validated access token's session and token
+// version, when enabled
+func (a *AuthService) checkTokenClaims(ctx context.Context, claims *TokenClaims) error {
+	if err := a.checkIssuedAt(ctx, claims.IssuedAt); err != nil {
+		return err
+	}
+	
+	if a.config.BindTokenToSession {
+		if claims.SessionID == "" {
+			return fmt.Errorf("token is not bound to a session")
+		}
+		if !a.sessionActive(ctx, claims) {
+			return fmt.Errorf("session has ended")
+		}
+	}
+	
+	if a.config.EnableTokenVersioning {
+		return a.checkTokenVersion(ctx, claims)
+	}
+	return nil
+}
+
+// GetUser retrieves a user by ID
+func (a *AuthService) GetUser(ctx context.Context, userID string) (*User, error) {
+	user, err := a.userStore.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	return user, nil
+}
+
+// GetUserInfo returns the OpenID Connect userinfo claims for a user
+func (a *AuthService) GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
+	user, err := a.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	
+	info := &UserInfo{
+		Subject:       a.config.subject(user),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Name:          user.Name,
+		Picture:       user.AvatarURL,
+	}
+	if !user.UpdatedAt.IsZero() {
+		info.UpdatedAt = user.UpdatedAt.Unix()
+	}
+	
+	return info, nil
 }
 
 // GetOAuthURL generates OAuth authorization URL
 func (a *AuthService) GetOAuthURL(provider OAuthProvider, redirectURI string) (string, error) {
+	return a.GetOAuthURLWithParams(provider, redirectURI, nil)
+}
+
+// GetOAuthURLWithParams generates the OAuth authorization URL with optional
+// provider params such as login_hint and prompt; see OAuthAuthParams
+func (a *AuthService) GetOAuthURLWithParams(provider OAuthProvider, redirectURI string, params url.Values) (string, error) {
 	if redirectURI == "" {
 		redirectURI = a.config.FrontendSuccessURL
 	}
-	return a.oauthManager.GetAuthURL(provider, redirectURI)
+	return a.oauthManager.GetAuthURLWithParams(provider, redirectURI, params)
+}
+
+// CleanupOAuthStates deletes expired OAuth states from the session store
+// and returns how many were removed; see OAuthManager.CleanupStates
+func (a *AuthService) CleanupOAuthStates(ctx context.Context) int {
+	return a.oauthManager.CleanupStates(ctx)
 }
 
 // Logout invalidates a session
 func (a *AuthService) Logout(ctx context.Context, sessionID string) error {
-	if sessionID != "" {
-		return a.sessionManager.InvalidateSession(ctx, sessionID)
+	if sessionID == "" {
+		return nil
+	}
+	
+	var userID, email string
+	if a.config.AuditStore != nil {
+		if session, err := a.sessionManager.GetSession(ctx, sessionID); err == nil {
+			userID, email = session.UserID, session.Email
+		}
+	}
+	
+	err := a.sessionManager.InvalidateSession(ctx, sessionID)
+	a.forgetSession(sessionID)
+	a.audit(ctx, AuditLogout, userID, email, err)
+	return err
+}
+
+// LogoutAllSessions invalidates all sessions and refresh tokens for a user
+// and returns the number of sessions invalidated
+func (a *AuthService) LogoutAllSessions(ctx context.Context, userID string) (int, error) {
+	count, err := a.sessionManager.InvalidateUserSessions(ctx, userID)
+	a.forgetUser(userID)
+	if err != nil {
+		err = fmt.Errorf("failed to invalidate sessions: %w", err)
+		a.audit(ctx, AuditLogoutAll, userID, "", err)
+		return 0, err
+	}
+	
+	if _, err := a.refreshTokens.RevokeUserTokens(ctx, userID); err != nil {
+		err = fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		a.audit(ctx, AuditLogoutAll, userID, "", err)
+		return count, err
 	}
+	
+	a.audit(ctx, AuditLogoutAll, userID, "", nil)
+	return count, nil
+}
+
+// ListRefreshTokens returns the active refresh tokens of a user, newest
+// first, e.g. to show signed-in devices. Custom claims are omitted.
+func (a *AuthService) ListRefreshTokens(ctx context.Context, userID string) ([]*RefreshTokenRecord, error) {
+	records, err := a.refreshTokens.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		record.Claims = nil
+	}
+	return records, nil
+}
+
+// RevokeRefreshToken revokes one of a user's refresh tokens. Tokens of other
+// users are reported as not found.
+func (a *AuthService) RevokeRefreshToken(ctx context.Context, userID, tokenID string) error {
+	record, err := a.refreshTokens.Get(ctx, tokenID)
+	if err != nil || record.UserID != userID {
+		return fmt.Errorf("refresh token not found")
+	}
+	
+	err = a.refreshTokens.Revoke(ctx, userID, tokenID)
+	a.audit(ctx, AuditRefreshTokenRevoked, userID, "", err)
+	return err
+}
+
+// RevokeAllUserCredentials forces a user to re-authenticate everywhere after a
+// security event such as a password compromise: all sessions are invalidated
+// and all refresh tokens revoked. Outstanding access tokens stop working
+// immediately when BindTokenToSession or EnableTokenVersioning is enabled;
+// otherwise they remain valid until they expire.
+func (a *AuthService) RevokeAllUserCredentials(ctx context.Context, userID string) error {
+	if a.config.EnableTokenVersioning {
+		if _, err := a.IncrementTokenVersion(ctx, userID); err != nil {
+			a.audit(ctx, AuditCredentialsRevoked, userID, "", err)
+			return err
+		}
+	}
+	
+	_, err := a.sessionManager.InvalidateUserSessions(ctx, userID)
+	a.forgetUser(userID)
+	if err != nil {
+		err = fmt.Errorf("failed to invalidate sessions: %w", err)
+		a.audit(ctx, AuditCredentialsRevoked, userID, "", err)
+		return err
+	}
+	
+	if _, err := a.refreshTokens.RevokeUserTokens(ctx, userID); err != nil {
+		err = fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		a.audit(ctx, AuditCredentialsRevoked, userID, "", err)
+		return err
+	}
+	
+	a.audit(ctx, AuditCredentialsRevoked, userID, "", nil)
 	return nil
 }
 
-// LogoutAllSessions invalidates all sessions for a user
-func (a *AuthService) LogoutAllSessions(ctx context.Context, userID string) error {
-	return a.sessionManager.InvalidateUserSessions(ctx, userID)
+// InvalidateAllSessions deletes the sessions of every user, for maintenance
+// such as deploying an incompatible session change. It returns the number of
+// keys deleted, including session indexes.
+func (a *AuthService) InvalidateAllSessions(ctx context.Context) (int, error) {
+	count, err := a.sessionManager.InvalidateAllSessions(ctx)
+	if err != nil {
+		return count, fmt.Errorf("failed to invalidate sessions: %w", err)
+	}
+	return count, nil
 }
 
 // GetSession retrieves session data
@@ -188,14 +688,135 @@ func (a *AuthService) GetSession(ctx context.Context, sessionID string) (*Sessio
 	return a.sessionManager.GetSession(ctx, sessionID)
 }
 
+// SessionToken issues an access token for the user of an existing session,
+// bound to that session, so pages authenticated by the session cookie can
+// call APIs with a bearer token. A refresh token is included when
+// Config.SessionTokenRefresh is set.
+func (a *AuthService) SessionToken(ctx context.Context, sessionID string) (*AuthResponse, error) {
+	session, err := a.sessionManager.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found or expired")
+	}
+	
+	user, err := a.GetUser(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	
+	var extra map[string]interface{}
+	if a.config.ClaimsEnricher != nil {
+		if extra, err = a.config.ClaimsEnricher(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to enrich claims: %w", err)
+		}
+	}
+	
+	return a.issueTokens(ctx, user, session.CreatedAt, extra, sessionID, a.config.SessionTokenRefresh)
+}
+
 // Helper method to generate auth response with tokens
 func (a *AuthService) generateAuthResponse(ctx context.Context, user *User) (*AuthResponse, error) {
+	var extra map[string]interface{}
+	if a.config.ClaimsEnricher != nil {
+		var err error
+		if extra, err = a.config.ClaimsEnricher(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to enrich claims: %w", err)
+		}
+	}
+	return a.generateAuthResponseAt(ctx, user, time.Now(), extra)
+}
+
+// generateAuthResponseAt generates an auth response for a user who
+// authenticated interactively at authTime, with custom claims granted then
+func (a *AuthService) generateAuthResponseAt(ctx context.Context, user *User, authTime time.Time, extra map[string]interface{}) (*AuthResponse, error) {
+	if _, _, err := a.checkEmailVerification(user); err != nil {
+		return nil, err
+	}
+	
+	// Create session
+	sessionID, err := a.sessionManager.CreateSession(ctx, user.ID, user.Email, a.config.JWTExpiration)
+	if err != nil {
+		// A bound token would be unusable without its session
+		if a.config.BindTokenToSession || a.config.SessionCreationRequired {
+			logf(ctx, "Failed to create session, failing sign-in for user %s: %v", user.ID, err)
+			return nil, fmt.Errorf("%w: %v", ErrSessionUnavailable, err)
+		}
+		// Log error but don't fail authentication
+		logf(ctx, "Failed to create session, continuing without one for user %s: %v", user.ID, err)
+	}
+	
+	return a.issueTokens(ctx, user, authTime, extra, sessionID, true)
+}
+
+// claimsProvider returns Config.ClaimsProvider, or the user store if it
+// implements ClaimsProvider
+func (a *AuthService) claimsProvider() ClaimsProvider {
+	if a.config.ClaimsProvider != nil {
+		return a.config.ClaimsProvider
+	}
+	provider, _ := userStoreAs[ClaimsProvider](a.userStore)
+	return provider
+}
+
+// mergeClaims returns the custom claims with the provided ones added,
+// replacing claims of the same name. Reserved claims are dropped when the
+// token is generated.
+func mergeClaims(custom, provided map[string]interface{}) map[string]interface{} {
+	if len(provided) == 0 {
+		return custom
+	}
+	merged := make(map[string]interface{}, len(custom)+len(provided))
+	for key, value := range custom {
+		merged[key] = value
+	}
+	for key, value := range provided {
+		merged[key] = value
+	}
+	return merged
+}
+
+// issueTokens generates the access token, and the refresh token if
+// withRefresh is set, of a user signed in to sessionID
+func (a *AuthService) issueTokens(ctx context.Context, user *User, authTime time.Time, extra map[string]interface{}, sessionID string, withRefresh bool) (*AuthResponse, error) {
+	emailVerified, verifyBy, err := a.checkEmailVerification(user)
+	if err != nil {
+		return nil, err
+	}
+	
 	// Generate access token
 	claims := TokenClaims{
 		UserID:   user.ID,
 		Email:    user.Email,
 		Name:     user.Name,
 		Provider: user.Provider,
+		Subject:  a.config.subject(user),
+		AuthTime: authTime,
+		Roles:    user.Roles,
+		TenantID: user.TenantID,
+		EmailVerified: emailVerified,
+		VerifyBy: verifyBy,
+		Extra:    extra,
+	}
+	if a.config.BindTokenToSession {
+		claims.SessionID = sessionID
+	}
+	if a.config.EnableTokenVersioning {
+		if claims.TokenVersion, err = a.TokenVersion(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	
+	if provider := a.claimsProvider(); provider != nil {
+		provided, err := provider.Claims(ctx, user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load claims: %w", err)
+		}
+		claims.Extra = mergeClaims(extra, provided)
+	}
+	
+	// Keep PII out of the token in minimal mode
+	if a.config.MinimalAuthResponse {
+		claims.Email = ""
+		claims.Name = ""
 	}
 	
 	accessToken, err := a.jwtManager.GenerateToken(claims)
@@ -204,22 +825,34 @@ func (a *AuthService) generateAuthResponse(ctx context.Context, user *User) (*Au
 	}
 	
 	// Generate refresh token
-	refreshToken, err := a.jwtManager.GenerateRefreshToken(user.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	var refreshToken string
+	if withRefresh {
+		var refreshClaims *RefreshTokenClaims
+		refreshToken, refreshClaims, err = a.jwtManager.IssueRefreshToken(user.ID, authTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		}
+		
+		if err := a.refreshTokens.Track(ctx, refreshClaims, extra); err != nil {
+			return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		}
 	}
 	
-	// Create session
-	_, err = a.sessionManager.CreateSession(ctx, user.ID, user.Email, a.config.JWTExpiration)
-	if err != nil {
-		// Log error but don't fail authentication
-		fmt.Printf("Failed to create session: %v\n", err)
+	responseUser := user
+	if a.config.MinimalAuthResponse {
+		responseUser = &User{ID: user.ID}
 	}
 	
-	return &AuthResponse{
-		User:         user,
+	response := &AuthResponse{
+		User:         responseUser,
 		AccessToken:  accessToken,
+		TokenType:    a.config.authScheme(),
 		RefreshToken: refreshToken,
 		ExpiresIn:    int64(a.config.JWTExpiration.Seconds()),
-	}, nil
+		SessionID:    sessionID,
+	}
+	if a.config.ExposeTokenMetadata {
+		response.Algorithm, response.KeyID = a.jwtManager.signingHeader()
+	}
+	return response, nil
 }
\ No newline at end of file
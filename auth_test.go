@@ -0,0 +1,355 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMinimalAuthResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		minimal bool
+	}{
+		{name: "full response"},
+		{name: "minimal response", minimal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, func(c *Config) { c.MinimalAuthResponse = tt.minimal })
+			signUp(t, a, "jane@example.com")
+
+			response, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword})
+			if err != nil {
+				t.Fatalf("SignIn() error = %v", err)
+			}
+
+			wantPII := !tt.minimal
+			if got := response.User.Email != "" || response.User.Name != ""; got != wantPII {
+				t.Errorf("response user = %+v, want PII %v", response.User, wantPII)
+			}
+			if response.User.ID == "" {
+				t.Errorf("response user has no ID")
+			}
+			payload := tokenPayload(t, response.AccessToken)
+			_, hasEmail := payload["email"]
+			_, hasName := payload["name"]
+			if hasEmail != wantPII || hasName != wantPII {
+				t.Errorf("token claims = %v, want PII %v", payload, wantPII)
+			}
+
+			// The user endpoint falls back to the store
+			ctx := newTestContext(http.MethodGet, "/auth/user", "").withBearer(response.AccessToken)
+			serve(t, ctx, h.GetUserHandler, h.AuthMiddleware())
+			if body := ctx.body(t); body["email"] != "jane@example.com" || body["name"] != "Test User" {
+				t.Errorf("GetUserHandler() = %v", body)
+			}
+		})
+	}
+}
+
+func TestRevokeAllUserCredentials(t *testing.T) {
+	tests := []struct {
+		name              string
+		configure         func(*Config)
+		wantAccessRevoked bool
+	}{
+		{name: "stateless access tokens", configure: func(c *Config) {}},
+		{name: "session-bound access tokens", configure: func(c *Config) { c.BindTokenToSession = true }, wantAccessRevoked: true},
+		{name: "versioned access tokens", configure: func(c *Config) { c.EnableTokenVersioning = true }, wantAccessRevoked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, tt.configure)
+			ctx := context.Background()
+			first := signUp(t, a, "jane@example.com")
+			second, err := a.SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword})
+			if err != nil {
+				t.Fatalf("SignIn() error = %v", err)
+			}
+			other := signUp(t, a, "john@example.com")
+			issued := []*AuthResponse{first, second}
+
+			if err := a.RevokeAllUserCredentials(ctx, first.User.ID); err != nil {
+				t.Fatalf("RevokeAllUserCredentials() error = %v", err)
+			}
+
+			for i, response := range issued {
+				if _, err := a.RefreshToken(ctx, response.RefreshToken); err == nil {
+					t.Errorf("refresh token %d still accepted", i)
+				}
+				if response.SessionID != "" {
+					if _, err := a.sessionManager.GetSession(ctx, response.SessionID); err == nil {
+						t.Errorf("session %d still exists", i)
+					}
+				}
+				_, err := a.ValidateTokenContext(ctx, response.AccessToken)
+				if revoked := err != nil; revoked != tt.wantAccessRevoked {
+					t.Errorf("access token %d revoked = %v, want %v", i, revoked, tt.wantAccessRevoked)
+				}
+			}
+			sessions, err := a.sessionManager.ListUserSessions(ctx, first.User.ID)
+			if err != nil || len(sessions) != 0 {
+				t.Errorf("ListUserSessions() = %d sessions, %v", len(sessions), err)
+			}
+
+			// Other users are unaffected
+			if _, err := a.ValidateTokenContext(ctx, other.AccessToken); err != nil {
+				t.Errorf("another user's access token rejected: %v", err)
+			}
+			if _, err := a.RefreshToken(ctx, other.RefreshToken); err != nil {
+				t.Errorf("another user's refresh token rejected: %v", err)
+			}
+
+			// Signing in again issues working credentials
+			again, err := a.SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword})
+			if err != nil {
+				t.Fatalf("SignIn() after revocation error = %v", err)
+			}
+			if _, err := a.ValidateTokenContext(ctx, again.AccessToken); err != nil {
+				t.Errorf("new access token rejected: %v", err)
+			}
+		})
+	}
+}
+
+func TestOAuthSignupAllowed(t *testing.T) {
+	enabled, disabled := true, false
+
+	tests := []struct {
+		name        string
+		allowSignup bool
+		allowOAuth  *bool
+		existing    bool
+		wantCreated bool
+		wantErr     bool
+	}{
+		{name: "signup allowed", allowSignup: true, wantCreated: true},
+		{name: "signup disabled", wantErr: true},
+		{name: "signup disabled for an existing user", existing: true},
+		{name: "signup disabled but OAuth signup enabled", allowOAuth: &enabled, wantCreated: true},
+		{name: "signup allowed but OAuth signup disabled", allowSignup: true, allowOAuth: &disabled, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, users, _ := newTestService(t, func(c *Config) {
+				c.OAuthAccountLinkingMode = AccountLinkingAuto
+				c.AllowOAuthSignup = tt.allowOAuth
+			})
+			if tt.existing {
+				signUp(t, a, "jane@example.com")
+			}
+			a.config.AllowSignup = tt.allowSignup
+
+			oauthUser := &OAuthUserInfo{ID: "7", Email: "jane@example.com", EmailVerified: true, Provider: string(ProviderGitHub)}
+			response, err := a.signInOAuthUser(context.Background(), ProviderGitHub, oauthUser)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("signInOAuthUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			exists, _ := users.UserExists(context.Background(), "jane@example.com")
+			if exists != (tt.existing || tt.wantCreated) {
+				t.Errorf("user exists = %v", exists)
+			}
+			if tt.wantCreated && response.User.ID != "github_7" {
+				t.Errorf("created user ID = %q, want github_7", response.User.ID)
+			}
+		})
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   string
+		password string
+		wantErr  string
+	}{
+		{name: "correct password", userID: "local", password: testPassword},
+		{name: "incorrect password", userID: "local", password: "wrong-password", wantErr: "invalid password"},
+		{name: "OAuth-only user", userID: "github_7", password: testPassword, wantErr: "signs in with github"},
+		{name: "unknown user", userID: "missing", password: testPassword, wantErr: "user not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a, users, sessions := newTestService(t, nil)
+			local := signUp(t, a, "jane@example.com").User
+			if err := users.CreateUser(ctx, &User{ID: "github_7", Email: "john@example.com", Provider: string(ProviderGitHub)}, ""); err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+			userID := tt.userID
+			if userID == "local" {
+				userID = local.ID
+			}
+			sessionCount := sessions.Len()
+
+			err := a.VerifyPassword(ctx, userID, tt.password)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("VerifyPassword() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("VerifyPassword() error = %v, want %q", err, tt.wantErr)
+			}
+			if sessions.Len() != sessionCount {
+				t.Errorf("VerifyPassword() changed the session count from %d to %d", sessionCount, sessions.Len())
+			}
+		})
+	}
+}
+
+func TestPasswordConfirmation(t *testing.T) {
+	tests := []struct {
+		name         string
+		required     bool
+		confirmation string
+		wantErr      error
+	}{
+		{name: "matching", required: true, confirmation: testPassword},
+		{name: "mismatched", required: true, confirmation: testPassword + "x", wantErr: ErrPasswordMismatch},
+		{name: "missing", required: true, wantErr: ErrPasswordMismatch},
+		{name: "not required", confirmation: "anything"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, func(c *Config) {
+				c.RequirePasswordConfirmation = tt.required
+				c.AllowGuestSessions = true
+			})
+			users := a.userStore.(*MemoryUserStore)
+
+			req := &SignUpRequest{Email: "jane@example.com", Password: testPassword, PasswordConfirmation: tt.confirmation}
+			if _, err := a.SignUp(context.Background(), req); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SignUp() error = %v, want %v", err, tt.wantErr)
+			}
+			if created := users.Len() == 1; created != (tt.wantErr == nil) {
+				t.Errorf("user created = %v, want %v", created, tt.wantErr == nil)
+			}
+
+			// Upgrading a guest applies the same check
+			guest, err := a.CreateGuest(context.Background())
+			if err != nil {
+				t.Fatalf("CreateGuest() error = %v", err)
+			}
+			upgrade := &SignUpRequest{Email: "john@example.com", Password: testPassword, PasswordConfirmation: tt.confirmation}
+			if _, err := a.UpgradeGuest(context.Background(), guest.User.ID, upgrade); !errors.Is(err, tt.wantErr) {
+				t.Errorf("UpgradeGuest() error = %v, want %v", err, tt.wantErr)
+			}
+
+			body := fmt.Sprintf(`{"email": "joan@example.com", "password": %q, "password_confirmation": %q}`, testPassword, tt.confirmation)
+			ctx := newTestContext(http.MethodPost, "/auth/signup", body)
+			serve(t, ctx, h.SignUpHandler)
+			if tt.wantErr == nil {
+				if ctx.status() != http.StatusCreated {
+					t.Errorf("SignUpHandler() status = %d, want %d", ctx.status(), http.StatusCreated)
+				}
+				return
+			}
+			if ctx.status() != http.StatusBadRequest || ctx.body(t)["code"] != "password_mismatch" {
+				t.Errorf("SignUpHandler() status = %d, body = %v, want 400 password_mismatch", ctx.status(), ctx.body(t))
+			}
+		})
+	}
+}
+
+// oauthState starts an OAuth sign-in and returns its state parameter
+func oauthState(t *testing.T, a *AuthService, provider OAuthProvider) string {
+	t.Helper()
+
+	authURL, err := a.GetOAuthURL(provider, "")
+	if err != nil {
+		t.Fatalf("GetOAuthURL() error = %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("GetOAuthURL() = %q: %v", authURL, err)
+	}
+	return u.Query().Get("state")
+}
+
+func TestIsNewUser(t *testing.T) {
+	server := newGitLabServer(t, `{"application": {"uid": "client-1"}}`)
+	h, a := newTestHandlers(t, func(c *Config) {
+		c.GitLabBaseURL = server.URL + "/"
+		c.GitLabClientID = "client-1"
+		c.GitLabClientSecret = "secret-1"
+		c.FrontendSuccessURL = "https://app.example.com/welcome"
+	})
+
+	// callback completes an OAuth sign-in and returns the redirect's query
+	callback := func() url.Values {
+		t.Helper()
+
+		target := "/auth/gitlab/callback?code=good-code&state=" + url.QueryEscape(oauthState(t, a, ProviderGitLab))
+		ctx := newTestContext(http.MethodGet, target, "")
+		serve(t, ctx, h.OAuthCallbackHandler(string(ProviderGitLab)))
+		location, err := url.Parse(ctx.recorder.Header().Get("Location"))
+		if err != nil || location.Query().Get("token") == "" {
+			t.Fatalf("redirect = %q, want a signed-in redirect", ctx.recorder.Header().Get("Location"))
+		}
+		return location.Query()
+	}
+
+	tests := []struct {
+		name string
+		// signIn signs in and returns whether a new user was reported
+		signIn      func(t *testing.T) bool
+		wantNewUser bool
+	}{
+		{
+			name:        "first OAuth sign-in",
+			signIn:      func(t *testing.T) bool { return callback().Get("new_user") == "true" },
+			wantNewUser: true,
+		},
+		{
+			name: "later OAuth sign-in",
+			signIn: func(t *testing.T) bool {
+				_, reported := callback()["new_user"]
+				return reported
+			},
+		},
+		{
+			name: "OAuth sign-in through the service",
+			signIn: func(t *testing.T) bool {
+				response, err := a.OAuthSignIn(context.Background(), ProviderGitLab, oauthState(t, a, ProviderGitLab), "good-code")
+				if err != nil {
+					t.Fatalf("OAuthSignIn() error = %v", err)
+				}
+				return response.IsNewUser
+			},
+		},
+		{
+			name:        "sign-up",
+			signIn:      func(t *testing.T) bool { return signUp(t, a, "john@example.com").IsNewUser },
+			wantNewUser: true,
+		},
+		{
+			name: "password sign-in",
+			signIn: func(t *testing.T) bool {
+				response, err := a.SignIn(context.Background(), &SignInRequest{Email: "john@example.com", Password: testPassword})
+				if err != nil {
+					t.Fatalf("SignIn() error = %v", err)
+				}
+				return response.IsNewUser
+			},
+		},
+	}
+
+	// The cases run in order against the same service
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.signIn(t); got != tt.wantNewUser {
+				t.Errorf("new user reported = %v, want %v", got, tt.wantNewUser)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubCaptcha accepts only the token "valid"
+type stubCaptcha struct {
+	calls int
+}
+
+func (s *stubCaptcha) Verify(ctx context.Context, token, remoteIP string) error {
+	s.calls++
+	if token != "valid" {
+		return fmt.Errorf("invalid token %q", token)
+	}
+	return nil
+}
+
+func TestCaptchaVerification(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "valid token", token: "valid", wantCalls: 1},
+		{name: "rejected token", token: "bogus", wantErr: ErrCaptchaFailed, wantCalls: 1},
+		{name: "missing token", wantErr: ErrCaptchaRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			verifier := &stubCaptcha{}
+			a, users, _ := newTestService(t, func(c *Config) { c.CaptchaVerifier = verifier })
+
+			_, err := a.SignUp(ctx, &SignUpRequest{Email: "user@example.com", Password: testPassword, CaptchaToken: tt.token})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SignUp() error = %v, want %v", err, tt.wantErr)
+			}
+			if _, _, lookupErr := users.GetUserByEmail(ctx, "user@example.com"); (lookupErr == nil) != (tt.wantErr == nil) {
+				t.Errorf("user created = %v, want %v", lookupErr == nil, tt.wantErr == nil)
+			}
+			if verifier.calls != tt.wantCalls {
+				t.Errorf("SignUp() verifier calls = %d, want %d", verifier.calls, tt.wantCalls)
+			}
+
+			// Sign in checks the token even for unknown users
+			verifier.calls = 0
+			_, err = a.SignIn(ctx, &SignInRequest{Email: "user@example.com", Password: testPassword, CaptchaToken: tt.token})
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("SignIn() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("SignIn() error = %v", err)
+			}
+			if verifier.calls != tt.wantCalls {
+				t.Errorf("SignIn() verifier calls = %d, want %d", verifier.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCaptchaErrorCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		wantCode string
+	}{
+		{name: "rejected token", token: "bogus", wantCode: "captcha_failed"},
+		{name: "missing token", wantCode: "captcha_required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, func(c *Config) { c.CaptchaVerifier = &stubCaptcha{} })
+
+			for _, endpoint := range []struct {
+				target  string
+				handler HTTPHandler
+			}{
+				{"/signup", h.SignUpHandler},
+				{"/signin", h.SignInHandler},
+			} {
+				body := fmt.Sprintf(`{"email": "user@example.com", "password": %q, "captcha_token": %q}`, testPassword, tt.token)
+				ctx := newTestContext(http.MethodPost, endpoint.target, body)
+				serve(t, ctx, endpoint.handler)
+
+				if ctx.status() != http.StatusBadRequest {
+					t.Errorf("%s status = %d, want %d", endpoint.target, ctx.status(), http.StatusBadRequest)
+				}
+				if code := ctx.body(t)["code"]; code != tt.wantCode {
+					t.Errorf("%s code = %v, want %s", endpoint.target, code, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestSiteVerifyCaptcha(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		minScore float64
+		wantErr  bool
+	}{
+		{name: "success", status: http.StatusOK, response: `{"success": true}`},
+		{name: "rejected", status: http.StatusOK, response: `{"success": false, "error-codes": ["invalid-input-response"]}`, wantErr: true},
+		{name: "score above minimum", status: http.StatusOK, response: `{"success": true, "score": 0.9}`, minScore: 0.5},
+		{name: "score below minimum", status: http.StatusOK, response: `{"success": true, "score": 0.1}`, minScore: 0.5, wantErr: true},
+		{name: "server error", status: http.StatusInternalServerError, response: `{}`, wantErr: true},
+		{name: "malformed response", status: http.StatusOK, response: `not json`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var form map[string]string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				form = map[string]string{
+					"secret":   r.PostForm.Get("secret"),
+					"response": r.PostForm.Get("response"),
+					"remoteip": r.PostForm.Get("remoteip"),
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			verifier := &SiteVerifyCaptcha{URL: server.URL, Secret: "shh", MinScore: tt.minScore}
+			err := verifier.Verify(context.Background(), "token", "203.0.113.7")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := map[string]string{"secret": "shh", "response": "token", "remoteip": "203.0.113.7"}
+			if fmt.Sprint(form) != fmt.Sprint(want) {
+				t.Errorf("siteverify form = %v, want %v", form, want)
+			}
+		})
+	}
+}
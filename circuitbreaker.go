@@ -0,0 +1,116 @@
+package gotrust
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default OAuth circuit breaker settings
+const (
+	DefaultOAuthBreakerThreshold = 5
+	DefaultOAuthBreakerCooldown  = 30 * time.Second
+)
+
+// circuitBreaker fast-fails calls to a dependency after threshold consecutive
+// failures. Once the cooldown has passed a single trial call is let through;
+// its success closes the breaker and its failure reopens it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a call may be made
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	now := b.now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	// Half-open: let this call through and hold the others back until it
+	// reports its result
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// providerBreaker returns the circuit breaker of an OAuth provider
+func (o *OAuthManager) providerBreaker(provider OAuthProvider) *circuitBreaker {
+	o.breakersMu.Lock()
+	defer o.breakersMu.Unlock()
+
+	if o.breakers == nil {
+		o.breakers = make(map[OAuthProvider]*circuitBreaker)
+	}
+	breaker, ok := o.breakers[provider]
+	if !ok {
+		cooldown := o.config.OAuthBreakerCooldown
+		if cooldown <= 0 {
+			cooldown = DefaultOAuthBreakerCooldown
+		}
+		breaker = newCircuitBreaker(o.config.OAuthBreakerThreshold, cooldown)
+		o.breakers[provider] = breaker
+	}
+	return breaker
+}
+
+// providerRequestTimeout bounds each request to an OAuth provider, so a
+// stalled provider cannot hang the handler
+const providerRequestTimeout = 10 * time.Second
+
+var providerClient = &http.Client{Timeout: providerRequestTimeout}
+
+// doProviderRequest sends a request to an OAuth provider through its circuit
+// breaker. Transport errors and 5xx responses count as failures; while the
+// breaker is open the request is not sent and ErrProviderUnavailable is
+// returned.
+func (o *OAuthManager) doProviderRequest(provider OAuthProvider, req *http.Request) (*http.Response, error) {
+	breaker := o.providerBreaker(provider)
+	if !breaker.allow() {
+		return nil, fmt.Errorf("%w: %s", ErrProviderUnavailable, provider)
+	}
+
+	resp, err := providerClient.Do(req)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		breaker.failure()
+	} else {
+		breaker.success()
+	}
+	return resp, err
+}
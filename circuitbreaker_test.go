@@ -0,0 +1,201 @@
+package gotrust
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 30 * time.Second
+
+	// Each step records a call's result or advances the clock, then checks
+	// whether the next call is allowed
+	type step struct {
+		fail      bool
+		succeed   bool
+		advance   time.Duration
+		wantAllow bool
+	}
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []step
+	}{
+		{
+			name:      "opens after the threshold",
+			threshold: 3,
+			steps: []step{
+				{fail: true, wantAllow: true},
+				{fail: true, wantAllow: true},
+				{fail: true, wantAllow: false},
+				{advance: cooldown / 2, wantAllow: false},
+			},
+		},
+		{
+			name:      "success resets the count",
+			threshold: 2,
+			steps: []step{
+				{fail: true, wantAllow: true},
+				{succeed: true, wantAllow: true},
+				{fail: true, wantAllow: true},
+			},
+		},
+		{
+			name:      "recovers after the cooldown",
+			threshold: 2,
+			steps: []step{
+				{fail: true, wantAllow: true},
+				{fail: true, wantAllow: false},
+				{advance: cooldown + time.Second, wantAllow: true},
+				{succeed: true, wantAllow: true},
+				{wantAllow: true},
+			},
+		},
+		{
+			name:      "failed trial call reopens",
+			threshold: 2,
+			steps: []step{
+				{fail: true, wantAllow: true},
+				{fail: true, wantAllow: false},
+				{advance: cooldown + time.Second, wantAllow: true},
+				{fail: true, wantAllow: false},
+				{advance: cooldown / 2, wantAllow: false},
+			},
+		},
+		{
+			name:      "disabled",
+			threshold: 0,
+			steps: []step{
+				{fail: true, wantAllow: true},
+				{fail: true, wantAllow: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			breaker := newCircuitBreaker(tt.threshold, cooldown)
+			breaker.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				switch {
+				case s.fail:
+					breaker.failure()
+				case s.succeed:
+					breaker.success()
+				}
+				now = now.Add(s.advance)
+				if got := breaker.allow(); got != s.wantAllow {
+					t.Fatalf("step %d: allow() = %v, want %v", i, got, s.wantAllow)
+				}
+			}
+		})
+	}
+}
+
+func TestOAuthProviderBreaker(t *testing.T) {
+	var hits, failing atomic.Int32
+	failing.Store(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if failing.Load() == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	config := newTestConfig()
+	config.OAuthBreakerThreshold = 2
+	config.OAuthBreakerCooldown = time.Minute
+	manager := NewOAuthManager(config, NewMemorySessionStore())
+	now := time.Now()
+	manager.providerBreaker(ProviderGitLab).now = func() time.Time { return now }
+
+	call := func(provider OAuthProvider) error {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := manager.doProviderRequest(provider, req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// Two 5xx responses open the breaker; later calls fail fast
+	for i := 0; i < 2; i++ {
+		if err := call(ProviderGitLab); err != nil {
+			t.Fatalf("call %d error = %v", i, err)
+		}
+	}
+	if err := call(ProviderGitLab); !errors.Is(err, ErrProviderUnavailable) {
+		t.Fatalf("call with the breaker open error = %v, want ErrProviderUnavailable", err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("provider received %d requests, want 2", hits.Load())
+	}
+
+	// Other providers have their own breaker
+	if err := call(ProviderGitHub); err != nil {
+		t.Errorf("call to another provider error = %v", err)
+	}
+
+	// After the cooldown a trial call goes through and closes the breaker
+	failing.Store(0)
+	now = now.Add(time.Minute + time.Second)
+	for i := 0; i < 3; i++ {
+		if err := call(ProviderGitLab); err != nil {
+			t.Fatalf("call %d after recovery error = %v", i, err)
+		}
+	}
+}
+
+func TestOAuthCallbackProviderUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	h, a := newTestHandlers(t, func(c *Config) {
+		c.GitLabBaseURL = server.URL + "/"
+		c.GitLabClientID = "client-1"
+		c.GitLabClientSecret = "secret-1"
+		c.OAuthBreakerThreshold = 1
+		c.FrontendErrorURL = "https://app.example.com/login"
+	})
+
+	// callback completes a sign-in started with a fresh state
+	callback := func() url.Values {
+		authURL, err := a.GetOAuthURL(ProviderGitLab, "")
+		if err != nil {
+			t.Fatalf("GetOAuthURL() error = %v", err)
+		}
+		state := authURL[strings.Index(authURL, "state=")+len("state="):]
+		if i := strings.Index(state, "&"); i >= 0 {
+			state = state[:i]
+		}
+
+		ctx := newTestContext(http.MethodGet, "/auth/gitlab/callback?code=good-code&state="+state, "")
+		serve(t, ctx, h.OAuthCallbackHandler(string(ProviderGitLab)))
+		location, err := url.Parse(ctx.recorder.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("redirect = %q: %v", ctx.recorder.Header().Get("Location"), err)
+		}
+		return location.Query()
+	}
+
+	// The outage opens the breaker, after which callbacks fail fast
+	if got := callback().Get("error"); got == "" {
+		t.Fatalf("callback during an outage succeeded")
+	}
+	if got := callback().Get("error"); got != "provider_unavailable" {
+		t.Errorf("error = %q, want provider_unavailable", got)
+	}
+}
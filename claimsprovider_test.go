@@ -0,0 +1,127 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// orgClaims is a ClaimsProvider serving each user's current org
+type orgClaims struct {
+	orgs map[string]string
+	err  error
+}
+
+func (p *orgClaims) Claims(ctx context.Context, userID string) (map[string]interface{}, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return map[string]interface{}{"org": p.orgs[userID], "user_id": "someone-else", "sub": "someone-else"}, nil
+}
+
+// orgUserStore is a user store that provides claims itself
+type orgUserStore struct {
+	*MemoryUserStore
+	*orgClaims
+}
+
+func TestClaimsProvider(t *testing.T) {
+	tests := []struct {
+		name string
+		// wire sets the provider up on the config or the user store
+		wire func(c *Config, provider *orgClaims) UserStore
+	}{
+		{
+			name: "config provider",
+			wire: func(c *Config, provider *orgClaims) UserStore {
+				c.ClaimsProvider = provider
+				return NewMemoryUserStore()
+			},
+		},
+		{
+			name: "user store provider",
+			wire: func(c *Config, provider *orgClaims) UserStore {
+				return &orgUserStore{MemoryUserStore: NewMemoryUserStore(), orgClaims: provider}
+			},
+		},
+		{
+			name: "cached user store provider",
+			wire: func(c *Config, provider *orgClaims) UserStore {
+				return NewCachedUserStore(&orgUserStore{MemoryUserStore: NewMemoryUserStore(), orgClaims: provider}, 10, time.Minute)
+			},
+		},
+		{
+			name: "replicated user store provider",
+			wire: func(c *Config, provider *orgClaims) UserStore {
+				return NewReplicatedUserStore(&orgUserStore{MemoryUserStore: NewMemoryUserStore(), orgClaims: provider}, nil, 0)
+			},
+		},
+		{
+			name: "overrides enricher claims",
+			wire: func(c *Config, provider *orgClaims) UserStore {
+				c.ClaimsProvider = provider
+				c.ClaimsEnricher = func(ctx context.Context, user *User) (map[string]interface{}, error) {
+					return map[string]interface{}{"org": "stale", "plan": "pro"}, nil
+				}
+				return NewMemoryUserStore()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			provider := &orgClaims{orgs: make(map[string]string)}
+			config := newTestConfig()
+			config.RefreshTokenGracePeriod = 0
+			sessions := NewMemorySessionStore()
+			t.Cleanup(func() { sessions.Close() })
+			a := NewAuthService(config, tt.wire(config, provider), sessions)
+
+			userID := signUp(t, a, "jane@example.com").User.ID
+			provider.orgs[userID] = "acme"
+			response, err := a.SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword})
+			if err != nil {
+				t.Fatalf("SignIn() error = %v", err)
+			}
+			assertOrgClaim(t, a, "sign-in", response.AccessToken, userID, "acme")
+
+			// Refreshed tokens carry the provider's current claims
+			provider.orgs[userID] = "globex"
+			refreshed, err := a.RefreshToken(ctx, response.RefreshToken)
+			if err != nil {
+				t.Fatalf("RefreshToken() error = %v", err)
+			}
+			assertOrgClaim(t, a, "refresh", refreshed.AccessToken, userID, "globex")
+		})
+	}
+}
+
+// assertOrgClaim checks a token's org claim and that reserved claims were
+// not clobbered by the provider
+func assertOrgClaim(t *testing.T, a *AuthService, name, token, userID, wantOrg string) {
+	t.Helper()
+
+	claims, err := a.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("%s: ValidateToken() error = %v", name, err)
+	}
+	if claims.Extra["org"] != wantOrg {
+		t.Errorf("%s: org claim = %v, want %q", name, claims.Extra["org"], wantOrg)
+	}
+	if claims.UserID != userID || tokenPayload(t, token)["sub"] == "someone-else" {
+		t.Errorf("%s: provider overrode reserved claims: user_id = %q, sub = %v", name, claims.UserID, tokenPayload(t, token)["sub"])
+	}
+}
+
+func TestClaimsProviderError(t *testing.T) {
+	provider := &orgClaims{}
+	a, _, _ := newTestService(t, func(c *Config) { c.ClaimsProvider = provider })
+	signUp(t, a, "jane@example.com")
+
+	provider.err = fmt.Errorf("org service unavailable")
+	if _, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword}); err == nil {
+		t.Error("SignIn() issued tokens without the provider's claims")
+	}
+}
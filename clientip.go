@@ -0,0 +1,94 @@
+package gotrust
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// ClientIP returns the IP address of the client that sent the request. The
+// X-Forwarded-For and X-Real-IP headers are only honored when the immediate
+// peer is listed in Config.TrustedProxies, so clients cannot spoof their IP.
+func (h *GenericAuthHandlers) ClientIP(ctx HTTPContext) string {
+	peer := remoteIP(ctx)
+	if !h.fromTrustedProxy(ctx) {
+		return peer
+	}
+
+	// Walk X-Forwarded-For from the nearest hop, skipping trusted proxies;
+	// the first untrusted address is the client. Proxies may append their
+	// hop as another header line, so all lines are read. A malformed hop
+	// ends the walk, since nothing left of it can be attributed.
+	if forwarded := ctx.Request().Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			client = ip.String()
+			if !isTrustedProxy(h.trustedProxies, client) {
+				return client
+			}
+		}
+		return client
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(ctx.GetHeader("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+
+	return peer
+}
+
+// requestContext returns the request's context.Context with its request ID,
+// client IP and User-Agent attached
+func (h *GenericAuthHandlers) requestContext(ctx HTTPContext) context.Context {
+	reqCtx := WithClientIP(WithRequestID(ctx.Context(), GetRequestID(ctx)), h.ClientIP(ctx))
+	return WithUserAgent(reqCtx, ctx.GetHeader("User-Agent"))
+}
+
+// fromTrustedProxy reports whether the request's immediate peer is one of
+// the trusted proxies, whose forwarding headers can be believed
+func (h *GenericAuthHandlers) fromTrustedProxy(ctx HTTPContext) bool {
+	return isTrustedProxy(h.trustedProxies, remoteIP(ctx))
+}
+
+// parseTrustedProxies parses IP addresses and CIDR ranges, skipping invalid
+// entries
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+func isTrustedProxy(trusted []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
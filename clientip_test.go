@@ -0,0 +1,56 @@
+package gotrust
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "192.168.1.10", "fd00::/8"}
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   []string // header lines
+		realIP         string
+		want           string
+	}{
+		{name: "no proxies configured", remoteAddr: "203.0.113.7:4321", forwardedFor: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "spoofed header from an untrusted peer", trustedProxies: trusted, remoteAddr: "203.0.113.7:4321", forwardedFor: []string{"198.51.100.1"}, realIP: "198.51.100.2", want: "203.0.113.7"},
+		{name: "header from a trusted CIDR", trustedProxies: trusted, remoteAddr: "10.1.2.3:4321", forwardedFor: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "header from a trusted IP", trustedProxies: trusted, remoteAddr: "192.168.1.10:4321", forwardedFor: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "chain of trusted proxies", trustedProxies: trusted, remoteAddr: "10.1.2.3:4321", forwardedFor: []string{"198.51.100.1, 10.9.9.9, 10.8.8.8"}, want: "198.51.100.1"},
+		{name: "client-supplied hop is not trusted", trustedProxies: trusted, remoteAddr: "10.1.2.3:4321", forwardedFor: []string{"1.1.1.1, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "only trusted hops", trustedProxies: trusted, remoteAddr: "10.1.2.3:4321", forwardedFor: []string{"10.9.9.9"}, want: "10.9.9.9"},
+		{name: "X-Real-IP from a trusted peer", trustedProxies: trusted, remoteAddr: "10.1.2.3:4321", realIP: "198.51.100.2", want: "198.51.100.2"},
+		{name: "trusted peer without headers", trustedProxies: trusted, remoteAddr: "10.1.2.3:4321", want: "10.1.2.3"},
+		{name: "IPv6 trusted peer", trustedProxies: trusted, remoteAddr: "[fd00::1]:4321", forwardedFor: []string{"2001:db8::7"}, want: "2001:db8::7"},
+		{name: "hops on separate header lines", trustedProxies: trusted, remoteAddr: "10.1.2.3:4321", forwardedFor: []string{"1.1.1.1, 198.51.100.1", "10.9.9.9"}, want: "198.51.100.1"},
+		{name: "malformed nearest hop", trustedProxies: trusted, remoteAddr: "10.1.2.3:4321", forwardedFor: []string{"198.51.100.1, not-an-ip"}, realIP: "198.51.100.2", want: "10.1.2.3"},
+		{name: "malformed hop behind trusted proxies", trustedProxies: trusted, remoteAddr: "10.1.2.3:4321", forwardedFor: []string{"not-an-ip, 10.9.9.9"}, want: "10.9.9.9"},
+		{name: "invalid entries are skipped", trustedProxies: []string{"not-an-ip", "10.0.0.0/99"}, remoteAddr: "10.1.2.3:4321", forwardedFor: []string{"198.51.100.1"}, want: "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, func(c *Config) { c.TrustedProxies = tt.trustedProxies })
+
+			ctx := newTestContext(http.MethodGet, "/", "")
+			ctx.request.RemoteAddr = tt.remoteAddr
+			for _, forwarded := range tt.forwardedFor {
+				ctx.request.Header.Add("X-Forwarded-For", forwarded)
+			}
+			if tt.realIP != "" {
+				ctx.request.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := h.ClientIP(ctx); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+			if got := ClientIPFromContext(h.requestContext(ctx)); got != tt.want {
+				t.Errorf("ClientIPFromContext() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,12 @@
 package gotrust
 
 import (
+	"context"
+	"net/http"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -10,12 +15,93 @@ type Config struct {
 	JWTSecret        string
 	JWTExpiration    time.Duration
 	JWTIssuer        string
+	// JWTAudience, when set, is added to access tokens as the "aud" claim and
+	// required when validating them
+	JWTAudience      string
+	
+	// JWTSigningKeys maps key IDs to HMAC secrets for zero-downtime secret
+	// rotation. Tokens are signed with JWTActiveKeyID's secret and carry its
+	// ID in the "kid" header; tokens are accepted while their key is listed.
+	// Tokens without a kid are still validated with JWTSecret.
+	JWTSigningKeys  map[string]string
+	JWTActiveKeyID  string
+	
+	// DeriveKeys derives separate keys for refresh tokens and signed OAuth
+	// state from the JWT secret (or signing keys) with HKDF, so one secret
+	// feeds each subsystem without key reuse. Access tokens keep using the
+	// secret itself. Enabling it invalidates outstanding refresh tokens and
+	// signed OAuth states.
+	DeriveKeys bool
+	
+	// JWT "typ" header values distinguishing access and refresh tokens
+	JWTAccessTokenType  string
+	JWTRefreshTokenType string
+	
+	// JWTCompactClaims shortens access tokens for size-limited cookies and
+	// headers: short claim names and no name claim
+	JWTCompactClaims bool
+	
+	// TokenEncryptionKey, when set, encrypts access tokens (JWE with direct
+	// AES-256-GCM, keyed by the SHA-256 of this secret) so clients cannot
+	// read their claims. Plain signed tokens are still accepted.
+	TokenEncryptionKey string
+	
+	// TokenLeeway tolerates clock skew between the servers issuing and
+	// validating access and refresh tokens
+	TokenLeeway time.Duration
+	
+	// AccessTokenGracePeriod lets GraceAuthMiddleware accept an access token
+	// once after it expired, for this long, so offline clients can recover.
+	// The regular AuthMiddleware never applies it.
+	AccessTokenGracePeriod time.Duration
+	
+	// AuthRealm is the realm reported in WWW-Authenticate challenges (defaults to JWTIssuer)
+	AuthRealm string
+	
+	// JWKSURL makes access tokens signed with the asymmetric keys published
+	// at this URL valid, e.g. tokens from a central GoTrust or OIDC provider.
+	// JWTSecret may then be left empty.
+	JWKSURL             string
+	JWKSRefreshInterval time.Duration
+	
+	// AuthScheme is the Authorization header scheme carrying access tokens,
+	// matched case-insensitively (defaults to "Bearer")
+	AuthScheme string
+	
+	// JSONNamingStrategy sets the key style of handler responses:
+	// JSONNamingSnake (default, e.g. access_token) or JSONNamingCamel
+	// (accessToken). Keys of application data such as custom claims are
+	// kept as they are.
+	JSONNamingStrategy string
+	
+	// OnOptionalAuthError is called when OptionalAuthMiddleware ignores a
+	// malformed or invalid token, e.g. to log it or set a header prompting
+	// the client to refresh. The request still proceeds unauthenticated.
+	OnOptionalAuthError OptionalAuthErrorHandler
+	
+	// SubjectFunc computes the JWT "sub" claim for a user. Defaults to the
+	// user ID; the "user_id" claim (or "uid" with JWTCompactClaims) carries
+	// the user ID.
+	SubjectFunc func(user *User) string
+	
+	// ClaimsEnricher adds custom claims to access tokens at sign-in. The
+	// claims are stored with the refresh token and carried over on refresh;
+	// they cannot override the standard claims.
+	ClaimsEnricher func(ctx context.Context, user *User) (map[string]interface{}, error)
+	
+	// ClaimsProvider adds custom claims each time tokens are issued, including
+	// on refresh, overriding ClaimsEnricher's claims of the same name. When
+	// nil, a UserStore implementing ClaimsProvider is used.
+	ClaimsProvider ClaimsProvider
 	
 	// OAuth Google Configuration
 	GoogleClientID     string
 	GoogleClientSecret string
 	GoogleRedirectURI  string
 	GoogleScopes       []string
+	// GoogleTokenAudiences lists extra client IDs (e.g. the iOS and Android
+	// clients) whose tokens /oauth/google/token accepts besides GoogleClientID
+	GoogleTokenAudiences []string
 	
 	// OAuth GitHub Configuration
 	GitHubClientID     string
@@ -23,53 +109,547 @@ type Config struct {
 	GitHubRedirectURI  string
 	GitHubScopes       []string
 	
-	// General OAuth Configuration
-	OAuthStateExpiration time.Duration
+	// OAuth GitLab Configuration (GitLabBaseURL supports self-managed instances)
+	GitLabClientID     string
+	GitLabClientSecret string
+	GitLabRedirectURI  string
+	GitLabScopes       []string
+	GitLabBaseURL      string
+	
+	// OAuth Discord Configuration (the email scope is required for an email)
+	DiscordClientID     string
+	DiscordClientSecret string
+	DiscordRedirectURI  string
+	DiscordScopes       []string
+	
+	// General OAuth Configuration. OAuthStateExpiration is the maximum age of
+	// an OAuth state; in store mode at most OAuthMaxPendingStates states are
+	// kept outstanding per instance, the oldest being dropped first (0 means
+	// no bound).
+	OAuthStateExpiration  time.Duration
+	OAuthMaxPendingStates int
 	FrontendSuccessURL   string
 	FrontendErrorURL     string
 	
+	// OAuthStateMode is OAuthStateModeStore (default) or OAuthStateModeSigned
+	// for deployments without a shared SessionStore. Signed states use
+	// OAuthStateSecret, defaulting to JWTSecret (or the active signing key);
+	// without either, signed states are refused.
+	OAuthStateMode   string
+	OAuthStateSecret string
+	
+	// OAuthAccountLinkingMode controls what happens when an OAuth login's email
+	// matches an existing account from another provider: AccountLinkingAuto,
+	// AccountLinkingVerifiedOnly (default) or AccountLinkingManual.
+	OAuthAccountLinkingMode string
+	
+	// OAuth circuit breaker: after OAuthBreakerThreshold consecutive failed
+	// calls to a provider (network errors or 5xx), sign-ins through it fail
+	// fast with ErrProviderUnavailable for OAuthBreakerCooldown. A threshold
+	// of 0 disables the breaker.
+	OAuthBreakerThreshold int
+	OAuthBreakerCooldown  time.Duration
+	
+	// OAuthRedirectStatus is the status code of the redirects to the provider
+	// and back to the frontend: 301, 302, 303, 307 (default) or 308
+	OAuthRedirectStatus int
+	
+	// Dynamic redirects. FrontendSuccessURL and FrontendErrorURL may contain
+	// text/template placeholders (see RedirectData), or be replaced entirely
+	// by a resolver func. Resolved URLs are checked against AllowedRedirectHosts,
+	// which defaults to the hosts of FrontendSuccessURL and FrontendErrorURL.
+	FrontendSuccessURLFunc RedirectURLFunc
+	FrontendErrorURLFunc   RedirectURLFunc
+	AllowedRedirectHosts   []string
+	
 	// Redis Configuration (optional)
 	RedisURL         string
 	EnableRedisCache bool
 	
+	// RedisFallbackToMemory makes NewSessionStore start with an in-memory store
+	// when Redis is unreachable, retrying Redis every RedisRetryInterval
+	RedisFallbackToMemory bool
+	RedisRetryInterval    time.Duration
+	
 	// Security Settings
+	PasswordHasher  PasswordHasher // defaults to bcrypt with BCryptCost
+	// LegacyPasswordHashers verify hashes of previous algorithms, which are
+	// replaced by PasswordHasher hashes on sign-in when the UserStore
+	// implements PasswordUpdater. When PasswordHasher is set to another
+	// algorithm, it defaults to bcrypt with BCryptCost.
+	LegacyPasswordHashers []PasswordHasher
 	BCryptCost      int
+	
+	// BCryptPreHash hashes passwords with SHA-256 before bcrypt, so
+	// passwords longer than bcrypt's 72-byte limit are not truncated.
+	// Existing hashes still verify and are upgraded on sign-in when the
+	// UserStore implements PasswordUpdater.
+	BCryptPreHash bool
+	
+	// PasswordPepper is an application-wide secret mixed into passwords before
+	// hashing. Keep it outside the database. To rotate it, move the old value
+	// to PasswordPreviousPeppers; matching hashes are upgraded on sign-in when
+	// the UserStore implements PasswordUpdater.
+	//
+	// Hashes made before a pepper was set no longer verify once it is. When
+	// enabling a pepper for existing users, also set
+	// PasswordPepperAcceptUnpeppered so their hashes are accepted and
+	// upgraded the same way, and turn it off once users have signed in again.
+	PasswordPepper                 string
+	PasswordPreviousPeppers        []string
+	PasswordPepperAcceptUnpeppered bool
+	
+	// MaxConcurrentHashes bounds the password hashes and comparisons running
+	// at once (default GOMAXPROCS; 0 means no limit). Others wait up to
+	// HashQueueTimeout, then fail with ErrHashingBusy.
+	MaxConcurrentHashes int
+	HashQueueTimeout    time.Duration
 	AllowSignup     bool
+	AllowOAuthSignup *bool // whether OAuth sign-in creates new users; nil follows AllowSignup
+	AllowGuestSessions bool // allow anonymous guest users via CreateGuest
+	
+	// RequirePasswordConfirmation rejects signups whose password_confirmation
+	// is missing or differs from the password
+	RequirePasswordConfirmation bool
+	
+	// CaptchaVerifier, when set, makes SignUp and SignIn require a verified
+	// captcha_token (see NewRecaptchaVerifier and NewHCaptchaVerifier)
+	CaptchaVerifier CaptchaVerifier
+	
+	// RejectBreachedPasswords rejects new passwords found in the Have I Been
+	// Pwned corpus. PwnedPasswordChecker overrides the default checker, e.g.
+	// to raise the threshold or use a mirror.
+	RejectBreachedPasswords bool
+	PwnedPasswordChecker    *PwnedPasswordChecker
+	
+	// EmailVerificationMode controls how unverified emails affect sign-in:
+	// EmailVerificationBlock, EmailVerificationGrace (allowed until
+	// EmailVerificationGracePeriod after signup) or EmailVerificationSoft.
+	// When set, access tokens carry email_verified. RequireEmailVerification
+	// is shorthand for block mode.
+	EmailVerificationMode        string
+	EmailVerificationGracePeriod time.Duration
 	RequireEmailVerification bool
+	
+	// VerificationSender delivers email verification tokens; nil disables
+	// sending them on signup and the verification endpoints
+	VerificationSender          VerificationSender
+	VerificationTokenExpiration time.Duration
+	VerificationResendInterval  time.Duration
+	
+	// EmailChangeSender delivers email change confirmations; nil disables
+	// the email change endpoints
+	EmailChangeSender EmailChangeSender
+	
+	// RotateRefreshTokens revokes a refresh token once it is used. Replaying a
+	// rotated token revokes all of the user's refresh tokens, except within
+	// RefreshTokenGracePeriod, where concurrent refreshes of the same token
+	// receive the same newly-issued pair.
+	RotateRefreshTokens     bool
+	RefreshTokenGracePeriod time.Duration
+	
+	// AcceptLegacyRefreshTokens keeps accepting refresh tokens issued before
+	// refresh tokens were tracked (tokens without a jti) until they expire.
+	// Such tokens cannot be revoked individually or by LogoutAllSessions, so
+	// enable it only for the upgrade window.
+	AcceptLegacyRefreshTokens bool
+	
+	// MaxSessionLifetime is an absolute session timeout: refreshes are
+	// rejected once it has elapsed since the original login. Zero disables it.
+	MaxSessionLifetime time.Duration
+	
+	// MinimalAuthResponse keeps PII out of auth responses and tokens: the
+	// response user only carries the ID and tokens omit email and name.
+	// The data is still stored server-side.
+	MinimalAuthResponse bool
+	
+	// ExposeTokenMetadata adds the access token's signing algorithm and, with
+	// JWTSigningKeys, key ID to auth responses
+	ExposeTokenMetadata bool
+	
+	// WebSocket token locations for AuthenticateWebSocket. An empty value
+	// disables that location.
+	WebSocketTokenProtocol   string
+	WebSocketTokenQueryParam string
+	
+	// MaxRequestBodyBytes limits the size of request bodies read by the auth
+	// handlers. Zero uses DefaultMaxRequestBodyBytes, a negative value disables the limit.
+	MaxRequestBodyBytes int64
+	
+	// BindTokenToSession embeds the session ID in access tokens (sid claim)
+	// and rejects tokens whose session no longer exists, so logout takes
+	// effect immediately instead of at token expiry
+	BindTokenToSession bool
+	
+	// SessionCreationRequired fails sign-ins whose server session cannot be
+	// created instead of issuing tokens without one. BindTokenToSession
+	// implies it.
+	SessionCreationRequired bool
+	
+	// SessionIDFormat sets the length, encoding and prefix of session IDs;
+	// the default is 32 alphanumeric characters
+	SessionIDFormat SessionIDFormat
+	
+	// EnableTokenVersioning embeds the user's token version (tv claim) in
+	// access tokens and rejects tokens whose version is outdated, so
+	// IncrementTokenVersion invalidates them. Adds a store lookup per validation.
+	EnableTokenVersioning bool
+	
+	// RefreshClaimsRevokesTokens makes RefreshClaims bump the user's token
+	// version, invalidating their older access tokens. Requires
+	// EnableTokenVersioning.
+	RefreshClaimsRevokesTokens bool
+	
+	// RevokeTokensIssuedBefore rejects all tokens issued before it; see
+	// AuthService.RevokeTokensIssuedBefore to set it at runtime
+	RevokeTokensIssuedBefore time.Time
+	
+	// ValidationCacheTTL caches the session and token version lookups of
+	// BindTokenToSession and EnableTokenVersioning in process for this long,
+	// so revocations made on other instances take up to this long to apply.
+	// 0 disables the cache.
+	ValidationCacheTTL time.Duration
+	
+	// MeFreshRoles makes /auth/me look the user up for their current roles
+	// and tenant, which may have changed since the token was issued. When
+	// off, /auth/me answers from the token's claims without any I/O.
+	MeFreshRoles bool
+	
+	// Session cookie, set on login when SessionCookieEnabled and read by
+	// SessionMiddleware and the logout handler
+	SessionCookieEnabled  bool
+	SessionCookieName     string
+	SessionCookiePath     string
+	SessionCookieDomain   string
+	SessionCookieSameSite http.SameSite // defaults to Lax; None forces Secure
+	SessionCookieSecure   *bool         // nil sets Secure on HTTPS requests only
+	
+	// SessionTokenRefresh includes a refresh token in the response of
+	// /auth/session/token, which otherwise only issues an access token
+	SessionTokenRefresh bool
+	
+	// PartitionedCookies sets the CHIPS Partitioned attribute, with
+	// SameSite=None and Secure, on the session and refresh cookies so they
+	// work in iframes on other sites when third-party cookies are blocked
+	PartitionedCookies bool
+	
+	// RefreshTokenDelivery sets where logins and /refresh return the refresh
+	// token: RefreshTokenDeliveryBody, RefreshTokenDeliveryCookie (an
+	// HttpOnly cookie with the session cookie attributes, never the body) or
+	// RefreshTokenDeliveryBoth. Defaults to both when RefreshCookieName is
+	// set, else body. /refresh reads the cookie in cookie and both modes.
+	RefreshTokenDelivery string
+	RefreshCookieName    string // defaults to "refresh_token"
+	
+	// TenantHeader and TenantResolver determine the tenant of a request for
+	// TenantMiddleware. The resolver takes precedence; without either the
+	// host's subdomain is used.
+	TenantHeader   string
+	TenantResolver TenantResolver
+	
+	// TrustedProxies lists the IPs and CIDR ranges of proxies whose
+	// X-Forwarded-For and X-Real-IP headers are trusted for the client IP,
+	// and whose X-Forwarded-Proto decides whether cookies are Secure. It is
+	// read when the handlers are created.
+	TrustedProxies []string
+	
+	// RedactionLevel controls email masking in logs and audit events:
+	// RedactionPartial (default), RedactionDomain or RedactionFull
+	RedactionLevel RedactionLevel
+	
+	// RedactAuditEmails masks emails recorded in audit events at RedactionLevel
+	RedactAuditEmails bool
+	
+	// AuditStore records auth events when set; nil disables auditing
+	AuditStore AuditStore
+	
+	// AuditAdminRole is the role required to query the audit log endpoint
+	AuditAdminRole string
 }
 
+// DefaultMaxRequestBodyBytes is the default request body limit (1MB)
+const DefaultMaxRequestBodyBytes int64 = 1 << 20
+
+// Refresh token delivery modes
+const (
+	RefreshTokenDeliveryBody   = "body"
+	RefreshTokenDeliveryCookie = "cookie"
+	RefreshTokenDeliveryBoth   = "both"
+)
+
 func NewConfig() *Config {
 	return &Config{
 		JWTSecret:            getEnv("JWT_SECRET", ""),
+		JWTSigningKeys:       getEnvMap("JWT_SIGNING_KEYS"),
+		JWTActiveKeyID:       getEnv("JWT_ACTIVE_KEY_ID", ""),
+		DeriveKeys:           getEnv("DERIVE_KEYS", "false") == "true",
 		JWTExpiration:        24 * time.Hour,
 		JWTIssuer:           getEnv("JWT_ISSUER", "gotrust"),
+		JWTAudience:          getEnv("JWT_AUDIENCE", ""),
+		JWTAccessTokenType:   getEnv("JWT_ACCESS_TOKEN_TYPE", DefaultAccessTokenType),
+		JWTRefreshTokenType:  getEnv("JWT_REFRESH_TOKEN_TYPE", DefaultRefreshTokenType),
+		JWTCompactClaims:     getEnv("JWT_COMPACT_CLAIMS", "false") == "true",
+		TokenLeeway:          getEnvDuration("TOKEN_LEEWAY", 0),
+		AccessTokenGracePeriod: getEnvDuration("ACCESS_TOKEN_GRACE_PERIOD", 0),
+		TokenEncryptionKey:   getEnv("TOKEN_ENCRYPTION_KEY", ""),
+		AuthScheme:           getEnv("AUTH_SCHEME", "Bearer"),
+		JSONNamingStrategy:   getEnv("JSON_NAMING_STRATEGY", JSONNamingSnake),
+		JWKSURL:              getEnv("JWKS_URL", ""),
+		JWKSRefreshInterval:  getEnvDuration("JWKS_REFRESH_INTERVAL", DefaultJWKSRefreshInterval),
 		
 		GoogleClientID:       getEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret:   getEnv("GOOGLE_CLIENT_SECRET", ""),
 		GoogleRedirectURI:    getEnv("GOOGLE_REDIRECT_URI", "http://localhost:4000/auth/google/callback"),
 		GoogleScopes:         []string{"email", "profile"},
+		GoogleTokenAudiences: getEnvList("GOOGLE_TOKEN_AUDIENCES"),
 		
 		GitHubClientID:       getEnv("GITHUB_CLIENT_ID", ""),
 		GitHubClientSecret:   getEnv("GITHUB_CLIENT_SECRET", ""),
 		GitHubRedirectURI:    getEnv("GITHUB_REDIRECT_URI", "http://localhost:4000/auth/github/callback"),
 		GitHubScopes:         []string{"user:email"},
 		
-		OAuthStateExpiration: 10 * time.Minute,
+		GitLabClientID:       getEnv("GITLAB_CLIENT_ID", ""),
+		GitLabClientSecret:   getEnv("GITLAB_CLIENT_SECRET", ""),
+		GitLabRedirectURI:    getEnv("GITLAB_REDIRECT_URI", "http://localhost:4000/auth/gitlab/callback"),
+		GitLabScopes:         []string{"read_user"},
+		GitLabBaseURL:        getEnv("GITLAB_BASE_URL", "https://gitlab.com"),
+		
+		DiscordClientID:      getEnv("DISCORD_CLIENT_ID", ""),
+		DiscordClientSecret:  getEnv("DISCORD_CLIENT_SECRET", ""),
+		DiscordRedirectURI:   getEnv("DISCORD_REDIRECT_URI", "http://localhost:4000/auth/discord/callback"),
+		DiscordScopes:        []string{"identify", "email"},
+		
+		OAuthStateExpiration: getEnvDuration("OAUTH_STATE_MAX_AGE", 10*time.Minute),
+		OAuthMaxPendingStates: getEnvInt("OAUTH_MAX_PENDING_STATES", DefaultOAuthMaxPendingStates),
+		OAuthStateMode:       getEnv("OAUTH_STATE_MODE", OAuthStateModeStore),
+		OAuthStateSecret:     getEnv("OAUTH_STATE_SECRET", ""),
 		FrontendSuccessURL:   getEnv("FRONTEND_SUCCESS_URL", "http://localhost:3000/auth/success"),
 		FrontendErrorURL:     getEnv("FRONTEND_ERROR_URL", "http://localhost:3000/auth/error"),
+		AllowedRedirectHosts: getEnvList("ALLOWED_REDIRECT_HOSTS"),
+		OAuthAccountLinkingMode: getEnv("OAUTH_ACCOUNT_LINKING_MODE", AccountLinkingVerifiedOnly),
+		OAuthBreakerThreshold:   getEnvInt("OAUTH_BREAKER_THRESHOLD", DefaultOAuthBreakerThreshold),
+		OAuthBreakerCooldown:    getEnvDuration("OAUTH_BREAKER_COOLDOWN", DefaultOAuthBreakerCooldown),
+		OAuthRedirectStatus:     getEnvInt("OAUTH_REDIRECT_STATUS", http.StatusTemporaryRedirect),
 		
 		RedisURL:         getEnv("REDIS_URL", ""),
 		EnableRedisCache: getEnv("ENABLE_REDIS_CACHE", "true") == "true",
+		RedisFallbackToMemory: getEnv("REDIS_FALLBACK_TO_MEMORY", "false") == "true",
+		RedisRetryInterval:    DefaultRedisRetryInterval,
 		
 		BCryptCost:               10,
+		BCryptPreHash:            getEnv("BCRYPT_PREHASH", "false") == "true",
+		PasswordPepper:           getEnv("PASSWORD_PEPPER", ""),
+		PasswordPreviousPeppers:  getEnvList("PASSWORD_PREVIOUS_PEPPERS"),
+		PasswordPepperAcceptUnpeppered: getEnv("PASSWORD_PEPPER_ACCEPT_UNPEPPERED", "false") == "true",
+		MaxConcurrentHashes:      getEnvInt("MAX_CONCURRENT_HASHES", runtime.GOMAXPROCS(0)),
+		HashQueueTimeout:         getEnvDuration("HASH_QUEUE_TIMEOUT", DefaultHashQueueTimeout),
 		AllowSignup:              getEnv("ALLOW_SIGNUP", "true") == "true",
+		RequirePasswordConfirmation: getEnv("REQUIRE_PASSWORD_CONFIRMATION", "false") == "true",
+		AllowOAuthSignup:         getEnvBoolPtr("ALLOW_OAUTH_SIGNUP"),
+		AllowGuestSessions:       getEnv("ALLOW_GUEST_SESSIONS", "false") == "true",
+		RejectBreachedPasswords:  getEnv("REJECT_BREACHED_PASSWORDS", "false") == "true",
 		RequireEmailVerification: getEnv("REQUIRE_EMAIL_VERIFICATION", "false") == "true",
+		EmailVerificationMode:        getEnv("EMAIL_VERIFICATION_MODE", ""),
+		EmailVerificationGracePeriod: getEnvDuration("EMAIL_VERIFICATION_GRACE_PERIOD", 7*24*time.Hour),
+		VerificationTokenExpiration: 24 * time.Hour,
+		VerificationResendInterval:  time.Minute,
+		MaxRequestBodyBytes:      DefaultMaxRequestBodyBytes,
+		MinimalAuthResponse:      getEnv("MINIMAL_AUTH_RESPONSE", "false") == "true",
+		ExposeTokenMetadata:      getEnv("EXPOSE_TOKEN_METADATA", "false") == "true",
+		BindTokenToSession:       getEnv("BIND_TOKEN_TO_SESSION", "false") == "true",
+		SessionCreationRequired:  getEnv("SESSION_CREATION_REQUIRED", "false") == "true",
+		SessionIDFormat: SessionIDFormat{
+			Length:   getEnvInt("SESSION_ID_LENGTH", DefaultSessionIDLength),
+			Encoding: getEnv("SESSION_ID_ENCODING", SessionIDAlphanumeric),
+			Prefix:   getEnv("SESSION_ID_PREFIX", ""),
+		},
+		EnableTokenVersioning:    getEnv("ENABLE_TOKEN_VERSIONING", "false") == "true",
+		RefreshClaimsRevokesTokens: getEnv("REFRESH_CLAIMS_REVOKE_TOKENS", "false") == "true",
+		RevokeTokensIssuedBefore: getEnvTime("REVOKE_TOKENS_ISSUED_BEFORE"),
+		ValidationCacheTTL:       getEnvDuration("VALIDATION_CACHE_TTL", 0),
+		MeFreshRoles:             getEnv("ME_FRESH_ROLES", "false") == "true",
+		RotateRefreshTokens:      getEnv("ROTATE_REFRESH_TOKENS", "false") == "true",
+		AcceptLegacyRefreshTokens: getEnv("ACCEPT_LEGACY_REFRESH_TOKENS", "false") == "true",
+		RefreshTokenGracePeriod:  10 * time.Second,
+		MaxSessionLifetime:       getEnvDuration("MAX_SESSION_LIFETIME", 0),
+		WebSocketTokenProtocol:   "access_token",
+		WebSocketTokenQueryParam: "access_token",
+		AuditAdminRole:           getEnv("AUDIT_ADMIN_ROLE", "admin"),
+		RedactionLevel:           RedactionLevel(getEnv("REDACTION_LEVEL", string(RedactionPartial))),
+		RedactAuditEmails:        getEnv("REDACT_AUDIT_EMAILS", "false") == "true",
+		TenantHeader:             getEnv("TENANT_HEADER", "X-Tenant-ID"),
+		TrustedProxies:           getEnvList("TRUSTED_PROXIES"),
+		SessionCookieEnabled:     getEnv("SESSION_COOKIE_ENABLED", "false") == "true",
+		SessionTokenRefresh:      getEnv("SESSION_TOKEN_REFRESH", "false") == "true",
+		SessionCookieName:        getEnv("SESSION_COOKIE_NAME", "session_id"),
+		SessionCookiePath:        getEnv("SESSION_COOKIE_PATH", "/"),
+		SessionCookieDomain:      getEnv("SESSION_COOKIE_DOMAIN", ""),
+		SessionCookieSameSite:    parseSameSite(getEnv("SESSION_COOKIE_SAMESITE", "lax")),
+		SessionCookieSecure:      getEnvBoolPtr("SESSION_COOKIE_SECURE"),
+		PartitionedCookies:       getEnv("PARTITIONED_COOKIES", "false") == "true",
+		RefreshTokenDelivery:     getEnv("REFRESH_TOKEN_DELIVERY", ""),
+		RefreshCookieName:        getEnv("REFRESH_COOKIE_NAME", ""),
 	}
 }
 
+// subject returns the JWT subject for a user
+func (c *Config) subject(user *User) string {
+	if c.SubjectFunc != nil {
+		if sub := c.SubjectFunc(user); sub != "" {
+			return sub
+		}
+	}
+	return user.ID
+}
+
+// passwordHasher returns the configured password hasher
+func (c *Config) passwordHasher() PasswordHasher {
+	bcryptHasher := NewBcryptHasher(c.BCryptCost)
+	bcryptHasher.PreHash = c.BCryptPreHash
+	
+	hasher := c.PasswordHasher
+	if hasher == nil {
+		hasher = bcryptHasher
+	} else {
+		legacy := c.LegacyPasswordHashers
+		if _, isBcrypt := hasher.(*BcryptHasher); legacy == nil && !isBcrypt {
+			legacy = []PasswordHasher{bcryptHasher}
+		}
+		if len(legacy) > 0 {
+			hasher = NewMigratingHasher(hasher, legacy...)
+		}
+	}
+	if c.PasswordPepper != "" {
+		peppered := NewPepperedHasher(hasher, c.PasswordPepper, c.PasswordPreviousPeppers...)
+		peppered.AcceptUnpeppered = c.PasswordPepperAcceptUnpeppered
+		hasher = peppered
+	}
+	if c.MaxConcurrentHashes > 0 {
+		hasher = NewLimitedHasher(hasher, c.MaxConcurrentHashes, c.HashQueueTimeout)
+	}
+	return hasher
+}
+
+// authScheme returns the expected Authorization header scheme
+func (c *Config) authScheme() string {
+	if c.AuthScheme != "" {
+		return c.AuthScheme
+	}
+	return "Bearer"
+}
+
+// authRealm returns the realm for WWW-Authenticate challenges
+func (c *Config) authRealm() string {
+	if c.AuthRealm != "" {
+		return c.AuthRealm
+	}
+	if c.JWTIssuer != "" {
+		return c.JWTIssuer
+	}
+	return "gotrust"
+}
+
+// maxRequestBodyBytes returns the effective request body limit
+func (c *Config) maxRequestBodyBytes() int64 {
+	if c.MaxRequestBodyBytes == 0 {
+		return DefaultMaxRequestBodyBytes
+	}
+	return c.MaxRequestBodyBytes
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvList(key string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvMap parses a comma separated list of key:value pairs
+func getEnvMap(key string) map[string]string {
+	list := getEnvList(key)
+	if len(list) == 0 {
+		return nil
+	}
+	
+	values := make(map[string]string, len(list))
+	for _, item := range list {
+		if k, v, ok := strings.Cut(item, ":"); ok {
+			values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return values
+}
+
+// signingSecret returns the secret tokens are signed with
+func (c *Config) signingSecret() string {
+	if c.JWTSecret == "" && c.JWTActiveKeyID != "" {
+		return c.JWTSigningKeys[c.JWTActiveKeyID]
+	}
+	return c.JWTSecret
+}
+
+// getEnvDuration parses a duration such as "720h", returning defaultValue
+// when the variable is unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// getEnvTime parses an RFC 3339 time, returning the zero time when the
+// variable is unset or invalid
+func getEnvTime(key string) time.Time {
+	if value := os.Getenv(key); value != "" {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// getEnvInt parses an integer, returning defaultValue when the variable is
+// unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// oauthSignupAllowed reports whether OAuth sign-in may create new users
+func (c *Config) oauthSignupAllowed() bool {
+	if c.AllowOAuthSignup != nil {
+		return *c.AllowOAuthSignup
+	}
+	return c.AllowSignup
+}
+
+// getEnvBoolPtr parses an optional boolean, returning nil when unset
+func getEnvBoolPtr(key string) *bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	b := value == "true"
+	return &b
+}
@@ -0,0 +1,70 @@
+package gotrust
+
+import "context"
+
+// contextKey is the type of keys GoTrust stores in contexts, so they cannot
+// collide with keys set by other packages
+type contextKey string
+
+const claimsContextKey contextKey = "gotrust.claims"
+
+// SetClaims stores the token claims for the current request. The claims are
+// also attached to the request's context.Context (see ClaimsFromContext).
+//
+// For backward compatibility the legacy string keys "user_id", "user_email",
+// "user_name", "user_provider" and "claims" are still set. They are
+// deprecated; use GetClaims instead.
+func SetClaims(ctx HTTPContext, claims *TokenClaims) {
+	ctx.Set(string(claimsContextKey), claims)
+
+	if req := ctx.Request(); req != nil {
+		*req = *req.WithContext(ContextWithClaims(req.Context(), claims))
+	}
+
+	// Deprecated string keys
+	ctx.Set("user_id", claims.UserID)
+	ctx.Set("user_email", claims.Email)
+	ctx.Set("user_name", claims.Name)
+	ctx.Set("user_provider", claims.Provider)
+	ctx.Set("claims", claims)
+
+	// Roles are also available as []string for handlers that read them directly
+	roles := claims.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	ctx.Set("user_roles", roles)
+}
+
+// GetRolesFromContext returns the roles of the authenticated user, or nil if
+// the request is not authenticated
+func GetRolesFromContext(ctx HTTPContext) []string {
+	if claims, ok := GetClaims(ctx); ok {
+		return claims.Roles
+	}
+	return nil
+}
+
+// GetClaims returns the token claims stored by the auth middleware. They are
+// read from the request's context.Context, where no string key set by other
+// middleware can shadow them, falling back to the HTTPContext value.
+func GetClaims(ctx HTTPContext) (*TokenClaims, bool) {
+	if req := ctx.Request(); req != nil {
+		if claims, ok := ClaimsFromContext(req.Context()); ok {
+			return claims, true
+		}
+	}
+	claims, ok := ctx.Get(string(claimsContextKey)).(*TokenClaims)
+	return claims, ok && claims != nil
+}
+
+// ContextWithClaims returns a copy of ctx carrying the token claims
+func ContextWithClaims(ctx context.Context, claims *TokenClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// ClaimsFromContext returns the token claims carried by ctx, if any
+func ClaimsFromContext(ctx context.Context) (*TokenClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*TokenClaims)
+	return claims, ok && claims != nil
+}
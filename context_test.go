@@ -0,0 +1,111 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestClaimsContextKeyCollision(t *testing.T) {
+	claims := &TokenClaims{UserID: "user-1", Email: "jane@example.com", Roles: []string{"admin"}}
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{name: "plain key", key: "gotrust.claims"},
+		{name: "legacy key", key: "claims"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodGet, "/", "")
+			SetClaims(ctx, claims)
+
+			// Other middleware overwrites a string key with its own value
+			ctx.Set(tt.key, "unrelated")
+			if got, ok := GetClaims(ctx); !ok || got != claims {
+				t.Errorf("GetClaims() = %v, %v after %q was overwritten", got, ok, tt.key)
+			}
+
+			// Request context values set under the same string are distinct
+			reqCtx := context.WithValue(ctx.Request().Context(), tt.key, "unrelated")
+			if got, ok := ClaimsFromContext(reqCtx); !ok || got != claims {
+				t.Errorf("ClaimsFromContext() = %v, %v", got, ok)
+			}
+		})
+	}
+}
+
+func TestSetClaimsLegacyKeys(t *testing.T) {
+	ctx := newTestContext(http.MethodGet, "/", "")
+	SetClaims(ctx, &TokenClaims{UserID: "user-1", Email: "jane@example.com"})
+
+	if ctx.Get("user_id") != "user-1" || ctx.Get("user_email") != "jane@example.com" {
+		t.Errorf("legacy keys = %v, %v", ctx.Get("user_id"), ctx.Get("user_email"))
+	}
+	if roles, ok := ctx.Get("user_roles").([]string); !ok || roles == nil {
+		t.Errorf("user_roles = %#v, want an empty slice", ctx.Get("user_roles"))
+	}
+	if userID, err := GetUserFromContext(ctx); err != nil || userID != "user-1" {
+		t.Errorf("GetUserFromContext() = %q, %v", userID, err)
+	}
+
+	if _, ok := GetClaims(newTestContext(http.MethodGet, "/", "")); ok {
+		t.Errorf("GetClaims() found claims on an unauthenticated request")
+	}
+}
+
+func TestGetRolesFromContext(t *testing.T) {
+	h, a := newTestHandlers(t, nil)
+	tokenWithRoles := func(roles ...string) string {
+		token, err := a.jwtManager.GenerateToken(TokenClaims{UserID: "user-1", Roles: roles})
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name       string
+		middleware HTTPMiddleware
+		token      string
+		wantRoles  []string
+	}{
+		{name: "auth middleware", middleware: h.AuthMiddleware(), token: tokenWithRoles("admin", "editor"), wantRoles: []string{"admin", "editor"}},
+		{name: "auth middleware without roles", middleware: h.AuthMiddleware(), token: tokenWithRoles(), wantRoles: []string{}},
+		{name: "optional auth with a token", middleware: h.OptionalAuthMiddleware(), token: tokenWithRoles("admin"), wantRoles: []string{"admin"}},
+		{name: "optional auth without a token", middleware: h.OptionalAuthMiddleware()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodGet, "/", "")
+			if tt.token != "" {
+				ctx.withBearer(tt.token)
+			}
+
+			var roles []string
+			var contextRoles interface{}
+			serve(t, ctx, func(ctx HTTPContext) error {
+				roles = GetRolesFromContext(ctx)
+				contextRoles = ctx.Get("user_roles")
+				return nil
+			}, tt.middleware)
+
+			if fmt.Sprint(roles) != fmt.Sprint(tt.wantRoles) {
+				t.Errorf("GetRolesFromContext() = %v, want %v", roles, tt.wantRoles)
+			}
+			if tt.wantRoles == nil {
+				if contextRoles != nil {
+					t.Errorf("user_roles = %#v on an unauthenticated request", contextRoles)
+				}
+				return
+			}
+			if got, ok := contextRoles.([]string); !ok || fmt.Sprint(got) != fmt.Sprint(tt.wantRoles) {
+				t.Errorf("user_roles = %#v, want %v", contextRoles, tt.wantRoles)
+			}
+		})
+	}
+}
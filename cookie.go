@@ -0,0 +1,261 @@
+package gotrust
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// parseSameSite converts a SameSite name (lax, strict, none) to http.SameSite
+func parseSameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	case "lax":
+		return http.SameSiteLaxMode
+	default:
+		return http.SameSiteDefaultMode
+	}
+}
+
+// isSecureRequest reports whether the request arrived over HTTPS, directly or
+// through a trusted proxy setting X-Forwarded-Proto
+func (h *GenericAuthHandlers) isSecureRequest(ctx HTTPContext) bool {
+	if req := ctx.Request(); req != nil && req.TLS != nil {
+		return true
+	}
+	if !h.fromTrustedProxy(ctx) {
+		return false
+	}
+	proto := ctx.GetHeader("X-Forwarded-Proto")
+	if i := strings.Index(proto, ","); i >= 0 {
+		proto = proto[:i]
+	}
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// refreshCookieName returns the configured refresh token cookie name
+func (c *Config) refreshCookieName() string {
+	if c.RefreshCookieName != "" {
+		return c.RefreshCookieName
+	}
+	return "refresh_token"
+}
+
+// refreshTokenDelivery returns where refresh tokens are delivered. Setting
+// only RefreshCookieName delivers them in both the body and the cookie.
+func (c *Config) refreshTokenDelivery() string {
+	switch c.RefreshTokenDelivery {
+	case RefreshTokenDeliveryCookie, RefreshTokenDeliveryBoth:
+		return c.RefreshTokenDelivery
+	case "":
+		if c.RefreshCookieName != "" {
+			return RefreshTokenDeliveryBoth
+		}
+	}
+	return RefreshTokenDeliveryBody
+}
+
+// sessionCookieName returns the configured session cookie name
+func (c *Config) sessionCookieName() string {
+	if c.SessionCookieName != "" {
+		return c.SessionCookieName
+	}
+	return "session_id"
+}
+
+// newSessionCookie builds the session cookie with the configured attributes
+// for the request. A negative maxAge deletes the cookie.
+func (h *GenericAuthHandlers) newSessionCookie(ctx HTTPContext, value string, maxAge int) *http.Cookie {
+	return h.newAuthCookie(ctx, h.config.sessionCookieName(), value, maxAge)
+}
+
+// newAuthCookie builds an HttpOnly cookie with the configured session cookie
+// path, domain, SameSite and Secure attributes
+func (h *GenericAuthHandlers) newAuthCookie(ctx HTTPContext, name, value string, maxAge int) *http.Cookie {
+	c := h.config
+	path := c.SessionCookiePath
+	if path == "" {
+		path = "/"
+	}
+
+	sameSite := c.SessionCookieSameSite
+	if sameSite == http.SameSiteDefaultMode {
+		sameSite = http.SameSiteLaxMode
+	}
+	// Partitioned cookies are only useful in cross-site contexts
+	if c.PartitionedCookies {
+		sameSite = http.SameSiteNoneMode
+	}
+
+	secure := h.isSecureRequest(ctx)
+	if c.SessionCookieSecure != nil {
+		secure = *c.SessionCookieSecure
+	}
+	// Browsers reject SameSite=None cookies without Secure
+	if sameSite == http.SameSiteNoneMode {
+		secure = true
+	}
+
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.SessionCookieDomain,
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: sameSite,
+	}
+	if maxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(maxAge) * time.Second)
+	} else if maxAge < 0 {
+		cookie.Expires = time.Unix(0, 0)
+	}
+	if c.PartitionedCookies {
+		cookie.Unparsed = append(cookie.Unparsed, partitionedAttribute)
+	}
+	return cookie
+}
+
+// partitionedAttribute marks cookies needing the CHIPS Partitioned
+// attribute. http.Cookie only supports it from Go 1.23, so it is carried in
+// Unparsed and written by CookieHeader.
+const partitionedAttribute = "Partitioned"
+
+// CookieHeader returns the Set-Cookie header value of a cookie, including the
+// Partitioned attribute of GoTrust's partitioned cookies. Adapters use it to
+// implement HTTPContext.SetCookie. It returns "" for invalid cookies.
+func CookieHeader(cookie *http.Cookie) string {
+	value := cookie.String()
+	if value == "" {
+		return ""
+	}
+	for _, attr := range cookie.Unparsed {
+		if attr == partitionedAttribute {
+			return value + "; " + partitionedAttribute
+		}
+	}
+	return value
+}
+
+// setAuthCookies sets the session and refresh token cookies, where enabled,
+// after a successful login
+func (h *GenericAuthHandlers) setAuthCookies(ctx HTTPContext, response *AuthResponse) {
+	h.setSessionCookie(ctx, response)
+	h.deliverRefreshToken(ctx, response)
+}
+
+// deliverRefreshToken sets the refresh token cookie and, in cookie-only mode,
+// removes the refresh token from the response body
+func (h *GenericAuthHandlers) deliverRefreshToken(ctx HTTPContext, response *AuthResponse) {
+	delivery := h.config.refreshTokenDelivery()
+	if delivery == RefreshTokenDeliveryBody {
+		return
+	}
+
+	h.setRefreshCookie(ctx, response)
+	if delivery == RefreshTokenDeliveryCookie {
+		response.RefreshToken = ""
+	}
+}
+
+// setSessionCookie sets the session cookie after a successful login when
+// Config.SessionCookieEnabled is set
+func (h *GenericAuthHandlers) setSessionCookie(ctx HTTPContext, response *AuthResponse) {
+	if !h.config.SessionCookieEnabled || response.SessionID == "" {
+		return
+	}
+	ctx.SetCookie(h.newSessionCookie(ctx, response.SessionID, int(h.config.JWTExpiration.Seconds())))
+}
+
+// clearSessionCookie removes the session cookie
+func (h *GenericAuthHandlers) clearSessionCookie(ctx HTTPContext) {
+	ctx.SetCookie(h.newSessionCookie(ctx, "", -1))
+}
+
+// setRefreshCookie stores the refresh token in the refresh token cookie
+func (h *GenericAuthHandlers) setRefreshCookie(ctx HTTPContext, response *AuthResponse) {
+	if response.RefreshToken == "" {
+		return
+	}
+	ctx.SetCookie(h.newAuthCookie(ctx, h.config.refreshCookieName(), response.RefreshToken, int(refreshTokenExpiration.Seconds())))
+}
+
+// clearRefreshCookie removes the refresh token cookie, if enabled
+func (h *GenericAuthHandlers) clearRefreshCookie(ctx HTTPContext) {
+	if h.config.refreshTokenDelivery() == RefreshTokenDeliveryBody {
+		return
+	}
+	ctx.SetCookie(h.newAuthCookie(ctx, h.config.refreshCookieName(), "", -1))
+}
+
+// refreshTokenFromCookie returns the refresh token carried by the refresh
+// cookie, if enabled
+func (h *GenericAuthHandlers) refreshTokenFromCookie(ctx HTTPContext) string {
+	if h.config.refreshTokenDelivery() == RefreshTokenDeliveryBody {
+		return ""
+	}
+	cookie, err := ctx.GetCookie(h.config.refreshCookieName())
+	if err != nil || cookie == nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// sessionIDFromCookie returns the session ID carried by the session cookie
+func (h *GenericAuthHandlers) sessionIDFromCookie(ctx HTTPContext) string {
+	cookie, err := ctx.GetCookie(h.config.sessionCookieName())
+	if err != nil || cookie == nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// SessionTokenHandler exchanges the session of a request authenticated by
+// SessionMiddleware for an access token
+func (h *GenericAuthHandlers) SessionTokenHandler(ctx HTTPContext) error {
+	sessionID, _ := ctx.Get("session_id").(string)
+	if sessionID == "" {
+		return h.errorJSON(ctx, http.StatusUnauthorized, "Session cookie is required")
+	}
+
+	response, err := h.authService.SessionToken(h.requestContext(ctx), sessionID)
+	if err != nil {
+		if errors.Is(err, ErrEmailNotVerified) {
+			return h.errorJSONCode(ctx, http.StatusForbidden, "email_not_verified", err.Error())
+		}
+		return h.errorJSON(ctx, http.StatusUnauthorized, err.Error())
+	}
+
+	h.deliverRefreshToken(ctx, response)
+	return h.writeJSON(ctx, http.StatusOK, response)
+}
+
+// SessionMiddleware authenticates requests with the session cookie instead
+// of a bearer token. The session ID and data are stored in the context under
+// "session_id" and "session".
+func (h *GenericAuthHandlers) SessionMiddleware() HTTPMiddleware {
+	return func(next HTTPHandler) HTTPHandler {
+		return func(ctx HTTPContext) error {
+			sessionID := h.sessionIDFromCookie(ctx)
+			if sessionID == "" {
+				return h.errorJSON(ctx, http.StatusUnauthorized, "Session cookie is required")
+			}
+
+			session, err := h.authService.GetSession(h.requestContext(ctx), sessionID)
+			if err != nil {
+				h.clearSessionCookie(ctx)
+				return h.errorJSON(ctx, http.StatusUnauthorized, "Invalid or expired session")
+			}
+
+			ctx.Set("session_id", sessionID)
+			ctx.Set("session", session)
+
+			return next(ctx)
+		}
+	}
+}
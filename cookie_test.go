@@ -0,0 +1,471 @@
+package gotrust
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSessionCookie(t *testing.T) {
+	secure, insecure := true, false
+
+	tests := []struct {
+		name         string
+		configure    func(*Config)
+		https        bool
+		wantName     string
+		wantPath     string
+		wantDomain   string
+		wantSameSite http.SameSite
+		wantSecure   bool
+	}{
+		{
+			name:         "defaults over http",
+			configure:    func(c *Config) {},
+			wantName:     "session_id",
+			wantPath:     "/",
+			wantSameSite: http.SameSiteLaxMode,
+		},
+		{
+			name:         "defaults over https",
+			configure:    func(c *Config) {},
+			https:        true,
+			wantName:     "session_id",
+			wantPath:     "/",
+			wantSameSite: http.SameSiteLaxMode,
+			wantSecure:   true,
+		},
+		{
+			name: "custom attributes",
+			configure: func(c *Config) {
+				c.SessionCookieName = "app_session"
+				c.SessionCookiePath = "/app"
+				c.SessionCookieDomain = "example.com"
+				c.SessionCookieSameSite = http.SameSiteStrictMode
+				c.SessionCookieSecure = &secure
+			},
+			wantName:     "app_session",
+			wantPath:     "/app",
+			wantDomain:   "example.com",
+			wantSameSite: http.SameSiteStrictMode,
+			wantSecure:   true,
+		},
+		{
+			name: "Secure disabled",
+			configure: func(c *Config) {
+				c.SessionCookieSecure = &insecure
+			},
+			https:        true,
+			wantName:     "session_id",
+			wantPath:     "/",
+			wantSameSite: http.SameSiteLaxMode,
+		},
+		{
+			name: "SameSite=None forces Secure",
+			configure: func(c *Config) {
+				c.SessionCookieSameSite = http.SameSiteNoneMode
+				c.SessionCookieSecure = &insecure
+			},
+			wantName:     "session_id",
+			wantPath:     "/",
+			wantSameSite: http.SameSiteNoneMode,
+			wantSecure:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, func(c *Config) {
+				c.SessionCookieEnabled = true
+				c.SessionCookieName = ""
+				c.SessionCookiePath = ""
+				c.SessionCookieDomain = ""
+				c.SessionCookieSameSite = http.SameSiteDefaultMode
+				c.SessionCookieSecure = nil
+				tt.configure(c)
+			})
+			signUp(t, a, "jane@example.com")
+
+			body := fmt.Sprintf(`{"email": "jane@example.com", "password": %q}`, testPassword)
+			signIn := newTestContext(http.MethodPost, "/auth/signin", body)
+			if tt.https {
+				signIn.request.TLS = &tls.ConnectionState{}
+			}
+			serve(t, signIn, h.SignInHandler)
+			if signIn.status() != http.StatusOK {
+				t.Fatalf("sign-in status = %d", signIn.status())
+			}
+
+			cookie := signIn.cookie(tt.wantName)
+			if cookie == nil || cookie.Value == "" {
+				t.Fatalf("no %s cookie set", tt.wantName)
+			}
+			if cookie.Path != tt.wantPath || cookie.Domain != tt.wantDomain || cookie.SameSite != tt.wantSameSite ||
+				cookie.Secure != tt.wantSecure || !cookie.HttpOnly {
+				t.Errorf("cookie = %+v", cookie)
+			}
+
+			// SessionMiddleware reads the session from the same cookie
+			exchange := newTestContext(http.MethodPost, "/auth/session/token", "")
+			exchange.request.AddCookie(&http.Cookie{Name: tt.wantName, Value: cookie.Value})
+			serve(t, exchange, h.SessionTokenHandler, h.SessionMiddleware())
+			if exchange.status() != http.StatusOK {
+				t.Errorf("session exchange status = %d, want %d", exchange.status(), http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestSessionMiddlewareCookieName(t *testing.T) {
+	h, a := newTestHandlers(t, func(c *Config) { c.SessionCookieName = "app_session" })
+	sessionID := signUp(t, a, "jane@example.com").SessionID
+
+	tests := []struct {
+		name       string
+		cookie     *http.Cookie
+		wantStatus int
+	}{
+		{name: "configured name", cookie: &http.Cookie{Name: "app_session", Value: sessionID}, wantStatus: http.StatusOK},
+		{name: "default name", cookie: &http.Cookie{Name: "session_id", Value: sessionID}, wantStatus: http.StatusUnauthorized},
+		{name: "unknown session", cookie: &http.Cookie{Name: "app_session", Value: "unknown"}, wantStatus: http.StatusUnauthorized},
+		{name: "no cookie", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodGet, "/dashboard", "")
+			if tt.cookie != nil {
+				ctx.request.AddCookie(tt.cookie)
+			}
+			serve(t, ctx, func(ctx HTTPContext) error { return ctx.String(http.StatusOK, "ok") }, h.SessionMiddleware())
+
+			if ctx.status() != tt.wantStatus {
+				t.Errorf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestIsSecureRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		tls            bool
+		fromProxy      bool
+		forwardedProto string
+		want           bool
+	}{
+		{name: "plain http"},
+		{name: "direct https", tls: true, want: true},
+		{name: "https behind a proxy", fromProxy: true, forwardedProto: "https", want: true},
+		{name: "proxy chain starting with https", fromProxy: true, forwardedProto: "https, http", want: true},
+		{name: "uppercase proto", fromProxy: true, forwardedProto: " HTTPS ", want: true},
+		{name: "http behind a proxy", fromProxy: true, forwardedProto: "http"},
+		{name: "proxy chain starting with http", fromProxy: true, forwardedProto: "http, https"},
+		{name: "https from an untrusted peer", forwardedProto: "https"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, func(c *Config) {
+				if tt.fromProxy {
+					c.TrustedProxies = []string{"10.0.0.0/8"}
+				}
+			})
+			ctx := newTestContext(http.MethodGet, "/", "")
+			ctx.request.RemoteAddr = "10.1.2.3:4321"
+			if tt.tls {
+				ctx.request.TLS = &tls.ConnectionState{}
+			}
+			if tt.forwardedProto != "" {
+				ctx.request.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+
+			if got := h.isSecureRequest(ctx); got != tt.want {
+				t.Errorf("isSecureRequest() = %v, want %v", got, tt.want)
+			}
+
+			// The session cookie follows the scheme unless overridden
+			if cookie := h.newSessionCookie(ctx, "id", 60); cookie.Secure != tt.want {
+				t.Errorf("session cookie Secure = %v, want %v", cookie.Secure, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenHandlerDelivery(t *testing.T) {
+	tests := []struct {
+		name       string
+		delivery   string
+		inBody     bool
+		inCookie   bool
+		wantStatus int
+		wantBody   bool // refresh token in the response body
+		wantCookie bool // refresh token cookie set
+	}{
+		{name: "body mode from body", delivery: RefreshTokenDeliveryBody, inBody: true, wantStatus: http.StatusOK, wantBody: true},
+		{name: "body mode ignores cookie", delivery: RefreshTokenDeliveryBody, inCookie: true, wantStatus: http.StatusBadRequest},
+		{name: "both from body", delivery: RefreshTokenDeliveryBoth, inBody: true, wantStatus: http.StatusOK, wantBody: true, wantCookie: true},
+		{name: "both from cookie", delivery: RefreshTokenDeliveryBoth, inCookie: true, wantStatus: http.StatusOK, wantBody: true, wantCookie: true},
+		{name: "cookie mode from cookie", delivery: RefreshTokenDeliveryCookie, inCookie: true, wantStatus: http.StatusOK, wantCookie: true},
+		{name: "cookie mode ignores body", delivery: RefreshTokenDeliveryCookie, inBody: true, wantStatus: http.StatusBadRequest},
+		{name: "no refresh token", delivery: RefreshTokenDeliveryBoth, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, func(c *Config) {
+				c.RefreshTokenDelivery = tt.delivery
+				c.RefreshCookieName = "app_refresh"
+				c.RotateRefreshTokens = true
+				c.RefreshTokenGracePeriod = 0
+			})
+			refreshToken := signUp(t, a, "jane@example.com").RefreshToken
+
+			body := ""
+			if tt.inBody {
+				body = `{"refresh_token": "` + refreshToken + `"}`
+			}
+			ctx := newTestContext(http.MethodPost, "/auth/refresh", body)
+			if tt.inCookie {
+				ctx.request.AddCookie(&http.Cookie{Name: "app_refresh", Value: refreshToken})
+			}
+			serve(t, ctx, h.RefreshTokenHandler)
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %v", ctx.status(), tt.wantStatus, ctx.body(t))
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			rotated, _ := ctx.body(t)["refresh_token"].(string)
+			if (rotated != "") != tt.wantBody {
+				t.Errorf("refresh token in body = %v, want %v", rotated != "", tt.wantBody)
+			}
+			cookie := ctx.cookie("app_refresh")
+			if (cookie != nil) != tt.wantCookie {
+				t.Fatalf("refresh cookie set = %v, want %v", cookie != nil, tt.wantCookie)
+			}
+			if cookie == nil {
+				return
+			}
+			if cookie.Value == refreshToken || !cookie.HttpOnly {
+				t.Errorf("refresh cookie = %+v, want the rotated token, HttpOnly", cookie)
+			}
+			if tt.wantBody && cookie.Value != rotated {
+				t.Errorf("cookie and body carry different refresh tokens")
+			}
+		})
+	}
+}
+
+func TestLoginRefreshTokenDelivery(t *testing.T) {
+	tests := []struct {
+		name       string
+		delivery   string
+		cookieName string
+		wantBody   bool // refresh token in the response body
+		wantCookie string
+	}{
+		{name: "default", wantBody: true},
+		{name: "body", delivery: RefreshTokenDeliveryBody, wantBody: true},
+		{name: "cookie", delivery: RefreshTokenDeliveryCookie, wantCookie: "refresh_token"},
+		{name: "both", delivery: RefreshTokenDeliveryBoth, wantBody: true, wantCookie: "refresh_token"},
+		{name: "cookie name implies both", cookieName: "app_refresh", wantBody: true, wantCookie: "app_refresh"},
+		{name: "cookie with custom name", delivery: RefreshTokenDeliveryCookie, cookieName: "app_refresh", wantCookie: "app_refresh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, func(c *Config) {
+				c.RefreshTokenDelivery = tt.delivery
+				c.RefreshCookieName = tt.cookieName
+			})
+
+			ctx := newTestContext(http.MethodPost, "/auth/signup", signUpBody("jane@example.com", 0))
+			serve(t, ctx, h.SignUpHandler)
+			if ctx.status() != http.StatusCreated {
+				t.Fatalf("status = %d, want %d: %v", ctx.status(), http.StatusCreated, ctx.body(t))
+			}
+
+			body := ctx.body(t)
+			if body["access_token"] == nil {
+				t.Error("access token missing from body")
+			}
+			if _, ok := body["refresh_token"]; ok != tt.wantBody {
+				t.Errorf("refresh token in body = %v, want %v", ok, tt.wantBody)
+			}
+			for _, name := range []string{"refresh_token", "app_refresh"} {
+				cookie := ctx.cookie(name)
+				if want := name == tt.wantCookie; (cookie != nil) != want {
+					t.Fatalf("%s cookie set = %v, want %v", name, cookie != nil, want)
+				}
+				if cookie != nil && (cookie.Value == "" || !cookie.HttpOnly) {
+					t.Errorf("%s cookie = %+v, want a refresh token, HttpOnly", name, cookie)
+				}
+			}
+		})
+	}
+}
+
+func TestPartitionedCookies(t *testing.T) {
+	insecure := false
+
+	tests := []struct {
+		name            string
+		partitioned     bool
+		wantPartitioned bool
+		wantSameSite    string
+		wantSecure      bool
+	}{
+		{name: "partitioned", partitioned: true, wantPartitioned: true, wantSameSite: "SameSite=None", wantSecure: true},
+		{name: "not partitioned", wantSameSite: "SameSite=Strict"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, func(c *Config) {
+				c.PartitionedCookies = tt.partitioned
+				c.SessionCookieSameSite = http.SameSiteStrictMode
+				c.SessionCookieSecure = &insecure
+				c.RefreshTokenDelivery = RefreshTokenDeliveryCookie
+			})
+
+			ctx := newTestContext(http.MethodPost, "/auth/signup", signUpBody("jane@example.com", 0))
+			serve(t, ctx, h.SignUpHandler)
+
+			header := ctx.recorder.Header().Values("Set-Cookie")
+			if len(header) == 0 {
+				t.Fatalf("no cookies set")
+			}
+			for _, value := range header {
+				if got := strings.HasSuffix(value, "; Partitioned"); got != tt.wantPartitioned {
+					t.Errorf("Set-Cookie = %q, want Partitioned %v", value, tt.wantPartitioned)
+				}
+				if !strings.Contains(value, tt.wantSameSite) {
+					t.Errorf("Set-Cookie = %q, want %s", value, tt.wantSameSite)
+				}
+				if got := strings.Contains(value, "; Secure"); got != tt.wantSecure {
+					t.Errorf("Set-Cookie = %q, want Secure %v", value, tt.wantSecure)
+				}
+			}
+		})
+	}
+}
+
+func TestCookieHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		want   string
+	}{
+		{name: "plain cookie", cookie: &http.Cookie{Name: "a", Value: "b"}, want: "a=b"},
+		{name: "partitioned cookie", cookie: &http.Cookie{Name: "a", Value: "b", Unparsed: []string{partitionedAttribute}}, want: "a=b; Partitioned"},
+		{name: "invalid cookie", cookie: &http.Cookie{Name: "bad name", Value: "b", Unparsed: []string{partitionedAttribute}}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CookieHeader(tt.cookie); got != tt.want {
+				t.Errorf("CookieHeader() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionTokenHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		withRefresh bool
+		// cookie returns the session cookie value to send, or "" for none
+		cookie      func(t *testing.T, a *AuthService, response *AuthResponse) string
+		wantStatus  int
+		wantRefresh bool
+	}{
+		{
+			name:       "valid session",
+			cookie:     func(t *testing.T, a *AuthService, response *AuthResponse) string { return response.SessionID },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "valid session with refresh",
+			withRefresh: true,
+			cookie:      func(t *testing.T, a *AuthService, response *AuthResponse) string { return response.SessionID },
+			wantStatus:  http.StatusOK,
+			wantRefresh: true,
+		},
+		{
+			name: "ended session",
+			cookie: func(t *testing.T, a *AuthService, response *AuthResponse) string {
+				if err := a.Logout(context.Background(), response.SessionID); err != nil {
+					t.Fatalf("Logout() error = %v", err)
+				}
+				return response.SessionID
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown session",
+			cookie:     func(t *testing.T, a *AuthService, response *AuthResponse) string { return "not-a-session" },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "no cookie",
+			cookie:     func(t *testing.T, a *AuthService, response *AuthResponse) string { return "" },
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, func(c *Config) {
+				c.SessionTokenRefresh = tt.withRefresh
+				c.BindTokenToSession = true
+			})
+			response := signUp(t, a, "jane@example.com")
+
+			ctx := newTestContext(http.MethodPost, "/auth/session/token", "")
+			if value := tt.cookie(t, a, response); value != "" {
+				ctx.request.AddCookie(&http.Cookie{Name: "session_id", Value: value})
+			}
+			serve(t, ctx, h.SessionTokenHandler, h.SessionMiddleware())
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			body := ctx.body(t)
+			if _, ok := body["refresh_token"].(string); ok != tt.wantRefresh {
+				t.Errorf("refresh token returned = %v, want %v", ok, tt.wantRefresh)
+			}
+
+			// The token authenticates API calls as the session's user, and
+			// ends with the session
+			token, _ := body["access_token"].(string)
+			claims, err := a.ValidateTokenContext(context.Background(), token)
+			if err != nil {
+				t.Fatalf("ValidateTokenContext() error = %v", err)
+			}
+			if claims.UserID != response.User.ID || claims.SessionID != response.SessionID {
+				t.Errorf("claims = %+v, want user %s in session %s", claims, response.User.ID, response.SessionID)
+			}
+			me := newTestContext(http.MethodGet, "/auth/me", "").withBearer(token)
+			serve(t, me, h.MeHandler, h.AuthMiddleware())
+			if me.status() != http.StatusOK {
+				t.Errorf("MeHandler() with the exchanged token status = %d", me.status())
+			}
+			if err := a.Logout(context.Background(), response.SessionID); err != nil {
+				t.Fatalf("Logout() error = %v", err)
+			}
+			if _, err := a.ValidateTokenContext(context.Background(), token); err == nil {
+				t.Errorf("exchanged token outlived its session")
+			}
+		})
+	}
+}
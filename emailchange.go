@@ -0,0 +1,288 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EmailChangeSender delivers the token confirming an email change to the new
+// address, typically as a link to a page that posts it to /auth/email/confirm
+type EmailChangeSender interface {
+	SendEmailChange(ctx context.Context, user *User, newEmail, token string) error
+}
+
+// EmailAddSender may be implemented by an EmailChangeSender to word the
+// message confirming an address added with AuthService.AddEmail differently.
+// The token is confirmed through /auth/email/confirm as well.
+type EmailAddSender interface {
+	SendEmailAdd(ctx context.Context, user *User, email, token string) error
+}
+
+// pendingEmailChange is an email change waiting for the new address to be verified
+type pendingEmailChange struct {
+	UserID    string    `json:"user_id"`
+	OldEmail  string    `json:"old_email"`
+	NewEmail  string    `json:"new_email"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Secondary adds NewEmail as a secondary address instead of replacing
+	// the primary one
+	Secondary bool `json:"secondary,omitempty"`
+}
+
+const emailChangePrefix = "email_change"
+
+// RequestEmailChange starts changing a user's email. The change is applied
+// by ConfirmEmailChange once the token sent to the new address is used.
+func (a *AuthService) RequestEmailChange(ctx context.Context, userID, newEmail string) error {
+	sender := a.config.EmailChangeSender
+	if sender == nil {
+		return fmt.Errorf("email change is not configured")
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	if newEmail == "" || !strings.Contains(newEmail, "@") {
+		return fmt.Errorf("a valid email is required")
+	}
+
+	user, err := a.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(user.Email, newEmail) {
+		return fmt.Errorf("new email is the same as the current email")
+	}
+
+	exists, err := a.userStore.UserExists(ctx, newEmail)
+	if err != nil {
+		return fmt.Errorf("failed to check user existence: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("email is already in use")
+	}
+
+	return a.sendEmailChange(ctx, user, &pendingEmailChange{
+		UserID:   user.ID,
+		OldEmail: user.Email,
+		NewEmail: newEmail,
+	})
+}
+
+// sendEmailChange stores a pending email change and sends its token to the
+// new address
+func (a *AuthService) sendEmailChange(ctx context.Context, user *User, change *pendingEmailChange) error {
+	expiration := a.config.VerificationTokenExpiration
+	change.ExpiresAt = time.Now().Add(expiration)
+
+	token := generateRandomString(32)
+	key := fmt.Sprintf("%s:%s", emailChangePrefix, token)
+	if err := a.sessionStore.Set(ctx, key, change, expiration); err != nil {
+		return fmt.Errorf("failed to store email change: %w", err)
+	}
+
+	sender := a.config.EmailChangeSender
+	var err error
+	if addSender, ok := sender.(EmailAddSender); ok && change.Secondary {
+		err = addSender.SendEmailAdd(ctx, user, change.NewEmail, token)
+	} else {
+		err = sender.SendEmailChange(ctx, user, change.NewEmail, token)
+	}
+	if err != nil {
+		a.sessionStore.Delete(ctx, key)
+		return fmt.Errorf("failed to send email change verification: %w", err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange applies a pending email change, marks the new address
+// as verified and revokes all of the user's sessions and tokens
+func (a *AuthService) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	key := fmt.Sprintf("%s:%s", emailChangePrefix, token)
+
+	// Tokens are single use
+	var change pendingEmailChange
+	if err := consumeKey(ctx, a.sessionStore, key, &change); err != nil {
+		return nil, fmt.Errorf("email change not found or expired")
+	}
+
+	if time.Now().After(change.ExpiresAt) {
+		return nil, fmt.Errorf("email change expired")
+	}
+
+	user, err := a.GetUser(ctx, change.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if change.Secondary {
+		return a.confirmEmailAdd(ctx, user, change.NewEmail)
+	}
+
+	// The email changed again since the request
+	if user.Email != change.OldEmail {
+		return nil, fmt.Errorf("email change is no longer valid")
+	}
+
+	// The address may have been registered since the request
+	exists, err := a.userStore.UserExists(ctx, change.NewEmail)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %w", err)
+	}
+	if exists {
+		return nil, fmt.Errorf("email is already in use")
+	}
+
+	user.Email = change.NewEmail
+	user.EmailVerified = true
+	user.UpdatedAt = time.Now()
+
+	if err := a.userStore.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to change email: %w", err)
+	}
+
+	a.audit(ctx, AuditEmailChange, user.ID, user.Email, nil)
+
+	// The login identity changed: require signing in again everywhere
+	if err := a.RevokeAllUserCredentials(ctx, user.ID); err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+// AddEmail starts adding a secondary email address to a user. The address is
+// added by ConfirmEmailChange once the token sent to it is used, after which
+// the user can sign in with it.
+func (a *AuthService) AddEmail(ctx context.Context, userID, email string) error {
+	if a.config.EmailChangeSender == nil {
+		return fmt.Errorf("email change is not configured")
+	}
+
+	email = strings.TrimSpace(email)
+	if email == "" || !strings.Contains(email, "@") {
+		return fmt.Errorf("a valid email is required")
+	}
+
+	user, err := a.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.HasEmail(email) {
+		return fmt.Errorf("email is already added to this account")
+	}
+
+	exists, err := a.userStore.UserExists(ctx, email)
+	if err != nil {
+		return fmt.Errorf("failed to check user existence: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("email is already in use")
+	}
+
+	return a.sendEmailChange(ctx, user, &pendingEmailChange{
+		UserID:    user.ID,
+		OldEmail:  user.Email,
+		NewEmail:  email,
+		Secondary: true,
+	})
+}
+
+// confirmEmailAdd adds a verified secondary email to the user
+func (a *AuthService) confirmEmailAdd(ctx context.Context, user *User, email string) (*User, error) {
+	if user.HasEmail(email) {
+		return user, nil
+	}
+
+	// The address may have been registered since the request
+	exists, err := a.userStore.UserExists(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %w", err)
+	}
+	if exists {
+		return nil, fmt.Errorf("email is already in use")
+	}
+
+	user.SecondaryEmails = append(user.SecondaryEmails, email)
+	user.UpdatedAt = time.Now()
+
+	if err := a.userStore.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to add email: %w", err)
+	}
+
+	a.audit(ctx, AuditEmailAdded, user.ID, email, nil)
+	return user, nil
+}
+
+// RemoveEmail removes a secondary email address from a user. The primary
+// address cannot be removed; make another address primary first.
+func (a *AuthService) RemoveEmail(ctx context.Context, userID, email string) (*User, error) {
+	user, err := a.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(user.Email, email) {
+		return nil, fmt.Errorf("the primary email cannot be removed")
+	}
+
+	i := secondaryEmailIndex(user, email)
+	if i < 0 {
+		return nil, fmt.Errorf("email is not added to this account")
+	}
+	removed := user.SecondaryEmails[i]
+	user.SecondaryEmails = append(user.SecondaryEmails[:i], user.SecondaryEmails[i+1:]...)
+	user.UpdatedAt = time.Now()
+
+	if err := a.userStore.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to remove email: %w", err)
+	}
+
+	a.audit(ctx, AuditEmailRemoved, user.ID, removed, nil)
+	return user, nil
+}
+
+// SetPrimaryEmail makes one of a user's secondary emails the primary address.
+// The previous primary address stays a secondary one if it was verified.
+func (a *AuthService) SetPrimaryEmail(ctx context.Context, userID, email string) (*User, error) {
+	user, err := a.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(user.Email, email) {
+		return user, nil
+	}
+
+	i := secondaryEmailIndex(user, email)
+	if i < 0 {
+		return nil, fmt.Errorf("email must be added to the account first")
+	}
+
+	primary := user.SecondaryEmails[i]
+	if user.EmailVerified {
+		user.SecondaryEmails[i] = user.Email
+	} else {
+		user.SecondaryEmails = append(user.SecondaryEmails[:i], user.SecondaryEmails[i+1:]...)
+	}
+	user.Email = primary
+	user.EmailVerified = true
+	user.UpdatedAt = time.Now()
+
+	if err := a.userStore.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to change primary email: %w", err)
+	}
+
+	a.audit(ctx, AuditEmailChange, user.ID, user.Email, nil)
+	return user, nil
+}
+
+// secondaryEmailIndex returns the index of email in the user's secondary
+// emails, ignoring case, or -1
+func secondaryEmailIndex(user *User, email string) int {
+	for i, e := range user.SecondaryEmails {
+		if strings.EqualFold(e, email) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,262 @@
+package gotrust
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// recordingEmailChangeSender records email change tokens by new address
+type recordingEmailChangeSender struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func (s *recordingEmailChangeSender) SendEmailChange(ctx context.Context, user *User, newEmail, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokens == nil {
+		s.tokens = make(map[string]string)
+	}
+	s.tokens[newEmail] = token
+	return nil
+}
+
+func (s *recordingEmailChangeSender) token(email string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[email]
+}
+
+func TestRequestEmailChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		newEmail string
+		wantErr  bool
+	}{
+		{name: "available email", newEmail: "jane@example.org"},
+		{name: "taken email", newEmail: "john@example.com", wantErr: true},
+		{name: "same email", newEmail: "JANE@example.com", wantErr: true},
+		{name: "invalid email", newEmail: "jane", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingEmailChangeSender{}
+			a, _, _ := newTestService(t, func(c *Config) { c.EmailChangeSender = sender })
+			user := signUp(t, a, "jane@example.com").User
+			signUp(t, a, "john@example.com")
+
+			err := a.RequestEmailChange(context.Background(), user.ID, tt.newEmail)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RequestEmailChange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if sent := sender.token(tt.newEmail) != ""; sent == tt.wantErr {
+				t.Errorf("confirmation sent = %v, want %v", sent, !tt.wantErr)
+			}
+
+			// Nothing changes before the new address is verified
+			current, err := a.GetUser(context.Background(), user.ID)
+			if err != nil || current.Email != "jane@example.com" {
+				t.Errorf("GetUser() = %+v, %v before confirmation", current, err)
+			}
+		})
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	sender := &recordingEmailChangeSender{}
+	h, a := newTestHandlers(t, func(c *Config) { c.EmailChangeSender = sender })
+	ctx := context.Background()
+	response := signUp(t, a, "jane@example.com")
+
+	request := newTestContext(http.MethodPost, "/auth/email/change", `{"email": "jane@example.org"}`).withBearer(response.AccessToken)
+	serve(t, request, h.RequestEmailChangeHandler, h.AuthMiddleware())
+	if request.status() != http.StatusOK {
+		t.Fatalf("request status = %d", request.status())
+	}
+	token := sender.token("jane@example.org")
+
+	confirm := newTestContext(http.MethodPost, "/auth/email/confirm", `{"token": "`+token+`"}`)
+	serve(t, confirm, h.ConfirmEmailChangeHandler)
+	if confirm.status() != http.StatusOK {
+		t.Fatalf("confirm status = %d", confirm.status())
+	}
+
+	user, err := a.GetUser(ctx, response.User.ID)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if user.Email != "jane@example.org" || !user.EmailVerified {
+		t.Errorf("user after confirmation = %+v", user)
+	}
+
+	// The new address is the login identity
+	if _, err := a.SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword}); err == nil {
+		t.Errorf("SignIn() with the old email succeeded")
+	}
+
+	// Sessions and refresh tokens issued before the change are revoked
+	if _, err := a.GetSession(ctx, response.SessionID); err == nil {
+		t.Errorf("session survived the email change")
+	}
+	if _, err := a.RefreshToken(ctx, response.RefreshToken); err == nil {
+		t.Errorf("refresh token survived the email change")
+	}
+
+	if _, err := a.SignIn(ctx, &SignInRequest{Email: "jane@example.org", Password: testPassword}); err != nil {
+		t.Errorf("SignIn() with the new email error = %v", err)
+	}
+
+	// Tokens are single use
+	again := newTestContext(http.MethodPost, "/auth/email/confirm", `{"token": "`+token+`"}`)
+	serve(t, again, h.ConfirmEmailChangeHandler)
+	if again.status() != http.StatusBadRequest {
+		t.Errorf("reused token status = %d, want %d", again.status(), http.StatusBadRequest)
+	}
+}
+
+func TestConfirmEmailChangeTakenMeanwhile(t *testing.T) {
+	sender := &recordingEmailChangeSender{}
+	a, _, _ := newTestService(t, func(c *Config) { c.EmailChangeSender = sender })
+	user := signUp(t, a, "jane@example.com").User
+
+	if err := a.RequestEmailChange(context.Background(), user.ID, "jane@example.org"); err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+	signUp(t, a, "jane@example.org")
+
+	if _, err := a.ConfirmEmailChange(context.Background(), sender.token("jane@example.org")); err == nil {
+		t.Errorf("ConfirmEmailChange() took over an email registered since the request")
+	}
+}
+
+// addEmail adds and confirms a secondary email for the user
+func addEmail(t *testing.T, a *AuthService, sender *recordingEmailChangeSender, userID, email string) {
+	t.Helper()
+
+	if err := a.AddEmail(context.Background(), userID, email); err != nil {
+		t.Fatalf("AddEmail() error = %v", err)
+	}
+	if _, err := a.ConfirmEmailChange(context.Background(), sender.token(email)); err != nil {
+		t.Fatalf("ConfirmEmailChange() error = %v", err)
+	}
+}
+
+func TestAddEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   string
+		wantErr bool
+	}{
+		{name: "available email", email: "jane@work.example.com"},
+		{name: "owned by another user", email: "john@example.com", wantErr: true},
+		{name: "another user's secondary email", email: "john@work.example.com", wantErr: true},
+		{name: "own primary email", email: "JANE@example.com", wantErr: true},
+		{name: "invalid email", email: "jane", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingEmailChangeSender{}
+			a, _, _ := newTestService(t, func(c *Config) { c.EmailChangeSender = sender })
+			user := signUp(t, a, "jane@example.com").User
+			john := signUp(t, a, "john@example.com").User
+			addEmail(t, a, sender, john.ID, "john@work.example.com")
+
+			before := sender.token(tt.email)
+			err := a.AddEmail(context.Background(), user.ID, tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddEmail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if sent := sender.token(tt.email) != before; sent == tt.wantErr {
+				t.Errorf("confirmation sent = %v, want %v", sent, !tt.wantErr)
+			}
+
+			// The address is only added once it is verified
+			current, err := a.GetUser(context.Background(), user.ID)
+			if err != nil || len(current.SecondaryEmails) != 0 {
+				t.Errorf("GetUser() = %+v, %v before confirmation", current, err)
+			}
+		})
+	}
+}
+
+func TestSignInWithSecondaryEmail(t *testing.T) {
+	sender := &recordingEmailChangeSender{}
+	a, _, _ := newTestService(t, func(c *Config) { c.EmailChangeSender = sender })
+	ctx := context.Background()
+	user := signUp(t, a, "jane@example.com").User
+	addEmail(t, a, sender, user.ID, "jane@work.example.com")
+
+	tests := []struct {
+		name    string
+		email   string
+		wantErr bool
+	}{
+		{name: "primary email", email: "jane@example.com"},
+		{name: "secondary email", email: "jane@work.example.com"},
+		{name: "secondary email in another case", email: "Jane@Work.Example.com"},
+		{name: "unknown email", email: "jane@other.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := a.SignIn(ctx, &SignInRequest{Email: tt.email, Password: testPassword})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SignIn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && response.User.ID != user.ID {
+				t.Errorf("SignIn() user = %s, want %s", response.User.ID, user.ID)
+			}
+		})
+	}
+
+	// A secondary email cannot be used to register another account
+	if _, err := a.SignUp(ctx, &SignUpRequest{Email: "jane@work.example.com", Password: testPassword}); err == nil {
+		t.Errorf("SignUp() with another user's secondary email succeeded")
+	}
+}
+
+func TestRemoveAndSetPrimaryEmail(t *testing.T) {
+	sender := &recordingEmailChangeSender{}
+	a, _, _ := newTestService(t, func(c *Config) { c.EmailChangeSender = sender })
+	ctx := context.Background()
+	user := signUp(t, a, "jane@example.com").User
+	addEmail(t, a, sender, user.ID, "jane@work.example.com")
+	addEmail(t, a, sender, user.ID, "jane@home.example.com")
+
+	if _, err := a.RemoveEmail(ctx, user.ID, "jane@example.com"); err == nil {
+		t.Errorf("RemoveEmail() removed the primary email")
+	}
+	if _, err := a.RemoveEmail(ctx, user.ID, "jane@other.example.com"); err == nil {
+		t.Errorf("RemoveEmail() removed an email not on the account")
+	}
+	if _, err := a.SetPrimaryEmail(ctx, user.ID, "jane@other.example.com"); err == nil {
+		t.Errorf("SetPrimaryEmail() accepted an email not on the account")
+	}
+
+	updated, err := a.RemoveEmail(ctx, user.ID, "JANE@home.example.com")
+	if err != nil {
+		t.Fatalf("RemoveEmail() error = %v", err)
+	}
+	if updated.HasEmail("jane@home.example.com") {
+		t.Errorf("RemoveEmail() = %+v", updated)
+	}
+	if _, err := a.SignIn(ctx, &SignInRequest{Email: "jane@home.example.com", Password: testPassword}); err == nil {
+		t.Errorf("SignIn() with a removed email succeeded")
+	}
+
+	updated, err = a.SetPrimaryEmail(ctx, user.ID, "jane@work.example.com")
+	if err != nil {
+		t.Fatalf("SetPrimaryEmail() error = %v", err)
+	}
+	if updated.Email != "jane@work.example.com" || !updated.EmailVerified {
+		t.Errorf("SetPrimaryEmail() = %+v", updated)
+	}
+	if got := updated.HasEmail("jane@example.com"); got != user.EmailVerified {
+		t.Errorf("previous primary kept = %v, want %v", got, user.EmailVerified)
+	}
+}
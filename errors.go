@@ -0,0 +1,53 @@
+package gotrust
+
+import "errors"
+
+// Errors returned by SignUp and SignIn that callers may want to tell apart
+var (
+	// ErrSignupDisabled is returned when Config.AllowSignup is off
+	ErrSignupDisabled = errors.New("signup is disabled")
+	// ErrGuestsDisabled is returned by CreateGuest when
+	// Config.AllowGuestSessions is off
+	ErrGuestsDisabled = errors.New("guest sessions are disabled")
+	// ErrUserExists is returned when the email is already registered
+	ErrUserExists = errors.New("user already exists")
+	// ErrUserNotFound is returned, possibly wrapped, by UserStore lookups of
+	// users that do not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserDeleted is returned by RefreshToken when the token's user no
+	// longer exists; clients should discard their tokens and sign in again
+	ErrUserDeleted = errors.New("user no longer exists")
+	// ErrUserStoreUnavailable is returned by RefreshToken when the user could
+	// not be loaded because of a store error; clients may retry
+	ErrUserStoreUnavailable = errors.New("user store is unavailable")
+	// ErrCaptchaRequired is returned when a CAPTCHA verifier is configured
+	// and the request has no captcha_token
+	ErrCaptchaRequired = errors.New("captcha token is required")
+	// ErrCaptchaFailed is returned when the CAPTCHA token is rejected
+	ErrCaptchaFailed = errors.New("captcha verification failed")
+	// ErrPasswordMismatch is returned when Config.RequirePasswordConfirmation
+	// is set and the password confirmation is missing or differs
+	ErrPasswordMismatch = errors.New("password confirmation does not match")
+	// ErrBreachedPassword is returned when a new password appears in known
+	// data breaches
+	ErrBreachedPassword = errors.New("password has appeared in a data breach; choose a different password")
+	// ErrEmailNotVerified is returned when Config.EmailVerificationMode
+	// requires a verified email before signing in
+	ErrEmailNotVerified = errors.New("email address is not verified")
+	// ErrSessionUnavailable is returned when the session of a sign-in could
+	// not be created and Config.SessionCreationRequired is set
+	ErrSessionUnavailable = errors.New("failed to create session")
+	// ErrProviderUnavailable is returned by OAuth sign-in while the
+	// provider's circuit breaker is open after repeated failures
+	ErrProviderUnavailable = errors.New("oauth provider is unavailable")
+	// ErrHashingBusy is returned when a password could not be hashed or
+	// checked because Config.MaxConcurrentHashes operations stayed busy for
+	// Config.HashQueueTimeout
+	ErrHashingBusy = errors.New("server is busy, please try again")
+	// ErrUnknownProvider is returned for OAuth provider names GoTrust does
+	// not support
+	ErrUnknownProvider = errors.New("unsupported oauth provider")
+	// ErrInvalidAuthParam is returned for optional OAuth authorization params
+	// the provider does not accept, or with invalid values
+	ErrInvalidAuthParam = errors.New("invalid oauth authorization param")
+)
@@ -59,7 +59,7 @@ func (s *InMemoryUserStore) GetUserByID(ctx context.Context, userID string) (*go
 			return user, nil
 		}
 	}
-	return nil, fmt.Errorf("user not found")
+	return nil, gotrust.ErrUserNotFound
 }
 
 func (s *InMemoryUserStore) UpdateUser(ctx context.Context, user *gotrust.User) error {
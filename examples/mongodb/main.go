@@ -19,6 +19,7 @@ import (
 type mongoUser struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty"`
 	Email     string             `bson:"email"`
+	Emails    []string           `bson:"emails"` // primary and secondary addresses
 	Name      string             `bson:"name"`
 	AvatarURL string             `bson:"avatar_url,omitempty"`
 	Provider  string             `bson:"provider"`
@@ -35,9 +36,9 @@ type MongoUserStore struct {
 func NewMongoUserStore(db *mongo.Database) (*MongoUserStore, error) {
 	collection := db.Collection("users")
 
-	// Create unique index on email
+	// Create unique index on all of a user's emails
 	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "email", Value: 1}},
+		Keys:    bson.D{{Key: "emails", Value: 1}},
 		Options: options.Index().SetUnique(true),
 	}
 	
@@ -55,6 +56,7 @@ func (s *MongoUserStore) CreateUser(ctx context.Context, user *gotrust.User, has
 	doc := mongoUser{
 		ID:        primitive.NewObjectID(),
 		Email:     user.Email,
+		Emails:    append([]string{user.Email}, user.SecondaryEmails...),
 		Name:      user.Name,
 		AvatarURL: user.AvatarURL,
 		Provider:  user.Provider,
@@ -78,7 +80,7 @@ func (s *MongoUserStore) CreateUser(ctx context.Context, user *gotrust.User, has
 func (s *MongoUserStore) GetUserByEmail(ctx context.Context, email string) (*gotrust.User, string, error) {
 	var doc mongoUser
 	
-	err := s.collection.FindOne(ctx, bson.M{"email": email}).Decode(&doc)
+	err := s.collection.FindOne(ctx, bson.M{"emails": email}).Decode(&doc)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, "", fmt.Errorf("user not found")
@@ -89,6 +91,7 @@ func (s *MongoUserStore) GetUserByEmail(ctx context.Context, email string) (*got
 	user := &gotrust.User{
 		ID:        doc.ID.Hex(),
 		Email:     doc.Email,
+		SecondaryEmails: secondaryEmails(doc),
 		Name:      doc.Name,
 		AvatarURL: doc.AvatarURL,
 		Provider:  doc.Provider,
@@ -109,7 +112,7 @@ func (s *MongoUserStore) GetUserByID(ctx context.Context, userID string) (*gotru
 	err = s.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&doc)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("user not found")
+			return nil, gotrust.ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -117,6 +120,7 @@ func (s *MongoUserStore) GetUserByID(ctx context.Context, userID string) (*gotru
 	return &gotrust.User{
 		ID:        doc.ID.Hex(),
 		Email:     doc.Email,
+		SecondaryEmails: secondaryEmails(doc),
 		Name:      doc.Name,
 		AvatarURL: doc.AvatarURL,
 		Provider:  doc.Provider,
@@ -133,6 +137,8 @@ func (s *MongoUserStore) UpdateUser(ctx context.Context, user *gotrust.User) err
 
 	update := bson.M{
 		"$set": bson.M{
+			"email":      user.Email,
+			"emails":     append([]string{user.Email}, user.SecondaryEmails...),
 			"name":       user.Name,
 			"avatar_url": user.AvatarURL,
 			"updated_at": time.Now(),
@@ -141,6 +147,9 @@ func (s *MongoUserStore) UpdateUser(ctx context.Context, user *gotrust.User) err
 
 	result, err := s.collection.UpdateByID(ctx, objectID, update)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("email is already in use")
+		}
 		return err
 	}
 
@@ -152,13 +161,24 @@ func (s *MongoUserStore) UpdateUser(ctx context.Context, user *gotrust.User) err
 }
 
 func (s *MongoUserStore) UserExists(ctx context.Context, email string) (bool, error) {
-	count, err := s.collection.CountDocuments(ctx, bson.M{"email": email})
+	count, err := s.collection.CountDocuments(ctx, bson.M{"emails": email})
 	if err != nil {
 		return false, err
 	}
 	return count > 0, nil
 }
 
+// secondaryEmails returns the document's emails other than the primary one
+func secondaryEmails(doc mongoUser) []string {
+	var emails []string
+	for _, email := range doc.Emails {
+		if email != doc.Email {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
 func main() {
 	// MongoDB connection
 	mongoURI := "mongodb://localhost:27017"
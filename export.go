@@ -0,0 +1,70 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ExportUserData gathers what GoTrust keeps about a user, e.g. to answer a
+// GDPR data access request: the user record, linked OAuth identities, active
+// sessions and refresh tokens, and audit events when Config.AuditStore is
+// set. Password hashes, session IDs and token claims are never included.
+func (a *AuthService) ExportUserData(ctx context.Context, userID string) (map[string]interface{}, error) {
+	user, err := a.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := a.sessionManager.ListUserSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	refreshTokens, err := a.ListRefreshTokens(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refresh tokens: %w", err)
+	}
+
+	data := map[string]interface{}{
+		"exported_at":    time.Now().UTC(),
+		"user":           user,
+		"identities":     exportIdentities(user),
+		"sessions":       sessions,
+		"refresh_tokens": refreshTokens,
+	}
+
+	if a.config.AuditStore != nil {
+		events, err := a.config.AuditStore.Query(ctx, AuditFilter{UserID: userID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query audit log: %w", err)
+		}
+		if events == nil {
+			events = []AuditEvent{}
+		}
+		data["audit_events"] = events
+	}
+
+	return data, nil
+}
+
+// exportedIdentity is an OAuth provider the user signs in with
+type exportedIdentity struct {
+	Provider string `json:"provider"`
+	// Primary is set for the provider the user signed up with
+	Primary bool `json:"primary"`
+}
+
+// exportIdentities lists the user's OAuth identities, skipping password and
+// guest accounts
+func exportIdentities(user *User) []exportedIdentity {
+	identities := []exportedIdentity{}
+	if user.Provider != "" && user.Provider != string(ProviderLocal) && user.Provider != string(ProviderGuest) {
+		identities = append(identities, exportedIdentity{Provider: user.Provider, Primary: true})
+	}
+	for _, provider := range user.LinkedProviders {
+		if provider != user.Provider {
+			identities = append(identities, exportedIdentity{Provider: provider})
+		}
+	}
+	return identities
+}
@@ -0,0 +1,163 @@
+package gotrust
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportUserData(t *testing.T) {
+	tests := []struct {
+		name         string
+		auditStore   bool
+		wantSections []string
+		wantMissing  []string
+	}{
+		{
+			name:         "with an audit store",
+			auditStore:   true,
+			wantSections: []string{"exported_at", "user", "identities", "sessions", "refresh_tokens", "audit_events"},
+		},
+		{
+			name:         "without an audit store",
+			wantSections: []string{"exported_at", "user", "identities", "sessions", "refresh_tokens"},
+			wantMissing:  []string{"audit_events"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, users, _ := newTestService(t, func(c *Config) {
+				if tt.auditStore {
+					c.AuditStore = NewMemoryAuditStore()
+				}
+			})
+			ctx := context.Background()
+			response := signUp(t, a, "jane@example.com")
+			sessionID, err := a.sessionManager.CreateSession(ctx, response.User.ID, "jane@example.com", time.Hour)
+			if err != nil {
+				t.Fatalf("CreateSession() error = %v", err)
+			}
+
+			data, err := a.ExportUserData(ctx, response.User.ID)
+			if err != nil {
+				t.Fatalf("ExportUserData() error = %v", err)
+			}
+
+			// Check the export as a client would receive it
+			raw, err := json.Marshal(data)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			var export map[string]interface{}
+			if err := json.Unmarshal(raw, &export); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			for _, section := range tt.wantSections {
+				if _, ok := export[section]; !ok {
+					t.Errorf("export is missing %q: %s", section, raw)
+				}
+			}
+			for _, section := range tt.wantMissing {
+				if _, ok := export[section]; ok {
+					t.Errorf("export has %q: %s", section, raw)
+				}
+			}
+			if user, _ := export["user"].(map[string]interface{}); user["email"] != "jane@example.com" {
+				t.Errorf("user = %v", export["user"])
+			}
+			// Sign-up opened a session before the one created above
+			sessions, _ := data["sessions"].([]*SessionData)
+			if len(sessions) != 2 || !sessions[0].CreatedAt.After(sessions[1].CreatedAt) {
+				t.Errorf("sessions = %v, want 2, newest first", export["sessions"])
+			}
+
+			// No secrets leave in the export
+			_, passwordHash, err := users.GetUserByEmail(ctx, "jane@example.com")
+			if err != nil {
+				t.Fatalf("GetUserByEmail() error = %v", err)
+			}
+			secrets := map[string]string{
+				"password":      testPassword,
+				"password hash": passwordHash,
+				"access token":  response.AccessToken,
+				"session ID":    sessionID,
+			}
+			if response.RefreshToken != "" {
+				secrets["refresh token"] = response.RefreshToken
+			}
+			for name, secret := range secrets {
+				if strings.Contains(string(raw), secret) {
+					t.Errorf("export contains the %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestExportUserDataIdentities(t *testing.T) {
+	tests := []struct {
+		name string
+		user User
+		want string
+	}{
+		{name: "password account", user: User{Provider: string(ProviderLocal)}, want: "[]"},
+		{name: "guest account", user: User{Provider: string(ProviderGuest)}, want: "[]"},
+		{name: "OAuth account", user: User{Provider: "github"}, want: `[{"provider":"github","primary":true}]`},
+		{
+			name: "linked providers",
+			user: User{Provider: "github", LinkedProviders: []string{"github", "google"}},
+			want: `[{"provider":"github","primary":true},{"provider":"google","primary":false}]`,
+		},
+		{name: "password account with a link", user: User{LinkedProviders: []string{"gitlab"}}, want: `[{"provider":"gitlab","primary":false}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(exportIdentities(&tt.user))
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("exportIdentities() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportUserDataHandler(t *testing.T) {
+	h, a := newTestHandlers(t, nil)
+	response := signUp(t, a, "jane@example.com")
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "authenticated", token: response.AccessToken, wantStatus: http.StatusOK},
+		{name: "unauthenticated", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodGet, "/auth/account/export", "")
+			if tt.token != "" {
+				ctx = ctx.withBearer(tt.token)
+			}
+			serve(t, ctx, h.ExportUserDataHandler, h.AuthMiddleware())
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if user, _ := ctx.body(t)["user"].(map[string]interface{}); user["id"] != response.User.ID {
+				t.Errorf("user = %v", ctx.body(t)["user"])
+			}
+		})
+	}
+}
@@ -11,4 +11,5 @@ require (
 require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-)
\ No newline at end of file
+	golang.org/x/sys v0.16.0 // indirect
+)
@@ -0,0 +1,64 @@
+package gotrust
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const gracePrefix = "token_grace"
+
+// ValidateTokenWithGrace validates an access token like ValidateTokenContext,
+// but also accepts a token that expired less than Config.AccessTokenGracePeriod
+// ago, once. It is meant for the few routes a client calls to recover after
+// being offline, not for general authentication; see GraceAuthMiddleware.
+func (a *AuthService) ValidateTokenWithGrace(ctx context.Context, token string) (*TokenClaims, error) {
+	claims, err := a.ValidateTokenContext(ctx, token)
+	grace := a.config.AccessTokenGracePeriod
+	if err == nil || grace <= 0 || !errors.Is(err, jwt.ErrTokenExpired) {
+		return claims, err
+	}
+
+	claims, graceErr := a.jwtManager.validateToken(token, a.jwtManager.leeway+grace)
+	if graceErr != nil {
+		return nil, err
+	}
+	if err := a.checkTokenClaims(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	// Each expired token is only accepted once within the grace period
+	if !a.claimGraceUse(ctx, token, grace) {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// claimGraceUse records that an expired token was accepted, reporting false
+// if it already was
+func (a *AuthService) claimGraceUse(ctx context.Context, token string, ttl time.Duration) bool {
+	sum := sha256.Sum256([]byte(token))
+	key := fmt.Sprintf("%s:%s", gracePrefix, hex.EncodeToString(sum[:]))
+
+	if atomic, ok := a.sessionStore.(AtomicSessionStore); ok {
+		claimed, err := atomic.SetNX(ctx, key, true, ttl)
+		return err == nil && claimed
+	}
+
+	if exists, err := a.sessionStore.Exists(ctx, key); err != nil || exists {
+		return false
+	}
+	return a.sessionStore.Set(ctx, key, true, ttl) == nil
+}
+
+// GraceAuthMiddleware is AuthMiddleware accepting access tokens that expired
+// within Config.AccessTokenGracePeriod, once each. Mount it only on routes a
+// returning client needs before it can refresh.
+func (h *GenericAuthHandlers) GraceAuthMiddleware() HTTPMiddleware {
+	return h.authMiddleware(h.authService.ValidateTokenWithGrace)
+}
@@ -0,0 +1,107 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// tokenExpiredAgo returns an access token for userID that expired ago
+func tokenExpiredAgo(t *testing.T, a *AuthService, userID string, ago time.Duration) string {
+	t.Helper()
+
+	issued := time.Now().Add(-a.config.JWTExpiration - ago)
+	token, err := a.jwtManager.generateTokenAt(TokenClaims{UserID: userID, AuthTime: issued}, issued)
+	if err != nil {
+		t.Fatalf("generateTokenAt() error = %v", err)
+	}
+	return token
+}
+
+func TestValidateTokenWithGrace(t *testing.T) {
+	tests := []struct {
+		name        string
+		gracePeriod time.Duration
+		expiredAgo  time.Duration
+		wantErr     bool
+	}{
+		{name: "just expired within grace", gracePeriod: 2 * time.Minute, expiredAgo: 30 * time.Second},
+		{name: "expired beyond grace", gracePeriod: 2 * time.Minute, expiredAgo: 5 * time.Minute, wantErr: true},
+		{name: "grace disabled", expiredAgo: 30 * time.Second, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, func(c *Config) { c.AccessTokenGracePeriod = tt.gracePeriod })
+			ctx := context.Background()
+			userID := signUp(t, a, "jane@example.com").User.ID
+			token := tokenExpiredAgo(t, a, userID, tt.expiredAgo)
+
+			claims, err := a.ValidateTokenWithGrace(ctx, token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateTokenWithGrace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, jwt.ErrTokenExpired) {
+					t.Errorf("ValidateTokenWithGrace() error = %v, want ErrTokenExpired", err)
+				}
+				return
+			}
+			if claims.UserID != userID {
+				t.Errorf("claims.UserID = %q, want %q", claims.UserID, userID)
+			}
+
+			// The grace period is applied once per token, and never by the
+			// regular validation
+			if _, err := a.ValidateTokenWithGrace(ctx, token); !errors.Is(err, jwt.ErrTokenExpired) {
+				t.Errorf("second ValidateTokenWithGrace() error = %v, want ErrTokenExpired", err)
+			}
+			if _, err := a.ValidateTokenContext(ctx, tokenExpiredAgo(t, a, userID, tt.expiredAgo)); err == nil {
+				t.Errorf("ValidateTokenContext() accepted an expired token")
+			}
+		})
+	}
+}
+
+func TestValidateTokenWithGraceValidToken(t *testing.T) {
+	a, _, _ := newTestService(t, func(c *Config) { c.AccessTokenGracePeriod = 2 * time.Minute })
+	response := signUp(t, a, "jane@example.com")
+
+	// Unexpired tokens are not limited to one use
+	for i := 0; i < 2; i++ {
+		if _, err := a.ValidateTokenWithGrace(context.Background(), response.AccessToken); err != nil {
+			t.Fatalf("call %d: ValidateTokenWithGrace() error = %v", i, err)
+		}
+	}
+}
+
+func TestGraceAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		middleware func(h *GenericAuthHandlers) HTTPMiddleware
+		wantStatus int
+	}{
+		{name: "grace middleware", middleware: (*GenericAuthHandlers).GraceAuthMiddleware, wantStatus: http.StatusOK},
+		{name: "regular middleware", middleware: (*GenericAuthHandlers).AuthMiddleware, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, func(c *Config) { c.AccessTokenGracePeriod = 2 * time.Minute })
+			userID := signUp(t, a, "jane@example.com").User.ID
+
+			ctx := newTestContext(http.MethodPost, "/sync", "").withBearer(tokenExpiredAgo(t, a, userID, 30*time.Second))
+			serve(t, ctx, func(ctx HTTPContext) error {
+				return ctx.String(http.StatusOK, "ok")
+			}, tt.middleware(h))
+
+			if ctx.status() != tt.wantStatus {
+				t.Errorf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+		})
+	}
+}
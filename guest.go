@@ -0,0 +1,116 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ProviderGuest marks anonymous users created with CreateGuest
+const ProviderGuest OAuthProvider = "guest"
+
+// IsGuest reports whether the token belongs to a guest user
+func (c *TokenClaims) IsGuest() bool {
+	return c.Provider == string(ProviderGuest)
+}
+
+// IsGuest reports whether the authenticated user is a guest
+func IsGuest(ctx HTTPContext) bool {
+	claims, ok := GetClaims(ctx)
+	return ok && claims.IsGuest()
+}
+
+// CreateGuest creates an anonymous user without credentials and issues tokens
+// for it. The guest can later register with UpgradeGuest, keeping its ID.
+func (a *AuthService) CreateGuest(ctx context.Context) (*AuthResponse, error) {
+	if !a.config.AllowGuestSessions {
+		return nil, ErrGuestsDisabled
+	}
+
+	now := time.Now()
+	user := &User{
+		ID:        generateRandomString(16),
+		Provider:  string(ProviderGuest),
+		IsGuest:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// Guests have no password, so they can only use their tokens
+	if err := a.userStore.CreateUser(ctx, user, ""); err != nil {
+		return nil, fmt.Errorf("failed to create guest user: %w", err)
+	}
+
+	return a.generateAuthResponse(ctx, user)
+}
+
+// UpgradeGuest turns a guest into a regular email/password account with the
+// same user ID, so data owned by the guest is kept. The guest's existing
+// sessions and refresh tokens are revoked and new tokens are issued. The
+// UserStore must implement PasswordUpdater.
+func (a *AuthService) UpgradeGuest(ctx context.Context, guestUserID string, req *SignUpRequest) (*AuthResponse, error) {
+	if !a.config.AllowSignup {
+		return nil, ErrSignupDisabled
+	}
+
+	updater, ok := userStoreAs[PasswordUpdater](a.userStore)
+	if !ok {
+		return nil, fmt.Errorf("user store does not support upgrading guests")
+	}
+
+	user, err := a.userStore.GetUserByID(ctx, guestUserID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	if !user.IsGuest {
+		return nil, fmt.Errorf("user is not a guest")
+	}
+
+	exists, err := a.userStore.UserExists(ctx, req.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %w", err)
+	}
+	if exists {
+		return nil, ErrUserExists
+	}
+
+	if err := a.checkPasswordConfirmation(req); err != nil {
+		return nil, err
+	}
+	if err := a.CheckPassword(ctx, req.Password); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := a.hasher.Hash(req.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user.Email = req.Email
+	user.Name = req.Name
+	user.Provider = string(ProviderLocal)
+	user.IsGuest = false
+	user.UpdatedAt = time.Now()
+
+	if err := a.userStore.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to upgrade guest: %w", err)
+	}
+	if err := updater.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		return nil, fmt.Errorf("failed to set password: %w", err)
+	}
+
+	// Tokens issued to the guest still carry the guest provider
+	if err := a.RevokeAllUserCredentials(ctx, user.ID); err != nil {
+		logf(ctx, "Failed to revoke guest credentials: %v", err)
+	}
+
+	a.audit(ctx, AuditSignUp, user.ID, user.Email, nil)
+
+	if a.config.VerificationSender != nil {
+		if err := a.SendVerification(ctx, user); err != nil {
+			logf(ctx, "Failed to send verification email: %v", err)
+		}
+	}
+
+	return a.generateAuthResponse(ctx, user)
+}
@@ -0,0 +1,160 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGuestUpgrade(t *testing.T) {
+	h, a := newTestHandlers(t, func(c *Config) { c.AllowGuestSessions = true })
+
+	create := newTestContext(http.MethodPost, "/auth/guest", "")
+	serve(t, create, h.GuestHandler)
+	if create.status() != http.StatusCreated {
+		t.Fatalf("guest status = %d", create.status())
+	}
+	guest := create.body(t)
+	guestUser, _ := guest["user"].(map[string]interface{})
+	guestID, _ := guestUser["id"].(string)
+	guestToken, _ := guest["access_token"].(string)
+	if guestID == "" || guestUser["is_guest"] != true {
+		t.Fatalf("guest user = %v", guestUser)
+	}
+
+	// The middleware exposes that the current user is a guest
+	var isGuest bool
+	probe := newTestContext(http.MethodGet, "/cart", "").withBearer(guestToken)
+	serve(t, probe, func(ctx HTTPContext) error {
+		isGuest = IsGuest(ctx)
+		return ctx.String(http.StatusOK, "ok")
+	}, h.AuthMiddleware())
+	if !isGuest {
+		t.Errorf("IsGuest() = false for a guest token")
+	}
+
+	body := fmt.Sprintf(`{"email": "jane@example.com", "password": %q, "name": "Jane"}`, testPassword)
+	upgrade := newTestContext(http.MethodPost, "/auth/guest/upgrade", body).withBearer(guestToken)
+	serve(t, upgrade, h.UpgradeGuestHandler, h.AuthMiddleware())
+	if upgrade.status() != http.StatusOK {
+		t.Fatalf("upgrade status = %d: %v", upgrade.status(), upgrade.body(t))
+	}
+
+	upgraded, err := a.GetUser(context.Background(), guestID)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if upgraded.IsGuest || upgraded.Email != "jane@example.com" || upgraded.Provider != string(ProviderLocal) {
+		t.Errorf("upgraded user = %+v", upgraded)
+	}
+
+	// The account signs in with the same ID and is no longer a guest
+	response, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatalf("SignIn() error = %v", err)
+	}
+	if response.User.ID != guestID {
+		t.Errorf("upgraded user ID = %q, want the guest ID %q", response.User.ID, guestID)
+	}
+	claims, err := a.ValidateToken(response.AccessToken)
+	if err != nil || claims.IsGuest() {
+		t.Errorf("ValidateToken() = %+v, %v", claims, err)
+	}
+}
+
+func TestUpgradeGuestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, a *AuthService) string // returns the user ID to upgrade
+		email   string
+		wantErr error
+	}{
+		{
+			name: "registered user",
+			setup: func(t *testing.T, a *AuthService) string {
+				return signUp(t, a, "john@example.com").User.ID
+			},
+			email: "jane@example.com",
+		},
+		{
+			name: "email taken",
+			setup: func(t *testing.T, a *AuthService) string {
+				signUp(t, a, "jane@example.com")
+				guest, err := a.CreateGuest(context.Background())
+				if err != nil {
+					t.Fatalf("CreateGuest() error = %v", err)
+				}
+				return guest.User.ID
+			},
+			email:   "jane@example.com",
+			wantErr: ErrUserExists,
+		},
+		{
+			name:  "unknown user",
+			setup: func(t *testing.T, a *AuthService) string { return "unknown" },
+			email: "jane@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, func(c *Config) { c.AllowGuestSessions = true })
+			userID := tt.setup(t, a)
+
+			_, err := a.UpgradeGuest(context.Background(), userID, &SignUpRequest{Email: tt.email, Password: testPassword})
+			if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("UpgradeGuest() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// failingUserStore fails to create users, like a store that cannot be
+// reached
+type failingUserStore struct {
+	*MemoryUserStore
+}
+
+func (s failingUserStore) CreateUser(ctx context.Context, user *User, hashedPassword string) error {
+	return errors.New("connection refused")
+}
+
+func TestGuestHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowGuests bool
+		wantErr     error
+		wantStatus  int
+	}{
+		{name: "guest sessions disabled", wantErr: ErrGuestsDisabled, wantStatus: http.StatusForbidden},
+		{name: "user store failure", allowGuests: true, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestConfig()
+			config.AllowGuestSessions = tt.allowGuests
+			sessions := NewMemorySessionStore()
+			t.Cleanup(func() { sessions.Close() })
+			a := NewAuthService(config, failingUserStore{NewMemoryUserStore()}, sessions)
+
+			_, err := a.CreateGuest(context.Background())
+			if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("CreateGuest() error = %v, want %v", err, tt.wantErr)
+			}
+
+			ctx := newTestContext(http.MethodPost, "/auth/guest", "")
+			serve(t, ctx, NewGenericAuthHandlers(a, config).GuestHandler)
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			// Store errors are not passed on to the client
+			if message, _ := ctx.body(t)["error"].(string); strings.Contains(message, "connection refused") {
+				t.Errorf("error = %q", message)
+			}
+		})
+	}
+}
@@ -2,84 +2,216 @@ package gotrust
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // GenericAuthHandlers provides framework-agnostic HTTP handlers for authentication
 type GenericAuthHandlers struct {
-	authService *AuthService
-	config      *Config
+	authService    *AuthService
+	config         *Config
+	trustedProxies []*net.IPNet // parsed Config.TrustedProxies
 }
 
 // NewGenericAuthHandlers creates new framework-agnostic authentication handlers
 func NewGenericAuthHandlers(authService *AuthService, config *Config) *GenericAuthHandlers {
 	return &GenericAuthHandlers{
-		authService: authService,
-		config:      config,
+		authService:    authService,
+		config:         config,
+		trustedProxies: parseTrustedProxies(config.TrustedProxies),
 	}
 }
 
 // SignUpHandler handles user registration
 func (h *GenericAuthHandlers) SignUpHandler(ctx HTTPContext) error {
 	var req SignUpRequest
-	if err := ctx.Bind(&req); err != nil {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid request body",
-		})
+	if err := h.bindFormOrJSON(ctx, &req); err != nil {
+		return h.bindError(ctx, err)
 	}
 	
 	// Basic validation
 	if req.Email == "" || req.Password == "" {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Email and password are required",
-		})
+		return h.errorJSON(ctx, http.StatusBadRequest, "Email and password are required")
 	}
 	
 	if len(req.Password) < 6 {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Password must be at least 6 characters",
-		})
+		return h.errorJSON(ctx, http.StatusBadRequest, "Password must be at least 6 characters")
 	}
 	
 	// Sign up user
-	response, err := h.authService.SignUp(ctx.Context(), &req)
-	if err != nil {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{
-			"error": err.Error(),
+	response, err := h.authService.SignUp(h.requestContext(ctx), &req)
+	if errors.Is(err, ErrEmailNotVerified) {
+		// The account exists but cannot sign in until the email is verified
+		return h.writeJSON(ctx, http.StatusAccepted, map[string]string{
+			"message": "Check your email to verify your account",
 		})
 	}
+	if err != nil {
+		return h.signUpError(ctx, err)
+	}
+	
+	h.setAuthCookies(ctx, response)
+	return h.writeJSON(ctx, http.StatusCreated, response)
+}
+
+// GuestHandler creates an anonymous guest user
+func (h *GenericAuthHandlers) GuestHandler(ctx HTTPContext) error {
+	response, err := h.authService.CreateGuest(h.requestContext(ctx))
+	if errors.Is(err, ErrSessionUnavailable) {
+		return h.sessionUnavailable(ctx)
+	}
+	if errors.Is(err, ErrGuestsDisabled) {
+		return h.errorJSON(ctx, http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusInternalServerError, "Failed to create guest")
+	}
 	
-	return ctx.JSON(http.StatusCreated, response)
+	h.setAuthCookies(ctx, response)
+	return h.writeJSON(ctx, http.StatusCreated, response)
+}
+
+// UpgradeGuestHandler registers the authenticated guest with an email and
+// password, keeping its user ID
+func (h *GenericAuthHandlers) UpgradeGuestHandler(ctx HTTPContext) error {
+	userID, err := GetUserFromContext(ctx)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusUnauthorized, "User not authenticated")
+	}
+	
+	var req SignUpRequest
+	if err := h.bindFormOrJSON(ctx, &req); err != nil {
+		return h.bindError(ctx, err)
+	}
+	
+	if req.Email == "" || req.Password == "" {
+		return h.errorJSON(ctx, http.StatusBadRequest, "Email and password are required")
+	}
+	
+	if len(req.Password) < 6 {
+		return h.errorJSON(ctx, http.StatusBadRequest, "Password must be at least 6 characters")
+	}
+	
+	response, err := h.authService.UpgradeGuest(h.requestContext(ctx), userID, &req)
+	if err != nil {
+		return h.signUpError(ctx, err)
+	}
+	
+	h.setAuthCookies(ctx, response)
+	return h.writeJSON(ctx, http.StatusOK, response)
 }
 
 // SignInHandler handles user login
 func (h *GenericAuthHandlers) SignInHandler(ctx HTTPContext) error {
 	var req SignInRequest
-	if err := ctx.Bind(&req); err != nil {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid request body",
-		})
+	if err := h.bindFormOrJSON(ctx, &req); err != nil {
+		return h.bindError(ctx, err)
 	}
 	
 	// Basic validation
 	if req.Email == "" || req.Password == "" {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Email and password are required",
-		})
+		return h.errorJSON(ctx, http.StatusBadRequest, "Email and password are required")
 	}
 	
 	// Sign in user
-	response, err := h.authService.SignIn(ctx.Context(), &req)
+	response, err := h.authService.SignIn(h.requestContext(ctx), &req)
 	if err != nil {
-		return ctx.JSON(http.StatusUnauthorized, map[string]string{
-			"error": err.Error(),
-		})
+		if code := captchaErrorCode(err); code != "" {
+			return h.errorJSONCode(ctx, http.StatusBadRequest, code, err.Error())
+		}
+		if errors.Is(err, ErrEmailNotVerified) {
+			return h.errorJSONCode(ctx, http.StatusForbidden, "email_not_verified", err.Error())
+		}
+		if errors.Is(err, ErrSessionUnavailable) {
+			return h.sessionUnavailable(ctx)
+		}
+		if errors.Is(err, ErrHashingBusy) {
+			return h.hashingBusy(ctx)
+		}
+		return h.errorJSON(ctx, http.StatusUnauthorized, err.Error())
 	}
 	
-	return ctx.JSON(http.StatusOK, response)
+	h.setAuthCookies(ctx, response)
+	return h.writeJSON(ctx, http.StatusOK, response)
+}
+
+// ConfirmAccountLinkHandler completes a manual OAuth account link
+func (h *GenericAuthHandlers) ConfirmAccountLinkHandler(ctx HTTPContext) error {
+	var req struct {
+		LinkToken string `json:"link_token"`
+		SignInRequest
+	}
+	if err := h.bind(ctx, &req); err != nil {
+		return h.bindError(ctx, err)
+	}
+	
+	if req.LinkToken == "" || req.Email == "" || req.Password == "" {
+		return h.errorJSON(ctx, http.StatusBadRequest, "Link token, email and password are required")
+	}
+	
+	response, err := h.authService.ConfirmAccountLink(h.requestContext(ctx), req.LinkToken, &req.SignInRequest)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusUnauthorized, err.Error())
+	}
+	
+	h.setAuthCookies(ctx, response)
+	return h.writeJSON(ctx, http.StatusOK, response)
+}
+
+// VerifyEmailHandler confirms an email address with a verification token
+func (h *GenericAuthHandlers) VerifyEmailHandler(ctx HTTPContext) error {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := h.bind(ctx, &req); err != nil {
+		return h.bindError(ctx, err)
+	}
+	
+	if req.Token == "" {
+		return h.errorJSON(ctx, http.StatusBadRequest, "Verification token is required")
+	}
+	
+	if _, err := h.authService.VerifyEmail(h.requestContext(ctx), req.Token); err != nil {
+		return h.errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, map[string]string{
+		"message": "Email verified",
+	})
+}
+
+// ResendVerificationHandler sends a new verification email. It responds the
+// same way whether or not the email is registered.
+func (h *GenericAuthHandlers) ResendVerificationHandler(ctx HTTPContext) error {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := h.bind(ctx, &req); err != nil {
+		return h.bindError(ctx, err)
+	}
+	
+	if req.Email == "" {
+		return h.errorJSON(ctx, http.StatusBadRequest, "Email is required")
+	}
+	
+	if err := h.authService.ResendVerification(h.requestContext(ctx), req.Email); err != nil {
+		logf(h.requestContext(ctx), "Failed to resend verification: %v", err)
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, map[string]string{
+		"message": "If the email is registered and unverified, a verification link has been sent",
+	})
 }
 
 // RefreshTokenHandler handles token refresh
@@ -88,79 +220,397 @@ func (h *GenericAuthHandlers) RefreshTokenHandler(ctx HTTPContext) error {
 		RefreshToken string `json:"refresh_token"`
 	}
 	
-	if err := ctx.Bind(&req); err != nil {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid request body",
-		})
+	delivery := h.config.refreshTokenDelivery()
+	
+	// Cookie clients may send no body at all
+	if err := h.bind(ctx, &req); err != nil && !(errors.Is(err, io.EOF) && delivery != RefreshTokenDeliveryBody) {
+		return h.bindError(ctx, err)
+	}
+	
+	// In cookie-only mode the refresh token never leaves the cookie
+	if req.RefreshToken == "" || delivery == RefreshTokenDeliveryCookie {
+		req.RefreshToken = h.refreshTokenFromCookie(ctx)
 	}
 	
 	if req.RefreshToken == "" {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Refresh token is required",
-		})
+		return h.errorJSON(ctx, http.StatusBadRequest, "Refresh token is required")
 	}
 	
 	// Refresh token
-	response, err := h.authService.RefreshToken(ctx.Context(), req.RefreshToken)
+	response, err := h.authService.RefreshToken(h.requestContext(ctx), req.RefreshToken)
+	if errors.Is(err, ErrSessionUnavailable) {
+		return h.sessionUnavailable(ctx)
+	}
+	if errors.Is(err, ErrUserDeleted) {
+		h.clearRefreshCookie(ctx)
+		return h.errorJSONCode(ctx, http.StatusUnauthorized, "user_deleted", err.Error())
+	}
+	if errors.Is(err, ErrUserStoreUnavailable) {
+		ctx.SetHeader("Retry-After", "1")
+		return h.errorJSONCode(ctx, http.StatusServiceUnavailable, "store_unavailable", ErrUserStoreUnavailable.Error())
+	}
 	if err != nil {
-		return ctx.JSON(http.StatusUnauthorized, map[string]string{
-			"error": err.Error(),
-		})
+		return h.errorJSON(ctx, http.StatusUnauthorized, err.Error())
 	}
 	
-	return ctx.JSON(http.StatusOK, response)
+	h.deliverRefreshToken(ctx, response)
+	return h.writeJSON(ctx, http.StatusOK, response)
 }
 
 // LogoutHandler handles user logout
 func (h *GenericAuthHandlers) LogoutHandler(ctx HTTPContext) error {
-	// Get session ID from context (set by middleware)
+	// Get session ID from context (set by middleware), a session-bound token
+	// or the session cookie
 	sessionID, _ := ctx.Get("session_id").(string)
+	if claims, ok := GetClaims(ctx); ok && sessionID == "" {
+		sessionID = claims.SessionID
+	}
+	if cookieSessionID := h.sessionIDFromCookie(ctx); cookieSessionID != "" {
+		if sessionID == "" {
+			sessionID = cookieSessionID
+		}
+		h.clearSessionCookie(ctx)
+	}
+	h.clearRefreshCookie(ctx)
 	
 	// Logout
-	if err := h.authService.Logout(ctx.Context(), sessionID); err != nil {
+	if err := h.authService.Logout(h.requestContext(ctx), sessionID); err != nil {
 		// Log error but return success
-		fmt.Printf("Failed to logout: %v\n", err)
+		logf(h.requestContext(ctx), "Failed to logout: %v", err)
 	}
 	
-	return ctx.JSON(http.StatusOK, map[string]string{
+	return h.writeJSON(ctx, http.StatusOK, map[string]string{
 		"message": "Successfully logged out",
 	})
 }
 
+// LogoutAllHandler invalidates every session and refresh token of the current user
+func (h *GenericAuthHandlers) LogoutAllHandler(ctx HTTPContext) error {
+	userID, err := GetUserFromContext(ctx)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusUnauthorized, "User not authenticated")
+	}
+	
+	count, err := h.authService.LogoutAllSessions(h.requestContext(ctx), userID)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusInternalServerError, "Failed to logout from all sessions")
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, map[string]interface{}{
+		"message":              "Successfully logged out from all sessions",
+		"sessions_invalidated": count,
+	})
+}
+
+// ListRefreshTokensHandler lists the current user's active refresh tokens
+func (h *GenericAuthHandlers) ListRefreshTokensHandler(ctx HTTPContext) error {
+	userID, err := GetUserFromContext(ctx)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusUnauthorized, "User not authenticated")
+	}
+	
+	tokens, err := h.authService.ListRefreshTokens(h.requestContext(ctx), userID)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusInternalServerError, "Failed to list refresh tokens")
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, map[string]interface{}{
+		"refresh_tokens": tokens,
+	})
+}
+
+// ExportUserDataHandler returns everything stored about the current user as
+// JSON
+func (h *GenericAuthHandlers) ExportUserDataHandler(ctx HTTPContext) error {
+	userID, err := GetUserFromContext(ctx)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusUnauthorized, "User not authenticated")
+	}
+	
+	data, err := h.authService.ExportUserData(h.requestContext(ctx), userID)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusInternalServerError, "Failed to export user data")
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, data)
+}
+
+// RefreshClaimsHandler re-issues the current user's tokens with their
+// current roles and tenant, rotating their session
+func (h *GenericAuthHandlers) RefreshClaimsHandler(ctx HTTPContext) error {
+	claims, ok := GetClaims(ctx)
+	if !ok {
+		return h.errorJSON(ctx, http.StatusUnauthorized, "User not authenticated")
+	}
+	
+	reqCtx := ContextWithClaims(h.requestContext(ctx), claims)
+	response, err := h.authService.RefreshClaims(reqCtx, claims.UserID)
+	if errors.Is(err, ErrSessionUnavailable) {
+		return h.sessionUnavailable(ctx)
+	}
+	if errors.Is(err, ErrEmailNotVerified) {
+		return h.errorJSONCode(ctx, http.StatusForbidden, "email_not_verified", err.Error())
+	}
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusInternalServerError, "Failed to refresh claims")
+	}
+	
+	h.setAuthCookies(ctx, response)
+	return h.writeJSON(ctx, http.StatusOK, response)
+}
+
+// RevokeRefreshTokenHandler revokes one of the current user's refresh tokens
+func (h *GenericAuthHandlers) RevokeRefreshTokenHandler(ctx HTTPContext) error {
+	userID, err := GetUserFromContext(ctx)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusUnauthorized, "User not authenticated")
+	}
+	
+	var req struct {
+		TokenID string `json:"token_id"`
+	}
+	if err := h.bind(ctx, &req); err != nil {
+		return h.bindError(ctx, err)
+	}
+	if req.TokenID == "" {
+		return h.errorJSON(ctx, http.StatusBadRequest, "Token ID is required")
+	}
+	
+	if err := h.authService.RevokeRefreshToken(h.requestContext(ctx), userID, req.TokenID); err != nil {
+		return h.errorJSON(ctx, http.StatusNotFound, err.Error())
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, map[string]string{
+		"message": "Refresh token revoked",
+	})
+}
+
 // GetUserHandler returns current user info
 func (h *GenericAuthHandlers) GetUserHandler(ctx HTTPContext) error {
-	userID, ok := ctx.Get("user_id").(string)
+	claims, ok := GetClaims(ctx)
 	if !ok {
-		return ctx.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "User not authenticated",
-		})
+		return h.errorJSON(ctx, http.StatusUnauthorized, "User not authenticated")
 	}
 	
-	email, _ := ctx.Get("user_email").(string)
-	name, _ := ctx.Get("user_name").(string)
-	provider, _ := ctx.Get("user_provider").(string)
+	email, name := claims.Email, claims.Name
 	
-	return ctx.JSON(http.StatusOK, map[string]interface{}{
-		"user_id":  userID,
+	// Tokens issued in minimal mode carry no profile claims
+	if email == "" {
+		if user, err := h.authService.GetUser(h.requestContext(ctx), claims.UserID); err == nil {
+			email, name = user.Email, user.Name
+		}
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, map[string]interface{}{
+		"user_id":  claims.UserID,
 		"email":    email,
 		"name":     name,
-		"provider": provider,
+		"provider": claims.Provider,
+	})
+}
+
+// MeResponse is the identity returned by /auth/me
+type MeResponse struct {
+	UserID    string   `json:"user_id"`
+	Email     string   `json:"email,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Provider  string   `json:"provider,omitempty"`
+	Roles     []string `json:"roles"`
+	TenantID  string   `json:"tenant_id,omitempty"`
+	SessionID string   `json:"session_id,omitempty"`
+	// RolesFresh reports whether Roles and TenantID were read from the user
+	// store rather than the token
+	RolesFresh bool `json:"roles_fresh"`
+}
+
+// MeHandler returns the current identity from the access token's claims for
+// cheap polling. With Config.MeFreshRoles the roles and tenant are looked up
+// so changes made since the token was issued show immediately.
+func (h *GenericAuthHandlers) MeHandler(ctx HTTPContext) error {
+	claims, ok := GetClaims(ctx)
+	if !ok {
+		return h.errorJSON(ctx, http.StatusUnauthorized, "User not authenticated")
+	}
+	
+	me := MeResponse{
+		UserID:    claims.UserID,
+		Email:     claims.Email,
+		Name:      claims.Name,
+		Provider:  claims.Provider,
+		Roles:     GetRolesFromContext(ctx),
+		TenantID:  claims.TenantID,
+		SessionID: claims.SessionID,
+	}
+	
+	if h.config.MeFreshRoles {
+		user, err := h.authService.GetUser(h.requestContext(ctx), claims.UserID)
+		if err != nil {
+			return h.errorJSON(ctx, http.StatusUnauthorized, "User not found")
+		}
+		me.Roles = append([]string{}, user.Roles...)
+		me.TenantID = user.TenantID
+		me.RolesFresh = true
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, me)
+}
+
+// UpdateProfileHandler lets the current user change their name and avatar.
+// Other fields in the request body are ignored.
+func (h *GenericAuthHandlers) UpdateProfileHandler(ctx HTTPContext) error {
+	userID, err := GetUserFromContext(ctx)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusUnauthorized, "User not authenticated")
+	}
+	
+	var updates ProfileUpdate
+	if err := h.bind(ctx, &updates); err != nil {
+		return h.bindError(ctx, err)
+	}
+	
+	if err := updates.Validate(); err != nil {
+		return h.errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	
+	user, err := h.authService.UpdateProfile(h.requestContext(ctx), userID, updates)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusInternalServerError, "Failed to update profile")
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, user)
+}
+
+// RequestEmailChangeHandler sends a confirmation to the current user's new email
+func (h *GenericAuthHandlers) RequestEmailChangeHandler(ctx HTTPContext) error {
+	userID, err := GetUserFromContext(ctx)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusUnauthorized, "User not authenticated")
+	}
+	
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := h.bind(ctx, &req); err != nil {
+		return h.bindError(ctx, err)
+	}
+	
+	if err := h.authService.RequestEmailChange(h.requestContext(ctx), userID, req.Email); err != nil {
+		return h.errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, map[string]string{
+		"message": "A confirmation link has been sent to the new email",
+	})
+}
+
+// ConfirmEmailChangeHandler applies an email change. The user must sign in
+// again afterwards.
+func (h *GenericAuthHandlers) ConfirmEmailChangeHandler(ctx HTTPContext) error {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := h.bind(ctx, &req); err != nil {
+		return h.bindError(ctx, err)
+	}
+	
+	if req.Token == "" {
+		return h.errorJSON(ctx, http.StatusBadRequest, "Token is required")
+	}
+	
+	if _, err := h.authService.ConfirmEmailChange(h.requestContext(ctx), req.Token); err != nil {
+		return h.errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, map[string]string{
+		"message": "Email changed, please sign in again",
+	})
+}
+
+// UserInfoHandler returns OpenID Connect userinfo claims for the current user
+func (h *GenericAuthHandlers) UserInfoHandler(ctx HTTPContext) error {
+	userID, err := GetUserFromContext(ctx)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusUnauthorized, "User not authenticated")
+	}
+	
+	info, err := h.authService.GetUserInfo(h.requestContext(ctx), userID)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusNotFound, "User not found")
+	}
+	
+	// Report the subject the token was issued with
+	if claims, ok := GetClaims(ctx); ok && claims.Subject != "" {
+		info.Subject = claims.Subject
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, info)
+}
+
+// maxAuditPageSize caps the number of audit events returned per request
+const maxAuditPageSize = 500
+
+// AuditLogHandler returns audit events filtered by the user_id, type, result,
+// since and until (RFC 3339) query parameters, paginated with limit and offset.
+// Mount it behind AuthMiddleware and RequireAuditAccess.
+func (h *GenericAuthHandlers) AuditLogHandler(ctx HTTPContext) error {
+	if h.config.AuditStore == nil {
+		return h.errorJSON(ctx, http.StatusNotFound, "Audit log is not enabled")
+	}
+	
+	filter := AuditFilter{
+		UserID: ctx.GetQueryParam("user_id"),
+		Type:   AuditEventType(ctx.GetQueryParam("type")),
+		Result: ctx.GetQueryParam("result"),
+		Limit:  50,
+	}
+	
+	var err error
+	if filter.Since, err = parseTimeParam(ctx.GetQueryParam("since")); err != nil {
+		return h.errorJSON(ctx, http.StatusBadRequest, "Invalid since parameter")
+	}
+	if filter.Until, err = parseTimeParam(ctx.GetQueryParam("until")); err != nil {
+		return h.errorJSON(ctx, http.StatusBadRequest, "Invalid until parameter")
+	}
+	if limit := ctx.GetQueryParam("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 1 {
+			return h.errorJSON(ctx, http.StatusBadRequest, "Invalid limit parameter")
+		}
+		if filter.Limit > maxAuditPageSize {
+			filter.Limit = maxAuditPageSize
+		}
+	}
+	if offset := ctx.GetQueryParam("offset"); offset != "" {
+		if filter.Offset, err = strconv.Atoi(offset); err != nil || filter.Offset < 0 {
+			return h.errorJSON(ctx, http.StatusBadRequest, "Invalid offset parameter")
+		}
+	}
+	
+	events, err := h.authService.QueryAuditLog(h.requestContext(ctx), filter)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusInternalServerError, "Failed to query audit log")
+	}
+	
+	return h.writeJSON(ctx, http.StatusOK, map[string]interface{}{
+		"events": events,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
 	})
 }
 
+// parseTimeParam parses an optional RFC 3339 query parameter
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 // OAuthHandler initiates OAuth flow
 func (h *GenericAuthHandlers) OAuthHandler(provider string) HTTPHandler {
 	return func(ctx HTTPContext) error {
-		var oauthProvider OAuthProvider
-		switch provider {
-		case "google":
-			oauthProvider = ProviderGoogle
-		case "github":
-			oauthProvider = ProviderGitHub
-		default:
-			return ctx.JSON(http.StatusBadRequest, map[string]string{
-				"error": "Unsupported provider",
-			})
+		oauthProvider, err := ParseOAuthProvider(provider)
+		if err != nil {
+			return h.unknownProvider(ctx)
 		}
 		
 		// Get redirect URI from query parameter
@@ -169,30 +619,109 @@ func (h *GenericAuthHandlers) OAuthHandler(provider string) HTTPHandler {
 			redirectURI = h.config.FrontendSuccessURL
 		}
 		
+		// Forward the optional params the provider supports, such as
+		// login_hint and prompt
+		params := url.Values{}
+		for _, name := range OAuthAuthParams(oauthProvider) {
+			if value := ctx.GetQueryParam(name); value != "" {
+				params.Set(name, value)
+			}
+		}
+		
 		// Get OAuth URL
-		authURL, err := h.authService.GetOAuthURL(oauthProvider, redirectURI)
+		authURL, err := h.authService.GetOAuthURLWithParams(oauthProvider, redirectURI, params)
 		if err != nil {
-			return ctx.JSON(http.StatusInternalServerError, map[string]string{
-				"error": err.Error(),
-			})
+			if errors.Is(err, ErrInvalidAuthParam) {
+				return h.errorJSONCode(ctx, http.StatusBadRequest, "invalid_auth_param", err.Error())
+			}
+			return h.errorJSON(ctx, http.StatusInternalServerError, err.Error())
 		}
 		
 		// Redirect to OAuth provider
-		return ctx.Redirect(http.StatusTemporaryRedirect, authURL)
+		return ctx.Redirect(h.config.oauthRedirectStatus(), authURL)
 	}
 }
 
+// OAuthTokenHandler signs in a native app with a token obtained from the
+// provider's SDK instead of the redirect flow
+func (h *GenericAuthHandlers) OAuthTokenHandler(provider string) HTTPHandler {
+	return func(ctx HTTPContext) error {
+		oauthProvider, err := ParseOAuthProvider(provider)
+		if err != nil {
+			return h.unknownProvider(ctx)
+		}
+		
+		var req struct {
+			AccessToken string `json:"access_token"`
+			IDToken     string `json:"id_token"`
+		}
+		if err := h.bind(ctx, &req); err != nil {
+			return h.bindError(ctx, err)
+		}
+		
+		if req.AccessToken == "" && req.IDToken == "" {
+			return h.errorJSON(ctx, http.StatusBadRequest, "access_token or id_token is required")
+		}
+		
+		response, err := h.authService.OAuthSignInWithToken(h.requestContext(ctx), oauthProvider, req.AccessToken, req.IDToken)
+		if err != nil {
+			var linkErr *AccountLinkRequiredError
+			if errors.As(err, &linkErr) {
+				return h.writeJSON(ctx, http.StatusConflict, map[string]string{
+					"error":      "account_link_required",
+					"link_token": linkErr.LinkToken,
+					"email":      linkErr.Email,
+					"request_id": GetRequestID(ctx),
+				})
+			}
+			if errors.Is(err, ErrProviderUnavailable) {
+				return h.errorJSONCode(ctx, http.StatusServiceUnavailable, "provider_unavailable", err.Error())
+			}
+			return h.errorJSON(ctx, http.StatusUnauthorized, err.Error())
+		}
+		
+		h.setAuthCookies(ctx, response)
+		return h.writeJSON(ctx, http.StatusOK, response)
+	}
+}
+
+// oauthProviderErrorCode maps an OAuth error returned by the provider to the
+// error reported to the frontend
+func oauthProviderErrorCode(providerError string) string {
+	switch providerError {
+	case "access_denied":
+		// The user cancelled or declined the consent screen
+		return "oauth_cancelled"
+	case "temporarily_unavailable", "server_error":
+		return "provider_unavailable"
+	default:
+		return "provider_error"
+	}
+}
+
+// unknownProvider responds to OAuth routes for providers GoTrust does not
+// support. The initiation, token and callback routes all answer 404 with the
+// unsupported_provider code, as no OAuth flow exists to redirect back to.
+func (h *GenericAuthHandlers) unknownProvider(ctx HTTPContext) error {
+	return h.errorJSONCode(ctx, http.StatusNotFound, "unsupported_provider", "Unsupported provider")
+}
+
 // OAuthCallbackHandler handles OAuth callback
 func (h *GenericAuthHandlers) OAuthCallbackHandler(provider string) HTTPHandler {
 	return func(ctx HTTPContext) error {
-		var oauthProvider OAuthProvider
-		switch provider {
-		case "google":
-			oauthProvider = ProviderGoogle
-		case "github":
-			oauthProvider = ProviderGitHub
-		default:
-			return h.redirectWithError(ctx, "unsupported_provider")
+		oauthProvider, err := ParseOAuthProvider(provider)
+		if err != nil {
+			return h.unknownProvider(ctx)
+		}
+		
+		// The provider reports denied or failed authorizations with an
+		// error parameter instead of a code (RFC 6749 section 4.1.2.1)
+		if providerError := ctx.GetQueryParam("error"); providerError != "" {
+			params := url.Values{"provider_error": {providerError}}
+			if description := ctx.GetQueryParam("error_description"); description != "" {
+				params.Set("error_description", description)
+			}
+			return h.redirectWithErrorParams(ctx, provider, oauthProviderErrorCode(providerError), params)
 		}
 		
 		// Get state and code
@@ -200,86 +729,326 @@ func (h *GenericAuthHandlers) OAuthCallbackHandler(provider string) HTTPHandler
 		code := ctx.GetQueryParam("code")
 		
 		if state == "" {
-			return h.redirectWithError(ctx, "state_missing")
+			return h.redirectWithError(ctx, provider, "state_missing")
 		}
 		
 		if code == "" {
-			return h.redirectWithError(ctx, "code_missing")
+			return h.redirectWithError(ctx, provider, "code_missing")
 		}
 		
 		// Handle OAuth callback
-		response, err := h.authService.OAuthSignIn(ctx.Context(), oauthProvider, state, code)
+		response, redirectURI, err := h.authService.OAuthSignInWithRedirect(h.requestContext(ctx), oauthProvider, state, code)
 		if err != nil {
-			return h.redirectWithError(ctx, err.Error())
+			var linkErr *AccountLinkRequiredError
+			if errors.As(err, &linkErr) {
+				return h.redirectWithErrorParams(ctx, provider, "account_link_required", url.Values{
+					"link_token": {linkErr.LinkToken},
+					"email":      {linkErr.Email},
+				})
+			}
+			if errors.Is(err, ErrProviderUnavailable) {
+				return h.redirectWithError(ctx, provider, "provider_unavailable")
+			}
+			return h.redirectWithError(ctx, provider, err.Error())
 		}
 		
-		// Get redirect URI from OAuth state
-		redirectURI := h.config.FrontendSuccessURL
+		// Resolve the frontend URL for this request
+		data := newRedirectData(ctx, provider)
+		data.RedirectURI = redirectURI
+		data.Response = response
+		
+		callbackURL, err := h.config.resolveRedirectURL(h.requestContext(ctx), h.config.FrontendSuccessURL, h.config.FrontendSuccessURLFunc, data)
+		if err != nil {
+			return h.redirectWithError(ctx, provider, "invalid_redirect")
+		}
 		
 		// Build callback URL with auth data
-		callbackURL, _ := url.Parse(redirectURI)
 		query := callbackURL.Query()
 		query.Set("token", response.AccessToken)
-		query.Set("refresh_token", response.RefreshToken)
+		if h.config.refreshTokenDelivery() != RefreshTokenDeliveryCookie {
+			query.Set("refresh_token", response.RefreshToken)
+		}
 		query.Set("user_id", response.User.ID)
-		query.Set("email", response.User.Email)
 		query.Set("provider", provider)
 		
+		if response.User.Email != "" {
+			query.Set("email", response.User.Email)
+		}
+		
 		if response.User.Name != "" {
 			query.Set("name", response.User.Name)
 		}
 		if response.User.AvatarURL != "" {
 			query.Set("avatar_url", response.User.AvatarURL)
 		}
+		if response.IsNewUser {
+			query.Set("new_user", "true")
+		}
 		
 		callbackURL.RawQuery = query.Encode()
 		
-		return ctx.Redirect(http.StatusTemporaryRedirect, callbackURL.String())
+		h.setAuthCookies(ctx, response)
+		return ctx.Redirect(h.config.oauthRedirectStatus(), callbackURL.String())
+	}
+}
+
+// errorJSON writes an error response tagged with the request ID and logs it
+func (h *GenericAuthHandlers) errorJSON(ctx HTTPContext, code int, message string) error {
+	requestID := GetRequestID(ctx)
+	logf(WithRequestID(ctx.Context(), requestID), "auth error %d: %s", code, message)
+	
+	return h.writeJSON(ctx, code, map[string]string{
+		"error":      message,
+		"request_id": requestID,
+	})
+}
+
+// errorJSONCode writes an error response with a machine-readable error code
+func (h *GenericAuthHandlers) errorJSONCode(ctx HTTPContext, status int, code, message string) error {
+	requestID := GetRequestID(ctx)
+	logf(WithRequestID(ctx.Context(), requestID), "auth error %d: %s", status, message)
+	
+	return h.writeJSON(ctx, status, map[string]string{
+		"error":      message,
+		"code":       code,
+		"request_id": requestID,
+	})
+}
+
+// signUpError writes the response for a failed registration
+func (h *GenericAuthHandlers) signUpError(ctx HTTPContext, err error) error {
+	switch {
+	case errors.Is(err, ErrSignupDisabled):
+		return h.errorJSONCode(ctx, http.StatusForbidden, "signup_disabled", err.Error())
+	case errors.Is(err, ErrUserExists):
+		return h.errorJSONCode(ctx, http.StatusConflict, "user_exists", err.Error())
+	case errors.Is(err, ErrPasswordMismatch):
+		return h.errorJSONCode(ctx, http.StatusBadRequest, "password_mismatch", err.Error())
+	case errors.Is(err, ErrBreachedPassword):
+		return h.errorJSONCode(ctx, http.StatusBadRequest, "breached_password", err.Error())
+	case errors.Is(err, ErrSessionUnavailable):
+		return h.sessionUnavailable(ctx)
+	case errors.Is(err, ErrHashingBusy):
+		return h.hashingBusy(ctx)
+	case captchaErrorCode(err) != "":
+		return h.errorJSONCode(ctx, http.StatusBadRequest, captchaErrorCode(err), err.Error())
+	default:
+		return h.errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+}
+
+// sessionUnavailable writes the response for a sign-in whose session could
+// not be created. The store error is logged, not returned to the client.
+func (h *GenericAuthHandlers) sessionUnavailable(ctx HTTPContext) error {
+	return h.errorJSONCode(ctx, http.StatusInternalServerError, "session_unavailable", "Failed to create session, please try again")
+}
+
+// hashingBusy writes the response for a request whose password could not be
+// checked because the hashing limiter stayed full
+func (h *GenericAuthHandlers) hashingBusy(ctx HTTPContext) error {
+	ctx.SetHeader("Retry-After", "1")
+	return h.errorJSONCode(ctx, http.StatusServiceUnavailable, "server_busy", ErrHashingBusy.Error())
+}
+
+// captchaErrorCode returns the error code of a CAPTCHA failure, if err is one
+func captchaErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrCaptchaRequired):
+		return "captcha_required"
+	case errors.Is(err, ErrCaptchaFailed):
+		return "captcha_failed"
+	default:
+		return ""
+	}
+}
+
+// unauthorized writes a 401 error with an RFC 6750 WWW-Authenticate challenge.
+// errorCode is omitted when the request carried no credentials.
+func (h *GenericAuthHandlers) unauthorized(ctx HTTPContext, errorCode, description, message string) error {
+	challenge := fmt.Sprintf(`%s realm="%s"`, h.config.authScheme(), h.config.authRealm())
+	if errorCode != "" {
+		challenge += fmt.Sprintf(`, error="%s", error_description="%s"`, errorCode, description)
 	}
+	ctx.SetHeader("WWW-Authenticate", challenge)
+	
+	return h.errorJSON(ctx, http.StatusUnauthorized, message)
+}
+
+// bind decodes the request body into dest, enforcing the configured body size limit
+func (h *GenericAuthHandlers) bind(ctx HTTPContext, dest interface{}) error {
+	if limit := h.config.maxRequestBodyBytes(); limit > 0 {
+		if req := ctx.Request(); req != nil && req.Body != nil {
+			req.Body = http.MaxBytesReader(nil, req.Body, limit)
+		}
+	}
+	return ctx.Bind(dest)
+}
+
+// bindFormOrJSON decodes an application/x-www-form-urlencoded body, as sent
+// by plain HTML forms, into the string fields of dest named by their json
+// tags, and any other body as JSON
+func (h *GenericAuthHandlers) bindFormOrJSON(ctx HTTPContext, dest interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(ctx.GetHeader("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" {
+		return h.bind(ctx, dest)
+	}
+	
+	if req := ctx.Request(); req != nil {
+		if limit := h.config.maxRequestBodyBytes(); limit > 0 && req.Body != nil {
+			req.Body = http.MaxBytesReader(nil, req.Body, limit)
+		}
+		if err := req.ParseForm(); err != nil {
+			return err
+		}
+	}
+	
+	value := reflect.ValueOf(dest).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" || field.Type.Kind() != reflect.String {
+			continue
+		}
+		value.Field(i).SetString(ctx.GetFormValue(name))
+	}
+	return nil
+}
+
+// bindError writes the response for a failed bind
+func (h *GenericAuthHandlers) bindError(ctx HTTPContext, err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return h.errorJSON(ctx, http.StatusRequestEntityTooLarge, "Request body too large")
+	}
+	
+	return h.errorJSON(ctx, http.StatusBadRequest, "Invalid request body")
 }
 
 // Helper method to redirect with error
-func (h *GenericAuthHandlers) redirectWithError(ctx HTTPContext, errorMsg string) error {
-	errorURL, _ := url.Parse(h.config.FrontendErrorURL)
+func (h *GenericAuthHandlers) redirectWithError(ctx HTTPContext, provider, errorMsg string) error {
+	return h.redirectWithErrorParams(ctx, provider, errorMsg, nil)
+}
+
+// Helper method to redirect with error and additional query parameters
+func (h *GenericAuthHandlers) redirectWithErrorParams(ctx HTTPContext, provider, errorMsg string, params url.Values) error {
+	data := newRedirectData(ctx, provider)
+	data.Error = errorMsg
+	
+	errorURL, err := h.config.resolveRedirectURL(h.requestContext(ctx), h.config.FrontendErrorURL, h.config.FrontendErrorURLFunc, data)
+	if err != nil {
+		return h.errorJSON(ctx, http.StatusBadRequest, errorMsg)
+	}
+	
 	query := errorURL.Query()
 	query.Set("error", errorMsg)
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
 	errorURL.RawQuery = query.Encode()
 	
-	return ctx.Redirect(http.StatusTemporaryRedirect, errorURL.String())
+	return ctx.Redirect(h.config.oauthRedirectStatus(), errorURL.String())
+}
+
+// authToken extracts the token from an Authorization header value using the
+// configured scheme, compared case-insensitively. Surrounding and repeated
+// whitespace is ignored; anything but the scheme followed by one token68
+// value is rejected.
+func (h *GenericAuthHandlers) authToken(authHeader string) (string, bool) {
+	fields := strings.Fields(authHeader)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], h.config.authScheme()) || !isToken68(fields[1]) {
+		return "", false
+	}
+	return fields[1], true
+}
+
+// isToken68 reports whether s is a token68 credential (RFC 7235), the
+// syntax of bearer tokens
+func isToken68(s string) bool {
+	value := strings.TrimRight(s, "=")
+	if value == "" {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			strings.ContainsRune("-._~+/", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// authHeaderValues returns the request's Authorization header values.
+// Proxies may repeat the header or fold repeats into one comma-separated
+// value; both are split into separate values.
+func authHeaderValues(ctx HTTPContext) []string {
+	headers := []string{ctx.GetHeader("Authorization")}
+	if req := ctx.Request(); req != nil {
+		headers = req.Header.Values("Authorization")
+	}
+	
+	var values []string
+	for _, header := range headers {
+		for _, value := range strings.Split(header, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// requestToken extracts the access token from the Authorization headers.
+// present is false when there is no header; ok is false when a value is
+// malformed or uses another scheme, or when values carry different tokens.
+func (h *GenericAuthHandlers) requestToken(ctx HTTPContext) (token string, present, ok bool) {
+	values := authHeaderValues(ctx)
+	if len(values) == 0 {
+		return "", false, false
+	}
+	
+	for _, value := range values {
+		valueToken, valid := h.authToken(value)
+		if !valid || (token != "" && valueToken != token) {
+			return "", true, false
+		}
+		token = valueToken
+	}
+	return token, true, true
 }
 
 // AuthMiddleware validates JWT tokens and sets user context
 func (h *GenericAuthHandlers) AuthMiddleware() HTTPMiddleware {
+	return h.authMiddleware(h.authService.ValidateTokenContext)
+}
+
+// authMiddleware requires an access token accepted by validate
+func (h *GenericAuthHandlers) authMiddleware(validate func(context.Context, string) (*TokenClaims, error)) HTTPMiddleware {
 	return func(next HTTPHandler) HTTPHandler {
 		return func(ctx HTTPContext) error {
-			authHeader := ctx.GetHeader("Authorization")
-			if authHeader == "" {
-				return ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error": "Authorization header is required",
-				})
+			tokenString, present, ok := h.requestToken(ctx)
+			if !present {
+				return h.unauthorized(ctx, "", "", "Authorization header is required")
 			}
-			
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			if tokenString == authHeader {
-				return ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error": "Bearer token is required",
-				})
+			if !ok {
+				scheme := h.config.authScheme()
+				return h.unauthorized(ctx, "invalid_request",
+					fmt.Sprintf("The %s authentication scheme is required", scheme), scheme+" token is required")
 			}
 			
 			// Validate token
-			claims, err := h.authService.ValidateToken(tokenString)
+			claims, err := validate(h.requestContext(ctx), tokenString)
 			if err != nil {
-				return ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error": "Invalid token: " + err.Error(),
-				})
+				description := "The access token is invalid"
+				if errors.Is(err, jwt.ErrTokenExpired) {
+					description = "The access token expired"
+				}
+				return h.unauthorized(ctx, "invalid_token", description, "Invalid token: " + err.Error())
 			}
 			
 			// Set user context
-			ctx.Set("user_id", claims.UserID)
-			ctx.Set("user_email", claims.Email)
-			ctx.Set("user_name", claims.Name)
-			ctx.Set("user_provider", claims.Provider)
-			ctx.Set("claims", claims)
+			SetClaims(ctx, claims)
 			
 			return next(ctx)
 		}
@@ -290,43 +1059,125 @@ func (h *GenericAuthHandlers) AuthMiddleware() HTTPMiddleware {
 func (h *GenericAuthHandlers) OptionalAuthMiddleware() HTTPMiddleware {
 	return func(next HTTPHandler) HTTPHandler {
 		return func(ctx HTTPContext) error {
-			authHeader := ctx.GetHeader("Authorization")
+			tokenString, present, ok := h.requestToken(ctx)
 			
 			// If no auth header, continue without authentication
-			if authHeader == "" {
+			if !present {
 				return next(ctx)
 			}
 			
 			// If auth header exists but is invalid format, continue without authentication
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			if tokenString == authHeader {
+			if !ok {
+				h.optionalAuthError(ctx, fmt.Errorf("authorization header does not carry a %s token", h.config.authScheme()))
 				return next(ctx)
 			}
 			
 			// Try to validate token
-			claims, err := h.authService.ValidateToken(tokenString)
+			claims, err := h.authService.ValidateTokenContext(h.requestContext(ctx), tokenString)
 			if err != nil {
 				// Invalid token, continue without authentication
+				h.optionalAuthError(ctx, err)
 				return next(ctx)
 			}
 			
 			// Set user context
-			ctx.Set("user_id", claims.UserID)
-			ctx.Set("user_email", claims.Email)
-			ctx.Set("user_name", claims.Name)
-			ctx.Set("user_provider", claims.Provider)
-			ctx.Set("claims", claims)
+			SetClaims(ctx, claims)
+			
+			return next(ctx)
+		}
+	}
+}
+
+// OptionalAuthErrorHandler observes tokens ignored by OptionalAuthMiddleware.
+// err wraps the validation error, e.g. jwt.ErrTokenExpired.
+type OptionalAuthErrorHandler func(ctx HTTPContext, err error)
+
+// optionalAuthError reports an ignored token to Config.OnOptionalAuthError
+func (h *GenericAuthHandlers) optionalAuthError(ctx HTTPContext, err error) {
+	if h.config.OnOptionalAuthError != nil {
+		h.config.OnOptionalAuthError(ctx, err)
+	}
+}
+
+// RequireRecentAuth rejects requests whose token was obtained by a login older
+// than maxAge, prompting the client to re-authenticate before sensitive
+// operations. It must be mounted after AuthMiddleware.
+func (h *GenericAuthHandlers) RequireRecentAuth(maxAge time.Duration) HTTPMiddleware {
+	return func(next HTTPHandler) HTTPHandler {
+		return func(ctx HTTPContext) error {
+			claims, ok := GetClaims(ctx)
+			if !ok {
+				return h.unauthorized(ctx, "", "", "User not authenticated")
+			}
+			
+			if claims.AuthTime.IsZero() || time.Since(claims.AuthTime) > maxAge {
+				// RFC 9470 step-up authentication challenge
+				ctx.SetHeader("WWW-Authenticate", fmt.Sprintf(
+					`%s realm="%s", error="insufficient_user_authentication", error_description="A more recent authentication is required", max_age=%d`,
+					h.config.authScheme(), h.config.authRealm(), int64(maxAge.Seconds()),
+				))
+				return h.errorJSON(ctx, http.StatusUnauthorized, "Recent authentication required")
+			}
+			
+			return next(ctx)
+		}
+	}
+}
+
+// RequireRole allows the request only if the token grants one of the roles.
+// It reads the claims placed in the context by AuthMiddleware, so no token is
+// validated twice; if they are absent the middleware was mounted in the wrong
+// order and the request fails with a 500 rather than a misleading 403.
+func (h *GenericAuthHandlers) RequireRole(roles ...string) HTTPMiddleware {
+	return func(next HTTPHandler) HTTPHandler {
+		return func(ctx HTTPContext) error {
+			claims, ok := GetClaims(ctx)
+			if !ok {
+				return h.errorJSON(ctx, http.StatusInternalServerError,
+					"RequireRole must be mounted after AuthMiddleware: no authentication claims in context")
+			}
+			
+			if !claims.HasRole(roles...) {
+				return h.errorJSON(ctx, http.StatusForbidden, "Insufficient role")
+			}
 			
 			return next(ctx)
 		}
 	}
 }
 
+// RequireVerifiedEmail rejects tokens flagged as having an unverified email,
+// letting apps gate features in the grace and soft email verification
+// modes. It must be mounted after AuthMiddleware.
+func (h *GenericAuthHandlers) RequireVerifiedEmail() HTTPMiddleware {
+	return func(next HTTPHandler) HTTPHandler {
+		return func(ctx HTTPContext) error {
+			claims, ok := GetClaims(ctx)
+			if !ok {
+				return h.errorJSON(ctx, http.StatusInternalServerError,
+					"RequireVerifiedEmail must be mounted after AuthMiddleware: no authentication claims in context")
+			}
+			
+			if claims.EmailVerified != nil && !*claims.EmailVerified {
+				return h.errorJSONCode(ctx, http.StatusForbidden, "email_not_verified", "Email verification required")
+			}
+			
+			return next(ctx)
+		}
+	}
+}
+
+// RequireAuditAccess restricts a route to Config.AuditAdminRole. It must be
+// mounted after AuthMiddleware.
+func (h *GenericAuthHandlers) RequireAuditAccess() HTTPMiddleware {
+	return h.RequireRole(h.config.AuditAdminRole)
+}
+
 // GetUserFromContext extracts user ID from context
 func GetUserFromContext(ctx HTTPContext) (string, error) {
-	userID, ok := ctx.Get("user_id").(string)
+	claims, ok := GetClaims(ctx)
 	if !ok {
 		return "", fmt.Errorf("user not authenticated")
 	}
-	return userID, nil
+	return claims.UserID, nil
 }
\ No newline at end of file
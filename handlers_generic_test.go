@@ -0,0 +1,719 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signUpBody returns a sign-up request body padded to at least size bytes
+func signUpBody(email string, size int) string {
+	body := fmt.Sprintf(`{"email": %q, "password": %q, "name": "Test User"}`, email, testPassword)
+	if pad := size - len(body); pad > 0 {
+		body = body[:len(body)-1] + `, "padding": "` + strings.Repeat("x", pad) + `"}`
+	}
+	return body
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      int64
+		size       int
+		wantStatus int
+	}{
+		{name: "small body", wantStatus: http.StatusCreated},
+		{name: "body over the default limit", size: int(DefaultMaxRequestBodyBytes) + 1024, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "body over a custom limit", limit: 512, size: 1024, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "body under a custom limit", limit: 4096, size: 1024, wantStatus: http.StatusCreated},
+		{name: "limit disabled", limit: -1, size: int(DefaultMaxRequestBodyBytes) + 1024, wantStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, func(c *Config) { c.MaxRequestBodyBytes = tt.limit })
+
+			ctx := newTestContext(http.MethodPost, "/auth/signup", signUpBody("jane@example.com", tt.size))
+			if err := h.SignUpHandler(ctx); err != nil {
+				t.Fatalf("SignUpHandler() error = %v", err)
+			}
+			if ctx.status() != tt.wantStatus {
+				t.Errorf("SignUpHandler() status = %d, want %d: %s", ctx.status(), tt.wantStatus, ctx.recorder.Body)
+			}
+		})
+	}
+}
+
+func TestUserInfoHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		subjectFunc func(*User) string
+	}{
+		{name: "default subject"},
+		{name: "custom subject", subjectFunc: func(u *User) string { return "urn:example:" + u.ID }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, func(c *Config) { c.SubjectFunc = tt.subjectFunc })
+			response := signUp(t, a, "jane@example.com")
+			avatar := "https://cdn.example.com/jane.png"
+			if _, err := a.UpdateProfile(context.Background(), response.User.ID, ProfileUpdate{AvatarURL: &avatar}); err != nil {
+				t.Fatalf("UpdateProfile() error = %v", err)
+			}
+
+			ctx := newTestContext(http.MethodGet, "/auth/userinfo", "").withBearer(response.AccessToken)
+			serve(t, ctx, h.UserInfoHandler, h.AuthMiddleware())
+			if ctx.status() != http.StatusOK {
+				t.Fatalf("UserInfoHandler() status = %d", ctx.status())
+			}
+
+			body := ctx.body(t)
+			for _, claim := range []string{"sub", "email", "email_verified", "name", "picture", "updated_at"} {
+				if _, ok := body[claim]; !ok {
+					t.Errorf("userinfo lacks the %q claim: %v", claim, body)
+				}
+			}
+			if body["sub"] != tokenPayload(t, response.AccessToken)["sub"] {
+				t.Errorf("sub = %v, want the token's subject", body["sub"])
+			}
+			if body["picture"] != avatar || body["email"] != "jane@example.com" {
+				t.Errorf("userinfo = %v", body)
+			}
+
+			unauthenticated := newTestContext(http.MethodGet, "/auth/userinfo", "")
+			serve(t, unauthenticated, h.UserInfoHandler, h.AuthMiddleware())
+			if unauthenticated.status() != http.StatusUnauthorized {
+				t.Errorf("UserInfoHandler() without a token status = %d, want 401", unauthenticated.status())
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareChallenge(t *testing.T) {
+	h, a := newTestHandlers(t, func(c *Config) { c.AuthRealm = "example" })
+	response := signUp(t, a, "jane@example.com")
+	expired := expiredToken(t, a, response.User.ID)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantChallenge string
+	}{
+		{name: "valid token", authorization: "Bearer " + response.AccessToken, wantStatus: http.StatusOK},
+		{name: "missing token", wantStatus: http.StatusUnauthorized, wantChallenge: `Bearer realm="example"`},
+		{
+			name:          "other scheme",
+			authorization: "Basic dXNlcjpwYXNz",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="example", error="invalid_request", error_description="The Bearer authentication scheme is required"`,
+		},
+		{
+			name:          "invalid token",
+			authorization: "Bearer not-a-token",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="example", error="invalid_token", error_description="The access token is invalid"`,
+		},
+		{
+			name:          "expired token",
+			authorization: "Bearer " + expired,
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="example", error="invalid_token", error_description="The access token expired"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodGet, "/auth/me", "")
+			if tt.authorization != "" {
+				ctx.request.Header.Set("Authorization", tt.authorization)
+			}
+			serve(t, ctx, func(ctx HTTPContext) error { return ctx.String(http.StatusOK, "ok") }, h.AuthMiddleware())
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if got := ctx.recorder.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantChallenge)
+			}
+			if tt.wantStatus == http.StatusUnauthorized {
+				if _, ok := ctx.body(t)["error"]; !ok {
+					t.Errorf("401 response has no JSON error body")
+				}
+			}
+		})
+	}
+}
+
+func TestRequireRecentAuth(t *testing.T) {
+	h, a := newTestHandlers(t, nil)
+	response := signUp(t, a, "jane@example.com")
+	userID := response.User.ID
+
+	tokenAt := func(authTime time.Time) string {
+		token, err := a.jwtManager.GenerateToken(TokenClaims{UserID: userID, AuthTime: authTime})
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v", err)
+		}
+		return token
+	}
+	refreshed, err := a.RefreshToken(context.Background(), response.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "fresh login", token: response.AccessToken, wantStatus: http.StatusOK},
+		{name: "refreshed token of a fresh login", token: refreshed.AccessToken, wantStatus: http.StatusOK},
+		{name: "stale login", token: tokenAt(time.Now().Add(-2 * time.Hour)), wantStatus: http.StatusUnauthorized},
+		{name: "token without auth_time", token: tokenAt(time.Time{}), wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodPost, "/auth/email/change", "").withBearer(tt.token)
+			serve(t, ctx, func(ctx HTTPContext) error { return ctx.String(http.StatusOK, "ok") },
+				h.AuthMiddleware(), h.RequireRecentAuth(time.Hour))
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			challenge := ctx.recorder.Header().Get("WWW-Authenticate")
+			if wantChallenge := tt.wantStatus == http.StatusUnauthorized; strings.Contains(challenge, `error="insufficient_user_authentication"`) != wantChallenge {
+				t.Errorf("WWW-Authenticate = %q", challenge)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	h, a := newTestHandlers(t, nil)
+	tokenWithRoles := func(roles ...string) string {
+		token, err := a.jwtManager.GenerateToken(TokenClaims{UserID: "user-1", Roles: roles})
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v", err)
+		}
+		return token
+	}
+	ok := func(ctx HTTPContext) error { return ctx.String(http.StatusOK, "ok") }
+
+	tests := []struct {
+		name       string
+		token      string
+		middleware []HTTPMiddleware
+		wantStatus int
+	}{
+		{
+			name:       "granted role",
+			token:      tokenWithRoles("editor", "admin"),
+			middleware: []HTTPMiddleware{h.AuthMiddleware(), h.RequireRole("admin")},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "any of several roles",
+			token:      tokenWithRoles("editor"),
+			middleware: []HTTPMiddleware{h.AuthMiddleware(), h.RequireRole("admin", "editor")},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "insufficient role",
+			token:      tokenWithRoles("viewer"),
+			middleware: []HTTPMiddleware{h.AuthMiddleware(), h.RequireRole("admin")},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "no roles",
+			token:      tokenWithRoles(),
+			middleware: []HTTPMiddleware{h.AuthMiddleware(), h.RequireRole("admin")},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "mounted before AuthMiddleware",
+			token:      tokenWithRoles("admin"),
+			middleware: []HTTPMiddleware{h.RequireRole("admin"), h.AuthMiddleware()},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "mounted without AuthMiddleware",
+			token:      tokenWithRoles("admin"),
+			middleware: []HTTPMiddleware{h.RequireRole("admin")},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodGet, "/admin", "").withBearer(tt.token)
+			serve(t, ctx, ok, tt.middleware...)
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusInternalServerError {
+				if message, _ := ctx.body(t)["error"].(string); !strings.Contains(message, "after AuthMiddleware") {
+					t.Errorf("error = %q, want it to name the required ordering", message)
+				}
+			}
+		})
+	}
+}
+
+func TestBindTokenToSession(t *testing.T) {
+	tests := []struct {
+		name             string
+		bind             bool
+		wantAfterLogout  int
+		wantSessionClaim bool
+	}{
+		{name: "bound to session", bind: true, wantAfterLogout: http.StatusUnauthorized, wantSessionClaim: true},
+		{name: "stateless", bind: false, wantAfterLogout: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, func(c *Config) { c.BindTokenToSession = tt.bind })
+			token := signUp(t, a, "jane@example.com").AccessToken
+			if _, ok := tokenPayload(t, token)["sid"]; ok != tt.wantSessionClaim {
+				t.Errorf("sid claim present = %v, want %v", ok, tt.wantSessionClaim)
+			}
+
+			protected := func() int {
+				ctx := newTestContext(http.MethodGet, "/auth/me", "").withBearer(token)
+				serve(t, ctx, h.UserInfoHandler, h.AuthMiddleware())
+				return ctx.status()
+			}
+			if status := protected(); status != http.StatusOK {
+				t.Fatalf("status before logout = %d, want %d", status, http.StatusOK)
+			}
+
+			logout := newTestContext(http.MethodPost, "/auth/logout", "").withBearer(token)
+			serve(t, logout, h.LogoutHandler, h.AuthMiddleware())
+			if logout.status() != http.StatusOK {
+				t.Fatalf("logout status = %d", logout.status())
+			}
+
+			if status := protected(); status != tt.wantAfterLogout {
+				t.Errorf("status after logout = %d, want %d", status, tt.wantAfterLogout)
+			}
+		})
+	}
+}
+
+func TestAuthScheme(t *testing.T) {
+	tests := []struct {
+		name       string
+		scheme     string
+		header     string // %s is replaced by a valid token
+		wantStatus int
+	}{
+		{name: "bearer", header: "Bearer %s", wantStatus: http.StatusOK},
+		{name: "bearer in lowercase", header: "bearer %s", wantStatus: http.StatusOK},
+		{name: "extra spaces", header: "  Bearer   %s ", wantStatus: http.StatusOK},
+		{name: "other scheme", header: "Token %s", wantStatus: http.StatusUnauthorized},
+		{name: "no scheme", header: "%s", wantStatus: http.StatusUnauthorized},
+		{name: "scheme without token", header: "Bearer ", wantStatus: http.StatusUnauthorized},
+		{name: "custom scheme", scheme: "Token", header: "Token %s", wantStatus: http.StatusOK},
+		{name: "custom scheme in uppercase", scheme: "Token", header: "TOKEN %s", wantStatus: http.StatusOK},
+		{name: "bearer with a custom scheme", scheme: "Token", header: "Bearer %s", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, func(c *Config) { c.AuthScheme = tt.scheme })
+			token := signUp(t, a, "jane@example.com").AccessToken
+
+			ctx := newTestContext(http.MethodGet, "/auth/me", "")
+			header := tt.header
+			if strings.Contains(header, "%s") {
+				header = fmt.Sprintf(header, token)
+			}
+			ctx.request.Header.Set("Authorization", header)
+			serve(t, ctx, h.UserInfoHandler, h.AuthMiddleware())
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusUnauthorized {
+				return
+			}
+			wantScheme := tt.scheme
+			if wantScheme == "" {
+				wantScheme = "Bearer"
+			}
+			if challenge := ctx.recorder.Header().Get("WWW-Authenticate"); !strings.HasPrefix(challenge, wantScheme+" ") {
+				t.Errorf("WWW-Authenticate = %q, want the %s scheme", challenge, wantScheme)
+			}
+		})
+	}
+}
+
+func TestSignUpErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowSignup bool
+		email       string
+		password    string
+		wantStatus  int
+		wantCode    string
+	}{
+		{name: "new user", allowSignup: true, email: "john@example.com", password: testPassword, wantStatus: http.StatusCreated},
+		{name: "signup disabled", email: "john@example.com", password: testPassword, wantStatus: http.StatusForbidden, wantCode: "signup_disabled"},
+		{name: "existing user", allowSignup: true, email: "jane@example.com", password: testPassword, wantStatus: http.StatusConflict, wantCode: "user_exists"},
+		{name: "missing password", allowSignup: true, email: "john@example.com", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, nil)
+			signUp(t, a, "jane@example.com")
+			a.config.AllowSignup = tt.allowSignup
+
+			body := fmt.Sprintf(`{"email": %q, "password": %q}`, tt.email, tt.password)
+			ctx := newTestContext(http.MethodPost, "/auth/signup", body)
+			serve(t, ctx, h.SignUpHandler)
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if code, _ := ctx.body(t)["code"].(string); code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSignUpSentinelErrors(t *testing.T) {
+	a, _, _ := newTestService(t, nil)
+	signUp(t, a, "jane@example.com")
+
+	_, err := a.SignUp(context.Background(), &SignUpRequest{Email: "jane@example.com", Password: testPassword})
+	if !errors.Is(err, ErrUserExists) {
+		t.Errorf("SignUp() of an existing email error = %v, want ErrUserExists", err)
+	}
+
+	a.config.AllowSignup = false
+	_, err = a.SignUp(context.Background(), &SignUpRequest{Email: "john@example.com", Password: testPassword})
+	if !errors.Is(err, ErrSignupDisabled) {
+		t.Errorf("SignUp() with signup disabled error = %v, want ErrSignupDisabled", err)
+	}
+}
+
+func TestOAuthCallbackProviderError(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		wantError       string
+		wantDescription string
+	}{
+		{
+			name:            "access denied",
+			query:           "error=access_denied&error_description=The+user+denied+access&state=s",
+			wantError:       "oauth_cancelled",
+			wantDescription: "The user denied access",
+		},
+		{name: "provider unavailable", query: "error=temporarily_unavailable", wantError: "provider_unavailable"},
+		{name: "generic provider error", query: "error=invalid_scope&error_description=Bad+scope", wantError: "provider_error", wantDescription: "Bad scope"},
+		{name: "no error or code", query: "state=s", wantError: "code_missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, func(c *Config) { c.FrontendErrorURL = "https://app.example.com/login" })
+
+			ctx := newTestContext(http.MethodGet, "/auth/google/callback?"+tt.query, "")
+			serve(t, ctx, h.OAuthCallbackHandler(string(ProviderGoogle)))
+
+			location, err := url.Parse(ctx.recorder.Header().Get("Location"))
+			if err != nil || location.Host != "app.example.com" {
+				t.Fatalf("redirect = %q, want the frontend error URL", ctx.recorder.Header().Get("Location"))
+			}
+			query := location.Query()
+			if got := query.Get("error"); got != tt.wantError {
+				t.Errorf("error = %q, want %q", got, tt.wantError)
+			}
+			if got := query.Get("error_description"); got != tt.wantDescription {
+				t.Errorf("error_description = %q, want %q", got, tt.wantDescription)
+			}
+			if tt.wantError != "code_missing" && query.Get("provider_error") == "" {
+				t.Error("provider_error missing from redirect")
+			}
+		})
+	}
+}
+
+func TestOptionalAuthError(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      func(a *AuthService, userID string) string
+		wantReport  bool
+		wantExpired bool
+		wantClaims  bool
+	}{
+		{name: "no token", header: func(*AuthService, string) string { return "" }},
+		{name: "valid token", header: func(a *AuthService, userID string) string {
+			token, _ := a.GenerateTestToken(&User{ID: userID, Email: "jane@example.com"})
+			return "Bearer " + token
+		}, wantClaims: true},
+		{name: "expired token", header: func(a *AuthService, userID string) string {
+			return "Bearer " + expiredToken(t, a, userID)
+		}, wantReport: true, wantExpired: true},
+		{name: "malformed token", header: func(*AuthService, string) string { return "Bearer not-a-jwt" }, wantReport: true},
+		{name: "other scheme", header: func(*AuthService, string) string { return "Basic dXNlcjpwYXNz" }, wantReport: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported []error
+			h, a := newTestHandlers(t, func(c *Config) {
+				c.OnOptionalAuthError = func(ctx HTTPContext, err error) {
+					reported = append(reported, err)
+					if errors.Is(err, jwt.ErrTokenExpired) {
+						ctx.SetHeader("X-Token-Expired", "true")
+					}
+				}
+			})
+			userID := signUp(t, a, "jane@example.com").User.ID
+
+			ctx := newTestContext(http.MethodGet, "/feed", "")
+			if header := tt.header(a, userID); header != "" {
+				ctx.request.Header.Set("Authorization", header)
+			}
+			var authenticated bool
+			serve(t, ctx, func(ctx HTTPContext) error {
+				_, authenticated = GetClaims(ctx)
+				return ctx.String(http.StatusOK, "ok")
+			}, h.OptionalAuthMiddleware())
+
+			if ctx.status() != http.StatusOK {
+				t.Errorf("status = %d, want the request to proceed", ctx.status())
+			}
+			if authenticated != tt.wantClaims {
+				t.Errorf("authenticated = %v, want %v", authenticated, tt.wantClaims)
+			}
+			if (len(reported) == 1) != tt.wantReport || len(reported) > 1 {
+				t.Fatalf("reported errors = %v, want reported %v", reported, tt.wantReport)
+			}
+			if tt.wantReport && errors.Is(reported[0], jwt.ErrTokenExpired) != tt.wantExpired {
+				t.Errorf("reported error = %v, want expired %v", reported[0], tt.wantExpired)
+			}
+			if got := ctx.recorder.Header().Get("X-Token-Expired") == "true"; got != tt.wantExpired {
+				t.Errorf("refresh hint header set = %v, want %v", got, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestUnknownOAuthProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		handler func(h *GenericAuthHandlers) HTTPHandler
+	}{
+		{name: "initiation", method: http.MethodGet, target: "/auth/twitter", handler: func(h *GenericAuthHandlers) HTTPHandler { return h.OAuthHandler("twitter") }},
+		{name: "callback", method: http.MethodGet, target: "/auth/twitter/callback?code=c&state=s", handler: func(h *GenericAuthHandlers) HTTPHandler { return h.OAuthCallbackHandler("twitter") }},
+		{name: "token", method: http.MethodPost, target: "/auth/oauth/twitter/token", handler: func(h *GenericAuthHandlers) HTTPHandler { return h.OAuthTokenHandler("twitter") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The callback answers with JSON even when a frontend error URL
+			// is configured
+			h, _ := newTestHandlers(t, func(c *Config) { c.FrontendErrorURL = "https://app.example.com/login" })
+
+			ctx := newTestContext(tt.method, tt.target, `{"code": "c"}`)
+			serve(t, ctx, tt.handler(h))
+
+			if ctx.status() != http.StatusNotFound {
+				t.Fatalf("status = %d, want %d", ctx.status(), http.StatusNotFound)
+			}
+			body := ctx.body(t)
+			if body["code"] != "unsupported_provider" || body["error"] == "" {
+				t.Errorf("body = %v, want an unsupported_provider error", body)
+			}
+		})
+	}
+}
+
+func TestParseOAuthProvider(t *testing.T) {
+	for _, provider := range OAuthProviders() {
+		got, err := ParseOAuthProvider(string(provider))
+		if err != nil || got != provider {
+			t.Errorf("ParseOAuthProvider(%q) = %q, %v", provider, got, err)
+		}
+	}
+
+	for _, name := range []string{"twitter", "Google", ""} {
+		if _, err := ParseOAuthProvider(name); !errors.Is(err, ErrUnknownProvider) {
+			t.Errorf("ParseOAuthProvider(%q) error = %v, want ErrUnknownProvider", name, err)
+		}
+	}
+}
+
+func TestMeHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		freshRoles  bool
+		wantRoles   string
+		wantTenant  interface{}
+		wantFresh   bool
+		wantLookups int
+	}{
+		{name: "claims only", wantRoles: "[]", wantTenant: nil},
+		{name: "fresh roles", freshRoles: true, wantRoles: "[admin]", wantTenant: "tenant-2", wantFresh: true, wantLookups: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestConfig()
+			config.MeFreshRoles = tt.freshRoles
+			users := &countingUserStore{MemoryUserStore: NewMemoryUserStore()}
+			sessions := NewMemorySessionStore()
+			t.Cleanup(func() { sessions.Close() })
+			a := NewAuthService(config, users, sessions)
+			h := NewGenericAuthHandlers(a, config)
+			response := signUp(t, a, "jane@example.com")
+
+			// The user's roles change after the token was issued
+			user, err := users.MemoryUserStore.GetUserByID(context.Background(), response.User.ID)
+			if err != nil {
+				t.Fatalf("GetUserByID() error = %v", err)
+			}
+			changed := *user
+			changed.Roles = []string{"admin"}
+			changed.TenantID = "tenant-2"
+			if err := users.UpdateUser(context.Background(), &changed); err != nil {
+				t.Fatalf("UpdateUser() error = %v", err)
+			}
+
+			users.gets = 0
+			ctx := newTestContext(http.MethodGet, "/auth/me", "").withBearer(response.AccessToken)
+			serve(t, ctx, h.MeHandler, h.AuthMiddleware())
+			if ctx.status() != http.StatusOK {
+				t.Fatalf("MeHandler() status = %d", ctx.status())
+			}
+
+			body := ctx.body(t)
+			if body["user_id"] != response.User.ID || body["email"] != "jane@example.com" {
+				t.Errorf("identity = %v", body)
+			}
+			roles, _ := body["roles"].([]interface{})
+			if got := fmt.Sprint(roles); got != tt.wantRoles {
+				t.Errorf("roles = %v, want %s", body["roles"], tt.wantRoles)
+			}
+			if body["tenant_id"] != tt.wantTenant || body["roles_fresh"] != tt.wantFresh {
+				t.Errorf("tenant_id = %v, roles_fresh = %v, want %v, %v", body["tenant_id"], body["roles_fresh"], tt.wantTenant, tt.wantFresh)
+			}
+			if users.gets != tt.wantLookups {
+				t.Errorf("user store lookups = %d, want %d", users.gets, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestBearerTokenHeaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		headers    []string // %s is replaced by a valid token
+		wantStatus int
+	}{
+		{name: "tab separated", headers: []string{"Bearer\t%s"}, wantStatus: http.StatusOK},
+		{name: "repeated header", headers: []string{"Bearer %s", "bearer %s"}, wantStatus: http.StatusOK},
+		{name: "folded repeats", headers: []string{"Bearer %s, Bearer %s"}, wantStatus: http.StatusOK},
+		{name: "different tokens", headers: []string{"Bearer %s", "Bearer other-token"}, wantStatus: http.StatusUnauthorized},
+		{name: "repeat with another scheme", headers: []string{"Bearer %s", "Basic dXNlcjpwYXNz"}, wantStatus: http.StatusUnauthorized},
+		{name: "trailing garbage", headers: []string{"Bearer %s extra"}, wantStatus: http.StatusUnauthorized},
+		{name: "invalid characters", headers: []string{"Bearer <%s>"}, wantStatus: http.StatusUnauthorized},
+		{name: "only padding", headers: []string{"Bearer =="}, wantStatus: http.StatusUnauthorized},
+		{name: "scheme only", headers: []string{"Bearer"}, wantStatus: http.StatusUnauthorized},
+		{name: "empty values", headers: []string{" , "}, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, nil)
+			token := signUp(t, a, "jane@example.com").AccessToken
+
+			// Both middlewares read the header the same way
+			middlewares := map[string]HTTPMiddleware{"AuthMiddleware": h.AuthMiddleware(), "OptionalAuthMiddleware": h.OptionalAuthMiddleware()}
+			for name, middleware := range middlewares {
+				ctx := newTestContext(http.MethodGet, "/auth/me", "")
+				for _, header := range tt.headers {
+					ctx.request.Header.Add("Authorization", strings.ReplaceAll(header, "%s", token))
+				}
+				serve(t, ctx, h.UserInfoHandler, middleware)
+
+				if ctx.status() != tt.wantStatus {
+					t.Errorf("%s status = %d, want %d", name, ctx.status(), tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestSignInBodyEncodings(t *testing.T) {
+	form := url.Values{"email": {"jane@example.com"}, "password": {testPassword}}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{name: "JSON", contentType: "application/json", body: fmt.Sprintf(`{"email": "jane@example.com", "password": %q}`, testPassword), wantStatus: http.StatusOK},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: form.Encode(), wantStatus: http.StatusOK},
+		{name: "form with charset", contentType: "application/x-www-form-urlencoded; charset=UTF-8", body: form.Encode(), wantStatus: http.StatusOK},
+		{name: "form with a wrong password", contentType: "application/x-www-form-urlencoded", body: "email=jane%40example.com&password=wrong-password", wantStatus: http.StatusUnauthorized},
+		{name: "form without a password", contentType: "application/x-www-form-urlencoded", body: "email=jane%40example.com", wantStatus: http.StatusBadRequest},
+		{name: "form sent as JSON", contentType: "application/json", body: form.Encode(), wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, nil)
+			signUp(t, a, "jane@example.com")
+
+			ctx := newTestContext(http.MethodPost, "/auth/signin", tt.body)
+			ctx.request.Header.Set("Content-Type", tt.contentType)
+			serve(t, ctx, h.SignInHandler)
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && ctx.body(t)["access_token"] == nil {
+				t.Errorf("sign-in response has no access token: %v", ctx.body(t))
+			}
+		})
+	}
+}
+
+func TestSignUpFormEncoded(t *testing.T) {
+	h, a := newTestHandlers(t, nil)
+
+	form := url.Values{"email": {"jane@example.com"}, "password": {testPassword}, "name": {"Jane Doe"}}
+	ctx := newTestContext(http.MethodPost, "/auth/signup", form.Encode())
+	ctx.request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	serve(t, ctx, h.SignUpHandler)
+
+	if ctx.status() != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", ctx.status(), http.StatusCreated)
+	}
+	if _, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword}); err != nil {
+		t.Errorf("SignIn() after a form sign-up error = %v", err)
+	}
+	if user, _ := ctx.body(t)["user"].(map[string]interface{}); user["name"] != "Jane Doe" {
+		t.Errorf("user = %v, want the form's name", ctx.body(t)["user"])
+	}
+}
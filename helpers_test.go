@@ -0,0 +1,182 @@
+package gotrust
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testSecret   = "test-secret-0123456789abcdef0123456789abcdef"
+	testPassword = "Correct-Horse-Battery-9"
+)
+
+// newTestConfig returns a config with a fixed secret and the cheapest bcrypt
+// cost, so tests do not depend on the environment
+func newTestConfig() *Config {
+	config := NewConfig()
+	config.JWTSecret = testSecret
+	config.BCryptCost = bcrypt.MinCost
+	return config
+}
+
+// newTestService creates an AuthService on in-memory stores. configure, if
+// set, adjusts the config first.
+func newTestService(t *testing.T, configure func(*Config)) (*AuthService, *MemoryUserStore, *MemorySessionStore) {
+	t.Helper()
+
+	config := newTestConfig()
+	if configure != nil {
+		configure(config)
+	}
+	users := NewMemoryUserStore()
+	sessions := NewMemorySessionStore()
+	t.Cleanup(func() { sessions.Close() })
+	return NewAuthService(config, users, sessions), users, sessions
+}
+
+// signUp registers a user with testPassword
+func signUp(t *testing.T, a *AuthService, email string) *AuthResponse {
+	t.Helper()
+
+	response, err := a.SignUp(context.Background(), &SignUpRequest{Email: email, Password: testPassword, Name: "Test User"})
+	if err != nil {
+		t.Fatalf("SignUp(%s) error = %v", email, err)
+	}
+	return response
+}
+
+// newTestHandlers creates handlers on a test service
+func newTestHandlers(t *testing.T, configure func(*Config)) (*GenericAuthHandlers, *AuthService) {
+	t.Helper()
+
+	a, _, _ := newTestService(t, configure)
+	return NewGenericAuthHandlers(a, a.config), a
+}
+
+// testContext is an HTTPContext on a recorded response, like the stdlib
+// adapter's StdContext
+type testContext struct {
+	request  *http.Request
+	recorder *httptest.ResponseRecorder
+	values   map[string]interface{}
+}
+
+// newTestContext creates a context for a request. A string body is sent as
+// JSON.
+func newTestContext(method, target, body string) *testContext {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	return newTestContextFor(r)
+}
+
+func newTestContextFor(r *http.Request) *testContext {
+	return &testContext{request: r, recorder: httptest.NewRecorder(), values: make(map[string]interface{})}
+}
+
+func (c *testContext) Context() context.Context                    { return c.request.Context() }
+func (c *testContext) Request() *http.Request                      { return c.request }
+func (c *testContext) GetHeader(key string) string                 { return c.request.Header.Get(key) }
+func (c *testContext) GetQueryParam(key string) string             { return c.request.URL.Query().Get(key) }
+func (c *testContext) GetFormValue(key string) string              { return c.request.FormValue(key) }
+func (c *testContext) SetHeader(key, value string)                 { c.recorder.Header().Set(key, value) }
+func (c *testContext) SetStatus(code int)                          { c.recorder.WriteHeader(code) }
+func (c *testContext) Set(key string, value interface{})           { c.values[key] = value }
+func (c *testContext) Get(key string) interface{}                  { return c.values[key] }
+func (c *testContext) GetCookie(name string) (*http.Cookie, error) { return c.request.Cookie(name) }
+
+func (c *testContext) Bind(dest interface{}) error {
+	return json.NewDecoder(c.request.Body).Decode(dest)
+}
+
+func (c *testContext) JSON(code int, data interface{}) error {
+	c.recorder.Header().Set("Content-Type", "application/json")
+	c.recorder.WriteHeader(code)
+	return json.NewEncoder(c.recorder).Encode(data)
+}
+
+func (c *testContext) Redirect(code int, url string) error {
+	http.Redirect(c.recorder, c.request, url, code)
+	return nil
+}
+
+func (c *testContext) String(code int, text string) error {
+	c.recorder.WriteHeader(code)
+	_, err := c.recorder.WriteString(text)
+	return err
+}
+
+func (c *testContext) SetCookie(cookie *http.Cookie) {
+	if value := CookieHeader(cookie); value != "" {
+		c.recorder.Header().Add("Set-Cookie", value)
+	}
+}
+
+// withBearer sets the Authorization header
+func (c *testContext) withBearer(token string) *testContext {
+	c.request.Header.Set("Authorization", "Bearer "+token)
+	return c
+}
+
+// status returns the response status code
+func (c *testContext) status() int {
+	return c.recorder.Code
+}
+
+// body decodes the JSON response body
+func (c *testContext) body(t *testing.T) map[string]interface{} {
+	t.Helper()
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(c.recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response %d is not JSON: %q", c.recorder.Code, c.recorder.Body.String())
+	}
+	return body
+}
+
+// cookie returns the response cookie with the given name
+func (c *testContext) cookie(name string) *http.Cookie {
+	for _, cookie := range c.recorder.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// serve runs handler behind middleware, outermost first
+func serve(t *testing.T, ctx *testContext, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	t.Helper()
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	if err := handler(ctx); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+}
+
+// expiredToken returns an access token for userID that expired an hour ago
+func expiredToken(t *testing.T, a *AuthService, userID string) string {
+	t.Helper()
+
+	issued := time.Now().Add(-a.config.JWTExpiration - time.Hour)
+	token, err := a.jwtManager.generateTokenAt(TokenClaims{UserID: userID, AuthTime: issued}, issued)
+	if err != nil {
+		t.Fatalf("generateTokenAt() error = %v", err)
+	}
+	return token
+}
@@ -46,6 +46,13 @@ type Router interface {
 	Group(prefix string, middleware ...HTTPMiddleware) Router
 }
 
+// PatchRouter is implemented by Routers that can register PATCH routes. It is
+// optional so Router implementations written before PATCH routes existed keep
+// working; routes needing it are skipped on routers without it.
+type PatchRouter interface {
+	PATCH(path string, handler HTTPHandler, middleware ...HTTPMiddleware)
+}
+
 // Validator interface for request validation
 type Validator interface {
 	Validate(interface{}) error
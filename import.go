@@ -0,0 +1,104 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Import statuses reported by ImportUsers
+const (
+	ImportStatusImported = "imported"
+	ImportStatusSkipped  = "skipped"
+	ImportStatusFailed   = "failed"
+)
+
+// ImportUserRecord is a user to import along with their existing password hash
+type ImportUserRecord struct {
+	User         *User
+	PasswordHash string
+}
+
+// ImportUserResult reports the outcome of importing one record
+type ImportUserResult struct {
+	Email  string `json:"email"`
+	UserID string `json:"user_id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportUser stores a user with an already-hashed password, for migrations
+// from another auth system. The hash must be in the configured hasher's
+// format so the user can sign in without a reset. Signup policy checks are
+// intentionally bypassed. An empty hash imports a user without a password.
+func (a *AuthService) ImportUser(ctx context.Context, user *User, passwordHash string) error {
+	if user == nil || user.Email == "" {
+		return fmt.Errorf("user email is required")
+	}
+
+	if passwordHash != "" && !a.hasher.Supports(passwordHash) {
+		return fmt.Errorf("password hash format does not match the configured hasher")
+	}
+
+	exists, err := a.userStore.UserExists(ctx, user.Email)
+	if err != nil {
+		return fmt.Errorf("failed to check user existence: %w", err)
+	}
+	if exists {
+		return ErrUserExists
+	}
+
+	now := time.Now()
+	if user.ID == "" {
+		user.ID = generateRandomString(16)
+	}
+	if user.Provider == "" {
+		user.Provider = string(ProviderLocal)
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+
+	if err := a.userStore.CreateUser(ctx, user, passwordHash); err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
+// ImportUsers imports a batch of users, skipping emails that already exist,
+// and returns a result for each record in order
+func (a *AuthService) ImportUsers(ctx context.Context, records []ImportUserRecord) []ImportUserResult {
+	results := make([]ImportUserResult, len(records))
+
+	for i, record := range records {
+		result := ImportUserResult{Status: ImportStatusFailed}
+		if record.User != nil {
+			result.Email = record.User.Email
+		}
+
+		if record.User != nil && record.User.Email != "" {
+			exists, err := a.userStore.UserExists(ctx, record.User.Email)
+			if err == nil && exists {
+				result.Status = ImportStatusSkipped
+				result.Error = ErrUserExists.Error()
+				results[i] = result
+				continue
+			}
+		}
+
+		if err := a.ImportUser(ctx, record.User, record.PasswordHash); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Status = ImportStatusImported
+			result.UserID = record.User.ID
+		}
+
+		results[i] = result
+	}
+
+	return results
+}
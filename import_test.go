@@ -0,0 +1,109 @@
+package gotrust
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func hashWith(t *testing.T, hasher PasswordHasher, password string) string {
+	t.Helper()
+
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	return hash
+}
+
+func TestImportUser(t *testing.T) {
+	bcryptHash := hashWith(t, NewBcryptHasher(bcrypt.MinCost), testPassword)
+	argon2Hash := hashWith(t, NewArgon2idHasher(), testPassword)
+
+	tests := []struct {
+		name    string
+		hasher  PasswordHasher // nil keeps the bcrypt default
+		hash    string
+		wantErr bool
+	}{
+		{name: "bcrypt hash with bcrypt hasher", hash: bcryptHash},
+		{name: "argon2 hash with argon2 hasher", hasher: NewArgon2idHasher(), hash: argon2Hash},
+		{name: "bcrypt hash with argon2 hasher migrating from bcrypt", hasher: NewArgon2idHasher(), hash: bcryptHash},
+		{name: "argon2 hash with bcrypt hasher", hash: argon2Hash, wantErr: true},
+		{name: "unknown hash format", hash: "md5:5f4dcc3b5aa765d61d8327deb882cf99", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, func(c *Config) { c.PasswordHasher = tt.hasher })
+
+			err := a.ImportUser(context.Background(), &User{Email: "jane@example.com", Name: "Jane"}, tt.hash)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ImportUser() accepted a hash the hasher does not support")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ImportUser() error = %v", err)
+			}
+
+			response, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword})
+			if err != nil {
+				t.Fatalf("SignIn() of an imported user error = %v", err)
+			}
+			if response.User.Provider != string(ProviderLocal) || response.User.ID == "" {
+				t.Errorf("imported user = %+v", response.User)
+			}
+			if _, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: "wrong-password"}); err == nil {
+				t.Errorf("SignIn() of an imported user accepted a wrong password")
+			}
+		})
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	a, _, _ := newTestService(t, nil)
+	signUp(t, a, "existing@example.com")
+	hash := hashWith(t, NewBcryptHasher(bcrypt.MinCost), testPassword)
+
+	results := a.ImportUsers(context.Background(), []ImportUserRecord{
+		{User: &User{Email: "one@example.com"}, PasswordHash: hash},
+		{User: &User{Email: "existing@example.com"}, PasswordHash: hash},
+		{User: &User{Email: "bad@example.com"}, PasswordHash: "not-a-hash"},
+		{User: nil},
+		{User: &User{ID: "user-two", Email: "two@example.com"}, PasswordHash: hash},
+	})
+
+	want := []struct {
+		email  string
+		status string
+	}{
+		{"one@example.com", ImportStatusImported},
+		{"existing@example.com", ImportStatusSkipped},
+		{"bad@example.com", ImportStatusFailed},
+		{"", ImportStatusFailed},
+		{"two@example.com", ImportStatusImported},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("ImportUsers() returned %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		if results[i].Email != w.email || results[i].Status != w.status {
+			t.Errorf("result %d = %+v, want %s %s", i, results[i], w.email, w.status)
+		}
+		if w.status == ImportStatusImported && results[i].UserID == "" {
+			t.Errorf("result %d has no user ID", i)
+		}
+	}
+	if results[4].UserID != "user-two" {
+		t.Errorf("ImportUsers() replaced the given user ID with %q", results[4].UserID)
+	}
+
+	for _, email := range []string{"one@example.com", "two@example.com"} {
+		if _, err := a.SignIn(context.Background(), &SignInRequest{Email: email, Password: testPassword}); err != nil {
+			t.Errorf("SignIn(%s) error = %v", email, err)
+		}
+	}
+}
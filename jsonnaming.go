@@ -0,0 +1,142 @@
+package gotrust
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// JSON naming strategies for Config.JSONNamingStrategy
+const (
+	JSONNamingSnake = "snake"
+	JSONNamingCamel = "camel"
+)
+
+// writeJSON writes a handler response using the configured JSON naming
+// strategy. Camel case converts the keys GoTrust defines, e.g. access_token
+// becomes accessToken, but not those of maps held in fields, such as custom
+// claims, which are the application's data.
+func (h *GenericAuthHandlers) writeJSON(ctx HTTPContext, code int, data interface{}) error {
+	if h.config.JSONNamingStrategy != JSONNamingCamel {
+		return ctx.JSON(code, data)
+	}
+
+	converted, err := camelCaseJSON(data)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(code, converted)
+}
+
+// camelCaseJSON returns data as generic JSON values with camelCase keys
+func camelCaseJSON(data interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return camelCaseKeys(reflect.ValueOf(data), value, false), nil
+}
+
+// camelCaseKeys converts the object keys of value, the decoded JSON of data.
+// Struct fields are renamed following their json tags, as are the keys of
+// maps built by the handlers. Maps reached through a field are left as they
+// are.
+func camelCaseKeys(data reflect.Value, value interface{}, inField bool) interface{} {
+	for data.IsValid() && (data.Kind() == reflect.Ptr || data.Kind() == reflect.Interface) {
+		if data.IsNil() {
+			return value
+		}
+		data = data.Elem()
+	}
+	if !data.IsValid() {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		switch data.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(data)
+			converted := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				field, ok := fields[key]
+				if !ok {
+					converted[key] = item
+					continue
+				}
+				converted[snakeToCamel(key)] = camelCaseKeys(field, item, true)
+			}
+			return converted
+		case reflect.Map:
+			if inField || data.Type().Key().Kind() != reflect.String {
+				return value
+			}
+			converted := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				converted[snakeToCamel(key)] = camelCaseKeys(data.MapIndex(reflect.ValueOf(key).Convert(data.Type().Key())), item, false)
+			}
+			return converted
+		}
+	case []interface{}:
+		if data.Kind() == reflect.Slice || data.Kind() == reflect.Array {
+			for i, item := range v {
+				if i < data.Len() {
+					v[i] = camelCaseKeys(data.Index(i), item, inField)
+				}
+			}
+		}
+	}
+	return value
+}
+
+// jsonFields returns the fields of a struct by JSON key, including those
+// promoted from embedded structs
+func jsonFields(data reflect.Value) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	typ := data.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		value := data.Field(i)
+		if field.Anonymous && name == "" {
+			for value.Kind() == reflect.Ptr && !value.IsNil() {
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct {
+				for key, promoted := range jsonFields(value) {
+					if _, ok := fields[key]; !ok {
+						fields[key] = promoted
+					}
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = value
+	}
+	return fields
+}
+
+// snakeToCamel converts snake_case to camelCase
+func snakeToCamel(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,165 @@
+package gotrust
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+)
+
+// objectKeys returns the sorted keys of a JSON object
+func objectKeys(object map[string]interface{}) []string {
+	var names []string
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestJSONNamingStrategy(t *testing.T) {
+	tests := []struct {
+		name          string
+		strategy      string
+		wantResponse  []string
+		wantUser      []string // a subset of the user keys
+		wantErrorKeys []string
+	}{
+		{
+			name:          "default",
+			wantResponse:  []string{"access_token", "expires_in", "is_new_user", "refresh_token", "token_type", "user"},
+			wantUser:      []string{"created_at", "email_verified"},
+			wantErrorKeys: []string{"code", "error", "request_id"},
+		},
+		{
+			name:          "snake case",
+			strategy:      JSONNamingSnake,
+			wantResponse:  []string{"access_token", "expires_in", "is_new_user", "refresh_token", "token_type", "user"},
+			wantUser:      []string{"created_at", "email_verified"},
+			wantErrorKeys: []string{"code", "error", "request_id"},
+		},
+		{
+			name:          "camel case",
+			strategy:      JSONNamingCamel,
+			wantResponse:  []string{"accessToken", "expiresIn", "isNewUser", "refreshToken", "tokenType", "user"},
+			wantUser:      []string{"createdAt", "emailVerified"},
+			wantErrorKeys: []string{"code", "error", "requestId"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, func(c *Config) { c.JSONNamingStrategy = tt.strategy })
+
+			ctx := newTestContext(http.MethodPost, "/auth/signup", signUpBody("jane@example.com", 0))
+			serve(t, ctx, h.SignUpHandler)
+			body := ctx.body(t)
+			if got := objectKeys(body); fmt.Sprint(got) != fmt.Sprint(tt.wantResponse) {
+				t.Errorf("response keys = %v, want %v", got, tt.wantResponse)
+			}
+			if _, ok := body["expiresIn"].(float64); tt.strategy == JSONNamingCamel && !ok {
+				t.Errorf("expiresIn = %#v, want a number", body["expiresIn"])
+			}
+			user, _ := body["user"].(map[string]interface{})
+			for _, key := range tt.wantUser {
+				if _, ok := user[key]; !ok {
+					t.Errorf("user keys = %v, want %s", objectKeys(user), key)
+				}
+			}
+
+			// Errors follow the same convention
+			ctx = newTestContext(http.MethodPost, "/auth/signup", signUpBody("jane@example.com", 0))
+			serve(t, ctx, h.SignUpHandler)
+			if got := objectKeys(ctx.body(t)); fmt.Sprint(got) != fmt.Sprint(tt.wantErrorKeys) {
+				t.Errorf("error keys = %v, want %v", got, tt.wantErrorKeys)
+			}
+		})
+	}
+}
+
+func TestSnakeToCamel(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "access_token", want: "accessToken"},
+		{key: "is_new_user", want: "isNewUser"},
+		{key: "email", want: "email"},
+		{key: "trailing_", want: "trailing"},
+		{key: "double__underscore", want: "doubleUnderscore"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := snakeToCamel(tt.key); got != tt.want {
+				t.Errorf("snakeToCamel(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+// namingSample has the shapes found in responses: tagged fields, an embedded
+// struct, a slice of structs and custom claims held in a field
+type namingSample struct {
+	namingEmbedded
+	UserID string                 `json:"user_id"`
+	Claims map[string]interface{} `json:"custom_claims,omitempty"`
+	Items  []namingEmbedded       `json:"list_items,omitempty"`
+}
+
+type namingEmbedded struct {
+	TokenType string `json:"token_type"`
+}
+
+func TestCamelCaseJSON(t *testing.T) {
+	claims := map[string]interface{}{"org_id": "acme", "billing_plan": map[string]interface{}{"seat_count": 5}}
+
+	tests := []struct {
+		name string
+		data interface{}
+		want string
+	}{
+		{
+			name: "struct fields",
+			data: &namingSample{UserID: "user-1", namingEmbedded: namingEmbedded{TokenType: "Bearer"}},
+			want: `{"tokenType":"Bearer","userId":"user-1"}`,
+		},
+		{
+			name: "custom claims keep their keys",
+			data: namingSample{UserID: "user-1", Claims: claims},
+			want: `{"customClaims":{"billing_plan":{"seat_count":5},"org_id":"acme"},"tokenType":"","userId":"user-1"}`,
+		},
+		{
+			name: "slice of structs",
+			data: namingSample{Items: []namingEmbedded{{TokenType: "Bearer"}}},
+			want: `{"listItems":[{"tokenType":"Bearer"}],"tokenType":"","userId":""}`,
+		},
+		{
+			name: "handler map",
+			data: map[string]interface{}{"sessions_invalidated": 2, "refresh_tokens": []*namingSample{{Claims: claims}}},
+			want: `{"refreshTokens":[{"customClaims":{"billing_plan":{"seat_count":5},"org_id":"acme"},"tokenType":"","userId":""}],"sessionsInvalidated":2}`,
+		},
+		{
+			name: "nested handler maps",
+			data: map[string]interface{}{"error_details": map[string]string{"request_id": "abc"}},
+			want: `{"errorDetails":{"requestId":"abc"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converted, err := camelCaseJSON(tt.data)
+			if err != nil {
+				t.Fatalf("camelCaseJSON() error = %v", err)
+			}
+			got, err := json.Marshal(converted)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("camelCaseJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
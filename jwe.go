@@ -0,0 +1,114 @@
+package gotrust
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jweHeader is the protected header of GoTrust's encrypted tokens: direct
+// encryption with AES-256-GCM of a signed JWT
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Cty string `json:"cty"`
+}
+
+// SetEncryptionKey makes GenerateToken encrypt access tokens as JWE (direct
+// AES-256-GCM) after signing them, so clients cannot read their claims. The
+// AES key is the SHA-256 of secret. ValidateToken still accepts plain signed
+// tokens. An empty secret disables encryption.
+func (j *JWTManager) SetEncryptionKey(secret string) {
+	if secret == "" {
+		j.encryptionKey = nil
+		return
+	}
+	key := sha256.Sum256([]byte(secret))
+	j.encryptionKey = key[:]
+}
+
+// encryptToken wraps a signed JWT in a compact JWE
+func (j *JWTManager) encryptToken(signed string) (string, error) {
+	header, err := json.Marshal(jweHeader{Alg: "dir", Enc: "A256GCM", Cty: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(header)
+
+	gcm, err := j.tokenCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if err := readRandom(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nil, nonce, []byte(signed), []byte(encodedHeader))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		encodedHeader,
+		"", // no encrypted key with direct encryption
+		base64.RawURLEncoding.EncodeToString(nonce),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// decryptToken returns the signed JWT inside a compact JWE
+func (j *JWTManager) decryptToken(token string) (string, error) {
+	if j.encryptionKey == nil {
+		return "", fmt.Errorf("encrypted tokens are not enabled")
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return "", fmt.Errorf("malformed encrypted token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted token header")
+	}
+	var header jweHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return "", fmt.Errorf("malformed encrypted token header")
+	}
+	if header.Alg != "dir" || header.Enc != "A256GCM" || parts[1] != "" {
+		return "", fmt.Errorf("unsupported token encryption: %s/%s", header.Alg, header.Enc)
+	}
+
+	nonce, err1 := base64.RawURLEncoding.DecodeString(parts[2])
+	ciphertext, err2 := base64.RawURLEncoding.DecodeString(parts[3])
+	tag, err3 := base64.RawURLEncoding.DecodeString(parts[4])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return "", fmt.Errorf("malformed encrypted token")
+	}
+
+	gcm, err := j.tokenCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted token")
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt token")
+	}
+	return string(plaintext), nil
+}
+
+func (j *JWTManager) tokenCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(j.encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,108 @@
+package gotrust
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncryptedTokenRoundTrip(t *testing.T) {
+	manager := NewJWTManager(testSecret, "gotrust", time.Hour)
+	manager.SetEncryptionKey("encryption-secret")
+
+	token, err := manager.GenerateToken(TokenClaims{UserID: "user-1", Email: "jane@example.com", Roles: []string{"entitlement-gold"}})
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		t.Fatalf("token has %d parts, want a 5 part JWE", len(parts))
+	}
+
+	// Without the key, no part of the token reveals the claims
+	for i, part := range parts {
+		decoded, _ := base64.RawURLEncoding.DecodeString(part)
+		for _, secret := range []string{"jane@example.com", "entitlement-gold", "user-1"} {
+			if strings.Contains(string(decoded), secret) || strings.Contains(part, secret) {
+				t.Errorf("token part %d reveals %q", i, secret)
+			}
+		}
+	}
+	if header := tokenHeader(t, token); header["alg"] != "dir" || header["enc"] != "A256GCM" {
+		t.Errorf("JWE header = %v", header)
+	}
+
+	claims, err := manager.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if claims.UserID != "user-1" || claims.Email != "jane@example.com" || len(claims.Roles) != 1 {
+		t.Errorf("ValidateToken() = %+v", claims)
+	}
+}
+
+func TestEncryptedTokenValidation(t *testing.T) {
+	issuer := NewJWTManager(testSecret, "gotrust", time.Hour)
+	issuer.SetEncryptionKey("encryption-secret")
+	encrypted, err := issuer.GenerateToken(TokenClaims{UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	plain, err := NewJWTManager(testSecret, "gotrust", time.Hour).GenerateToken(TokenClaims{UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+
+	// replacePart swaps one part of the encrypted token
+	replacePart := func(i int, value string) string {
+		parts := strings.Split(encrypted, ".")
+		parts[i] = value
+		return strings.Join(parts, ".")
+	}
+	flipped := []byte(strings.Split(encrypted, ".")[3])
+	if flipped[0] == 'A' {
+		flipped[0] = 'B'
+	} else {
+		flipped[0] = 'A'
+	}
+
+	tests := []struct {
+		name          string
+		encryptionKey string
+		token         string
+		wantErr       bool
+	}{
+		{name: "encrypted token", encryptionKey: "encryption-secret", token: encrypted},
+		{name: "plain token still accepted", encryptionKey: "encryption-secret", token: plain},
+		{name: "wrong key", encryptionKey: "other-secret", token: encrypted, wantErr: true},
+		{name: "encryption disabled", token: encrypted, wantErr: true},
+		{name: "tampered ciphertext", encryptionKey: "encryption-secret", token: replacePart(3, string(flipped)), wantErr: true},
+		{name: "tampered header", encryptionKey: "encryption-secret", token: replacePart(0, base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"dir","enc":"A256GCM","cty":"jwt"}`))), wantErr: true},
+		{name: "unsupported algorithm", encryptionKey: "encryption-secret", token: replacePart(0, base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RSA-OAEP","enc":"A256GCM"}`))), wantErr: true},
+		{name: "malformed nonce", encryptionKey: "encryption-secret", token: replacePart(2, "AAAA"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewJWTManager(testSecret, "gotrust", time.Hour)
+			manager.SetEncryptionKey(tt.encryptionKey)
+
+			if _, err := manager.ValidateToken(tt.token); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigTokenEncryptionKey(t *testing.T) {
+	a, _, _ := newTestService(t, func(c *Config) { c.TokenEncryptionKey = "encryption-secret" })
+
+	response := signUp(t, a, "jane@example.com")
+	if strings.Count(response.AccessToken, ".") != 4 {
+		t.Errorf("access token %q is not encrypted", response.AccessToken)
+	}
+	if _, err := a.ValidateToken(response.AccessToken); err != nil {
+		t.Errorf("ValidateToken() error = %v", err)
+	}
+}
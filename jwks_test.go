@@ -0,0 +1,240 @@
+package gotrust
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksServer publishes a mutable set of public keys
+type jwksServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	failing bool
+	fetches int
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	t.Helper()
+
+	s := &jwksServer{keys: make(map[string]crypto.PublicKey)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.fetches++
+		if s.failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var set struct {
+			Keys []jsonWebKey `json:"keys"`
+		}
+		for kid, key := range s.keys {
+			set.Keys = append(set.Keys, toJWK(kid, key))
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// publish replaces the published keys
+func (s *jwksServer) publish(keys map[string]crypto.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *jwksServer) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *jwksServer) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func toJWK(kid string, key crypto.PublicKey) jsonWebKey {
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return jsonWebKey{Kty: "RSA", Kid: kid, Use: "sig", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return jsonWebKey{Kty: "EC", Kid: kid, Crv: key.Curve.Params().Name, X: encode(key.X.Bytes()), Y: encode(key.Y.Bytes())}
+	case ed25519.PublicKey:
+		return jsonWebKey{Kty: "OKP", Kid: kid, Crv: "Ed25519", X: encode(key)}
+	}
+	panic("unsupported key type")
+}
+
+// signedWith signs an access token for user-1 with a private key and kid
+func signedWith(t *testing.T, method jwt.SigningMethod, key crypto.PrivateKey, kid string) string {
+	t.Helper()
+
+	now := time.Now()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"user_id": "user-1",
+		"iss":     "central",
+		"iat":     now.Unix(),
+		"exp":     now.Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return signed
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	return key
+}
+
+// newKeySetManager creates a JWT manager verifying tokens with the server's keys
+func newKeySetManager(server *jwksServer, refreshInterval time.Duration) (*JWTManager, *RemoteKeySet) {
+	keySet := NewRemoteKeySet(server.URL, refreshInterval)
+	manager := NewJWTManager("", "central", time.Hour)
+	manager.SetKeySet(keySet)
+	return manager, keySet
+}
+
+func TestRemoteKeySetValidateToken(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() error = %v", err)
+	}
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	otherKey := newRSAKey(t)
+
+	server := newJWKSServer(t)
+	server.publish(map[string]crypto.PublicKey{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey, "ed": edPublic})
+	manager, _ := newKeySetManager(server, 0)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "RSA", token: signedWith(t, jwt.SigningMethodRS256, rsaKey, "rsa")},
+		{name: "RSA-PSS", token: signedWith(t, jwt.SigningMethodPS256, rsaKey, "rsa")},
+		{name: "ECDSA", token: signedWith(t, jwt.SigningMethodES256, ecKey, "ec")},
+		{name: "Ed25519", token: signedWith(t, jwt.SigningMethodEdDSA, edKey, "ed")},
+		{name: "unknown kid", token: signedWith(t, jwt.SigningMethodRS256, rsaKey, "missing"), wantErr: true},
+		{name: "unpublished key under a known kid", token: signedWith(t, jwt.SigningMethodRS256, otherKey, "rsa"), wantErr: true},
+		{name: "HMAC without a secret", token: signedWith(t, jwt.SigningMethodHS256, []byte(testSecret), "rsa"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := manager.ValidateToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && claims.UserID != "user-1" {
+				t.Errorf("UserID = %q, want user-1", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestRemoteKeySetRotation(t *testing.T) {
+	oldKey, newKey := newRSAKey(t), newRSAKey(t)
+	server := newJWKSServer(t)
+	server.publish(map[string]crypto.PublicKey{"key-1": &oldKey.PublicKey})
+	manager, keySet := newKeySetManager(server, 0)
+
+	if _, err := manager.ValidateToken(signedWith(t, jwt.SigningMethodRS256, oldKey, "key-1")); err != nil {
+		t.Fatalf("ValidateToken() with the first key error = %v", err)
+	}
+
+	// The issuer rotates to a new key and retires the old one
+	server.publish(map[string]crypto.PublicKey{"key-2": &newKey.PublicKey})
+	newToken := signedWith(t, jwt.SigningMethodRS256, newKey, "key-2")
+
+	// Unknown kids refetch at most once per jwksMinRefreshInterval
+	if _, err := manager.ValidateToken(newToken); err == nil {
+		t.Fatalf("ValidateToken() refetched the key set right after fetching it")
+	}
+	if fetches := server.fetchCount(); fetches != 1 {
+		t.Fatalf("%d fetches, want 1", fetches)
+	}
+
+	keySet.mu.Lock()
+	keySet.lastAttempt = time.Now().Add(-2 * jwksMinRefreshInterval)
+	keySet.mu.Unlock()
+
+	if _, err := manager.ValidateToken(newToken); err != nil {
+		t.Fatalf("ValidateToken() with the rotated key error = %v", err)
+	}
+	if fetches := server.fetchCount(); fetches != 2 {
+		t.Errorf("%d fetches, want 2", fetches)
+	}
+
+	// The retired key is gone from the cache
+	if _, err := keySet.Key(context.Background(), "key-1"); err == nil {
+		t.Errorf("Key() returned a retired key")
+	}
+}
+
+func TestRemoteKeySetServesCacheOnError(t *testing.T) {
+	key := newRSAKey(t)
+	server := newJWKSServer(t)
+	server.publish(map[string]crypto.PublicKey{"key-1": &key.PublicKey})
+	manager, keySet := newKeySetManager(server, time.Millisecond)
+	token := signedWith(t, jwt.SigningMethodRS256, key, "key-1")
+
+	if _, err := manager.ValidateToken(token); err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+
+	// The cached keys are stale and the JWKS endpoint is down
+	server.setFailing(true)
+	time.Sleep(5 * time.Millisecond)
+	keySet.mu.Lock()
+	keySet.lastAttempt = time.Now().Add(-2 * jwksMinRefreshInterval)
+	keySet.mu.Unlock()
+
+	if err := keySet.Refresh(context.Background()); err == nil {
+		t.Fatalf("Refresh() succeeded against a failing endpoint")
+	}
+	keySet.mu.Lock()
+	keySet.lastAttempt = time.Now().Add(-2 * jwksMinRefreshInterval)
+	keySet.mu.Unlock()
+
+	if _, err := manager.ValidateToken(token); err != nil {
+		t.Errorf("ValidateToken() with the JWKS endpoint down error = %v", err)
+	}
+	if fetches := server.fetchCount(); fetches != 3 {
+		t.Errorf("%d fetches, want 3", fetches)
+	}
+}
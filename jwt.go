@@ -1,52 +1,315 @@
 package gotrust
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Default values of the JWT "typ" header (RFC 9068 / RFC 8725 explicit typing)
+const (
+	DefaultAccessTokenType  = "at+jwt"
+	DefaultRefreshTokenType = "rt+jwt"
+)
+
 type JWTManager struct {
-	secret    []byte
-	issuer    string
-	expiresIn time.Duration
+	secret           []byte
+	issuer           string
+	expiresIn        time.Duration
+	accessTokenType  string
+	refreshTokenType string
+	compactClaims    bool
+	keySet           *RemoteKeySet
+	signingKeys      map[string][]byte
+	activeKeyID      string
+	leeway           time.Duration
+	encryptionKey    []byte
+	audience         string
+	checkIssuer      bool
+	publicKey        interface{}
+	deriveKeys       bool
 }
 
 func NewJWTManager(secret string, issuer string, expiresIn time.Duration) *JWTManager {
 	return &JWTManager{
-		secret:    []byte(secret),
-		issuer:    issuer,
-		expiresIn: expiresIn,
+		secret:           []byte(secret),
+		issuer:           issuer,
+		expiresIn:        expiresIn,
+		accessTokenType:  DefaultAccessTokenType,
+		refreshTokenType: DefaultRefreshTokenType,
 	}
 }
 
+// SetTokenTypes overrides the "typ" header values of access and refresh
+// tokens. Empty values keep the defaults. The two must differ.
+func (j *JWTManager) SetTokenTypes(accessType, refreshType string) {
+	if accessType != "" {
+		j.accessTokenType = accessType
+	}
+	if refreshType != "" {
+		j.refreshTokenType = refreshType
+	}
+}
+
+// SetCompactClaims makes access tokens use short claim names ("idp" for the
+// provider, "tid" for the tenant), carry the user ID only in "sub" when it
+// matches the subject, and leave out the name. Tokens in either form validate.
+func (j *JWTManager) SetCompactClaims(compact bool) {
+	j.compactClaims = compact
+}
+
+// SetSigningKeys enables HMAC secret rotation. Tokens are signed with the
+// active key, whose ID is stamped in the "kid" header, and validated with the
+// key matching their kid. Tokens without a kid are validated with the secret
+// passed to NewJWTManager. To rotate, add the new key, make it active, and
+// remove the old key once the tokens it signed have expired.
+func (j *JWTManager) SetSigningKeys(keys map[string]string, activeKeyID string) error {
+	if len(keys) == 0 {
+		j.signingKeys = nil
+		j.activeKeyID = ""
+		return nil
+	}
+	if _, ok := keys[activeKeyID]; !ok {
+		return fmt.Errorf("active signing key %q is not among the signing keys", activeKeyID)
+	}
+	
+	signingKeys := make(map[string][]byte, len(keys))
+	for kid, secret := range keys {
+		if secret == "" {
+			return fmt.Errorf("signing key %q is empty", kid)
+		}
+		signingKeys[kid] = []byte(secret)
+	}
+	
+	j.signingKeys = signingKeys
+	j.activeKeyID = activeKeyID
+	return nil
+}
+
+// SetKeyDerivation makes refresh tokens use a key derived from the HMAC
+// secret (or each signing key) with HKDF instead of the secret itself.
+// Access tokens are unaffected. Refresh tokens issued before enabling it no
+// longer validate.
+func (j *JWTManager) SetKeyDerivation(enabled bool) {
+	j.deriveKeys = enabled
+}
+
+// purposeKey returns the key for purpose derived from an HMAC key when key
+// derivation is enabled; an empty purpose is the key itself
+func (j *JWTManager) purposeKey(key []byte, purpose string) []byte {
+	if !j.deriveKeys || purpose == "" {
+		return key
+	}
+	return deriveKey(key, purpose)
+}
+
+// sign signs a token with the active HMAC key, or the key derived from it
+// for purpose
+func (j *JWTManager) sign(token *jwt.Token, purpose string) (string, error) {
+	if j.activeKeyID != "" {
+		token.Header["kid"] = j.activeKeyID
+		return token.SignedString(j.purposeKey(j.signingKeys[j.activeKeyID], purpose))
+	}
+	return token.SignedString(j.purposeKey(j.secret, purpose))
+}
+
+// signingHeader returns the "alg" and "kid" headers of generated access
+// tokens; kid is empty without signing keys
+func (j *JWTManager) signingHeader() (alg, kid string) {
+	return jwt.SigningMethodHS256.Alg(), j.activeKeyID
+}
+
+// hmacKey selects the HMAC key that verifies a token by its "kid" header
+func (j *JWTManager) hmacKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	
+	if kid, _ := token.Header["kid"].(string); kid != "" && j.signingKeys != nil {
+		key, ok := j.signingKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return key, nil
+	}
+	
+	if len(j.secret) == 0 {
+		return nil, fmt.Errorf("no secret configured for %v tokens", token.Header["alg"])
+	}
+	return j.secret, nil
+}
+
+// refreshKey selects the key that verifies a refresh token
+func (j *JWTManager) refreshKey(token *jwt.Token) (interface{}, error) {
+	key, err := j.hmacKey(token)
+	if err != nil {
+		return nil, err
+	}
+	return j.purposeKey(key.([]byte), keyPurposeRefreshToken), nil
+}
+
+// SetKeySet makes ValidateToken accept asymmetrically signed (RS, PS, ES and
+// EdDSA) access tokens, verified with the key set's key matching the token's
+// "kid" header
+func (j *JWTManager) SetKeySet(keySet *RemoteKeySet) {
+	j.keySet = keySet
+}
+
+// SetAudience adds an "aud" claim to access tokens and makes ValidateToken
+// require it. An empty audience disables both.
+func (j *JWTManager) SetAudience(audience string) {
+	j.audience = audience
+}
+
+// SetLeeway tolerates clock skew of up to leeway when checking the exp, nbf
+// and iat claims of access and refresh tokens
+func (j *JWTManager) SetLeeway(leeway time.Duration) {
+	j.leeway = leeway
+}
+
+// verificationKey selects the key that verifies an access token
+func (j *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return j.hmacKey(token)
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+		if j.keySet == nil {
+			if j.publicKey != nil {
+				return j.publicKey, nil
+			}
+			break
+		}
+		kid, _ := token.Header["kid"].(string)
+		return j.keySet.Key(context.Background(), kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+}
+
+// checkTokenType verifies the "typ" header of a parsed token. Tokens issued
+// before explicit typing carry the generic "JWT" (or no) typ and are left to
+// the "type" claim check.
+func checkTokenType(token *jwt.Token, expected string) error {
+	typ, _ := token.Header["typ"].(string)
+	typ = strings.TrimPrefix(strings.ToLower(typ), "application/")
+	if typ == "" || typ == "jwt" {
+		return nil
+	}
+	if typ != strings.TrimPrefix(strings.ToLower(expected), "application/") {
+		return fmt.Errorf("unexpected token type: %s", typ)
+	}
+	return nil
+}
+
 func (j *JWTManager) GenerateToken(claims TokenClaims) (string, error) {
-	now := time.Now()
+	return j.generateTokenAt(claims, time.Now())
+}
+
+// generateTokenAt generates an access token issued at now
+func (j *JWTManager) generateTokenAt(claims TokenClaims, now time.Time) (string, error) {
+	subject := claims.Subject
+	if subject == "" {
+		subject = claims.UserID
+	}
 	
 	jwtClaims := jwt.MapClaims{
-		"user_id":  claims.UserID,
-		"email":    claims.Email,
-		"name":     claims.Name,
-		"provider": claims.Provider,
 		"iss":      j.issuer,
-		"sub":      claims.UserID,
+		"sub":      subject,
 		"iat":      now.Unix(),
 		"exp":      now.Add(j.expiresIn).Unix(),
 		"nbf":      now.Unix(),
 	}
+	if j.audience != "" {
+		jwtClaims["aud"] = j.audience
+	}
+	
+	if j.compactClaims {
+		if subject != claims.UserID {
+			jwtClaims["uid"] = claims.UserID
+		}
+		if claims.Provider != "" {
+			jwtClaims["idp"] = claims.Provider
+		}
+	} else {
+		jwtClaims["user_id"] = claims.UserID
+		jwtClaims["provider"] = claims.Provider
+	}
+	
+	if !claims.AuthTime.IsZero() {
+		jwtClaims["auth_time"] = claims.AuthTime.Unix()
+	}
+	
+	// Optional profile claims are left out when empty
+	if claims.Email != "" {
+		jwtClaims["email"] = claims.Email
+	}
+	if claims.Name != "" && !j.compactClaims {
+		jwtClaims["name"] = claims.Name
+	}
+	if len(claims.Roles) > 0 {
+		jwtClaims["roles"] = claims.Roles
+	}
+	if claims.SessionID != "" {
+		jwtClaims["sid"] = claims.SessionID
+	}
+	if claims.TokenVersion != 0 {
+		jwtClaims["tv"] = claims.TokenVersion
+	}
+	if claims.EmailVerified != nil {
+		jwtClaims["email_verified"] = *claims.EmailVerified
+	}
+	if !claims.VerifyBy.IsZero() {
+		jwtClaims["verify_by"] = claims.VerifyBy.Unix()
+	}
+	if claims.TenantID != "" {
+		if j.compactClaims {
+			jwtClaims["tid"] = claims.TenantID
+		} else {
+			jwtClaims["tenant_id"] = claims.TenantID
+		}
+	}
+	
+	// Custom claims never override the standard ones
+	for key, value := range claims.Extra {
+		if _, reserved := reservedClaims[key]; !reserved {
+			jwtClaims[key] = value
+		}
+	}
 	
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaims)
-	return token.SignedString(j.secret)
+	token.Header["typ"] = j.accessTokenType
+	signed, err := j.sign(token, "")
+	if err != nil || j.encryptionKey == nil {
+		return signed, err
+	}
+	return j.encryptToken(signed)
 }
 
 func (j *JWTManager) ValidateToken(tokenString string) (*TokenClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	return j.validateToken(tokenString, j.leeway)
+}
+
+// validateToken validates an access token, tolerating clock skew of leeway
+func (j *JWTManager) validateToken(tokenString string, leeway time.Duration) (*TokenClaims, error) {
+	// Encrypted tokens have five parts; decrypt, then verify the inner JWT
+	if strings.Count(tokenString, ".") == 4 {
+		signed, err := j.decryptToken(tokenString)
+		if err != nil {
+			return nil, err
 		}
-		return j.secret, nil
-	})
+		tokenString = signed
+	}
+	
+	options := []jwt.ParserOption{jwt.WithLeeway(leeway)}
+	if j.audience != "" {
+		options = append(options, jwt.WithAudience(j.audience))
+	}
+	if j.checkIssuer {
+		options = append(options, jwt.WithIssuer(j.issuer))
+	}
+	token, err := jwt.Parse(tokenString, j.verificationKey, options...)
 	
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -61,10 +324,38 @@ func (j *JWTManager) ValidateToken(tokenString string) (*TokenClaims, error) {
 		return nil, fmt.Errorf("invalid token claims")
 	}
 	
+	if err := checkTokenType(token, j.accessTokenType); err != nil {
+		return nil, err
+	}
+	
+	// Refresh tokens carry a "type" claim; access tokens never do
+	if tokenType, _ := claims["type"].(string); tokenType != "" {
+		return nil, fmt.Errorf("not an access token")
+	}
+	
 	userID, _ := claims["user_id"].(string)
 	email, _ := claims["email"].(string)
 	name, _ := claims["name"].(string)
 	provider, _ := claims["provider"].(string)
+	subject, _ := claims["sub"].(string)
+	sessionID, _ := claims["sid"].(string)
+	tokenVersion, _ := claims["tv"].(float64)
+	tenantID, _ := claims["tenant_id"].(string)
+	
+	var emailVerified *bool
+	if verified, ok := claims["email_verified"].(bool); ok {
+		emailVerified = &verified
+	}
+	
+	// Compact tokens use short claim names
+	if _, full := claims["user_id"]; !full {
+		userID, _ = claims["uid"].(string)
+		if userID == "" {
+			userID = subject
+		}
+		provider, _ = claims["idp"].(string)
+		tenantID, _ = claims["tid"].(string)
+	}
 	
 	if userID == "" {
 		return nil, fmt.Errorf("user_id not found in token")
@@ -75,55 +366,166 @@ func (j *JWTManager) ValidateToken(tokenString string) (*TokenClaims, error) {
 		Email:    email,
 		Name:     name,
 		Provider: provider,
+		Subject:  subject,
+		AuthTime: unixClaim(claims, "auth_time"),
+		Roles:    stringsClaim(claims, "roles"),
+		SessionID: sessionID,
+		TokenVersion: int64(tokenVersion),
+		TenantID: tenantID,
+		EmailVerified: emailVerified,
+		VerifyBy: unixClaim(claims, "verify_by"),
+		IssuedAt: unixClaim(claims, "iat"),
+		Extra:    extraClaims(claims),
 	}, nil
 }
 
+// reservedClaims are the claims GoTrust sets itself
+var reservedClaims = map[string]struct{}{
+	"user_id": {}, "email": {}, "name": {}, "provider": {}, "roles": {},
+	"sid": {}, "tv": {}, "tenant_id": {}, "type": {}, "auth_time": {},
+	"uid": {}, "idp": {}, "tid": {}, "email_verified": {}, "verify_by": {},
+	"iss": {}, "sub": {}, "aud": {}, "exp": {}, "nbf": {}, "iat": {}, "jti": {},
+}
+
+// extraClaims returns the custom (non-reserved) claims of a token
+func extraClaims(claims jwt.MapClaims) map[string]interface{} {
+	var extra map[string]interface{}
+	for key, value := range claims {
+		if _, reserved := reservedClaims[key]; reserved {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]interface{})
+		}
+		extra[key] = value
+	}
+	return extra
+}
+
+// stringsClaim reads a string array claim
+func stringsClaim(claims jwt.MapClaims, key string) []string {
+	values, _ := claims[key].([]interface{})
+	var result []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// unixClaim reads a numeric date claim, returning the zero time when absent
+func unixClaim(claims jwt.MapClaims, key string) time.Time {
+	if value, ok := claims[key].(float64); ok {
+		return time.Unix(int64(value), 0)
+	}
+	return time.Time{}
+}
+
+// RefreshTokenClaims represents refresh token claims
+type RefreshTokenClaims struct {
+	UserID    string
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	AuthTime  time.Time // original login time of the token family
+}
+
+const refreshTokenExpiration = 30 * 24 * time.Hour
+
 func (j *JWTManager) GenerateRefreshToken(userID string) (string, error) {
+	token, _, err := j.IssueRefreshToken(userID, time.Now())
+	return token, err
+}
+
+// IssueRefreshToken generates a refresh token with a unique token ID (jti).
+// authTime is the original login time, carried across refreshes.
+func (j *JWTManager) IssueRefreshToken(userID string, authTime time.Time) (string, *RefreshTokenClaims, error) {
 	now := time.Now()
+	refreshClaims := &RefreshTokenClaims{
+		UserID:    userID,
+		TokenID:   generateRandomString(32),
+		IssuedAt:  now,
+		ExpiresAt: now.Add(refreshTokenExpiration),
+		AuthTime:  authTime,
+	}
 	
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"type":    "refresh",
+		"jti":     refreshClaims.TokenID,
 		"iss":     j.issuer,
 		"sub":     userID,
 		"iat":     now.Unix(),
-		"exp":     now.Add(30 * 24 * time.Hour).Unix(), // 30 days
+		"exp":     refreshClaims.ExpiresAt.Unix(),
+		"auth_time": authTime.Unix(),
 	}
 	
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(j.secret)
+	token.Header["typ"] = j.refreshTokenType
+	signed, err := j.sign(token, keyPurposeRefreshToken)
+	if err != nil {
+		return "", nil, err
+	}
+	
+	return signed, refreshClaims, nil
 }
 
 func (j *JWTManager) ValidateRefreshToken(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return j.secret, nil
-	})
+	claims, err := j.ParseRefreshToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+	return claims.UserID, nil
+}
+
+// ParseRefreshToken validates a refresh token and returns its claims
+func (j *JWTManager) ParseRefreshToken(tokenString string) (*RefreshTokenClaims, error) {
+	token, err := jwt.Parse(tokenString, j.refreshKey, jwt.WithLeeway(j.leeway))
 	
 	if err != nil {
-		return "", fmt.Errorf("failed to parse refresh token: %w", err)
+		return nil, fmt.Errorf("failed to parse refresh token: %w", err)
 	}
 	
 	if !token.Valid {
-		return "", fmt.Errorf("invalid refresh token")
+		return nil, fmt.Errorf("invalid refresh token")
 	}
 	
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", fmt.Errorf("invalid refresh token claims")
+		return nil, fmt.Errorf("invalid refresh token claims")
+	}
+	
+	if err := checkTokenType(token, j.refreshTokenType); err != nil {
+		return nil, err
 	}
 	
 	tokenType, _ := claims["type"].(string)
 	if tokenType != "refresh" {
-		return "", fmt.Errorf("not a refresh token")
+		return nil, fmt.Errorf("not a refresh token")
 	}
 	
 	userID, _ := claims["user_id"].(string)
 	if userID == "" {
-		return "", fmt.Errorf("user_id not found in refresh token")
+		return nil, fmt.Errorf("user_id not found in refresh token")
+	}
+	
+	tokenID, _ := claims["jti"].(string)
+	
+	refreshClaims := &RefreshTokenClaims{
+		UserID:  userID,
+		TokenID: tokenID,
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		refreshClaims.IssuedAt = iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		refreshClaims.ExpiresAt = exp.Time
+	}
+	refreshClaims.AuthTime = unixClaim(claims, "auth_time")
+	if refreshClaims.AuthTime.IsZero() {
+		refreshClaims.AuthTime = refreshClaims.IssuedAt
 	}
 	
-	return userID, nil
-}
\ No newline at end of file
+	return refreshClaims, nil
+}
@@ -0,0 +1,463 @@
+package gotrust
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// tokenPayload decodes the claims of a JWT without verifying it
+func tokenPayload(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed token %q", token)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("failed to decode token payload: %v", err)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatalf("failed to parse token payload: %v", err)
+	}
+	return payload
+}
+
+func TestCompactClaims(t *testing.T) {
+	tests := []struct {
+		name        string
+		compact     bool
+		subject     string
+		wantClaims  []string
+		wantMissing []string
+	}{
+		{
+			name:        "full claims",
+			wantClaims:  []string{"user_id", "provider", "tenant_id", "name"},
+			wantMissing: []string{"uid", "idp", "tid"},
+		},
+		{
+			name:        "compact claims",
+			compact:     true,
+			wantClaims:  []string{"idp", "tid"},
+			wantMissing: []string{"user_id", "uid", "provider", "tenant_id", "name"},
+		},
+		{
+			name:        "compact claims with a custom subject",
+			compact:     true,
+			subject:     "external-7",
+			wantClaims:  []string{"uid", "idp", "tid"},
+			wantMissing: []string{"user_id", "provider", "tenant_id", "name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := NewJWTManager(testSecret, "gotrust", time.Hour)
+			issuer.SetCompactClaims(tt.compact)
+
+			token, err := issuer.GenerateToken(TokenClaims{
+				UserID:   "user-1",
+				Subject:  tt.subject,
+				Email:    "jane@example.com",
+				Name:     "Jane",
+				Provider: "github",
+				TenantID: "acme",
+			})
+			if err != nil {
+				t.Fatalf("GenerateToken() error = %v", err)
+			}
+
+			payload := tokenPayload(t, token)
+			for _, claim := range tt.wantClaims {
+				if _, ok := payload[claim]; !ok {
+					t.Errorf("token lacks the %q claim", claim)
+				}
+			}
+			for _, claim := range tt.wantMissing {
+				if _, ok := payload[claim]; ok {
+					t.Errorf("token carries the %q claim", claim)
+				}
+			}
+
+			// Tokens in either form validate regardless of the setting
+			for _, compact := range []bool{false, true} {
+				verifier := NewJWTManager(testSecret, "gotrust", time.Hour)
+				verifier.SetCompactClaims(compact)
+
+				claims, err := verifier.ValidateToken(token)
+				if err != nil {
+					t.Fatalf("ValidateToken() error = %v", err)
+				}
+				if claims.UserID != "user-1" || claims.Provider != "github" || claims.TenantID != "acme" {
+					t.Errorf("ValidateToken() = %+v", claims)
+				}
+			}
+		})
+	}
+}
+
+func TestSubjectFunc(t *testing.T) {
+	tests := []struct {
+		name        string
+		subjectFunc func(*User) string
+		wantSubject func(*User) string
+	}{
+		{name: "default subject", wantSubject: func(u *User) string { return u.ID }},
+		{
+			name:        "custom subject",
+			subjectFunc: func(u *User) string { return "urn:example:user:" + u.Email },
+			wantSubject: func(u *User) string { return "urn:example:user:" + u.Email },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, func(c *Config) { c.SubjectFunc = tt.subjectFunc })
+			response := signUp(t, a, "jane@example.com")
+
+			payload := tokenPayload(t, response.AccessToken)
+			if payload["sub"] != tt.wantSubject(response.User) {
+				t.Errorf("sub = %v, want %q", payload["sub"], tt.wantSubject(response.User))
+			}
+			if payload["user_id"] != response.User.ID {
+				t.Errorf("user_id = %v, want %q", payload["user_id"], response.User.ID)
+			}
+
+			claims, err := a.ValidateToken(response.AccessToken)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+			if claims.UserID != response.User.ID || claims.Subject != tt.wantSubject(response.User) {
+				t.Errorf("ValidateToken() = user %q, subject %q", claims.UserID, claims.Subject)
+			}
+		})
+	}
+}
+
+func TestTokenTypeHeader(t *testing.T) {
+	manager := NewJWTManager(testSecret, "gotrust", time.Hour)
+
+	access, err := manager.GenerateToken(TokenClaims{UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	refresh, err := manager.GenerateRefreshToken("user-1")
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken() error = %v", err)
+	}
+
+	// signed signs claims under a chosen typ header with the manager's key
+	signed := func(typ string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["typ"] = typ
+		s, err := manager.sign(token, "")
+		if err != nil {
+			t.Fatalf("sign() error = %v", err)
+		}
+		return s
+	}
+	now := time.Now()
+	accessClaims := jwt.MapClaims{"user_id": "user-1", "iss": "gotrust", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix()}
+	refreshClaims := jwt.MapClaims{"user_id": "user-1", "type": "refresh", "iss": "gotrust", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name        string
+		token       string
+		wantAccess  bool
+		wantRefresh bool
+	}{
+		{name: "access token", token: access, wantAccess: true},
+		{name: "refresh token", token: refresh, wantRefresh: true},
+		{name: "refresh claims under access typ", token: signed(DefaultAccessTokenType, refreshClaims)},
+		{name: "access claims under refresh typ", token: signed(DefaultRefreshTokenType, accessClaims)},
+		{name: "unknown typ", token: signed("id+jwt", accessClaims)},
+		{name: "legacy access token", token: signed("JWT", accessClaims), wantAccess: true},
+		{name: "legacy refresh token", token: signed("JWT", refreshClaims), wantRefresh: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := manager.ValidateToken(tt.token); (err == nil) != tt.wantAccess {
+				t.Errorf("ValidateToken() error = %v, want accepted %v", err, tt.wantAccess)
+			}
+			if _, err := manager.ParseRefreshToken(tt.token); (err == nil) != tt.wantRefresh {
+				t.Errorf("ParseRefreshToken() error = %v, want accepted %v", err, tt.wantRefresh)
+			}
+		})
+	}
+}
+
+func TestSetTokenTypes(t *testing.T) {
+	manager := NewJWTManager(testSecret, "gotrust", time.Hour)
+	manager.SetTokenTypes("application/custom-at+jwt", "")
+
+	access, err := manager.GenerateToken(TokenClaims{UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	if _, err := manager.ValidateToken(access); err != nil {
+		t.Errorf("ValidateToken() error = %v", err)
+	}
+
+	other := NewJWTManager(testSecret, "gotrust", time.Hour)
+	if _, err := other.ValidateToken(access); err == nil {
+		t.Errorf("ValidateToken() accepted a token with another access typ")
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	manager := NewJWTManager(testSecret, "gotrust", time.Hour)
+	legacy, err := manager.GenerateToken(TokenClaims{UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	tokens := map[string]string{"legacy": legacy}
+
+	// Each step reconfigures the keys, issues a token under the active key,
+	// and checks which of the tokens issued so far are still accepted
+	steps := []struct {
+		name         string
+		keys         map[string]string
+		active       string
+		wantAccepted []string
+		wantRejected []string
+	}{
+		{
+			name:         "first key",
+			keys:         map[string]string{"k1": "secret-one"},
+			active:       "k1",
+			wantAccepted: []string{"legacy", "k1"},
+		},
+		{
+			name:         "new key introduced",
+			keys:         map[string]string{"k1": "secret-one", "k2": "secret-two"},
+			active:       "k1",
+			wantAccepted: []string{"legacy", "k1"},
+		},
+		{
+			name:         "new key active",
+			keys:         map[string]string{"k1": "secret-one", "k2": "secret-two"},
+			active:       "k2",
+			wantAccepted: []string{"legacy", "k1", "k2"},
+		},
+		{
+			name:         "old key retired",
+			keys:         map[string]string{"k2": "secret-two"},
+			active:       "k2",
+			wantAccepted: []string{"legacy", "k2"},
+			wantRejected: []string{"k1"},
+		},
+	}
+
+	for _, step := range steps {
+		if err := manager.SetSigningKeys(step.keys, step.active); err != nil {
+			t.Fatalf("%s: SetSigningKeys() error = %v", step.name, err)
+		}
+		token, err := manager.GenerateToken(TokenClaims{UserID: "user-1"})
+		if err != nil {
+			t.Fatalf("%s: GenerateToken() error = %v", step.name, err)
+		}
+		if kid := tokenHeader(t, token)["kid"]; kid != step.active {
+			t.Errorf("%s: token kid = %v, want %s", step.name, kid, step.active)
+		}
+		if _, issued := tokens[step.active]; !issued {
+			tokens[step.active] = token
+		}
+
+		for _, kid := range step.wantAccepted {
+			if _, err := manager.ValidateToken(tokens[kid]); err != nil {
+				t.Errorf("%s: ValidateToken(%s token) error = %v", step.name, kid, err)
+			}
+		}
+		for _, kid := range step.wantRejected {
+			if _, err := manager.ValidateToken(tokens[kid]); err == nil {
+				t.Errorf("%s: ValidateToken(%s token) accepted a retired key", step.name, kid)
+			}
+		}
+	}
+}
+
+func TestSetSigningKeysErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   map[string]string
+		active string
+	}{
+		{name: "unknown active key", keys: map[string]string{"k1": "secret-one"}, active: "k2"},
+		{name: "empty secret", keys: map[string]string{"k1": "secret-one", "k2": ""}, active: "k1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewJWTManager(testSecret, "gotrust", time.Hour)
+			if err := manager.SetSigningKeys(tt.keys, tt.active); err == nil {
+				t.Fatal("SetSigningKeys() error = nil")
+			}
+
+			// The manager keeps signing with its secret
+			token, err := manager.GenerateToken(TokenClaims{UserID: "user-1"})
+			if err != nil {
+				t.Fatalf("GenerateToken() error = %v", err)
+			}
+			if kid, ok := tokenHeader(t, token)["kid"]; ok {
+				t.Errorf("token kid = %v, want none", kid)
+			}
+		})
+	}
+}
+
+func TestConfigSigningKeys(t *testing.T) {
+	a, _, _ := newTestService(t, func(c *Config) {
+		c.JWTSigningKeys = map[string]string{"2024-01": "secret-one", "2024-06": "secret-two"}
+		c.JWTActiveKeyID = "2024-06"
+	})
+
+	response := signUp(t, a, "jane@example.com")
+	if kid := tokenHeader(t, response.AccessToken)["kid"]; kid != "2024-06" {
+		t.Errorf("access token kid = %v, want 2024-06", kid)
+	}
+	if _, err := a.ValidateToken(response.AccessToken); err != nil {
+		t.Errorf("ValidateToken() error = %v", err)
+	}
+}
+
+// tokenHeader decodes the header of a JWT without verifying it
+func tokenHeader(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	if err != nil {
+		t.Fatalf("failed to decode token header: %v", err)
+	}
+	var header map[string]interface{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		t.Fatalf("failed to parse token header: %v", err)
+	}
+	return header
+}
+
+func TestRefreshTokenLeeway(t *testing.T) {
+	// refreshToken signs a refresh token as if issued by a server whose clock
+	// is off by skew and that expires after ttl by that clock
+	refreshToken := func(t *testing.T, manager *JWTManager, skew, ttl time.Duration) string {
+		t.Helper()
+
+		issued := time.Now().Add(skew)
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user_id": "user-1",
+			"type":    "refresh",
+			"jti":     "token-1",
+			"iss":     "gotrust",
+			"iat":     issued.Unix(),
+			"exp":     issued.Add(ttl).Unix(),
+		})
+		token.Header["typ"] = DefaultRefreshTokenType
+		signed, err := manager.sign(token, keyPurposeRefreshToken)
+		if err != nil {
+			t.Fatalf("sign() error = %v", err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		leeway  time.Duration
+		skew    time.Duration
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{name: "issued slightly in the future", leeway: 30 * time.Second, skew: 10 * time.Second, ttl: time.Hour},
+		{name: "expired within the leeway", leeway: 30 * time.Second, skew: -time.Hour, ttl: time.Hour - 10*time.Second},
+		{name: "expired beyond the leeway", leeway: 30 * time.Second, skew: -time.Hour, ttl: time.Hour - time.Minute, wantErr: true},
+		{name: "expired without leeway", skew: -time.Hour, ttl: time.Hour - 10*time.Second, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewJWTManager(testSecret, "gotrust", time.Hour)
+			manager.SetLeeway(tt.leeway)
+
+			userID, err := manager.ValidateRefreshToken(refreshToken(t, manager, tt.skew, tt.ttl))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateRefreshToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && userID != "user-1" {
+				t.Errorf("ValidateRefreshToken() = %q, want user-1", userID)
+			}
+		})
+	}
+}
+
+func TestAuthResponseTokenMetadata(t *testing.T) {
+	tests := []struct {
+		name          string
+		configure     func(c *Config)
+		wantTokenType string
+		wantAlg       string
+		wantKid       string
+	}{
+		{name: "default", configure: func(c *Config) {}, wantTokenType: "Bearer"},
+		{name: "custom scheme", configure: func(c *Config) { c.AuthScheme = "Token" }, wantTokenType: "Token"},
+		{name: "metadata", configure: func(c *Config) { c.ExposeTokenMetadata = true }, wantTokenType: "Bearer", wantAlg: "HS256"},
+		{
+			name: "metadata with signing keys",
+			configure: func(c *Config) {
+				c.ExposeTokenMetadata = true
+				c.JWTSigningKeys = map[string]string{"2024-01": "secret-one", "2024-06": "secret-two"}
+				c.JWTActiveKeyID = "2024-06"
+			},
+			wantTokenType: "Bearer",
+			wantAlg:       "HS256",
+			wantKid:       "2024-06",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, tt.configure)
+			signUp(t, a, "jane@example.com")
+
+			ctx := newTestContext(http.MethodPost, "/auth/signin", fmt.Sprintf(`{"email": "jane@example.com", "password": %q}`, testPassword))
+			serve(t, ctx, h.SignInHandler)
+			if ctx.status() != http.StatusOK {
+				t.Fatalf("status = %d", ctx.status())
+			}
+
+			body := ctx.body(t)
+			if body["token_type"] != tt.wantTokenType {
+				t.Errorf("token_type = %v, want %q", body["token_type"], tt.wantTokenType)
+			}
+			alg, _ := body["alg"].(string)
+			kid, _ := body["kid"].(string)
+			if alg != tt.wantAlg || kid != tt.wantKid {
+				t.Errorf("alg, kid = %q, %q, want %q, %q", alg, kid, tt.wantAlg, tt.wantKid)
+			}
+
+			// The metadata matches the token's own header
+			header := tokenHeader(t, body["access_token"].(string))
+			if tt.wantAlg != "" && (header["alg"] != alg || (kid != "" && header["kid"] != kid)) {
+				t.Errorf("token header = %v, response alg, kid = %q, %q", header, alg, kid)
+			}
+
+			// Refreshed responses carry the token type as well
+			refreshToken, _ := body["refresh_token"].(string)
+			refreshed, err := a.RefreshToken(context.Background(), refreshToken)
+			if err != nil {
+				t.Fatalf("RefreshToken() error = %v", err)
+			}
+			if refreshed.TokenType != tt.wantTokenType {
+				t.Errorf("refreshed TokenType = %q, want %q", refreshed.TokenType, tt.wantTokenType)
+			}
+		})
+	}
+}
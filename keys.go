@@ -0,0 +1,27 @@
+package gotrust
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// HKDF info labels of the keys derived from the master secret when
+// Config.DeriveKeys is set. Changing a label changes its key.
+const (
+	keyPurposeRefreshToken = "gotrust refresh token v1"
+	keyPurposeOAuthState   = "gotrust oauth state v1"
+)
+
+// deriveKey derives a 32-byte key for purpose from a master secret with
+// HKDF-SHA256. The result only depends on its inputs, so it is stable across
+// restarts and instances.
+func deriveKey(secret []byte, purpose string) []byte {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(purpose)), key); err != nil {
+		// HKDF-SHA256 can produce up to 8160 bytes
+		panic(err)
+	}
+	return key
+}
@@ -0,0 +1,75 @@
+package gotrust
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDeriveKey(t *testing.T) {
+	secret := []byte(testSecret)
+
+	tests := []struct {
+		name     string
+		a, b     []byte
+		wantSame bool
+	}{
+		{name: "stable across calls", a: deriveKey(secret, keyPurposeRefreshToken), b: deriveKey([]byte(testSecret), keyPurposeRefreshToken), wantSame: true},
+		{name: "purposes differ", a: deriveKey(secret, keyPurposeRefreshToken), b: deriveKey(secret, keyPurposeOAuthState)},
+		{name: "secrets differ", a: deriveKey(secret, keyPurposeOAuthState), b: deriveKey([]byte("other-secret"), keyPurposeOAuthState)},
+		{name: "differs from the secret", a: deriveKey(secret, keyPurposeRefreshToken), b: secret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bytes.Equal(tt.a, tt.b); got != tt.wantSame {
+				t.Errorf("keys equal = %v, want %v", got, tt.wantSame)
+			}
+		})
+	}
+
+	if len(deriveKey(secret, keyPurposeRefreshToken)) != 32 {
+		t.Errorf("derived key length = %d, want 32", len(deriveKey(secret, keyPurposeRefreshToken)))
+	}
+}
+
+func TestRefreshTokenKeyDerivation(t *testing.T) {
+	tests := []struct {
+		name         string
+		issuerDerive bool
+		verifyDerive bool
+		wantErr      bool
+	}{
+		{name: "derivation disabled"},
+		{name: "derived keys after a restart", issuerDerive: true, verifyDerive: true},
+		{name: "token from before enabling", verifyDerive: true, wantErr: true},
+		{name: "derived token without derivation", issuerDerive: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Separate managers stand in for instances before and after a restart
+			issuer := NewJWTManager(testSecret, "gotrust", time.Hour)
+			issuer.SetKeyDerivation(tt.issuerDerive)
+			verifier := NewJWTManager(testSecret, "gotrust", time.Hour)
+			verifier.SetKeyDerivation(tt.verifyDerive)
+
+			refresh, _, err := issuer.IssueRefreshToken("user-1", time.Now())
+			if err != nil {
+				t.Fatalf("IssueRefreshToken() error = %v", err)
+			}
+			if _, err := verifier.ParseRefreshToken(refresh); (err != nil) != tt.wantErr {
+				t.Errorf("ParseRefreshToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// Access tokens keep using the secret itself
+			access, err := issuer.GenerateToken(TokenClaims{UserID: "user-1"})
+			if err != nil {
+				t.Fatalf("GenerateToken() error = %v", err)
+			}
+			if _, err := verifier.ValidateToken(access); err != nil {
+				t.Errorf("ValidateToken() error = %v", err)
+			}
+		})
+	}
+}
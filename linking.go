@@ -0,0 +1,124 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Account linking modes for OAuth logins whose email matches an existing account
+const (
+	// AccountLinkingAuto links the OAuth identity without further checks
+	AccountLinkingAuto = "auto"
+	// AccountLinkingVerifiedOnly links only if the provider reports the email as verified
+	AccountLinkingVerifiedOnly = "verified-only"
+	// AccountLinkingManual requires the user to confirm with their existing credentials
+	AccountLinkingManual = "manual"
+)
+
+// AccountLinkRequiredError is returned by OAuthSignIn in manual linking mode.
+// The link is completed by calling ConfirmAccountLink with LinkToken and the
+// existing account's credentials.
+type AccountLinkRequiredError struct {
+	LinkToken string
+	Email     string
+	Provider  string
+}
+
+func (e *AccountLinkRequiredError) Error() string {
+	return "account link confirmation required"
+}
+
+// pendingLink is an OAuth identity waiting for the account owner's confirmation
+type pendingLink struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Provider  string    `json:"provider"`
+	Name      string    `json:"name"`
+	AvatarURL string    `json:"avatar_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+const pendingLinkPrefix = "oauth:link"
+
+// checkAccountLink decides whether an OAuth identity may be attached to an
+// existing account according to Config.OAuthAccountLinkingMode
+func (a *AuthService) checkAccountLink(ctx context.Context, user *User, oauthUser *OAuthUserInfo) error {
+	switch a.config.OAuthAccountLinkingMode {
+	case AccountLinkingAuto:
+		return nil
+	case AccountLinkingManual:
+		link := &pendingLink{
+			UserID:    user.ID,
+			Email:     user.Email,
+			Provider:  oauthUser.Provider,
+			Name:      oauthUser.Name,
+			AvatarURL: oauthUser.AvatarURL,
+			ExpiresAt: time.Now().Add(a.config.OAuthStateExpiration),
+		}
+
+		linkToken := generateRandomString(32)
+		key := fmt.Sprintf("%s:%s", pendingLinkPrefix, linkToken)
+		if err := a.sessionStore.Set(ctx, key, link, a.config.OAuthStateExpiration); err != nil {
+			return fmt.Errorf("failed to store account link: %w", err)
+		}
+
+		return &AccountLinkRequiredError{
+			LinkToken: linkToken,
+			Email:     user.Email,
+			Provider:  oauthUser.Provider,
+		}
+	default:
+		if !oauthUser.EmailVerified {
+			return fmt.Errorf("an account with this email already exists and the provider email is not verified")
+		}
+		return nil
+	}
+}
+
+// ConfirmAccountLink completes a manual account link by authenticating with
+// the existing account's credentials
+func (a *AuthService) ConfirmAccountLink(ctx context.Context, linkToken string, req *SignInRequest) (*AuthResponse, error) {
+	key := fmt.Sprintf("%s:%s", pendingLinkPrefix, linkToken)
+
+	var link pendingLink
+	if err := a.sessionStore.Get(ctx, key, &link); err != nil {
+		return nil, fmt.Errorf("account link not found or expired")
+	}
+
+	if time.Now().After(link.ExpiresAt) {
+		a.sessionStore.Delete(ctx, key)
+		return nil, fmt.Errorf("account link expired")
+	}
+
+	user, hashedPassword, err := a.userStore.GetUserByEmail(ctx, req.Email)
+	if err != nil || user.ID != link.UserID || hashedPassword == "" {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	if err := a.verifyPassword(ctx, user, hashedPassword, req.Password); err != nil {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	// Links are single use; a concurrent confirmation may have consumed it
+	if err := consumeKey(ctx, a.sessionStore, key, &link); err != nil {
+		return nil, fmt.Errorf("account link not found or expired")
+	}
+
+	if !user.HasProvider(link.Provider) {
+		user.LinkedProviders = append(user.LinkedProviders, link.Provider)
+	}
+	if link.Name != "" {
+		user.Name = link.Name
+	}
+	if link.AvatarURL != "" {
+		user.AvatarURL = link.AvatarURL
+	}
+	user.UpdatedAt = time.Now()
+
+	if err := a.userStore.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to link account: %w", err)
+	}
+
+	return a.generateAuthResponse(ctx, user)
+}
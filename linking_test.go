@@ -0,0 +1,69 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAccountLinkingModes(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		verified     bool
+		wantLinked   bool
+		wantLinkStep bool
+	}{
+		{name: "auto with unverified email", mode: AccountLinkingAuto, wantLinked: true},
+		{name: "verified-only with verified email", mode: AccountLinkingVerifiedOnly, verified: true, wantLinked: true},
+		{name: "verified-only with unverified email", mode: AccountLinkingVerifiedOnly},
+		{name: "default with unverified email", mode: NewConfig().OAuthAccountLinkingMode},
+		{name: "manual with verified email", mode: AccountLinkingManual, verified: true, wantLinkStep: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, users, _ := newTestService(t, func(c *Config) { c.OAuthAccountLinkingMode = tt.mode })
+			user := signUp(t, a, "jane@example.com").User
+
+			oauthUser := &OAuthUserInfo{ID: "7", Email: "jane@example.com", EmailVerified: tt.verified, Provider: string(ProviderGitHub)}
+			response, err := a.signInOAuthUser(context.Background(), ProviderGitHub, oauthUser)
+
+			var linkErr *AccountLinkRequiredError
+			if got := errors.As(err, &linkErr); got != tt.wantLinkStep {
+				t.Fatalf("signInOAuthUser() error = %v, want link confirmation %v", err, tt.wantLinkStep)
+			}
+			if tt.wantLinked {
+				if err != nil {
+					t.Fatalf("signInOAuthUser() error = %v", err)
+				}
+				if response.User.ID != user.ID {
+					t.Errorf("signInOAuthUser() signed in as %q, want %q", response.User.ID, user.ID)
+				}
+			} else if err == nil {
+				t.Fatalf("signInOAuthUser() linked the account in %q mode", tt.mode)
+			}
+
+			stored, _ := users.GetUserByID(context.Background(), user.ID)
+			if stored.HasProvider(string(ProviderGitHub)) != tt.wantLinked {
+				t.Errorf("account linked = %v, want %v", !tt.wantLinked, tt.wantLinked)
+			}
+
+			if linkErr == nil {
+				return
+			}
+			if _, err := a.ConfirmAccountLink(context.Background(), linkErr.LinkToken, &SignInRequest{Email: user.Email, Password: "wrong"}); err == nil {
+				t.Errorf("ConfirmAccountLink() accepted a wrong password")
+			}
+			if _, err := a.ConfirmAccountLink(context.Background(), linkErr.LinkToken, &SignInRequest{Email: user.Email, Password: testPassword}); err != nil {
+				t.Fatalf("ConfirmAccountLink() error = %v", err)
+			}
+			if _, err := a.ConfirmAccountLink(context.Background(), linkErr.LinkToken, &SignInRequest{Email: user.Email, Password: testPassword}); err == nil {
+				t.Errorf("ConfirmAccountLink() accepted a link token twice")
+			}
+			if stored, _ := users.GetUserByID(context.Background(), user.ID); !stored.HasProvider(string(ProviderGitHub)) {
+				t.Errorf("ConfirmAccountLink() did not link the account")
+			}
+		})
+	}
+}
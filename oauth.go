@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,6 +16,10 @@ type OAuthManager struct {
 	config        *Config
 	sessionStore  SessionStore
 	statePrefix   string
+	states        *stateTracker
+	
+	breakersMu sync.Mutex
+	breakers   map[OAuthProvider]*circuitBreaker
 }
 
 func NewOAuthManager(config *Config, sessionStore SessionStore) *OAuthManager {
@@ -22,34 +27,45 @@ func NewOAuthManager(config *Config, sessionStore SessionStore) *OAuthManager {
 		config:       config,
 		sessionStore: sessionStore,
 		statePrefix:  "oauth:state",
+		states:       newStateTracker(),
 	}
 }
 
 // GetAuthURL generates the OAuth authorization URL
 func (o *OAuthManager) GetAuthURL(provider OAuthProvider, redirectURI string) (string, error) {
-	state := generateRandomString(32)
-	
-	// Store state with redirect URI
-	stateData := &OAuthState{
-		State:       state,
-		RedirectURI: redirectURI,
-		ExpiresAt:   time.Now().Add(o.config.OAuthStateExpiration),
+	return o.GetAuthURLWithParams(provider, redirectURI, nil)
+}
+
+// GetAuthURLWithParams generates the OAuth authorization URL with optional
+// provider params, such as Google's login_hint and prompt, appended. Params
+// the provider does not accept fail with ErrInvalidAuthParam.
+func (o *OAuthManager) GetAuthURLWithParams(provider OAuthProvider, redirectURI string, params url.Values) (string, error) {
+	if err := validateAuthParams(provider, params); err != nil {
+		return "", err
 	}
 	
-	ctx := context.Background()
-	stateKey := fmt.Sprintf("%s:%s", o.statePrefix, state)
-	if err := o.sessionStore.Set(ctx, stateKey, stateData, o.config.OAuthStateExpiration); err != nil {
-		return "", fmt.Errorf("failed to store oauth state: %w", err)
+	state, err := o.newState(redirectURI)
+	if err != nil {
+		return "", err
 	}
 	
+	var authURL string
 	switch provider {
 	case ProviderGoogle:
-		return o.getGoogleAuthURL(state)
+		authURL, err = o.getGoogleAuthURL(state)
 	case ProviderGitHub:
-		return o.getGitHubAuthURL(state)
+		authURL, err = o.getGitHubAuthURL(state)
+	case ProviderGitLab:
+		authURL, err = o.getGitLabAuthURL(state)
+	case ProviderDiscord:
+		authURL, err = o.getDiscordAuthURL(state)
 	default:
 		return "", fmt.Errorf("unsupported provider: %s", provider)
 	}
+	if err != nil || len(params) == 0 {
+		return authURL, err
+	}
+	return authURL + "&" + params.Encode(), nil
 }
 
 func (o *OAuthManager) getGoogleAuthURL(state string) (string, error) {
@@ -98,24 +114,68 @@ func (o *OAuthManager) ValidateCallback(provider OAuthProvider, state, code stri
 	case ProviderGitHub:
 		userInfo, err := o.handleGitHubCallback(code)
 		return userInfo, redirectURI, err
+	case ProviderGitLab:
+		userInfo, err := o.handleGitLabCallback(code)
+		return userInfo, redirectURI, err
+	case ProviderDiscord:
+		userInfo, err := o.handleDiscordCallback(code)
+		return userInfo, redirectURI, err
 	default:
 		return nil, "", fmt.Errorf("unsupported provider: %s", provider)
 	}
 }
 
+// newState creates the state parameter carrying the redirect URI
+func (o *OAuthManager) newState(redirectURI string) (string, error) {
+	if o.config.OAuthStateMode == OAuthStateModeSigned {
+		return o.newSignedState(redirectURI)
+	}
+	
+	state := generateRandomString(32)
+	
+	// Store state with redirect URI
+	stateData := &OAuthState{
+		State:       state,
+		RedirectURI: redirectURI,
+		ExpiresAt:   time.Now().Add(o.config.OAuthStateExpiration),
+	}
+	
+	ctx := context.Background()
+	stateKey := fmt.Sprintf("%s:%s", o.statePrefix, state)
+	if err := o.sessionStore.Set(ctx, stateKey, stateData, o.config.OAuthStateExpiration); err != nil {
+		return "", fmt.Errorf("failed to store oauth state: %w", err)
+	}
+	
+	// Bound the outstanding states and drop expired ones for stores without
+	// native TTL support
+	o.deleteStates(ctx, o.states.add(stateKey, stateData.ExpiresAt, o.config.OAuthMaxPendingStates))
+	
+	return state, nil
+}
+
 func (o *OAuthManager) validateState(state string) (string, error) {
+	if o.config.OAuthStateMode == OAuthStateModeSigned {
+		return o.validateSignedState(state)
+	}
+	
 	ctx := context.Background()
 	stateKey := fmt.Sprintf("%s:%s", o.statePrefix, state)
 	
+	// States are single use
 	var stateData OAuthState
-	if err := o.sessionStore.Get(ctx, stateKey, &stateData); err != nil {
+	o.states.forget(stateKey)
+	if err := consumeKey(ctx, o.sessionStore, stateKey, &stateData); err != nil {
 		return "", fmt.Errorf("state not found or expired")
 	}
+
+	if !secureCompare(stateData.State, state) {
+		return "", fmt.Errorf("state mismatch")
+	}
 	
-	// Delete used state
-	o.sessionStore.Delete(ctx, stateKey)
-	
-	if time.Now().After(stateData.ExpiresAt) {
+	// Stores may not expire keys on their own, so check the expiry recorded
+	// in the state, and that it is within the configured maximum age
+	now := time.Now()
+	if now.After(stateData.ExpiresAt) || stateData.ExpiresAt.After(now.Add(o.config.OAuthStateExpiration)) {
 		return "", fmt.Errorf("state expired")
 	}
 	
@@ -132,7 +192,14 @@ func (o *OAuthManager) handleGoogleCallback(code string) (*OAuthUserInfo, error)
 	data.Set("grant_type", "authorization_code")
 	data.Set("redirect_uri", o.config.GoogleRedirectURI)
 	
-	resp, err := http.Post(tokenURL, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	
+	resp, err := o.doProviderRequest(ProviderGoogle, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code: %w", err)
 	}
@@ -150,17 +217,20 @@ func (o *OAuthManager) handleGoogleCallback(code string) (*OAuthUserInfo, error)
 		return nil, fmt.Errorf("failed to parse token response: %w", err)
 	}
 	
-	// Get user info
+	return o.getGoogleUserInfo(tokenResp.AccessToken)
+}
+
+// getGoogleUserInfo fetches the profile of the user an access token belongs to
+func (o *OAuthManager) getGoogleUserInfo(accessToken string) (*OAuthUserInfo, error) {
 	userInfoURL := "https://www.googleapis.com/oauth2/v2/userinfo"
 	req, err := http.NewRequest("GET", userInfoURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	
-	req.Header.Set("Authorization", "Bearer "+tokenResp.AccessToken)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
 	
-	client := &http.Client{}
-	userResp, err := client.Do(req)
+	userResp, err := o.doProviderRequest(ProviderGoogle, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
@@ -171,10 +241,11 @@ func (o *OAuthManager) handleGoogleCallback(code string) (*OAuthUserInfo, error)
 	}
 	
 	var googleUser struct {
-		ID      string `json:"id"`
-		Email   string `json:"email"`
-		Name    string `json:"name"`
-		Picture string `json:"picture"`
+		ID            string `json:"id"`
+		Email         string `json:"email"`
+		VerifiedEmail bool   `json:"verified_email"`
+		Name          string `json:"name"`
+		Picture       string `json:"picture"`
 	}
 	
 	if err := json.NewDecoder(userResp.Body).Decode(&googleUser); err != nil {
@@ -184,6 +255,7 @@ func (o *OAuthManager) handleGoogleCallback(code string) (*OAuthUserInfo, error)
 	return &OAuthUserInfo{
 		ID:        googleUser.ID,
 		Email:     googleUser.Email,
+		EmailVerified: googleUser.VerifiedEmail,
 		Name:      googleUser.Name,
 		AvatarURL: googleUser.Picture,
 		Provider:  string(ProviderGoogle),
@@ -206,8 +278,7 @@ func (o *OAuthManager) handleGitHubCallback(code string) (*OAuthUserInfo, error)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Accept", "application/json")
 	
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := o.doProviderRequest(ProviderGitHub, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code: %w", err)
 	}
@@ -225,17 +296,21 @@ func (o *OAuthManager) handleGitHubCallback(code string) (*OAuthUserInfo, error)
 		return nil, fmt.Errorf("failed to parse token response: %w", err)
 	}
 	
-	// Get user info
+	return o.getGitHubUserInfo(tokenResp.AccessToken)
+}
+
+// getGitHubUserInfo fetches the profile of the user an access token belongs to
+func (o *OAuthManager) getGitHubUserInfo(accessToken string) (*OAuthUserInfo, error) {
 	userInfoURL := "https://api.github.com/user"
 	userReq, err := http.NewRequest("GET", userInfoURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	
-	userReq.Header.Set("Authorization", "Bearer "+tokenResp.AccessToken)
+	userReq.Header.Set("Authorization", "Bearer "+accessToken)
 	userReq.Header.Set("Accept", "application/vnd.github.v3+json")
 	
-	userResp, err := client.Do(userReq)
+	userResp, err := o.doProviderRequest(ProviderGitHub, userReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
@@ -259,7 +334,7 @@ func (o *OAuthManager) handleGitHubCallback(code string) (*OAuthUserInfo, error)
 	
 	// Get email if not public
 	if githubUser.Email == "" {
-		email, err := o.getGitHubEmail(tokenResp.AccessToken)
+		email, err := o.getGitHubEmail(accessToken)
 		if err == nil {
 			githubUser.Email = email
 		}
@@ -273,6 +348,9 @@ func (o *OAuthManager) handleGitHubCallback(code string) (*OAuthUserInfo, error)
 	return &OAuthUserInfo{
 		ID:        fmt.Sprintf("%d", githubUser.ID),
 		Email:     githubUser.Email,
+		// GitHub only allows verified addresses as the public profile email,
+		// and getGitHubEmail only returns verified ones
+		EmailVerified: githubUser.Email != "",
 		Name:      displayName,
 		AvatarURL: githubUser.AvatarURL,
 		Provider:  string(ProviderGitHub),
@@ -290,8 +368,7 @@ func (o *OAuthManager) getGitHubEmail(accessToken string) (string, error) {
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := o.doProviderRequest(ProviderGitHub, req)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,126 @@
+package gotrust
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// oauthClientConfig is the client registration of one OAuth provider
+type oauthClientConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	Scopes       []string
+}
+
+// oauthClientConfig returns the configured client of an OAuth provider
+func (c *Config) oauthClientConfig(provider OAuthProvider) oauthClientConfig {
+	switch provider {
+	case ProviderGoogle:
+		return oauthClientConfig{c.GoogleClientID, c.GoogleClientSecret, c.GoogleRedirectURI, c.GoogleScopes}
+	case ProviderGitHub:
+		return oauthClientConfig{c.GitHubClientID, c.GitHubClientSecret, c.GitHubRedirectURI, c.GitHubScopes}
+	case ProviderGitLab:
+		return oauthClientConfig{c.GitLabClientID, c.GitLabClientSecret, c.GitLabRedirectURI, c.GitLabScopes}
+	case ProviderDiscord:
+		return oauthClientConfig{c.DiscordClientID, c.DiscordClientSecret, c.DiscordRedirectURI, c.DiscordScopes}
+	default:
+		return oauthClientConfig{}
+	}
+}
+
+// ValidateOAuthConfig checks the configuration of every OAuth provider with a
+// client ID or secret set, so misconfigurations surface at startup rather
+// than on a user's first login. It returns all problems found, joined.
+func (a *AuthService) ValidateOAuthConfig() error {
+	return a.config.validateOAuthConfig()
+}
+
+func (c *Config) validateOAuthConfig() error {
+	var errs []error
+	if c.OAuthRedirectStatus != 0 && !isRedirectStatus(c.OAuthRedirectStatus) {
+		errs = append(errs, fmt.Errorf("redirect status %d is not a redirect status code", c.OAuthRedirectStatus))
+	}
+	for _, provider := range OAuthProviders() {
+		client := c.oauthClientConfig(provider)
+		if client.ClientID == "" && client.ClientSecret == "" {
+			continue // not enabled
+		}
+
+		if client.ClientID == "" {
+			errs = append(errs, fmt.Errorf("%s: client ID is missing", provider))
+		}
+		if client.ClientSecret == "" {
+			errs = append(errs, fmt.Errorf("%s: client secret is missing", provider))
+		}
+		if len(client.Scopes) == 0 {
+			errs = append(errs, fmt.Errorf("%s: no scopes are configured", provider))
+		}
+		if err := checkOAuthRedirectURI(client.RedirectURI); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", provider, err))
+		}
+		if provider == ProviderGitLab {
+			if u, err := url.Parse(c.GitLabBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("%s: base URL %q is not an absolute URL", provider, c.GitLabBaseURL))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// oauthRedirectStatus returns the status code of OAuth redirects, falling
+// back to 307 when OAuthRedirectStatus is unset or not a redirect status
+func (c *Config) oauthRedirectStatus() int {
+	if isRedirectStatus(c.OAuthRedirectStatus) {
+		return c.OAuthRedirectStatus
+	}
+	return http.StatusTemporaryRedirect
+}
+
+// isRedirectStatus reports whether code is a 3xx status that redirects
+// with a Location header
+func isRedirectStatus(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// checkOAuthRedirectURI checks that a redirect URI is an absolute URL using
+// https, except on loopback hosts used in development
+func checkOAuthRedirectURI(redirectURI string) error {
+	if redirectURI == "" {
+		return fmt.Errorf("redirect URI is missing")
+	}
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("redirect URI %q is not an absolute URL", redirectURI)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect URI %q must not contain a fragment", redirectURI)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if isLoopbackHost(u.Hostname()) {
+			return nil
+		}
+		return fmt.Errorf("redirect URI %q must use https", redirectURI)
+	default:
+		return fmt.Errorf("redirect URI %q must use https", redirectURI)
+	}
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,122 @@
+package gotrust
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateOAuthConfig(t *testing.T) {
+	// google configures a complete Google client
+	google := func(c *Config) {
+		c.GoogleClientID = "client-1"
+		c.GoogleClientSecret = "secret-1"
+		c.GoogleRedirectURI = "https://app.example.com/auth/google/callback"
+	}
+
+	tests := []struct {
+		name      string
+		configure func(c *Config)
+		wantErrs  []string
+	}{
+		{name: "no providers enabled", configure: func(c *Config) {}},
+		{name: "complete provider", configure: google},
+		{name: "loopback http redirect", configure: func(c *Config) {
+			google(c)
+			c.GoogleRedirectURI = "http://localhost:4000/auth/google/callback"
+		}},
+		{name: "missing client secret", configure: func(c *Config) {
+			google(c)
+			c.GoogleClientSecret = ""
+		}, wantErrs: []string{"google: client secret is missing"}},
+		{name: "missing client ID", configure: func(c *Config) {
+			c.GitHubClientSecret = "secret-1"
+			c.GitHubRedirectURI = "https://app.example.com/auth/github/callback"
+		}, wantErrs: []string{"github: client ID is missing"}},
+		{name: "no scopes", configure: func(c *Config) {
+			google(c)
+			c.GoogleScopes = nil
+		}, wantErrs: []string{"google: no scopes are configured"}},
+		{name: "missing redirect URI", configure: func(c *Config) {
+			google(c)
+			c.GoogleRedirectURI = ""
+		}, wantErrs: []string{"google: redirect URI is missing"}},
+		{name: "relative redirect URI", configure: func(c *Config) {
+			google(c)
+			c.GoogleRedirectURI = "/auth/google/callback"
+		}, wantErrs: []string{"is not an absolute URL"}},
+		{name: "http redirect in production", configure: func(c *Config) {
+			google(c)
+			c.GoogleRedirectURI = "http://app.example.com/auth/google/callback"
+		}, wantErrs: []string{"must use https"}},
+		{name: "redirect with a fragment", configure: func(c *Config) {
+			google(c)
+			c.GoogleRedirectURI = "https://app.example.com/callback#done"
+		}, wantErrs: []string{"must not contain a fragment"}},
+		{name: "invalid GitLab base URL", configure: func(c *Config) {
+			c.GitLabClientID = "client-1"
+			c.GitLabClientSecret = "secret-1"
+			c.GitLabRedirectURI = "https://app.example.com/auth/gitlab/callback"
+			c.GitLabBaseURL = "gitlab.internal"
+		}, wantErrs: []string{"gitlab: base URL"}},
+		{name: "invalid redirect status", configure: func(c *Config) {
+			c.OAuthRedirectStatus = 200
+		}, wantErrs: []string{"redirect status 200"}},
+		{name: "problems are aggregated", configure: func(c *Config) {
+			google(c)
+			c.GoogleClientSecret = ""
+			c.DiscordClientID = "client-2"
+			c.DiscordRedirectURI = "ftp://app.example.com/callback"
+		}, wantErrs: []string{"google: client secret is missing", "discord: client secret is missing", "discord: redirect URI"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, tt.configure)
+
+			err := a.ValidateOAuthConfig()
+			if (err != nil) != (len(tt.wantErrs) > 0) {
+				t.Fatalf("ValidateOAuthConfig() error = %v, want errors %q", err, tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("ValidateOAuthConfig() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOAuthRedirectStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus int
+	}{
+		{name: "default", wantStatus: http.StatusTemporaryRedirect},
+		{name: "found", status: http.StatusFound, wantStatus: http.StatusFound},
+		{name: "see other", status: http.StatusSeeOther, wantStatus: http.StatusSeeOther},
+		{name: "not a redirect status", status: http.StatusOK, wantStatus: http.StatusTemporaryRedirect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, func(c *Config) {
+				c.OAuthRedirectStatus = tt.status
+				c.GoogleClientID = "google-client"
+				c.FrontendErrorURL = "https://app.example.com/login"
+			})
+
+			initiation := newTestContext(http.MethodGet, "/auth/google", "")
+			serve(t, initiation, h.OAuthHandler(string(ProviderGoogle)))
+			callback := newTestContext(http.MethodGet, "/auth/google/callback?error=access_denied", "")
+			serve(t, callback, h.OAuthCallbackHandler(string(ProviderGoogle)))
+
+			for name, ctx := range map[string]*testContext{"initiation": initiation, "callback": callback} {
+				if ctx.status() != tt.wantStatus || ctx.recorder.Header().Get("Location") == "" {
+					t.Errorf("%s status = %d, Location = %q, want a %d redirect", name, ctx.status(), ctx.recorder.Header().Get("Location"), tt.wantStatus)
+				}
+			}
+		})
+	}
+}
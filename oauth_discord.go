@@ -0,0 +1,142 @@
+package gotrust
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	discordAuthURL    = "https://discord.com/oauth2/authorize"
+	discordAPIBaseURL = "https://discord.com/api"
+	discordCDNBaseURL = "https://cdn.discordapp.com"
+)
+
+func (o *OAuthManager) getDiscordAuthURL(state string) (string, error) {
+	if o.config.DiscordClientID == "" {
+		return "", fmt.Errorf("Discord OAuth not configured")
+	}
+
+	params := url.Values{}
+	params.Add("client_id", o.config.DiscordClientID)
+	params.Add("redirect_uri", o.config.DiscordRedirectURI)
+	params.Add("scope", strings.Join(o.config.DiscordScopes, " "))
+	params.Add("response_type", "code")
+	params.Add("state", state)
+
+	return discordAuthURL + "?" + params.Encode(), nil
+}
+
+func (o *OAuthManager) handleDiscordCallback(code string) (*OAuthUserInfo, error) {
+	// Exchange code for token
+	tokenURL := discordAPIBaseURL + "/oauth2/token"
+	data := url.Values{}
+	data.Set("client_id", o.config.DiscordClientID)
+	data.Set("client_secret", o.config.DiscordClientSecret)
+	data.Set("code", code)
+	data.Set("grant_type", "authorization_code")
+	data.Set("redirect_uri", o.config.DiscordRedirectURI)
+
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := o.doProviderRequest(ProviderDiscord, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed with status: %d", resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	return o.getDiscordUserInfo(tokenResp.AccessToken)
+}
+
+// getDiscordUserInfo fetches the profile of the user an access token belongs to
+func (o *OAuthManager) getDiscordUserInfo(accessToken string) (*OAuthUserInfo, error) {
+	req, err := http.NewRequest("GET", discordAPIBaseURL+"/users/@me", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	userResp, err := o.doProviderRequest(ProviderDiscord, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+	defer userResp.Body.Close()
+
+	if userResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("user info request failed with status: %d", userResp.StatusCode)
+	}
+
+	// email is only present when the email scope was granted
+	var discordUser struct {
+		ID            string `json:"id"`
+		Username      string `json:"username"`
+		GlobalName    string `json:"global_name"`
+		Discriminator string `json:"discriminator"`
+		Avatar        string `json:"avatar"`
+		Email         string `json:"email"`
+		Verified      bool   `json:"verified"`
+	}
+
+	if err := json.NewDecoder(userResp.Body).Decode(&discordUser); err != nil {
+		return nil, fmt.Errorf("failed to parse user info: %w", err)
+	}
+
+	displayName := discordUser.GlobalName
+	if displayName == "" {
+		displayName = discordUser.Username
+	}
+
+	return &OAuthUserInfo{
+		ID:            discordUser.ID,
+		Email:         discordUser.Email,
+		EmailVerified: discordUser.Verified,
+		Name:          displayName,
+		AvatarURL:     discordAvatarURL(discordUser.ID, discordUser.Avatar, discordUser.Discriminator),
+		Provider:      string(ProviderDiscord),
+	}, nil
+}
+
+// discordAvatarURL computes the CDN URL of a Discord user's avatar, falling
+// back to the default avatar when the user has none
+func discordAvatarURL(userID, avatarHash, discriminator string) string {
+	if avatarHash != "" {
+		ext := "png"
+		if strings.HasPrefix(avatarHash, "a_") {
+			ext = "gif"
+		}
+		return fmt.Sprintf("%s/avatars/%s/%s.%s", discordCDNBaseURL, userID, avatarHash, ext)
+	}
+
+	// Users on the new username system have discriminator "0"
+	index := 0
+	if discriminator != "" && discriminator != "0" {
+		if d, err := strconv.Atoi(discriminator); err == nil {
+			index = d % 5
+		}
+	} else if id, err := strconv.ParseUint(userID, 10, 64); err == nil {
+		index = int((id >> 22) % 6)
+	}
+
+	return fmt.Sprintf("%s/embed/avatars/%d.png", discordCDNBaseURL, index)
+}
@@ -0,0 +1,125 @@
+package gotrust
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// useDiscordServer points the Discord API at a mock serving the token and
+// user endpoints. The code "good-code" exchanges for the token "discord-token".
+func useDiscordServer(t *testing.T, user string) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/token":
+			if r.Method != http.MethodPost || r.FormValue("code") != "good-code" || r.FormValue("grant_type") != "authorization_code" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token": "discord-token", "token_type": "Bearer"}`)
+		case "/users/@me":
+			if r.Header.Get("Authorization") != "Bearer discord-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, user)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	saved := discordAPIBaseURL
+	discordAPIBaseURL = server.URL
+	t.Cleanup(func() { discordAPIBaseURL = saved })
+}
+
+func newDiscordManager() *OAuthManager {
+	config := newTestConfig()
+	config.DiscordClientID = "discord-client"
+	config.DiscordClientSecret = "discord-secret"
+	config.DiscordRedirectURI = "https://app.example.com/auth/discord/callback"
+	config.DiscordScopes = []string{"identify", "email"}
+	return NewOAuthManager(config, NewMemorySessionStore())
+}
+
+func TestDiscordAuthURL(t *testing.T) {
+	authURL, err := newDiscordManager().GetAuthURL(ProviderDiscord, "")
+	if err != nil {
+		t.Fatalf("GetAuthURL() error = %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	if u.Host != "discord.com" || u.Query().Get("scope") != "identify email" || u.Query().Get("client_id") != "discord-client" {
+		t.Errorf("GetAuthURL() = %q", authURL)
+	}
+
+	if _, err := NewOAuthManager(newTestConfig(), NewMemorySessionStore()).GetAuthURL(ProviderDiscord, ""); err == nil {
+		t.Errorf("GetAuthURL() succeeded without a Discord client ID")
+	}
+}
+
+func TestDiscordCallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		user    string
+		want    OAuthUserInfo
+		wantErr bool
+	}{
+		{
+			name: "user with an avatar",
+			code: "good-code",
+			user: `{"id": "80351110224678912", "username": "jane", "global_name": "Jane", "avatar": "8342729096ea3675442027381ff50dfe", "email": "jane@example.com", "verified": true}`,
+			want: OAuthUserInfo{
+				ID: "80351110224678912", Email: "jane@example.com", EmailVerified: true, Name: "Jane",
+				AvatarURL: "https://cdn.discordapp.com/avatars/80351110224678912/8342729096ea3675442027381ff50dfe.png",
+				Provider:  string(ProviderDiscord),
+			},
+		},
+		{
+			name: "animated avatar and unverified email",
+			code: "good-code",
+			user: `{"id": "1", "username": "jane", "avatar": "a_123", "email": "jane@example.com", "verified": false}`,
+			want: OAuthUserInfo{
+				ID: "1", Email: "jane@example.com", Name: "jane",
+				AvatarURL: "https://cdn.discordapp.com/avatars/1/a_123.gif",
+				Provider:  string(ProviderDiscord),
+			},
+		},
+		{
+			name: "legacy discriminator without an avatar",
+			code: "good-code",
+			user: `{"id": "1", "username": "jane", "discriminator": "1337"}`,
+			want: OAuthUserInfo{
+				ID: "1", Name: "jane",
+				AvatarURL: "https://cdn.discordapp.com/embed/avatars/2.png",
+				Provider:  string(ProviderDiscord),
+			},
+		},
+		{name: "invalid code", code: "bad-code", user: `{"id": "1"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useDiscordServer(t, tt.user)
+
+			info, err := newDiscordManager().handleDiscordCallback(tt.code)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("handleDiscordCallback() = %+v, want error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleDiscordCallback() error = %v", err)
+			}
+			if *info != tt.want {
+				t.Errorf("handleDiscordCallback() = %+v, want %+v", *info, tt.want)
+			}
+		})
+	}
+}
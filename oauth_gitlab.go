@@ -0,0 +1,122 @@
+package gotrust
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// gitLabBaseURL returns the GitLab instance URL without a trailing slash
+func (o *OAuthManager) gitLabBaseURL() string {
+	baseURL := o.config.GitLabBaseURL
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+	return strings.TrimRight(baseURL, "/")
+}
+
+func (o *OAuthManager) getGitLabAuthURL(state string) (string, error) {
+	if o.config.GitLabClientID == "" {
+		return "", fmt.Errorf("GitLab OAuth not configured")
+	}
+
+	params := url.Values{}
+	params.Add("client_id", o.config.GitLabClientID)
+	params.Add("redirect_uri", o.config.GitLabRedirectURI)
+	params.Add("scope", strings.Join(o.config.GitLabScopes, " "))
+	params.Add("response_type", "code")
+	params.Add("state", state)
+
+	return o.gitLabBaseURL() + "/oauth/authorize?" + params.Encode(), nil
+}
+
+func (o *OAuthManager) handleGitLabCallback(code string) (*OAuthUserInfo, error) {
+	// Exchange code for token
+	tokenURL := o.gitLabBaseURL() + "/oauth/token"
+	data := url.Values{}
+	data.Set("client_id", o.config.GitLabClientID)
+	data.Set("client_secret", o.config.GitLabClientSecret)
+	data.Set("code", code)
+	data.Set("grant_type", "authorization_code")
+	data.Set("redirect_uri", o.config.GitLabRedirectURI)
+
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := o.doProviderRequest(ProviderGitLab, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed with status: %d", resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	return o.getGitLabUserInfo(tokenResp.AccessToken)
+}
+
+// getGitLabUserInfo fetches the profile of the user an access token belongs to
+func (o *OAuthManager) getGitLabUserInfo(accessToken string) (*OAuthUserInfo, error) {
+	userInfoURL := o.gitLabBaseURL() + "/api/v4/user"
+	userReq, err := http.NewRequest("GET", userInfoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	userReq.Header.Set("Authorization", "Bearer "+accessToken)
+	userReq.Header.Set("Accept", "application/json")
+
+	userResp, err := o.doProviderRequest(ProviderGitLab, userReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+	defer userResp.Body.Close()
+
+	if userResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("user info request failed with status: %d", userResp.StatusCode)
+	}
+
+	// email is the user's primary email; confirmed_at is set once it is verified
+	var gitlabUser struct {
+		ID          int64   `json:"id"`
+		Username    string  `json:"username"`
+		Name        string  `json:"name"`
+		Email       string  `json:"email"`
+		AvatarURL   string  `json:"avatar_url"`
+		ConfirmedAt *string `json:"confirmed_at"`
+	}
+
+	if err := json.NewDecoder(userResp.Body).Decode(&gitlabUser); err != nil {
+		return nil, fmt.Errorf("failed to parse user info: %w", err)
+	}
+
+	displayName := gitlabUser.Name
+	if displayName == "" {
+		displayName = gitlabUser.Username
+	}
+
+	return &OAuthUserInfo{
+		ID:            fmt.Sprintf("%d", gitlabUser.ID),
+		Email:         gitlabUser.Email,
+		EmailVerified: gitlabUser.ConfirmedAt != nil && *gitlabUser.ConfirmedAt != "",
+		Name:          displayName,
+		AvatarURL:     gitlabUser.AvatarURL,
+		Provider:      string(ProviderGitLab),
+	}, nil
+}
@@ -0,0 +1,108 @@
+package gotrust
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGitLabAuthURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseURL  string
+		clientID string
+		want     string
+		wantErr  bool
+	}{
+		{name: "gitlab.com", clientID: "client-1", want: "https://gitlab.com/oauth/authorize"},
+		{name: "self-managed instance", baseURL: "https://git.example.com/", clientID: "client-1", want: "https://git.example.com/oauth/authorize"},
+		{name: "not configured", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestConfig()
+			config.GitLabBaseURL = tt.baseURL
+			config.GitLabClientID = tt.clientID
+			config.GitLabRedirectURI = "https://app.example.com/auth/gitlab/callback"
+			config.GitLabScopes = []string{"read_user", "openid"}
+			manager := NewOAuthManager(config, NewMemorySessionStore())
+
+			authURL, err := manager.GetAuthURL(ProviderGitLab, "")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetAuthURL() = %q, want error", authURL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetAuthURL() error = %v", err)
+			}
+
+			u, err := url.Parse(authURL)
+			if err != nil {
+				t.Fatalf("GetAuthURL() = %q: %v", authURL, err)
+			}
+			if got := u.Scheme + "://" + u.Host + u.Path; got != tt.want {
+				t.Errorf("GetAuthURL() endpoint = %q, want %q", got, tt.want)
+			}
+			query := u.Query()
+			if query.Get("client_id") != "client-1" || query.Get("scope") != "read_user openid" ||
+				query.Get("response_type") != "code" || query.Get("state") == "" {
+				t.Errorf("GetAuthURL() query = %v", query)
+			}
+		})
+	}
+}
+
+func TestGitLabCallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		secret  string
+		wantErr bool
+	}{
+		{name: "valid code", code: "good-code", secret: "secret-1"},
+		{name: "invalid code", code: "bad-code", secret: "secret-1", wantErr: true},
+		{name: "wrong client secret", code: "good-code", secret: "secret-2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newGitLabServer(t, `{"application": {"uid": "client-1"}}`)
+			config := newTestConfig()
+			config.GitLabBaseURL = server.URL + "/"
+			config.GitLabClientID = "client-1"
+			config.GitLabClientSecret = tt.secret
+			manager := NewOAuthManager(config, NewMemorySessionStore())
+
+			authURL, err := manager.GetAuthURL(ProviderGitLab, "")
+			if err != nil {
+				t.Fatalf("GetAuthURL() error = %v", err)
+			}
+			state := authURL[strings.Index(authURL, "state=")+len("state="):]
+
+			info, _, err := manager.ValidateCallback(ProviderGitLab, state, tt.code)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ValidateCallback() = %+v, want error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateCallback() error = %v", err)
+			}
+			want := OAuthUserInfo{
+				ID:            "42",
+				Email:         "jane@example.com",
+				EmailVerified: true,
+				Name:          "jane",
+				AvatarURL:     "https://gitlab.example.com/jane.png",
+				Provider:      string(ProviderGitLab),
+			}
+			if *info != want {
+				t.Errorf("ValidateCallback() = %+v, want %+v", *info, want)
+			}
+		})
+	}
+}
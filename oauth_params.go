@@ -0,0 +1,97 @@
+package gotrust
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// maxAuthParamLength bounds the length of a free-form authorization param
+// such as login_hint
+const maxAuthParamLength = 256
+
+// authParamRule validates the value of an optional authorization param. A
+// nil values list accepts any free-form value; otherwise the value must be
+// one of values, or with multi a space-separated list of them.
+type authParamRule struct {
+	values []string
+	multi  bool
+}
+
+// oauthAuthParams lists the optional params each provider's authorize
+// endpoint accepts. Anything else is rejected so callers cannot override
+// client_id, redirect_uri, scope or state.
+var oauthAuthParams = map[OAuthProvider]map[string]authParamRule{
+	ProviderGoogle: {
+		"login_hint": {},
+		"prompt":     {values: []string{"none", "consent", "select_account"}, multi: true},
+		"hd":         {},
+	},
+	ProviderGitHub: {
+		"login":        {},
+		"allow_signup": {values: []string{"true", "false"}},
+		"prompt":       {values: []string{"select_account"}},
+	},
+	ProviderDiscord: {
+		"prompt": {values: []string{"none", "consent"}},
+	},
+}
+
+// OAuthAuthParams returns the names of the optional params, such as
+// login_hint and prompt, that GetAuthURLWithParams accepts for a provider
+func OAuthAuthParams(provider OAuthProvider) []string {
+	names := make([]string, 0, len(oauthAuthParams[provider]))
+	for name := range oauthAuthParams[provider] {
+		names = append(names, name)
+	}
+	return names
+}
+
+// validateAuthParams checks optional authorization params against the
+// provider's allowed names and values
+func validateAuthParams(provider OAuthProvider, params url.Values) error {
+	allowed := oauthAuthParams[provider]
+	for name, values := range params {
+		rule, ok := allowed[name]
+		if !ok {
+			return fmt.Errorf("%w: %s does not support %s", ErrInvalidAuthParam, provider, name)
+		}
+		if len(values) != 1 {
+			return fmt.Errorf("%w: %s must be given once", ErrInvalidAuthParam, name)
+		}
+		if !rule.accepts(values[0]) {
+			return fmt.Errorf("%w: invalid %s", ErrInvalidAuthParam, name)
+		}
+	}
+	return nil
+}
+
+func (r authParamRule) accepts(value string) bool {
+	if value == "" || len(value) > maxAuthParamLength {
+		return false
+	}
+	if r.values == nil {
+		return strings.IndexFunc(value, unicode.IsControl) < 0
+	}
+
+	choices := []string{value}
+	if r.multi {
+		choices = strings.Split(value, " ")
+	}
+	for _, choice := range choices {
+		if !r.allows(choice) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r authParamRule) allows(choice string) bool {
+	for _, value := range r.values {
+		if value == choice {
+			return true
+		}
+	}
+	return false
+}
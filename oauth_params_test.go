@@ -0,0 +1,126 @@
+package gotrust
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGetAuthURLWithParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider OAuthProvider
+		params   url.Values
+		want     url.Values
+		wantErr  bool
+	}{
+		{
+			name:     "login_hint and prompt",
+			provider: ProviderGoogle,
+			params:   url.Values{"login_hint": {"jane@example.com"}, "prompt": {"consent"}},
+			want:     url.Values{"login_hint": {"jane@example.com"}, "prompt": {"consent"}},
+		},
+		{
+			name:     "space-separated prompt values",
+			provider: ProviderGoogle,
+			params:   url.Values{"prompt": {"consent select_account"}},
+			want:     url.Values{"prompt": {"consent select_account"}},
+		},
+		{name: "no params", provider: ProviderGoogle, want: url.Values{"access_type": {"offline"}}},
+		{name: "GitHub login", provider: ProviderGitHub, params: url.Values{"login": {"jane"}}, want: url.Values{"login": {"jane"}}},
+		{name: "unknown prompt value", provider: ProviderGoogle, params: url.Values{"prompt": {"login"}}, wantErr: true},
+		{name: "overriding redirect_uri", provider: ProviderGoogle, params: url.Values{"redirect_uri": {"https://evil.example.com"}}, wantErr: true},
+		{name: "overriding state", provider: ProviderGoogle, params: url.Values{"state": {"forged"}}, wantErr: true},
+		{name: "param of another provider", provider: ProviderGitHub, params: url.Values{"login_hint": {"jane@example.com"}}, wantErr: true},
+		{name: "repeated param", provider: ProviderGoogle, params: url.Values{"login_hint": {"a@example.com", "b@example.com"}}, wantErr: true},
+		{name: "control characters", provider: ProviderGoogle, params: url.Values{"login_hint": {"jane\r\n@example.com"}}, wantErr: true},
+		{name: "overlong value", provider: ProviderGoogle, params: url.Values{"login_hint": {strings.Repeat("a", maxAuthParamLength+1)}}, wantErr: true},
+		{name: "provider without params", provider: ProviderGitLab, params: url.Values{"prompt": {"consent"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, func(c *Config) {
+				c.GoogleClientID = "google-client"
+				c.GitHubClientID = "github-client"
+				c.GitLabClientID = "gitlab-client"
+			})
+
+			authURL, err := a.GetOAuthURLWithParams(tt.provider, "", tt.params)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAuthParam) {
+					t.Fatalf("GetOAuthURLWithParams() error = %v, want ErrInvalidAuthParam", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetOAuthURLWithParams() error = %v", err)
+			}
+
+			parsed, err := url.Parse(authURL)
+			if err != nil {
+				t.Fatalf("auth URL %q: %v", authURL, err)
+			}
+			query := parsed.Query()
+			for name, values := range tt.want {
+				if got := query[name]; len(got) != 1 || got[0] != values[0] {
+					t.Errorf("%s = %v, want %v", name, got, values)
+				}
+			}
+			// The provider's own params are not duplicated or overridden
+			for _, name := range []string{"client_id", "redirect_uri", "state"} {
+				if len(query[name]) != 1 {
+					t.Errorf("%s = %v, want exactly one value", name, query[name])
+				}
+			}
+		})
+	}
+}
+
+func TestOAuthHandlerAuthParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantParams url.Values
+	}{
+		{
+			name:       "forwarded params",
+			query:      "?login_hint=jane%40example.com&prompt=select_account",
+			wantStatus: http.StatusTemporaryRedirect,
+			wantParams: url.Values{"login_hint": {"jane@example.com"}, "prompt": {"select_account"}},
+		},
+		{name: "invalid prompt", query: "?prompt=login", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, func(c *Config) { c.GoogleClientID = "google-client" })
+
+			ctx := newTestContext(http.MethodGet, "/auth/google"+tt.query, "")
+			serve(t, ctx, h.OAuthHandler(string(ProviderGoogle)))
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusBadRequest {
+				if code := ctx.body(t)["code"]; code != "invalid_auth_param" {
+					t.Errorf("code = %v, want invalid_auth_param", code)
+				}
+				return
+			}
+
+			location, err := url.Parse(ctx.recorder.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("redirect = %q: %v", ctx.recorder.Header().Get("Location"), err)
+			}
+			for name, values := range tt.wantParams {
+				if got := location.Query().Get(name); got != values[0] {
+					t.Errorf("%s = %q, want %q", name, got, values[0])
+				}
+			}
+		})
+	}
+}
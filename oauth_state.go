@@ -0,0 +1,198 @@
+package gotrust
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth state modes
+const (
+	// OAuthStateModeStore keeps OAuth state in the SessionStore (single use)
+	OAuthStateModeStore = "store"
+	// OAuthStateModeSigned encodes the state in an HMAC-signed, expiring token
+	// verified without a store lookup. Signed states are not single use, so
+	// keep OAuthStateExpiration short.
+	OAuthStateModeSigned = "signed"
+)
+
+// DefaultOAuthMaxPendingStates is the default bound on the store-mode OAuth
+// states an instance keeps outstanding
+const DefaultOAuthMaxPendingStates = 10000
+
+// signedState is the payload of a signed OAuth state
+type signedState struct {
+	Nonce       string `json:"n"`
+	RedirectURI string `json:"r,omitempty"`
+	ExpiresAt   int64  `json:"e"`
+}
+
+// newSignedState encodes the redirect URI in a signed state parameter
+func (o *OAuthManager) newSignedState(redirectURI string) (string, error) {
+	payload, err := json.Marshal(&signedState{
+		Nonce:       generateRandomString(16),
+		RedirectURI: redirectURI,
+		ExpiresAt:   time.Now().Add(o.config.OAuthStateExpiration).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode oauth state: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := o.signState(encoded)
+	if err != nil {
+		return "", err
+	}
+	return encoded + "." + signature, nil
+}
+
+// validateSignedState verifies a signed state and returns its redirect URI
+func (o *OAuthManager) validateSignedState(state string) (string, error) {
+	encoded, signature, ok := strings.Cut(state, ".")
+	if !ok {
+		return "", fmt.Errorf("malformed state")
+	}
+
+	expected, err := o.signState(encoded)
+	if err != nil {
+		return "", err
+	}
+	if !secureCompare(signature, expected) {
+		return "", fmt.Errorf("state signature mismatch")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("malformed state")
+	}
+
+	var data signedState
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return "", fmt.Errorf("malformed state")
+	}
+
+	if time.Now().Unix() > data.ExpiresAt {
+		return "", fmt.Errorf("state expired")
+	}
+
+	return data.RedirectURI, nil
+}
+
+// signState returns the base64url HMAC-SHA256 of the encoded state
+func (o *OAuthManager) signState(encoded string) (string, error) {
+	secret, err := o.stateSecret()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("gotrust-oauth-state:"))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// stateSecret returns the key used to sign OAuth states. Without a secret
+// anyone could forge states, so signed states are refused.
+func (o *OAuthManager) stateSecret() ([]byte, error) {
+	if o.config.OAuthStateSecret != "" {
+		return []byte(o.config.OAuthStateSecret), nil
+	}
+	secret := o.config.signingSecret()
+	if secret == "" {
+		return nil, fmt.Errorf("signed oauth states require OAUTH_STATE_SECRET or a JWT signing secret")
+	}
+	if o.config.DeriveKeys {
+		return deriveKey([]byte(secret), keyPurposeOAuthState), nil
+	}
+	return []byte(secret), nil
+}
+
+// stateTracker records the store-mode states an instance issued, oldest
+// first, so expired and excess states can be deleted from stores without
+// native TTL support
+type stateTracker struct {
+	mu    sync.Mutex
+	order *list.List // of *trackedState
+	byKey map[string]*list.Element
+}
+
+type trackedState struct {
+	key       string
+	expiresAt time.Time
+}
+
+func newStateTracker() *stateTracker {
+	return &stateTracker{order: list.New(), byKey: make(map[string]*list.Element)}
+}
+
+// add records a state and returns the keys of the expired states and, once
+// more than max are outstanding, the oldest ones, which it stops tracking
+func (t *stateTracker) add(key string, expiresAt time.Time, max int) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stale := t.removeExpired(time.Now())
+	for max > 0 && t.order.Len() >= max {
+		stale = append(stale, t.remove(t.order.Front()))
+	}
+	t.byKey[key] = t.order.PushBack(&trackedState{key: key, expiresAt: expiresAt})
+	return stale
+}
+
+// forget stops tracking a state
+func (t *stateTracker) forget(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if element, ok := t.byKey[key]; ok {
+		t.remove(element)
+	}
+}
+
+// expired stops tracking the expired states and returns their keys
+func (t *stateTracker) expired(now time.Time) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.removeExpired(now)
+}
+
+func (t *stateTracker) removeExpired(now time.Time) []string {
+	var keys []string
+	for element := t.order.Front(); element != nil; element = t.order.Front() {
+		if now.Before(element.Value.(*trackedState).expiresAt) {
+			break
+		}
+		keys = append(keys, t.remove(element))
+	}
+	return keys
+}
+
+func (t *stateTracker) remove(element *list.Element) string {
+	key := t.order.Remove(element).(*trackedState).key
+	delete(t.byKey, key)
+	return key
+}
+
+// deleteStates removes states from the session store, ignoring errors: a
+// state that could not be deleted still fails validation once expired
+func (o *OAuthManager) deleteStates(ctx context.Context, keys []string) {
+	if len(keys) > 0 {
+		_ = o.sessionStore.Delete(ctx, keys...)
+	}
+}
+
+// CleanupStates deletes the expired store-mode OAuth states this instance
+// issued from the session store and returns how many were removed. States
+// are also cleaned up as new ones are created; call it periodically when the
+// SessionStore does not expire keys on its own and sign-ins are rare.
+func (o *OAuthManager) CleanupStates(ctx context.Context) int {
+	keys := o.states.expired(time.Now())
+	o.deleteStates(ctx, keys)
+	return len(keys)
+}
@@ -0,0 +1,267 @@
+package gotrust
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSignedStateManager(configure func(*Config)) *OAuthManager {
+	config := newTestConfig()
+	config.OAuthStateMode = OAuthStateModeSigned
+	config.OAuthStateExpiration = time.Minute
+	if configure != nil {
+		configure(config)
+	}
+	return NewOAuthManager(config, NewMemorySessionStore())
+}
+
+func TestSignedState(t *testing.T) {
+	tests := []struct {
+		name    string
+		issuer  func(*Config)
+		tamper  func(state string) string
+		verify  func(*Config)
+		wantErr bool
+	}{
+		{name: "valid state"},
+		{name: "dedicated state secret", issuer: func(c *Config) { c.OAuthStateSecret = "state-secret" }, verify: func(c *Config) { c.OAuthStateSecret = "state-secret" }},
+		{name: "derived key", issuer: func(c *Config) { c.DeriveKeys = true }, verify: func(c *Config) { c.DeriveKeys = true }},
+		{name: "signed before deriving keys", verify: func(c *Config) { c.DeriveKeys = true }, wantErr: true},
+		{
+			name: "tampered payload",
+			tamper: func(state string) string {
+				encoded, signature, _ := strings.Cut(state, ".")
+				return encoded + "x." + signature
+			},
+			wantErr: true,
+		},
+		{
+			name:    "tampered signature",
+			tamper:  func(state string) string { return state[:len(state)-2] + "AA" },
+			wantErr: true,
+		},
+		{name: "missing signature", tamper: func(state string) string { return strings.Split(state, ".")[0] }, wantErr: true},
+		{name: "expired", issuer: func(c *Config) { c.OAuthStateExpiration = -2 * time.Second }, wantErr: true},
+		{name: "signed with another secret", issuer: func(c *Config) { c.OAuthStateSecret = "other-secret" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := newSignedStateManager(tt.issuer).newState("https://app.example.com/done")
+			if err != nil {
+				t.Fatalf("newState() error = %v", err)
+			}
+			if tt.tamper != nil {
+				state = tt.tamper(state)
+			}
+
+			redirectURI, err := newSignedStateManager(tt.verify).validateState(state)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("validateState() = %q, want error", redirectURI)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateState() error = %v", err)
+			}
+			if redirectURI != "https://app.example.com/done" {
+				t.Errorf("validateState() = %q", redirectURI)
+			}
+		})
+	}
+}
+
+func TestSignedStateRequiresSecret(t *testing.T) {
+	for _, deriveKeys := range []bool{false, true} {
+		manager := newSignedStateManager(func(c *Config) {
+			c.JWTSecret = ""
+			c.DeriveKeys = deriveKeys
+		})
+
+		if state, err := manager.newState(""); err == nil {
+			t.Errorf("newState() = %q without a secret (DeriveKeys %v), want error", state, deriveKeys)
+		}
+
+		// A state an attacker signed with the empty key
+		encoded := base64.RawURLEncoding.EncodeToString([]byte(`{"n":"x","e":9999999999}`))
+		mac := hmac.New(sha256.New, nil)
+		mac.Write([]byte("gotrust-oauth-state:" + encoded))
+		forged := encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+		if _, err := manager.validateState(forged); err == nil {
+			t.Errorf("validateState() accepted a state without a secret (DeriveKeys %v)", deriveKeys)
+		}
+	}
+}
+
+func TestStoreStateSingleUse(t *testing.T) {
+	manager := NewOAuthManager(newTestConfig(), NewMemorySessionStore())
+
+	state, err := manager.newState("https://app.example.com/done")
+	if err != nil {
+		t.Fatalf("newState() error = %v", err)
+	}
+	if redirectURI, err := manager.validateState(state); err != nil || redirectURI != "https://app.example.com/done" {
+		t.Fatalf("validateState() = %q, %v", redirectURI, err)
+	}
+	if _, err := manager.validateState(state); err == nil {
+		t.Errorf("validateState() accepted a state twice")
+	}
+}
+
+func TestSecureCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "secret", b: "secret", want: true},
+		{a: "", b: "", want: true},
+		{a: "secret", b: "Secret"},
+		{a: "secret", b: "secret2"},
+		{a: "secret", b: "secre"},
+		{a: "secret", b: ""},
+		{a: "sécret", b: "sécret", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := secureCompare(tt.a, tt.b); got != tt.want {
+			t.Errorf("secureCompare(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestStoreStateMismatch(t *testing.T) {
+	store := NewMemorySessionStore()
+	defer store.Close()
+	manager := NewOAuthManager(newTestConfig(), store)
+
+	state, err := manager.newState("")
+	if err != nil {
+		t.Fatalf("newState() error = %v", err)
+	}
+
+	// A record stored under the state's key for another state is rejected
+	key := manager.statePrefix + ":" + state
+	if err := store.Set(context.Background(), key, &OAuthState{State: state + "x", ExpiresAt: time.Now().Add(time.Minute)}, time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if _, err := manager.validateState(state); err == nil || !strings.Contains(err.Error(), "mismatch") {
+		t.Errorf("validateState() error = %v, want state mismatch", err)
+	}
+}
+
+// noTTLSessionStore is a session store that never expires keys on its own
+type noTTLSessionStore struct {
+	*MemorySessionStore
+}
+
+func (s *noTTLSessionStore) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return s.MemorySessionStore.Set(ctx, key, value, 0)
+}
+
+func TestStoreStateExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		wantErr   bool
+	}{
+		{name: "unexpired", expiresIn: 30 * time.Second},
+		{name: "expired but kept by the store", expiresIn: -time.Second, wantErr: true},
+		{name: "beyond the maximum age", expiresIn: 2 * time.Hour, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &noTTLSessionStore{NewMemorySessionStore()}
+			defer store.Close()
+			config := newTestConfig()
+			config.OAuthStateExpiration = time.Minute
+			manager := NewOAuthManager(config, store)
+
+			state, err := manager.newState("")
+			if err != nil {
+				t.Fatalf("newState() error = %v", err)
+			}
+			key := manager.statePrefix + ":" + state
+			record := &OAuthState{State: state, ExpiresAt: time.Now().Add(tt.expiresIn)}
+			if err := store.Set(context.Background(), key, record, 0); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+
+			if _, err := manager.validateState(state); (err != nil) != tt.wantErr {
+				t.Errorf("validateState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStoreStateBound(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxPending   int
+		wantAccepted int
+	}{
+		{name: "bounded", maxPending: 3, wantAccepted: 3},
+		{name: "unbounded", wantAccepted: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &noTTLSessionStore{NewMemorySessionStore()}
+			defer store.Close()
+			config := newTestConfig()
+			config.OAuthMaxPendingStates = tt.maxPending
+			manager := NewOAuthManager(config, store)
+
+			var states []string
+			for i := 0; i < 5; i++ {
+				state, err := manager.newState("")
+				if err != nil {
+					t.Fatalf("newState() error = %v", err)
+				}
+				states = append(states, state)
+			}
+			if store.Len() != tt.wantAccepted {
+				t.Errorf("stored states = %d, want %d", store.Len(), tt.wantAccepted)
+			}
+
+			// The oldest states were dropped; the newest still work
+			for i, state := range states {
+				_, err := manager.validateState(state)
+				if wantOK := i >= len(states)-tt.wantAccepted; (err == nil) != wantOK {
+					t.Errorf("state %d validateState() error = %v, want accepted %v", i, err, wantOK)
+				}
+			}
+		})
+	}
+}
+
+func TestCleanupStates(t *testing.T) {
+	store := &noTTLSessionStore{NewMemorySessionStore()}
+	defer store.Close()
+	config := newTestConfig()
+	config.OAuthStateExpiration = 10 * time.Millisecond
+	a := NewAuthService(config, NewMemoryUserStore(), store)
+
+	for i := 0; i < 3; i++ {
+		if _, err := a.oauthManager.newState(""); err != nil {
+			t.Fatalf("newState() error = %v", err)
+		}
+	}
+	if removed := a.CleanupOAuthStates(context.Background()); removed != 0 {
+		t.Errorf("CleanupOAuthStates() before expiry = %d, want 0", removed)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if removed := a.CleanupOAuthStates(context.Background()); removed != 3 {
+		t.Errorf("CleanupOAuthStates() = %d, want 3", removed)
+	}
+	if store.Len() != 0 {
+		t.Errorf("store still holds %d keys", store.Len())
+	}
+}
@@ -0,0 +1,248 @@
+package gotrust
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	googleCertsURL     = "https://www.googleapis.com/oauth2/v3/certs"
+	googleTokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+	githubAPIBaseURL   = "https://api.github.com"
+)
+
+// googleIssuers are the valid "iss" values of Google ID tokens
+var googleIssuers = map[string]bool{
+	"accounts.google.com":         true,
+	"https://accounts.google.com": true,
+}
+
+var (
+	googleKeysOnce sync.Once
+	googleKeys     *RemoteKeySet
+)
+
+// UserInfoFromToken returns the user a token obtained by a native app from
+// the provider's SDK belongs to. For Google, pass either an ID token, whose
+// signature and audience are verified, or an access token. For the other
+// providers pass an access token. Access tokens are checked to have been
+// issued to this app's client before the profile is fetched.
+func (o *OAuthManager) UserInfoFromToken(ctx context.Context, provider OAuthProvider, accessToken, idToken string) (*OAuthUserInfo, error) {
+	if provider == ProviderGoogle && idToken != "" {
+		return o.verifyGoogleIDToken(ctx, idToken)
+	}
+	if accessToken == "" {
+		return nil, fmt.Errorf("access_token is required")
+	}
+
+	switch provider {
+	case ProviderGoogle:
+		if err := o.checkGoogleAccessToken(ctx, accessToken); err != nil {
+			return nil, err
+		}
+		return o.getGoogleUserInfo(accessToken)
+	case ProviderGitHub:
+		if err := o.checkGitHubAccessToken(ctx, accessToken); err != nil {
+			return nil, err
+		}
+		return o.getGitHubUserInfo(accessToken)
+	case ProviderGitLab:
+		if err := o.checkGitLabAccessToken(ctx, accessToken); err != nil {
+			return nil, err
+		}
+		return o.getGitLabUserInfo(accessToken)
+	case ProviderDiscord:
+		if err := o.checkDiscordAccessToken(ctx, accessToken); err != nil {
+			return nil, err
+		}
+		return o.getDiscordUserInfo(accessToken)
+	default:
+		return nil, fmt.Errorf("unsupported provider: %s", provider)
+	}
+}
+
+// googleAudiences returns the client IDs Google tokens may be issued to
+func (o *OAuthManager) googleAudiences() map[string]bool {
+	audiences := map[string]bool{}
+	if o.config.GoogleClientID != "" {
+		audiences[o.config.GoogleClientID] = true
+	}
+	for _, audience := range o.config.GoogleTokenAudiences {
+		audiences[audience] = true
+	}
+	return audiences
+}
+
+// verifyGoogleIDToken verifies a Google ID token against Google's published keys
+func (o *OAuthManager) verifyGoogleIDToken(ctx context.Context, idToken string) (*OAuthUserInfo, error) {
+	googleKeysOnce.Do(func() {
+		googleKeys = NewRemoteKeySet(googleCertsURL, 0)
+	})
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return googleKeys.Key(ctx, kid)
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if issuer, _ := claims["iss"].(string); !googleIssuers[issuer] {
+		return nil, fmt.Errorf("invalid id_token issuer")
+	}
+
+	audience, _ := claims["aud"].(string)
+	if !o.googleAudiences()[audience] {
+		return nil, fmt.Errorf("id_token was issued to another client")
+	}
+
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	picture, _ := claims["picture"].(string)
+
+	// email_verified is a boolean, but older tokens use the string "true"
+	verified, ok := claims["email_verified"].(bool)
+	if !ok {
+		verified = claims["email_verified"] == "true"
+	}
+
+	if subject == "" {
+		return nil, fmt.Errorf("id_token has no subject")
+	}
+
+	return &OAuthUserInfo{
+		ID:            subject,
+		Email:         email,
+		EmailVerified: verified,
+		Name:          name,
+		AvatarURL:     picture,
+		Provider:      string(ProviderGoogle),
+	}, nil
+}
+
+// checkGoogleAccessToken verifies that a Google access token was issued to
+// one of the configured client IDs
+func (o *OAuthManager) checkGoogleAccessToken(ctx context.Context, accessToken string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", googleTokenInfoURL+"?"+url.Values{"access_token": {accessToken}}.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	var info struct {
+		Audience        string `json:"aud"`
+		AuthorizedParty string `json:"azp"`
+	}
+	if err := o.doJSON(ProviderGoogle, req, &info); err != nil {
+		return fmt.Errorf("invalid access token: %w", err)
+	}
+
+	audiences := o.googleAudiences()
+	if !audiences[info.Audience] && !audiences[info.AuthorizedParty] {
+		return fmt.Errorf("access token was issued to another client")
+	}
+	return nil
+}
+
+// checkGitHubAccessToken verifies that a GitHub access token belongs to this
+// OAuth app
+func (o *OAuthManager) checkGitHubAccessToken(ctx context.Context, accessToken string) error {
+	body, err := json.Marshal(map[string]string{"access_token": accessToken})
+	if err != nil {
+		return err
+	}
+
+	checkURL := fmt.Sprintf("%s/applications/%s/token", githubAPIBaseURL, url.PathEscape(o.config.GitHubClientID))
+	req, err := http.NewRequestWithContext(ctx, "POST", checkURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.SetBasicAuth(o.config.GitHubClientID, o.config.GitHubClientSecret)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	if err := o.doJSON(ProviderGitHub, req, nil); err != nil {
+		return fmt.Errorf("invalid access token: %w", err)
+	}
+	return nil
+}
+
+// checkGitLabAccessToken verifies that a GitLab access token was issued to
+// this application
+func (o *OAuthManager) checkGitLabAccessToken(ctx context.Context, accessToken string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", o.gitLabBaseURL()+"/oauth/token/info", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var info struct {
+		Application struct {
+			UID string `json:"uid"`
+		} `json:"application"`
+	}
+	if err := o.doJSON(ProviderGitLab, req, &info); err != nil {
+		return fmt.Errorf("invalid access token: %w", err)
+	}
+	return checkTokenApplication(o.config.GitLabClientID, info.Application.UID)
+}
+
+// checkDiscordAccessToken verifies that a Discord access token was issued to
+// this application
+func (o *OAuthManager) checkDiscordAccessToken(ctx context.Context, accessToken string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", discordAPIBaseURL+"/oauth2/@me", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var info struct {
+		Application struct {
+			ID string `json:"id"`
+		} `json:"application"`
+	}
+	if err := o.doJSON(ProviderDiscord, req, &info); err != nil {
+		return fmt.Errorf("invalid access token: %w", err)
+	}
+	return checkTokenApplication(o.config.DiscordClientID, info.Application.ID)
+}
+
+// checkTokenApplication verifies that the application a provider reports for
+// an access token is this app's client. Tokens without an application, such
+// as personal access tokens, are rejected.
+func checkTokenApplication(clientID, applicationID string) error {
+	if clientID == "" {
+		return fmt.Errorf("client ID is not configured")
+	}
+	if applicationID != clientID {
+		return fmt.Errorf("access token was issued to another application")
+	}
+	return nil
+}
+
+// doJSON sends a request to a provider and decodes a 200 JSON response into
+// dest, if set
+func (o *OAuthManager) doJSON(provider OAuthProvider, req *http.Request, dest interface{}) error {
+	resp, err := o.doProviderRequest(provider, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed with status: %d", resp.StatusCode)
+	}
+	if dest == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
@@ -0,0 +1,154 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newGitLabServer mocks the token, token info and user endpoints of a GitLab
+// instance. tokenInfo is the body of /oauth/token/info. The code "good-code"
+// exchanges for the access token "app-token".
+func newGitLabServer(t *testing.T, tokenInfo string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/token" {
+			if r.Method != http.MethodPost || r.FormValue("code") != "good-code" || r.FormValue("client_secret") != "secret-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token": "app-token", "token_type": "Bearer"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer app-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/oauth/token/info":
+			fmt.Fprint(w, tokenInfo)
+		case "/api/v4/user":
+			fmt.Fprint(w, `{"id": 42, "username": "jane", "email": "jane@example.com", "avatar_url": "https://gitlab.example.com/jane.png", "confirmed_at": "2024-01-01T00:00:00Z"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUserInfoFromGitLabToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		clientID  string
+		tokenInfo string
+		token     string
+		wantErr   bool
+	}{
+		{name: "token of this application", clientID: "client-1", tokenInfo: `{"application": {"uid": "client-1"}}`, token: "app-token"},
+		{name: "token of another application", clientID: "client-1", tokenInfo: `{"application": {"uid": "client-2"}}`, token: "app-token", wantErr: true},
+		{name: "personal access token", clientID: "client-1", tokenInfo: `{"application": null}`, token: "app-token", wantErr: true},
+		{name: "personal access token without a client ID", tokenInfo: `{"application": null}`, token: "app-token", wantErr: true},
+		{name: "unconfigured client ID", tokenInfo: `{"application": {"uid": "client-1"}}`, token: "app-token", wantErr: true},
+		{name: "rejected token", clientID: "client-1", tokenInfo: `{"application": {"uid": "client-1"}}`, token: "bad-token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newGitLabServer(t, tt.tokenInfo)
+			config := newTestConfig()
+			config.GitLabBaseURL = server.URL
+			config.GitLabClientID = tt.clientID
+			manager := NewOAuthManager(config, NewMemorySessionStore())
+
+			info, err := manager.UserInfoFromToken(context.Background(), ProviderGitLab, tt.token, "")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("UserInfoFromToken() = %+v, want error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UserInfoFromToken() error = %v", err)
+			}
+			if info.ID != "42" || info.Email != "jane@example.com" || !info.EmailVerified {
+				t.Errorf("UserInfoFromToken() = %+v", info)
+			}
+		})
+	}
+}
+
+func TestUserInfoFromDiscordTokenRequiresClientID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"application": {"id": ""}}`)
+	}))
+	defer server.Close()
+
+	saved := discordAPIBaseURL
+	discordAPIBaseURL = server.URL
+	defer func() { discordAPIBaseURL = saved }()
+
+	manager := NewOAuthManager(newTestConfig(), NewMemorySessionStore())
+	if _, err := manager.UserInfoFromToken(context.Background(), ProviderDiscord, "token", ""); err == nil {
+		t.Errorf("UserInfoFromToken() accepted a token without an application")
+	}
+}
+
+func TestTokenCheckUsesCircuitBreaker(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	config := newTestConfig()
+	config.GitLabBaseURL = server.URL
+	config.GitLabClientID = "client-1"
+	config.OAuthBreakerThreshold = 2
+	manager := NewOAuthManager(config, NewMemorySessionStore())
+
+	for i := 0; i < 2; i++ {
+		if _, err := manager.UserInfoFromToken(context.Background(), ProviderGitLab, "app-token", ""); err == nil {
+			t.Fatalf("UserInfoFromToken() succeeded against a failing provider")
+		}
+	}
+
+	_, err := manager.UserInfoFromToken(context.Background(), ProviderGitLab, "app-token", "")
+	if !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("UserInfoFromToken() error = %v, want ErrProviderUnavailable", err)
+	}
+	if calls != 2 {
+		t.Errorf("provider called %d times, want 2", calls)
+	}
+}
+
+func TestProviderClientHasTimeout(t *testing.T) {
+	if providerClient.Timeout <= 0 {
+		t.Errorf("provider requests have no timeout")
+	}
+}
+
+func TestOAuthSignInWithToken(t *testing.T) {
+	server := newGitLabServer(t, `{"application": {"uid": "client-1"}}`)
+	a, _, _ := newTestService(t, func(c *Config) {
+		c.GitLabBaseURL = server.URL
+		c.GitLabClientID = "client-1"
+	})
+
+	response, err := a.OAuthSignInWithToken(context.Background(), ProviderGitLab, "app-token", "")
+	if err != nil {
+		t.Fatalf("OAuthSignInWithToken() error = %v", err)
+	}
+	if response.AccessToken == "" || response.User.Email != "jane@example.com" {
+		t.Errorf("OAuthSignInWithToken() = %+v", response)
+	}
+
+	if _, err := a.OAuthSignInWithToken(context.Background(), ProviderGitLab, "bad-token", ""); err == nil {
+		t.Errorf("OAuthSignInWithToken() accepted an invalid token")
+	}
+}
@@ -0,0 +1,309 @@
+package gotrust
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RouteDescriptor describes a route registered by the adapters'
+// RegisterRoutes functions
+type RouteDescriptor struct {
+	Method  string
+	Path    string // relative to the base path
+	Summary string
+	// Auth reports whether the route requires an access token
+	Auth bool
+	// Request and Response are values of the JSON request and success
+	// response body types, or nil when the route has no body
+	Request  interface{}
+	Response interface{}
+	// Status is the success status code
+	Status int
+}
+
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error     string `json:"error"`
+	Code      string `json:"code,omitempty"`
+	RequestID string `json:"request_id"`
+}
+
+// AuthRoutes describes the routes registered by RegisterRoutes
+func AuthRoutes() []RouteDescriptor {
+	routes := []RouteDescriptor{
+		{Method: http.MethodPost, Path: "/signup", Summary: "Register with email and password", Request: SignUpRequest{}, Response: AuthResponse{}, Status: http.StatusCreated},
+		{Method: http.MethodPost, Path: "/signin", Summary: "Sign in with email and password", Request: SignInRequest{}, Response: AuthResponse{}},
+		{Method: http.MethodPost, Path: "/guest", Summary: "Start a guest session", Response: AuthResponse{}, Status: http.StatusCreated},
+		{Method: http.MethodPost, Path: "/guest/upgrade", Summary: "Upgrade the current guest to a registered user", Auth: true, Request: SignUpRequest{}, Response: AuthResponse{}},
+		{Method: http.MethodPost, Path: "/refresh", Summary: "Exchange a refresh token for new tokens", Request: struct {
+			RefreshToken string `json:"refresh_token,omitempty"`
+		}{}, Response: AuthResponse{}},
+		{Method: http.MethodPost, Path: "/verify-email", Summary: "Verify an email address", Request: struct {
+			Token string `json:"token"`
+		}{}, Response: messageResponse{}},
+		{Method: http.MethodPost, Path: "/resend-verification", Summary: "Resend the verification email", Request: struct {
+			Email string `json:"email"`
+		}{}, Response: messageResponse{}},
+		{Method: http.MethodPost, Path: "/logout", Summary: "End the current session", Response: messageResponse{}},
+		{Method: http.MethodPost, Path: "/logout-all", Summary: "End every session of the current user", Auth: true, Response: struct {
+			Message             string `json:"message"`
+			SessionsInvalidated int    `json:"sessions_invalidated"`
+		}{}},
+		{Method: http.MethodGet, Path: "/refresh-tokens", Summary: "List the current user's active refresh tokens", Auth: true, Response: struct {
+			RefreshTokens []RefreshTokenRecord `json:"refresh_tokens"`
+		}{}},
+		{Method: http.MethodPost, Path: "/refresh-tokens/revoke", Summary: "Revoke one of the current user's refresh tokens", Auth: true, Request: struct {
+			TokenID string `json:"token_id"`
+		}{}, Response: messageResponse{}},
+		{Method: http.MethodGet, Path: "/account/export", Summary: "Export everything stored about the current user", Auth: true, Response: struct {
+			ExportedAt    time.Time            `json:"exported_at"`
+			User          User                 `json:"user"`
+			Identities    []exportedIdentity   `json:"identities"`
+			Sessions      []SessionData        `json:"sessions"`
+			RefreshTokens []RefreshTokenRecord `json:"refresh_tokens"`
+			AuditEvents   []AuditEvent         `json:"audit_events,omitempty"`
+		}{}},
+		{Method: http.MethodPost, Path: "/claims/refresh", Summary: "Re-issue the current user's tokens with their current roles", Auth: true, Response: AuthResponse{}},
+		{Method: http.MethodGet, Path: "/user", Summary: "Get the current user", Auth: true, Response: struct {
+			UserID   string `json:"user_id"`
+			Email    string `json:"email"`
+			Name     string `json:"name"`
+			Provider string `json:"provider"`
+		}{}},
+		{Method: http.MethodPost, Path: "/session/token", Summary: "Exchange the session cookie for an access token", Response: AuthResponse{}},
+		{Method: http.MethodGet, Path: "/me", Summary: "Get the current identity from the access token", Auth: true, Response: MeResponse{}},
+		{Method: http.MethodGet, Path: "/userinfo", Summary: "Get the OpenID Connect claims of the current user", Auth: true, Response: UserInfo{}},
+		{Method: http.MethodPatch, Path: "/profile", Summary: "Update the current user's profile", Auth: true, Request: ProfileUpdate{}, Response: User{}},
+		{Method: http.MethodPost, Path: "/email/change", Summary: "Request an email change", Auth: true, Request: struct {
+			Email string `json:"email"`
+		}{}, Response: messageResponse{}},
+		{Method: http.MethodPost, Path: "/email/confirm", Summary: "Confirm an email change", Request: struct {
+			Token string `json:"token"`
+		}{}, Response: User{}},
+		{Method: http.MethodGet, Path: "/audit", Summary: "Query the audit log", Auth: true, Response: struct {
+			Events []AuditEvent `json:"events"`
+			Limit  int          `json:"limit"`
+			Offset int          `json:"offset"`
+		}{}},
+	}
+
+	for _, provider := range OAuthProviders() {
+		name := string(provider)
+		routes = append(routes,
+			RouteDescriptor{Method: http.MethodGet, Path: "/" + name, Summary: "Redirect to " + name + " sign-in", Status: http.StatusTemporaryRedirect},
+			RouteDescriptor{Method: http.MethodGet, Path: "/" + name + "/callback", Summary: "Complete " + name + " sign-in", Status: http.StatusTemporaryRedirect},
+			RouteDescriptor{Method: http.MethodPost, Path: "/oauth/" + name + "/token", Summary: "Sign in with a " + name + " token obtained by a native app", Request: struct {
+				AccessToken string `json:"access_token,omitempty"`
+				IDToken     string `json:"id_token,omitempty"`
+			}{}, Response: AuthResponse{}},
+		)
+	}
+
+	routes = append(routes, RouteDescriptor{Method: http.MethodPost, Path: "/oauth/link", Summary: "Link an OAuth account by confirming the password", Request: struct {
+		LinkToken string `json:"link_token"`
+		SignInRequest
+	}{}, Response: AuthResponse{}})
+
+	return routes
+}
+
+// OpenAPISpec returns an OpenAPI 3 document describing the auth routes
+// mounted at basePath, with schemas derived from the request and response
+// types' struct tags. It is meant to be merged into an application's own
+// spec or marshalled to JSON.
+func OpenAPISpec(basePath string) map[string]interface{} {
+	basePath = strings.TrimSuffix(basePath, "/")
+	schemas := map[string]interface{}{}
+	errorSchema := schemaFor(reflect.TypeOf(errorResponse{}), schemas)
+
+	paths := map[string]interface{}{}
+	for _, route := range AuthRoutes() {
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if route.Response != nil {
+			success["content"] = jsonContent(schemaFor(reflect.TypeOf(route.Response), schemas))
+		}
+		operation := map[string]interface{}{
+			"summary": route.Summary,
+			"tags":    []string{"auth"},
+			"responses": map[string]interface{}{
+				strconv.Itoa(status): success,
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     jsonContent(errorSchema),
+				},
+			},
+		}
+		if route.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(schemaFor(reflect.TypeOf(route.Request), schemas)),
+			}
+		}
+		if route.Auth {
+			operation["security"] = []map[string][]string{{"bearerAuth": {}}}
+		}
+
+		path := basePath + route.Path
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "GoTrust authentication API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the JSON schema of t. Named structs are added to schemas
+// and referenced; anonymous structs are inlined.
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		name := schemaName(t)
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = nil // reserve the name for recursive types
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t, schemas)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// schemaName strips unexported type names down to an exported-looking name
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// structSchema builds an object schema from the struct's json and validate
+// tags. Fields without omitempty are required.
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	addStructFields(t, schemas, properties, &required)
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func addStructFields(t reflect.Type, schemas map[string]interface{}, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		// Embedded structs without a name are flattened, as encoding/json does
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addStructFields(field.Type, schemas, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaFor(field.Type, schemas)
+		applyValidateTag(property, field.Tag.Get("validate"))
+		properties[name] = property
+
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// applyValidateTag maps the email and min/max rules of a validate tag to
+// schema keywords
+func applyValidateTag(property map[string]interface{}, validate string) {
+	if validate == "" || property["type"] != "string" {
+		return
+	}
+	for _, rule := range strings.Split(validate, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "email":
+			property["format"] = "email"
+		case "min":
+			if n, err := strconv.Atoi(value); err == nil {
+				property["minLength"] = n
+			}
+		case "max":
+			if n, err := strconv.Atoi(value); err == nil {
+				property["maxLength"] = n
+			}
+		}
+	}
+}
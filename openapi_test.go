@@ -0,0 +1,189 @@
+package gotrust
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// openAPIDocument is the subset of an OpenAPI 3 document the spec is
+// checked against
+type openAPIDocument struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas         map[string]json.RawMessage `json:"schemas"`
+		SecuritySchemes map[string]json.RawMessage `json:"securitySchemes"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	Tags        []string                   `json:"tags"`
+	RequestBody *openAPIBody               `json:"requestBody"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security"`
+}
+
+type openAPIBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema json.RawMessage `json:"schema"`
+}
+
+type openAPISchema struct {
+	Type       string                   `json:"type"`
+	Format     string                   `json:"format"`
+	MinLength  int                      `json:"minLength"`
+	Required   []string                 `json:"required"`
+	Properties map[string]openAPISchema `json:"properties"`
+}
+
+// parseOpenAPISpec round-trips the spec through JSON, as a docs pipeline
+// consuming it would
+func parseOpenAPISpec(t *testing.T, basePath string) (*openAPIDocument, string) {
+	t.Helper()
+
+	data, err := json.Marshal(OpenAPISpec(basePath))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var doc openAPIDocument
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		t.Fatalf("spec does not parse as OpenAPI: %v", err)
+	}
+	return &doc, string(data)
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	doc, raw := parseOpenAPISpec(t, "/auth/")
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") || doc.Info.Title == "" || doc.Info.Version == "" {
+		t.Errorf("openapi = %q, info = %+v", doc.OpenAPI, doc.Info)
+	}
+	if _, ok := doc.Components.SecuritySchemes["bearerAuth"]; !ok {
+		t.Error("bearerAuth security scheme missing")
+	}
+
+	// Every route is described once, with a success and an error response
+	operations := 0
+	for path, item := range doc.Paths {
+		if !strings.HasPrefix(path, "/auth/") || strings.HasPrefix(path, "/auth//") {
+			t.Errorf("path %q is not under the base path", path)
+		}
+		for method, op := range item {
+			operations++
+			if op.Summary == "" || len(op.Responses) < 2 || op.Responses["default"].Description == "" {
+				t.Errorf("%s %s = %+v, want a summary, success and default responses", method, path, op)
+			}
+			if op.RequestBody != nil && op.RequestBody.Content["application/json"].Schema == nil {
+				t.Errorf("%s %s request body has no JSON schema", method, path)
+			}
+		}
+	}
+	if operations != len(AuthRoutes()) {
+		t.Errorf("spec has %d operations, want %d", operations, len(AuthRoutes()))
+	}
+
+	// Every schema reference resolves
+	for _, ref := range strings.Split(raw, `"$ref":"`)[1:] {
+		name := strings.TrimPrefix(ref[:strings.Index(ref, `"`)], "#/components/schemas/")
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("unresolved schema reference %q", name)
+		}
+	}
+}
+
+func TestOpenAPISpecOperations(t *testing.T) {
+	doc, _ := parseOpenAPISpec(t, "/auth")
+
+	tests := []struct {
+		method      string
+		path        string
+		wantStatus  string
+		wantRequest string
+		wantAuth    bool
+	}{
+		{method: "post", path: "/auth/signup", wantStatus: "201", wantRequest: "SignUpRequest"},
+		{method: "post", path: "/auth/signin", wantStatus: "200", wantRequest: "SignInRequest"},
+		{method: "get", path: "/auth/me", wantStatus: "200", wantAuth: true},
+		{method: "patch", path: "/auth/profile", wantStatus: "200", wantRequest: "ProfileUpdate", wantAuth: true},
+		{method: "get", path: "/auth/google/callback", wantStatus: "307"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			op, ok := doc.Paths[tt.path][tt.method]
+			if !ok {
+				t.Fatalf("operation missing from the spec")
+			}
+			if _, ok := op.Responses[tt.wantStatus]; !ok {
+				t.Errorf("responses = %v, want status %s", op.Responses, tt.wantStatus)
+			}
+			if (len(op.Security) > 0) != tt.wantAuth {
+				t.Errorf("security = %v, want auth %v", op.Security, tt.wantAuth)
+			}
+			if tt.wantRequest == "" {
+				return
+			}
+			if op.RequestBody == nil {
+				t.Fatalf("request body missing")
+			}
+			schema := string(op.RequestBody.Content["application/json"].Schema)
+			if want := fmt.Sprintf(`{"$ref":"#/components/schemas/%s"}`, tt.wantRequest); schema != want {
+				t.Errorf("request schema = %s, want %s", schema, want)
+			}
+		})
+	}
+}
+
+func TestOpenAPISchemaFromTags(t *testing.T) {
+	doc, _ := parseOpenAPISpec(t, "/auth")
+
+	var signUp openAPISchema
+	if err := json.Unmarshal(doc.Components.Schemas["SignUpRequest"], &signUp); err != nil {
+		t.Fatalf("SignUpRequest schema: %v", err)
+	}
+	if fmt.Sprint(signUp.Required) != "[email password]" {
+		t.Errorf("required = %v, want [email password]", signUp.Required)
+	}
+
+	tests := []struct {
+		property      string
+		wantType      string
+		wantFormat    string
+		wantMinLength int
+	}{
+		{property: "email", wantType: "string", wantFormat: "email"},
+		{property: "password", wantType: "string", wantMinLength: 6},
+		{property: "name", wantType: "string"},
+		{property: "captcha_token", wantType: "string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.property, func(t *testing.T) {
+			got, ok := signUp.Properties[tt.property]
+			if !ok {
+				t.Fatalf("property missing from %v", signUp.Properties)
+			}
+			if got.Type != tt.wantType || got.Format != tt.wantFormat || got.MinLength != tt.wantMinLength {
+				t.Errorf("schema = %+v, want type %s, format %q, minLength %d", got, tt.wantType, tt.wantFormat, tt.wantMinLength)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package gotrust
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes and verifies passwords
+type PasswordHasher interface {
+	// Hash returns an encoded hash of the password
+	Hash(password string) (string, error)
+	// Compare returns nil if the password matches the hash
+	Compare(hashedPassword, password string) error
+	// Supports reports whether the hash was produced by this algorithm
+	Supports(hashedPassword string) bool
+}
+
+// BcryptHasher hashes passwords with bcrypt
+type BcryptHasher struct {
+	Cost int
+	// PreHash hashes passwords with SHA-256 before bcrypt, which would
+	// otherwise ignore everything past the first 72 bytes. Hashes made
+	// without it still verify and are reported as needing a rehash.
+	PreHash bool
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{Cost: cost}
+}
+
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	if b.PreHash {
+		password = preHashPassword(password)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b *BcryptHasher) Compare(hashedPassword, password string) error {
+	_, err := b.Verify(hashedPassword, password)
+	return err
+}
+
+// Verify also reports hashes made with another cost as needing a rehash
+func (b *BcryptHasher) Verify(hashedPassword, password string) (bool, error) {
+	cost, _ := bcrypt.Cost([]byte(hashedPassword))
+	costChanged := cost != b.Cost
+
+	if !b.PreHash {
+		return costChanged, bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(preHashPassword(password))); err == nil {
+		return costChanged, nil
+	}
+
+	// Hashes made before PreHash was enabled. bcrypt never hashed passwords
+	// over 72 bytes, so longer ones can only match by truncation.
+	if len(password) <= bcryptMaxPasswordLength {
+		if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err == nil {
+			return true, nil
+		}
+	}
+
+	return false, fmt.Errorf("password does not match")
+}
+
+func (b *BcryptHasher) Supports(hashedPassword string) bool {
+	_, err := bcrypt.Cost([]byte(hashedPassword))
+	return err == nil
+}
+
+// bcryptMaxPasswordLength is the number of password bytes bcrypt uses
+const bcryptMaxPasswordLength = 72
+
+// preHashPassword returns the base64 SHA-256 of the password, which fits in
+// bcrypt's 72-byte limit
+func preHashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Argon2idHasher hashes passwords with argon2id, encoded in the PHC string
+// format: $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+type Argon2idHasher struct {
+	Time       uint32
+	Memory     uint32 // in KiB
+	Threads    uint8
+	KeyLength  uint32
+	SaltLength uint32
+}
+
+// NewArgon2idHasher creates an argon2id hasher with the OWASP recommended
+// parameters (19 MiB memory, 2 iterations, 1 thread)
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Time:       2,
+		Memory:     19 * 1024,
+		Threads:    1,
+		KeyLength:  32,
+		SaltLength: 16,
+	}
+}
+
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *Argon2idHasher) Compare(hashedPassword, password string) error {
+	params, salt, key, err := decodeArgon2idHash(hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, candidate) != 1 {
+		return fmt.Errorf("password does not match")
+	}
+	return nil
+}
+
+// Verify also reports hashes made with other parameters as needing a rehash
+func (a *Argon2idHasher) Verify(hashedPassword, password string) (bool, error) {
+	if err := a.Compare(hashedPassword, password); err != nil {
+		return false, err
+	}
+	params, salt, key, _ := decodeArgon2idHash(hashedPassword)
+	return params.Time != a.Time || params.Memory != a.Memory || params.Threads != a.Threads ||
+		uint32(len(key)) != a.KeyLength || uint32(len(salt)) != a.SaltLength, nil
+}
+
+func (a *Argon2idHasher) Supports(hashedPassword string) bool {
+	_, _, _, err := decodeArgon2idHash(hashedPassword)
+	return err == nil
+}
+
+// decodeArgon2idHash parses a PHC-formatted argon2id hash
+func decodeArgon2idHash(hashedPassword string) (*Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, fmt.Errorf("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2id version: %d", version)
+	}
+
+	params := &Argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	return params, salt, key, nil
+}
+
+// PasswordVerifier is implemented by hashers that can tell, while verifying,
+// that a hash is outdated and should be replaced by a fresh Hash
+type PasswordVerifier interface {
+	Verify(hashedPassword, password string) (needsRehash bool, err error)
+}
+
+// MigratingHasher hashes new passwords with Hasher and still verifies hashes
+// made by the Legacy hashers, reporting them as needing a rehash so users
+// move to Hasher as they sign in
+type MigratingHasher struct {
+	Hasher PasswordHasher
+	Legacy []PasswordHasher
+}
+
+func NewMigratingHasher(hasher PasswordHasher, legacy ...PasswordHasher) *MigratingHasher {
+	return &MigratingHasher{Hasher: hasher, Legacy: legacy}
+}
+
+func (m *MigratingHasher) Hash(password string) (string, error) {
+	return m.Hasher.Hash(password)
+}
+
+func (m *MigratingHasher) Compare(hashedPassword, password string) error {
+	_, err := m.Verify(hashedPassword, password)
+	return err
+}
+
+func (m *MigratingHasher) Verify(hashedPassword, password string) (bool, error) {
+	if m.Hasher.Supports(hashedPassword) {
+		return verifyPasswordHash(m.Hasher, hashedPassword, password)
+	}
+	for _, legacy := range m.Legacy {
+		if legacy.Supports(hashedPassword) {
+			if _, err := verifyPasswordHash(legacy, hashedPassword, password); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("unsupported password hash")
+}
+
+func (m *MigratingHasher) Supports(hashedPassword string) bool {
+	if m.Hasher.Supports(hashedPassword) {
+		return true
+	}
+	for _, legacy := range m.Legacy {
+		if legacy.Supports(hashedPassword) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyPasswordHash verifies a password with the hasher, using Verify when
+// it implements PasswordVerifier
+func verifyPasswordHash(hasher PasswordHasher, hashedPassword, password string) (bool, error) {
+	if verifier, ok := hasher.(PasswordVerifier); ok {
+		return verifier.Verify(hashedPassword, password)
+	}
+	return false, hasher.Compare(hashedPassword, password)
+}
+
+// PasswordUpdater is implemented by user stores that can replace a user's
+// password hash, which enables transparent rehashing on sign-in
+type PasswordUpdater interface {
+	UpdatePassword(ctx context.Context, userID, hashedPassword string) error
+}
+
+// PepperedHasher mixes an application-wide secret pepper into passwords with
+// HMAC-SHA256 before hashing them with the wrapped hasher. Hashes made with
+// one of the PreviousPeppers still verify and are reported as needing a
+// rehash. An empty previous pepper, or AcceptUnpeppered, matches hashes made
+// without a pepper, for enabling one on existing users.
+type PepperedHasher struct {
+	Hasher           PasswordHasher
+	Pepper           string
+	PreviousPeppers  []string
+	AcceptUnpeppered bool
+}
+
+func NewPepperedHasher(hasher PasswordHasher, pepper string, previousPeppers ...string) *PepperedHasher {
+	return &PepperedHasher{
+		Hasher:          hasher,
+		Pepper:          pepper,
+		PreviousPeppers: previousPeppers,
+	}
+}
+
+func (p *PepperedHasher) Hash(password string) (string, error) {
+	return p.Hasher.Hash(pepperPassword(p.Pepper, password))
+}
+
+func (p *PepperedHasher) Compare(hashedPassword, password string) error {
+	_, err := p.Verify(hashedPassword, password)
+	return err
+}
+
+func (p *PepperedHasher) Verify(hashedPassword, password string) (bool, error) {
+	if needsRehash, err := verifyPasswordHash(p.Hasher, hashedPassword, pepperPassword(p.Pepper, password)); err == nil {
+		return needsRehash, nil
+	}
+
+	for _, previous := range p.PreviousPeppers {
+		if err := p.Hasher.Compare(hashedPassword, pepperPassword(previous, password)); err == nil {
+			return true, nil
+		}
+	}
+	if p.AcceptUnpeppered {
+		if err := p.Hasher.Compare(hashedPassword, password); err == nil {
+			return true, nil
+		}
+	}
+
+	return false, fmt.Errorf("password does not match")
+}
+
+func (p *PepperedHasher) Supports(hashedPassword string) bool {
+	return p.Hasher.Supports(hashedPassword)
+}
+
+// pepperPassword returns the base64 HMAC-SHA256 of the password keyed by the
+// pepper, which also keeps it within bcrypt's 72-byte limit
+func pepperPassword(pepper, password string) string {
+	if pepper == "" {
+		return password
+	}
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(password))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DefaultHashQueueTimeout is how long a hash waits for a free slot of a
+// LimitedHasher by default
+const DefaultHashQueueTimeout = 5 * time.Second
+
+// LimitedHasher runs at most a fixed number of hashes and comparisons at
+// once, so bursts of sign-ins cannot take every CPU. Calls beyond the limit
+// wait for a slot, failing with ErrHashingBusy after Timeout.
+type LimitedHasher struct {
+	Hasher  PasswordHasher
+	Timeout time.Duration
+	slots   chan struct{}
+}
+
+// NewLimitedHasher limits hasher to max concurrent operations. A zero timeout
+// uses DefaultHashQueueTimeout.
+func NewLimitedHasher(hasher PasswordHasher, max int, timeout time.Duration) *LimitedHasher {
+	if timeout <= 0 {
+		timeout = DefaultHashQueueTimeout
+	}
+	return &LimitedHasher{Hasher: hasher, Timeout: timeout, slots: make(chan struct{}, max)}
+}
+
+// acquire takes a slot, returning the function releasing it
+func (l *LimitedHasher) acquire() (func(), error) {
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		timer := time.NewTimer(l.Timeout)
+		defer timer.Stop()
+		select {
+		case l.slots <- struct{}{}:
+		case <-timer.C:
+			return nil, ErrHashingBusy
+		}
+	}
+	return func() { <-l.slots }, nil
+}
+
+func (l *LimitedHasher) Hash(password string) (string, error) {
+	release, err := l.acquire()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return l.Hasher.Hash(password)
+}
+
+func (l *LimitedHasher) Compare(hashedPassword, password string) error {
+	release, err := l.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return l.Hasher.Compare(hashedPassword, password)
+}
+
+func (l *LimitedHasher) Verify(hashedPassword, password string) (bool, error) {
+	release, err := l.acquire()
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return verifyPasswordHash(l.Hasher, hashedPassword, password)
+}
+
+func (l *LimitedHasher) Supports(hashedPassword string) bool {
+	return l.Hasher.Supports(hashedPassword)
+}
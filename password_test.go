@@ -0,0 +1,445 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPepperedHasher(t *testing.T) {
+	base := NewBcryptHasher(bcrypt.MinCost)
+	hashWithPepper := func(pepper string) string {
+		return hashWith(t, NewPepperedHasher(base, pepper), testPassword)
+	}
+
+	tests := []struct {
+		name             string
+		hash             string
+		password         string
+		previous         []string
+		acceptUnpeppered bool
+		wantErr          bool
+		wantNeedsRehash  bool
+	}{
+		{name: "current pepper", hash: hashWithPepper("pepper-2"), password: testPassword},
+		{name: "wrong password", hash: hashWithPepper("pepper-2"), password: "wrong-password", wantErr: true},
+		{name: "previous pepper", hash: hashWithPepper("pepper-1"), password: testPassword, previous: []string{"pepper-1"}, wantNeedsRehash: true},
+		{name: "previous pepper with wrong password", hash: hashWithPepper("pepper-1"), password: "wrong-password", previous: []string{"pepper-1"}, wantErr: true},
+		{name: "retired pepper", hash: hashWithPepper("pepper-0"), password: testPassword, previous: []string{"pepper-1"}, wantErr: true},
+		{name: "unpeppered hash", hash: hashWithPepper(""), password: testPassword, wantErr: true},
+		{name: "unpeppered hash migrating", hash: hashWithPepper(""), password: testPassword, previous: []string{""}, wantNeedsRehash: true},
+		{name: "unpeppered hash accepted", hash: hashWithPepper(""), password: testPassword, acceptUnpeppered: true, wantNeedsRehash: true},
+		{name: "unpeppered hash accepted with wrong password", hash: hashWithPepper(""), password: "wrong-password", acceptUnpeppered: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasher := NewPepperedHasher(base, "pepper-2", tt.previous...)
+			hasher.AcceptUnpeppered = tt.acceptUnpeppered
+
+			needsRehash, err := hasher.Verify(tt.hash, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if needsRehash != tt.wantNeedsRehash {
+				t.Errorf("Verify() needsRehash = %v, want %v", needsRehash, tt.wantNeedsRehash)
+			}
+			if err := hasher.Compare(tt.hash, tt.password); (err != nil) != tt.wantErr {
+				t.Errorf("Compare() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPepperedHashIsNotPlainHash(t *testing.T) {
+	hash := hashWith(t, NewPepperedHasher(NewBcryptHasher(bcrypt.MinCost), "pepper"), testPassword)
+
+	// Without the pepper the hash cannot be cracked from the password alone
+	if err := NewBcryptHasher(bcrypt.MinCost).Compare(hash, testPassword); err == nil {
+		t.Errorf("a peppered hash verified without the pepper")
+	}
+}
+
+func TestPepperRotationOnSignIn(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserStore()
+	sessions := NewMemorySessionStore()
+	defer sessions.Close()
+	service := func(pepper string, previous ...string) *AuthService {
+		config := newTestConfig()
+		config.PasswordPepper = pepper
+		config.PasswordPreviousPeppers = previous
+		return NewAuthService(config, users, sessions)
+	}
+
+	signUp(t, service("pepper-1"), "jane@example.com")
+	_, oldHash, _ := users.GetUserByEmail(ctx, "jane@example.com")
+
+	rotated := service("pepper-2", "pepper-1")
+	if _, err := rotated.SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword}); err != nil {
+		t.Fatalf("SignIn() after rotation error = %v", err)
+	}
+
+	// The hash was replaced by one made with the current pepper
+	_, newHash, _ := users.GetUserByEmail(ctx, "jane@example.com")
+	if newHash == oldHash {
+		t.Fatalf("SignIn() did not rehash a password made with the previous pepper")
+	}
+	if needsRehash, err := NewPepperedHasher(NewBcryptHasher(bcrypt.MinCost), "pepper-2").Verify(newHash, testPassword); err != nil || needsRehash {
+		t.Errorf("rehashed password Verify() = %v, %v", needsRehash, err)
+	}
+
+	// Once rehashed, the previous pepper can be retired
+	if _, err := service("pepper-2").SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword}); err != nil {
+		t.Errorf("SignIn() after retiring the previous pepper error = %v", err)
+	}
+}
+
+func TestPepperEnabledOnSignIn(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserStore()
+	sessions := NewMemorySessionStore()
+	defer sessions.Close()
+	service := func(pepper string, acceptUnpeppered bool) *AuthService {
+		config := newTestConfig()
+		config.PasswordPepper = pepper
+		config.PasswordPepperAcceptUnpeppered = acceptUnpeppered
+		return NewAuthService(config, users, sessions)
+	}
+	signIn := func(a *AuthService) error {
+		_, err := a.SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword})
+		return err
+	}
+
+	signUp(t, service("", false), "jane@example.com")
+
+	// Without the migration option existing users are locked out
+	if err := signIn(service("pepper", false)); err == nil {
+		t.Fatalf("SignIn() with an unpeppered hash succeeded without PasswordPepperAcceptUnpeppered")
+	}
+
+	if err := signIn(service("pepper", true)); err != nil {
+		t.Fatalf("SignIn() while accepting unpeppered hashes error = %v", err)
+	}
+	_, newHash, _ := users.GetUserByEmail(ctx, "jane@example.com")
+	if needsRehash, err := NewPepperedHasher(NewBcryptHasher(bcrypt.MinCost), "pepper").Verify(newHash, testPassword); err != nil || needsRehash {
+		t.Errorf("rehashed password Verify() = %v, %v", needsRehash, err)
+	}
+
+	// Once rehashed, the option can be turned off
+	if err := signIn(service("pepper", false)); err != nil {
+		t.Errorf("SignIn() after the migration error = %v", err)
+	}
+}
+
+func TestBcryptPreHash(t *testing.T) {
+	// Two 80-byte passwords that bcrypt alone could only tell apart by their
+	// last 8 bytes, which it ignores
+	prefix := strings.Repeat("p", bcryptMaxPasswordLength)
+	long1, long2 := prefix+"-first-1", prefix+"-second2"
+
+	plain := NewBcryptHasher(bcrypt.MinCost)
+	preHashed := NewBcryptHasher(bcrypt.MinCost)
+	preHashed.PreHash = true
+
+	tests := []struct {
+		name            string
+		hash            string
+		hasher          *BcryptHasher
+		password        string
+		wantErr         bool
+		wantNeedsRehash bool
+	}{
+		{name: "long password", hash: hashWith(t, preHashed, long1), hasher: preHashed, password: long1},
+		{name: "long password sharing a 72-byte prefix", hash: hashWith(t, preHashed, long1), hasher: preHashed, password: long2, wantErr: true},
+		{name: "short password", hash: hashWith(t, preHashed, testPassword), hasher: preHashed, password: testPassword},
+		{name: "wrong password", hash: hashWith(t, preHashed, testPassword), hasher: preHashed, password: "wrong-password", wantErr: true},
+		{name: "hash made before pre-hashing", hash: hashWith(t, plain, testPassword), hasher: preHashed, password: testPassword, wantNeedsRehash: true},
+		{name: "pre-hashed hash without pre-hashing", hash: hashWith(t, preHashed, testPassword), hasher: plain, password: testPassword, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := tt.hasher.Verify(tt.hash, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if needsRehash != tt.wantNeedsRehash {
+				t.Errorf("Verify() needsRehash = %v, want %v", needsRehash, tt.wantNeedsRehash)
+			}
+			if err := tt.hasher.Compare(tt.hash, tt.password); (err != nil) != tt.wantErr {
+				t.Errorf("Compare() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBcryptPreHashOnSignIn(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserStore()
+	sessions := NewMemorySessionStore()
+	defer sessions.Close()
+	service := func(preHash bool) *AuthService {
+		config := newTestConfig()
+		config.BCryptPreHash = preHash
+		return NewAuthService(config, users, sessions)
+	}
+
+	signUp(t, service(false), "jane@example.com")
+	_, oldHash, _ := users.GetUserByEmail(ctx, "jane@example.com")
+
+	if _, err := service(true).SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword}); err != nil {
+		t.Fatalf("SignIn() after enabling BCryptPreHash error = %v", err)
+	}
+
+	// The hash was upgraded to a pre-hashed one
+	_, newHash, _ := users.GetUserByEmail(ctx, "jane@example.com")
+	if newHash == oldHash {
+		t.Fatalf("SignIn() did not rehash a password hashed without pre-hashing")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(newHash), []byte(preHashPassword(testPassword))); err != nil {
+		t.Errorf("rehashed password is not pre-hashed: %v", err)
+	}
+}
+
+// testArgon2idHasher returns an argon2id hasher cheap enough for tests
+func testArgon2idHasher(iterations uint32) *Argon2idHasher {
+	hasher := NewArgon2idHasher()
+	hasher.Time = iterations
+	hasher.Memory = 64
+	return hasher
+}
+
+func TestPasswordHashMigrationOnSignIn(t *testing.T) {
+	tests := []struct {
+		name       string
+		signUpWith func(c *Config)
+		signInWith func(c *Config)
+		password   string
+		wantRehash bool
+		wantPrefix string
+	}{
+		{
+			name:       "bcrypt to argon2id",
+			signInWith: func(c *Config) { c.PasswordHasher = testArgon2idHasher(1) },
+			password:   testPassword,
+			wantRehash: true,
+			wantPrefix: "$argon2id$",
+		},
+		{
+			name:       "bcrypt cost change",
+			signInWith: func(c *Config) { c.BCryptCost = bcrypt.MinCost + 1 },
+			password:   testPassword,
+			wantRehash: true,
+			wantPrefix: "$2a$05$",
+		},
+		{
+			name:       "argon2id parameter change",
+			signUpWith: func(c *Config) { c.PasswordHasher = testArgon2idHasher(1) },
+			signInWith: func(c *Config) { c.PasswordHasher = testArgon2idHasher(2) },
+			password:   testPassword,
+			wantRehash: true,
+			wantPrefix: "$argon2id$v=19$m=64,t=2,",
+		},
+		{
+			name:       "unchanged config",
+			password:   testPassword,
+			wantPrefix: "$2a$04$",
+		},
+		{
+			name:       "wrong password is not migrated",
+			signInWith: func(c *Config) { c.PasswordHasher = testArgon2idHasher(1) },
+			password:   "wrong-password",
+			wantPrefix: "$2a$04$",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			users := NewMemoryUserStore()
+			sessions := NewMemorySessionStore()
+			defer sessions.Close()
+			service := func(configure func(c *Config)) *AuthService {
+				config := newTestConfig()
+				if configure != nil {
+					configure(config)
+				}
+				return NewAuthService(config, users, sessions)
+			}
+
+			signUp(t, service(tt.signUpWith), "jane@example.com")
+			_, oldHash, _ := users.GetUserByEmail(ctx, "jane@example.com")
+
+			_, err := service(tt.signInWith).SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: tt.password})
+			if (err != nil) != (tt.password != testPassword) {
+				t.Fatalf("SignIn() error = %v", err)
+			}
+
+			_, newHash, _ := users.GetUserByEmail(ctx, "jane@example.com")
+			if rehashed := newHash != oldHash; rehashed != tt.wantRehash {
+				t.Errorf("rehashed = %v, want %v", rehashed, tt.wantRehash)
+			}
+			if !strings.HasPrefix(newHash, tt.wantPrefix) {
+				t.Errorf("stored hash = %q, want prefix %q", newHash, tt.wantPrefix)
+			}
+
+			// The migrated hash verifies under the new config
+			if _, err := service(tt.signInWith).SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword}); err != nil {
+				t.Errorf("SignIn() after migration error = %v", err)
+			}
+		})
+	}
+}
+
+func TestMigratingHasher(t *testing.T) {
+	legacy := NewBcryptHasher(bcrypt.MinCost)
+	current := testArgon2idHasher(1)
+	hasher := NewMigratingHasher(current, legacy)
+
+	tests := []struct {
+		name            string
+		hash            string
+		password        string
+		wantNeedsRehash bool
+		wantErr         bool
+	}{
+		{name: "current hash", hash: hashWith(t, current, testPassword), password: testPassword},
+		{name: "legacy hash", hash: hashWith(t, legacy, testPassword), password: testPassword, wantNeedsRehash: true},
+		{name: "legacy hash, wrong password", hash: hashWith(t, legacy, testPassword), password: "wrong-password", wantErr: true},
+		{name: "current hash, wrong password", hash: hashWith(t, current, testPassword), password: "wrong-password", wantErr: true},
+		{name: "unsupported hash", hash: "$md5$abc", password: testPassword, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := hasher.Verify(tt.hash, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if needsRehash != tt.wantNeedsRehash {
+				t.Errorf("Verify() needsRehash = %v, want %v", needsRehash, tt.wantNeedsRehash)
+			}
+		})
+	}
+
+	if hash := hashWith(t, hasher, testPassword); !current.Supports(hash) {
+		t.Errorf("Hash() = %q, want a current hash", hash)
+	}
+}
+
+// gaugeHasher records the peak number of its operations running at once.
+// Each operation waits for release when it is set.
+type gaugeHasher struct {
+	PasswordHasher
+	release chan struct{}
+	active  atomic.Int32
+	peak    atomic.Int32
+}
+
+func (g *gaugeHasher) track() func() {
+	active := g.active.Add(1)
+	for peak := g.peak.Load(); active > peak && !g.peak.CompareAndSwap(peak, active); peak = g.peak.Load() {
+	}
+	if g.release != nil {
+		<-g.release
+	} else {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return func() { g.active.Add(-1) }
+}
+
+func (g *gaugeHasher) Hash(password string) (string, error) {
+	defer g.track()()
+	return g.PasswordHasher.Hash(password)
+}
+
+func (g *gaugeHasher) Compare(hashedPassword, password string) error {
+	defer g.track()()
+	return g.PasswordHasher.Compare(hashedPassword, password)
+}
+
+func TestMaxConcurrentHashes(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		wantPeak int32
+	}{
+		{name: "limited", limit: 2, wantPeak: 2},
+		{name: "single", limit: 1, wantPeak: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gauge := &gaugeHasher{PasswordHasher: NewBcryptHasher(bcrypt.MinCost)}
+			a, _, _ := newTestService(t, func(c *Config) {
+				c.PasswordHasher = gauge
+				c.MaxConcurrentHashes = tt.limit
+				c.HashQueueTimeout = 10 * time.Second
+			})
+			signUp(t, a, "jane@example.com")
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4*tt.limit+2; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword}); err != nil {
+						t.Errorf("SignIn() error = %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if peak := gauge.peak.Load(); peak > tt.wantPeak {
+				t.Errorf("peak concurrent hashes = %d, want at most %d", peak, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestHashingBusy(t *testing.T) {
+	gauge := &gaugeHasher{PasswordHasher: NewBcryptHasher(bcrypt.MinCost)}
+	h, a := newTestHandlers(t, func(c *Config) {
+		c.PasswordHasher = gauge
+		c.MaxConcurrentHashes = 1
+		c.HashQueueTimeout = 20 * time.Millisecond
+	})
+	signUp(t, a, "jane@example.com")
+
+	// One sign-in holds the only slot while another times out queueing
+	gauge.release = make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword})
+		done <- err
+	}()
+	for gauge.active.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword}); !errors.Is(err, ErrHashingBusy) {
+		t.Errorf("SignIn() error = %v, want ErrHashingBusy", err)
+	}
+	ctx := newTestContext(http.MethodPost, "/auth/signin", fmt.Sprintf(`{"email": "jane@example.com", "password": %q}`, testPassword))
+	serve(t, ctx, h.SignInHandler)
+	if ctx.status() != http.StatusServiceUnavailable || ctx.recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, Retry-After = %q, want 503 with Retry-After", ctx.status(), ctx.recorder.Header().Get("Retry-After"))
+	}
+	if code := ctx.body(t)["code"]; code != "server_busy" {
+		t.Errorf("code = %v, want server_busy", code)
+	}
+
+	close(gauge.release)
+	if err := <-done; err != nil {
+		t.Errorf("SignIn() holding the slot error = %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Profile field limits
+const (
+	maxProfileNameLength      = 100
+	maxProfileAvatarURLLength = 2048
+)
+
+// ProfileUpdate holds the profile fields a user may change themselves. Nil
+// fields are left unchanged. Identity fields (ID, email, provider) cannot be
+// changed this way.
+type ProfileUpdate struct {
+	Name      *string `json:"name,omitempty"`
+	AvatarURL *string `json:"avatar_url,omitempty"`
+}
+
+// Validate checks the field lengths and formats
+func (p *ProfileUpdate) Validate() error {
+	if p.Name != nil {
+		if utf8.RuneCountInString(*p.Name) > maxProfileNameLength {
+			return fmt.Errorf("name must be at most %d characters", maxProfileNameLength)
+		}
+	}
+	if p.AvatarURL != nil && *p.AvatarURL != "" {
+		if len(*p.AvatarURL) > maxProfileAvatarURLLength {
+			return fmt.Errorf("avatar URL must be at most %d characters", maxProfileAvatarURLLength)
+		}
+		u, err := url.Parse(*p.AvatarURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("avatar URL must be an http(s) URL")
+		}
+	}
+	return nil
+}
+
+// UpdateProfile applies a user's changes to their own profile and returns
+// the updated user
+func (a *AuthService) UpdateProfile(ctx context.Context, userID string, updates ProfileUpdate) (*User, error) {
+	if err := updates.Validate(); err != nil {
+		return nil, err
+	}
+
+	user, err := a.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if updates.Name != nil {
+		user.Name = strings.TrimSpace(*updates.Name)
+	}
+	if updates.AvatarURL != nil {
+		user.AvatarURL = *updates.AvatarURL
+	}
+	user.UpdatedAt = time.Now()
+
+	if err := a.userStore.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	a.audit(ctx, AuditProfileUpdate, user.ID, user.Email, nil)
+	return user, nil
+}
@@ -0,0 +1,56 @@
+package gotrust
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	name := func(s string) *string { return &s }
+
+	tests := []struct {
+		name       string
+		update     ProfileUpdate
+		wantName   string
+		wantAvatar string
+		wantErr    bool
+	}{
+		{name: "no changes", wantName: "Test User"},
+		{name: "name", update: ProfileUpdate{Name: name("  Jane Doe ")}, wantName: "Jane Doe"},
+		{name: "avatar", update: ProfileUpdate{AvatarURL: name("https://cdn.example.com/a.png")}, wantName: "Test User", wantAvatar: "https://cdn.example.com/a.png"},
+		{name: "clear avatar", update: ProfileUpdate{AvatarURL: name("")}, wantName: "Test User"},
+		{name: "name too long", update: ProfileUpdate{Name: name(strings.Repeat("a", maxProfileNameLength+1))}, wantErr: true},
+		{name: "avatar with another scheme", update: ProfileUpdate{AvatarURL: name("javascript:alert(1)")}, wantErr: true},
+		{name: "relative avatar", update: ProfileUpdate{AvatarURL: name("/a.png")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, users, _ := newTestService(t, nil)
+			user := signUp(t, a, "jane@example.com").User
+
+			updated, err := a.UpdateProfile(context.Background(), user.ID, tt.update)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("UpdateProfile() = %+v, want error", updated)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateProfile() error = %v", err)
+			}
+
+			stored, err := users.GetUserByID(context.Background(), user.ID)
+			if err != nil {
+				t.Fatalf("GetUserByID() error = %v", err)
+			}
+			if stored.Name != tt.wantName || stored.AvatarURL != tt.wantAvatar {
+				t.Errorf("stored profile = %q, %q, want %q, %q", stored.Name, stored.AvatarURL, tt.wantName, tt.wantAvatar)
+			}
+			if stored.Email != user.Email {
+				t.Errorf("UpdateProfile() changed the email to %q", stored.Email)
+			}
+		})
+	}
+}
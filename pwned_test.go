@@ -0,0 +1,128 @@
+package gotrust
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pwnedServer serves a HIBP range response listing the given passwords with
+// their breach counts, plus a padding entry. It records the requested paths.
+func pwnedServer(t *testing.T, status int, breached map[string]int) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(status)
+		fmt.Fprintln(w, "0000000000000000000000000000000000A:0")
+		for password, count := range breached {
+			sum := sha1.Sum([]byte(password))
+			hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+			if r.URL.Path == "/range/"+hash[:5] {
+				fmt.Fprintf(w, "%s:%d\r\n", hash[5:], count)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &paths
+}
+
+func TestPwnedPasswordChecker(t *testing.T) {
+	breached := map[string]int{"password123": 3}
+
+	tests := []struct {
+		name      string
+		status    int
+		password  string
+		threshold int
+		wantErr   error
+		wantFail  bool
+	}{
+		{name: "breached password", status: http.StatusOK, password: "password123", wantErr: ErrBreachedPassword},
+		{name: "clean password", status: http.StatusOK, password: "correct-horse-battery-staple"},
+		{name: "below the threshold", status: http.StatusOK, password: "password123", threshold: 10},
+		{name: "at the threshold", status: http.StatusOK, password: "password123", threshold: 3, wantErr: ErrBreachedPassword},
+		{name: "server error", status: http.StatusServiceUnavailable, password: "password123", wantFail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, paths := pwnedServer(t, tt.status, breached)
+			checker := &PwnedPasswordChecker{BaseURL: server.URL + "/range/", Client: server.Client(), Threshold: tt.threshold}
+
+			err := checker.Check(context.Background(), tt.password)
+			if tt.wantFail {
+				if err == nil || errors.Is(err, ErrBreachedPassword) {
+					t.Fatalf("Check() error = %v, want a lookup failure", err)
+				}
+			} else if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// Only the 5 character hash prefix leaves the process
+			sum := sha1.Sum([]byte(tt.password))
+			want := "/range/" + strings.ToUpper(hex.EncodeToString(sum[:]))[:5]
+			if len(*paths) != 1 || (*paths)[0] != want {
+				t.Errorf("requested paths = %v, want [%s]", *paths, want)
+			}
+		})
+	}
+}
+
+func TestRejectBreachedPasswords(t *testing.T) {
+	server, _ := pwnedServer(t, http.StatusOK, map[string]int{"password123": 3})
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		baseURL  string
+		password string
+		wantErr  error
+	}{
+		{name: "breached password", enabled: true, baseURL: server.URL + "/range/", password: "password123", wantErr: ErrBreachedPassword},
+		{name: "clean password", enabled: true, baseURL: server.URL + "/range/", password: "correct-horse-battery-staple"},
+		{name: "disabled", baseURL: server.URL + "/range/", password: "password123"},
+		{name: "lookup fails open", enabled: true, baseURL: unreachable.URL + "/range/", password: "password123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, func(c *Config) {
+				c.RejectBreachedPasswords = tt.enabled
+				c.PwnedPasswordChecker = &PwnedPasswordChecker{BaseURL: tt.baseURL}
+			})
+
+			_, err := a.SignUp(context.Background(), &SignUpRequest{Email: "jane@example.com", Password: tt.password})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SignUp() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBreachedPasswordErrorCode(t *testing.T) {
+	server, _ := pwnedServer(t, http.StatusOK, map[string]int{testPassword: 1})
+	h, _ := newTestHandlers(t, func(c *Config) {
+		c.RejectBreachedPasswords = true
+		c.PwnedPasswordChecker = &PwnedPasswordChecker{BaseURL: server.URL + "/range/"}
+	})
+
+	ctx := newTestContext(http.MethodPost, "/auth/signup", signUpBody("jane@example.com", 0))
+	serve(t, ctx, h.SignUpHandler)
+
+	if ctx.status() != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", ctx.status(), http.StatusBadRequest)
+	}
+	if code := ctx.body(t)["code"]; code != "breached_password" {
+		t.Errorf("code = %v, want breached_password", code)
+	}
+}
@@ -0,0 +1,89 @@
+package gotrust
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// RedactionLevel controls how much of an email address MaskEmail keeps
+type RedactionLevel string
+
+const (
+	// RedactionPartial keeps the first character and the domain: j***@example.com
+	RedactionPartial RedactionLevel = "partial"
+	// RedactionDomain keeps only the domain: ***@example.com
+	RedactionDomain RedactionLevel = "domain"
+	// RedactionFull hides the whole address: ***
+	RedactionFull RedactionLevel = "full"
+)
+
+const redactionMask = "***"
+
+// MaskEmail masks an email address for logging
+func MaskEmail(email string, level RedactionLevel) string {
+	if email == "" {
+		return ""
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 || level == RedactionFull {
+		return redactionMask
+	}
+
+	local, domain := email[:at], email[at+1:]
+	if level == RedactionDomain {
+		return redactionMask + "@" + domain
+	}
+
+	// Very short local parts would be revealed almost entirely
+	first, size := utf8.DecodeRuneInString(local)
+	if size == len(local) || first == utf8.RuneError {
+		return redactionMask + "@" + domain
+	}
+	return string(first) + redactionMask + "@" + domain
+}
+
+// RedactedUser is a log-safe view of a User: the email is masked and
+// personal details such as the name and avatar are omitted
+type RedactedUser struct {
+	ID            string    `json:"id"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	Provider      string    `json:"provider,omitempty"`
+	Roles         []string  `json:"roles,omitempty"`
+	TenantID      string    `json:"tenant_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Redacted returns a log-safe view of the user with partial email masking
+func (u *User) Redacted() RedactedUser {
+	return u.RedactedWith(RedactionPartial)
+}
+
+// RedactedWith returns a log-safe view of the user masking the email at the
+// given level
+func (u *User) RedactedWith(level RedactionLevel) RedactedUser {
+	return RedactedUser{
+		ID:            u.ID,
+		Email:         MaskEmail(u.Email, level),
+		EmailVerified: u.EmailVerified,
+		Provider:      u.Provider,
+		Roles:         u.Roles,
+		TenantID:      u.TenantID,
+		CreatedAt:     u.CreatedAt,
+	}
+}
+
+// RedactUser returns a log-safe view of the user at Config.RedactionLevel
+func (a *AuthService) RedactUser(user *User) RedactedUser {
+	return user.RedactedWith(a.config.redactionLevel())
+}
+
+// redactionLevel returns the configured redaction level
+func (c *Config) redactionLevel() RedactionLevel {
+	if c.RedactionLevel == "" {
+		return RedactionPartial
+	}
+	return c.RedactionLevel
+}
@@ -0,0 +1,101 @@
+package gotrust
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMaskEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		level RedactionLevel
+		want  string
+	}{
+		{email: "jane@example.com", level: RedactionPartial, want: "j***@example.com"},
+		{email: "jane.doe+tag@mail.example.co.uk", level: RedactionPartial, want: "j***@mail.example.co.uk"},
+		{email: "j@example.com", level: RedactionPartial, want: "***@example.com"},
+		{email: "élodie@example.fr", level: RedactionPartial, want: "é***@example.fr"},
+		{email: `"a@b"@example.com`, level: RedactionPartial, want: `"***@example.com`},
+		{email: "jane@example.com", level: RedactionDomain, want: "***@example.com"},
+		{email: "jane@example.com", level: RedactionFull, want: "***"},
+		{email: "jane@example.com", level: "", want: "j***@example.com"},
+		{email: "not-an-email", level: RedactionPartial, want: "***"},
+		{email: "@example.com", level: RedactionPartial, want: "***"},
+		{email: "jane@", level: RedactionPartial, want: "***"},
+		{email: "", level: RedactionPartial, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email+"/"+string(tt.level), func(t *testing.T) {
+			if got := MaskEmail(tt.email, tt.level); got != tt.want {
+				t.Errorf("MaskEmail(%q, %q) = %q, want %q", tt.email, tt.level, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactedUser(t *testing.T) {
+	user := &User{
+		ID:        "user-1",
+		Email:     "jane@example.com",
+		Name:      "Jane Doe",
+		AvatarURL: "https://example.com/jane.png",
+		Roles:     []string{"admin"},
+	}
+
+	data, err := json.Marshal(user.Redacted())
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	logged := string(data)
+	for _, secret := range []string{"jane@example.com", "Jane Doe", "jane.png"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("redacted user %s contains %q", logged, secret)
+		}
+	}
+	if !strings.Contains(logged, `"j***@example.com"`) || !strings.Contains(logged, `"user-1"`) {
+		t.Errorf("redacted user = %s", logged)
+	}
+
+	// The user itself is left intact for responses
+	if user.Email != "jane@example.com" {
+		t.Errorf("Redacted() modified the user")
+	}
+}
+
+func TestRedactUserLevel(t *testing.T) {
+	tests := []struct {
+		level RedactionLevel
+		want  string
+	}{
+		{level: "", want: "j***@example.com"},
+		{level: RedactionDomain, want: "***@example.com"},
+		{level: RedactionFull, want: "***"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.level), func(t *testing.T) {
+			audit := NewMemoryAuditStore()
+			a, _, _ := newTestService(t, func(c *Config) {
+				c.RedactionLevel = tt.level
+				c.AuditStore = audit
+				c.RedactAuditEmails = true
+			})
+			user := signUp(t, a, "jane@example.com").User
+
+			if got := a.RedactUser(user).Email; got != tt.want {
+				t.Errorf("RedactUser() email = %q, want %q", got, tt.want)
+			}
+
+			events, err := a.QueryAuditLog(context.Background(), AuditFilter{Type: AuditSignUp})
+			if err != nil || len(events) != 1 {
+				t.Fatalf("QueryAuditLog() = %v, %v", events, err)
+			}
+			if events[0].Email != tt.want {
+				t.Errorf("audit event email = %q, want %q", events[0].Email, tt.want)
+			}
+		})
+	}
+}
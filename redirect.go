@@ -0,0 +1,131 @@
+package gotrust
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// RedirectData is the data available when resolving frontend redirect URLs
+type RedirectData struct {
+	// Host is the host of the incoming request (without port)
+	Host string
+	// Subdomain is the leftmost label of Host, typically the tenant
+	Subdomain string
+	// RedirectURI is the redirect URI stored in the OAuth state, if any
+	RedirectURI string
+	// Provider is the OAuth provider handling the flow
+	Provider string
+	// Error is the error code for error redirects
+	Error string
+	// Response is the authentication result for success redirects
+	Response *AuthResponse
+}
+
+// RedirectURLFunc resolves a frontend redirect URL at callback time
+type RedirectURLFunc func(ctx context.Context, data *RedirectData) string
+
+// newRedirectData builds redirect data from the current request
+func newRedirectData(ctx HTTPContext, provider string) *RedirectData {
+	host := ""
+	if req := ctx.Request(); req != nil {
+		host = req.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	subdomain := ""
+	if labels := strings.Split(host, "."); len(labels) > 2 {
+		subdomain = labels[0]
+	}
+
+	return &RedirectData{
+		Host:      host,
+		Subdomain: subdomain,
+		Provider:  provider,
+	}
+}
+
+// resolveRedirectURL evaluates a redirect URL from a resolver func or template
+// and validates the result against the configured allowlist
+func (c *Config) resolveRedirectURL(ctx context.Context, tmpl string, fn RedirectURLFunc, data *RedirectData) (*url.URL, error) {
+	raw := tmpl
+	if fn != nil {
+		raw = fn(ctx, data)
+	} else if strings.Contains(tmpl, "{{") {
+		t, err := template.New("redirect").Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirect template: %w", err)
+		}
+
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render redirect template: %w", err)
+		}
+		raw = buf.String()
+	}
+
+	redirectURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect URL: %w", err)
+	}
+
+	if !c.isAllowedRedirect(redirectURL) {
+		return nil, fmt.Errorf("redirect URL not allowed: %s", redirectURL.Host)
+	}
+
+	return redirectURL, nil
+}
+
+// isAllowedRedirect reports whether the URL may be used as a redirect target.
+// Entries in AllowedRedirectHosts match exactly, or as a suffix when written
+// as "*.example.com". An empty allowlist accepts only the hosts of
+// FrontendSuccessURL and FrontendErrorURL.
+func (c *Config) isAllowedRedirect(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if u.Host == "" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range c.allowedRedirectHosts() {
+		allowed = strings.ToLower(allowed)
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowedRedirectHosts returns AllowedRedirectHosts or, when it is empty, the
+// hosts of the frontend URLs. A templated host cannot be known in advance, so
+// such URLs need an explicit allowlist.
+func (c *Config) allowedRedirectHosts() []string {
+	if len(c.AllowedRedirectHosts) > 0 {
+		return c.AllowedRedirectHosts
+	}
+
+	var hosts []string
+	for _, raw := range []string{c.FrontendSuccessURL, c.FrontendErrorURL} {
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" || strings.ContainsAny(u.Host, "{}") {
+			continue
+		}
+		hosts = append(hosts, u.Hostname())
+	}
+	return hosts
+}
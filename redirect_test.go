@@ -0,0 +1,119 @@
+package gotrust
+
+import (
+	"context"
+	"testing"
+)
+
+func TestResolveRedirectURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		successURL string
+		errorURL   string
+		allowed    []string
+		data       RedirectData
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "static URL",
+			successURL: "https://app.example.com/auth/success",
+			want:       "https://app.example.com/auth/success",
+		},
+		{
+			name:       "template interpolating the tenant",
+			successURL: "https://{{.Subdomain}}.example.com/auth/success",
+			allowed:    []string{"*.example.com"},
+			data:       RedirectData{Host: "acme.auth.example.com", Subdomain: "acme"},
+			want:       "https://acme.example.com/auth/success",
+		},
+		{
+			name:       "tenant outside the allowlist",
+			successURL: "https://{{.Subdomain}}.example.com/auth/success",
+			allowed:    []string{"acme.example.com"},
+			data:       RedirectData{Subdomain: "evil"},
+			wantErr:    true,
+		},
+		{
+			name:       "templated host without an allowlist",
+			successURL: "https://{{.Subdomain}}.example.com/auth/success",
+			data:       RedirectData{Subdomain: "acme"},
+			wantErr:    true,
+		},
+		{
+			name:       "redirect URI on the frontend host",
+			successURL: "{{.RedirectURI}}",
+			errorURL:   "https://app.example.com/auth/error",
+			data:       RedirectData{RedirectURI: "https://app.example.com/dashboard"},
+			want:       "https://app.example.com/dashboard",
+		},
+		{
+			name:       "foreign redirect URI without an allowlist",
+			successURL: "{{.RedirectURI}}",
+			errorURL:   "https://app.example.com/auth/error",
+			data:       RedirectData{RedirectURI: "https://attacker.example.net/steal"},
+			wantErr:    true,
+		},
+		{
+			name:       "foreign redirect URI outside the allowlist",
+			successURL: "{{.RedirectURI}}",
+			allowed:    []string{"app.example.com"},
+			data:       RedirectData{RedirectURI: "https://attacker.example.net/steal"},
+			wantErr:    true,
+		},
+		{
+			name:       "non-http scheme",
+			successURL: "{{.RedirectURI}}",
+			allowed:    []string{"app.example.com"},
+			data:       RedirectData{RedirectURI: "javascript://app.example.com/%0aalert(1)"},
+			wantErr:    true,
+		},
+		{
+			name:       "missing template field",
+			successURL: "https://{{.Tenant}}.example.com/",
+			allowed:    []string{"*.example.com"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{FrontendSuccessURL: tt.successURL, FrontendErrorURL: tt.errorURL, AllowedRedirectHosts: tt.allowed}
+			data := tt.data
+
+			got, err := config.resolveRedirectURL(context.Background(), config.FrontendSuccessURL, nil, &data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveRedirectURL() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveRedirectURL() error = %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("resolveRedirectURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveRedirectURLFunc(t *testing.T) {
+	config := &Config{
+		FrontendSuccessURL:   "https://app.example.com/auth/success",
+		AllowedRedirectHosts: []string{"*.example.com"},
+	}
+	resolve := func(ctx context.Context, data *RedirectData) string {
+		return "https://" + data.Subdomain + ".example.com/welcome"
+	}
+
+	got, err := config.resolveRedirectURL(context.Background(), config.FrontendSuccessURL, resolve, &RedirectData{Subdomain: "acme"})
+	if err != nil || got.String() != "https://acme.example.com/welcome" {
+		t.Errorf("resolveRedirectURL() = %v, %v", got, err)
+	}
+
+	config.AllowedRedirectHosts = nil
+	if got, err := config.resolveRedirectURL(context.Background(), config.FrontendSuccessURL, resolve, &RedirectData{Subdomain: "acme"}); err == nil {
+		t.Errorf("resolveRedirectURL() = %v, want the resolved host rejected without an allowlist", got)
+	}
+}
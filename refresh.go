@@ -0,0 +1,228 @@
+package gotrust
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RefreshTokenRecord is the server-side record of an issued refresh token
+type RefreshTokenRecord struct {
+	TokenID    string                 `json:"token_id"`
+	UserID     string                 `json:"user_id"`
+	CreatedAt  time.Time              `json:"created_at"`
+	ExpiresAt  time.Time              `json:"expires_at"`
+	Claims     map[string]interface{} `json:"claims,omitempty"` // custom access token claims
+	LastUsedAt time.Time              `json:"last_used_at,omitempty"`
+	UserAgent  string                 `json:"user_agent,omitempty"`
+	IP         string                 `json:"ip,omitempty"`
+}
+
+// RefreshTokenManager tracks issued refresh tokens so they can be revoked
+type RefreshTokenManager struct {
+	store  SessionStore
+	prefix string
+}
+
+func NewRefreshTokenManager(store SessionStore, prefix string) *RefreshTokenManager {
+	if prefix == "" {
+		prefix = "refresh"
+	}
+	return &RefreshTokenManager{
+		store:  store,
+		prefix: prefix,
+	}
+}
+
+// Track records an issued refresh token along with the custom claims of the
+// access token it was issued with
+func (r *RefreshTokenManager) Track(ctx context.Context, claims *RefreshTokenClaims, extra map[string]interface{}) error {
+	record := &RefreshTokenRecord{
+		TokenID:   claims.TokenID,
+		UserID:    claims.UserID,
+		CreatedAt: claims.IssuedAt,
+		ExpiresAt: claims.ExpiresAt,
+		Claims:    extra,
+		UserAgent: UserAgentFromContext(ctx),
+		IP:        ClientIPFromContext(ctx),
+	}
+
+	ttl := time.Until(claims.ExpiresAt)
+	if err := r.store.Set(ctx, r.tokenKey(claims.TokenID), record, ttl); err != nil {
+		return fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	if err := addToIndex(ctx, r.store, r.userIndexKey(claims.UserID), claims.TokenID, ttl, r.tokenKey); err != nil {
+		return fmt.Errorf("failed to index refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// IsActive reports whether the refresh token has been issued and not revoked
+func (r *RefreshTokenManager) IsActive(ctx context.Context, tokenID string) (bool, error) {
+	if tokenID == "" {
+		return false, nil
+	}
+	return r.store.Exists(ctx, r.tokenKey(tokenID))
+}
+
+// Get returns the record of an active refresh token
+func (r *RefreshTokenManager) Get(ctx context.Context, tokenID string) (*RefreshTokenRecord, error) {
+	var record RefreshTokenRecord
+	if err := r.store.Get(ctx, r.tokenKey(tokenID), &record); err != nil {
+		return nil, fmt.Errorf("refresh token not found: %w", err)
+	}
+	return &record, nil
+}
+
+// Touch records that a refresh token was just used
+func (r *RefreshTokenManager) Touch(ctx context.Context, record *RefreshTokenRecord) error {
+	record.LastUsedAt = time.Now()
+	return r.store.Set(ctx, r.tokenKey(record.TokenID), record, time.Until(record.ExpiresAt))
+}
+
+// List returns the active refresh tokens of a user, newest first
+func (r *RefreshTokenManager) List(ctx context.Context, userID string) ([]*RefreshTokenRecord, error) {
+	var index userIndex
+	if err := r.store.Get(ctx, r.userIndexKey(userID), &index); err != nil {
+		return []*RefreshTokenRecord{}, nil
+	}
+
+	records := make([]*RefreshTokenRecord, 0, len(index.Members))
+	for _, tokenID := range index.Members {
+		record, err := r.Get(ctx, tokenID)
+		if err != nil {
+			continue // revoked or expired
+		}
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.After(records[j].CreatedAt)
+	})
+	return records, nil
+}
+
+// Revoke invalidates a single refresh token
+func (r *RefreshTokenManager) Revoke(ctx context.Context, userID, tokenID string) error {
+	if err := r.store.Delete(ctx, r.tokenKey(tokenID)); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return removeFromIndex(ctx, r.store, r.userIndexKey(userID), tokenID)
+}
+
+// RevokeUserTokens invalidates all refresh tokens of a user and returns how
+// many active tokens were revoked
+func (r *RefreshTokenManager) RevokeUserTokens(ctx context.Context, userID string) (int, error) {
+	return invalidateIndex(ctx, r.store, r.userIndexKey(userID), r.tokenKey)
+}
+
+func (r *RefreshTokenManager) tokenKey(tokenID string) string {
+	return fmt.Sprintf("%s:%s", r.prefix, tokenID)
+}
+
+func (r *RefreshTokenManager) userIndexKey(userID string) string {
+	return fmt.Sprintf("%s:user:%s", r.prefix, userID)
+}
+
+// refreshLockTimeout bounds how long a refresh waits for a concurrent
+// refresh of the same token to finish
+const refreshLockTimeout = 5 * time.Second
+
+// fallbackRefreshLock serializes rotations for stores without SetNX
+var fallbackRefreshLock sync.Mutex
+
+// lock acquires a short-lived lock on a refresh token so concurrent refreshes
+// of the same token are serialized. The returned func releases the lock if
+// this call still owns it; a refresh that outlived the lock must not release
+// one acquired since. Stores without CompareAndDelete let the lock expire.
+func (r *RefreshTokenManager) lock(ctx context.Context, tokenID string) (func(), error) {
+	atomicStore, ok := r.store.(AtomicSessionStore)
+	if !ok {
+		fallbackRefreshLock.Lock()
+		return fallbackRefreshLock.Unlock, nil
+	}
+
+	key := fmt.Sprintf("%s:lock:%s", r.prefix, tokenID)
+	ownerBytes := make([]byte, 16)
+	if err := readRandom(ownerBytes); err != nil {
+		return nil, fmt.Errorf("failed to lock refresh token: %w", err)
+	}
+	owner := hex.EncodeToString(ownerBytes)
+	unlock := func() {
+		if deleter, ok := r.store.(CompareAndDeleter); ok {
+			deleter.CompareAndDelete(context.Background(), key, owner)
+		}
+	}
+
+	deadline := time.Now().Add(refreshLockTimeout)
+	for {
+		acquired, err := atomicStore.SetNX(ctx, key, owner, refreshLockTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock refresh token: %w", err)
+		}
+		if acquired {
+			return unlock, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for concurrent refresh")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(25 * time.Millisecond):
+		}
+	}
+}
+
+// rotatedToken marks a refresh token that was exchanged during rotation
+type rotatedToken struct {
+	UserID string `json:"user_id"`
+}
+
+// Rotate revokes a used refresh token, remembering it until its expiry for
+// reuse detection and caching the pair it was exchanged for during the grace
+// period so concurrent refreshes receive the same result
+func (r *RefreshTokenManager) Rotate(ctx context.Context, claims *RefreshTokenClaims, response *AuthResponse, grace time.Duration) error {
+	if ttl := time.Until(claims.ExpiresAt); ttl > 0 {
+		if err := r.store.Set(ctx, r.rotatedKey(claims.TokenID), &rotatedToken{UserID: claims.UserID}, ttl); err != nil {
+			return fmt.Errorf("failed to record rotated refresh token: %w", err)
+		}
+	}
+
+	if grace > 0 {
+		if err := r.store.Set(ctx, r.graceKey(claims.TokenID), response, grace); err != nil {
+			return fmt.Errorf("failed to cache rotated refresh token: %w", err)
+		}
+	}
+
+	return r.Revoke(ctx, claims.UserID, claims.TokenID)
+}
+
+// GraceResponse returns the pair a refresh token was rotated into, if the
+// rotation happened within the grace period
+func (r *RefreshTokenManager) GraceResponse(ctx context.Context, tokenID string) (*AuthResponse, bool) {
+	var response AuthResponse
+	if err := r.store.Get(ctx, r.graceKey(tokenID), &response); err != nil {
+		return nil, false
+	}
+	return &response, true
+}
+
+// WasRotated reports whether the refresh token was already exchanged
+func (r *RefreshTokenManager) WasRotated(ctx context.Context, tokenID string) (bool, error) {
+	return r.store.Exists(ctx, r.rotatedKey(tokenID))
+}
+
+func (r *RefreshTokenManager) rotatedKey(tokenID string) string {
+	return fmt.Sprintf("%s:rotated:%s", r.prefix, tokenID)
+}
+
+func (r *RefreshTokenManager) graceKey(tokenID string) string {
+	return fmt.Sprintf("%s:grace:%s", r.prefix, tokenID)
+}
@@ -0,0 +1,559 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// legacyRefreshToken signs a refresh token the way versions without refresh
+// token tracking did, i.e. without a jti
+func legacyRefreshToken(t *testing.T, a *AuthService, userID string) string {
+	t.Helper()
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"type":    "refresh",
+		"iss":     a.config.JWTIssuer,
+		"sub":     userID,
+		"iat":     now.Unix(),
+		"exp":     now.Add(time.Hour).Unix(),
+	})
+	token.Header["typ"] = a.jwtManager.refreshTokenType
+	signed, err := a.jwtManager.sign(token, keyPurposeRefreshToken)
+	if err != nil {
+		t.Fatalf("sign() error = %v", err)
+	}
+	return signed
+}
+
+func TestRefreshToken(t *testing.T) {
+	a, _, _ := newTestService(t, nil)
+	response := signUp(t, a, "jane@example.com")
+
+	refreshed, err := a.RefreshToken(context.Background(), response.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if refreshed.AccessToken == "" || refreshed.User.ID != response.User.ID {
+		t.Errorf("RefreshToken() = %+v", refreshed)
+	}
+
+	if _, err := a.RefreshToken(context.Background(), "not-a-token"); err == nil {
+		t.Errorf("RefreshToken() accepted a malformed token")
+	}
+}
+
+func TestRefreshTokenRevokedByLogoutAll(t *testing.T) {
+	a, _, _ := newTestService(t, nil)
+	first := signUp(t, a, "jane@example.com")
+	second, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatalf("SignIn() error = %v", err)
+	}
+
+	if _, err := a.LogoutAllSessions(context.Background(), first.User.ID); err != nil {
+		t.Fatalf("LogoutAllSessions() error = %v", err)
+	}
+
+	for _, token := range []string{first.RefreshToken, second.RefreshToken} {
+		if _, err := a.RefreshToken(context.Background(), token); err == nil {
+			t.Errorf("RefreshToken() accepted a token revoked by LogoutAllSessions")
+		}
+	}
+}
+
+func TestRefreshLegacyToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		accept  bool
+		rotate  bool
+		wantErr bool
+	}{
+		{name: "rejected by default", wantErr: true},
+		{name: "rejected by default with rotation", rotate: true, wantErr: true},
+		{name: "accepted when enabled", accept: true},
+		{name: "accepted when enabled with rotation", accept: true, rotate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, func(c *Config) {
+				c.AcceptLegacyRefreshTokens = tt.accept
+				c.RotateRefreshTokens = tt.rotate
+			})
+			user := signUp(t, a, "jane@example.com").User
+
+			response, err := a.RefreshToken(context.Background(), legacyRefreshToken(t, a, user.ID))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("RefreshToken() = %+v, want error", response)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RefreshToken() error = %v", err)
+			}
+
+			// The replacement is a tracked token
+			if _, err := a.RefreshToken(context.Background(), response.RefreshToken); err != nil {
+				t.Errorf("RefreshToken() of the replacement error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	a, _, _ := newTestService(t, func(c *Config) {
+		c.RotateRefreshTokens = true
+		c.RefreshTokenGracePeriod = 0
+	})
+	original := signUp(t, a, "jane@example.com")
+
+	rotated, err := a.RefreshToken(context.Background(), original.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if rotated.RefreshToken == original.RefreshToken {
+		t.Fatalf("RefreshToken() did not rotate the refresh token")
+	}
+
+	// Replaying the rotated token revokes the whole family
+	_, err = a.RefreshToken(context.Background(), original.RefreshToken)
+	if err == nil || !strings.Contains(err.Error(), "reuse") {
+		t.Fatalf("RefreshToken() of a rotated token error = %v, want reuse detected", err)
+	}
+	if _, err := a.RefreshToken(context.Background(), rotated.RefreshToken); err == nil {
+		t.Errorf("RefreshToken() accepted a token of a family revoked after reuse")
+	}
+}
+
+func TestRefreshTokenRotationGracePeriod(t *testing.T) {
+	a, _, _ := newTestService(t, func(c *Config) {
+		c.RotateRefreshTokens = true
+		c.RefreshTokenGracePeriod = time.Minute
+	})
+	original := signUp(t, a, "jane@example.com")
+
+	rotated, err := a.RefreshToken(context.Background(), original.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+
+	// A retry within the grace period receives the same pair
+	retried, err := a.RefreshToken(context.Background(), original.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() retry error = %v", err)
+	}
+	if retried.RefreshToken != rotated.RefreshToken {
+		t.Errorf("RefreshToken() retry issued a different refresh token")
+	}
+}
+
+func TestRefreshLockReleasedOnlyByOwner(t *testing.T) {
+	now := time.Now()
+	store := NewMemorySessionStoreWithOptions(MemorySessionStoreOptions{Now: func() time.Time { return now }})
+	defer store.Close()
+	manager := NewRefreshTokenManager(store, "")
+	key := "refresh:lock:token-1"
+
+	unlockFirst, err := manager.lock(context.Background(), "token-1")
+	if err != nil {
+		t.Fatalf("lock() error = %v", err)
+	}
+
+	// The first refresh outlives the lock and another request takes it over
+	now = now.Add(2 * refreshLockTimeout)
+	unlockSecond, err := manager.lock(context.Background(), "token-1")
+	if err != nil {
+		t.Fatalf("lock() after expiry error = %v", err)
+	}
+
+	unlockFirst()
+	if exists, _ := store.Exists(context.Background(), key); !exists {
+		t.Fatalf("a stale unlock released a lock held by another request")
+	}
+
+	unlockSecond()
+	if exists, _ := store.Exists(context.Background(), key); exists {
+		t.Errorf("unlock did not release the lock it owns")
+	}
+}
+
+func TestRefreshTokenConcurrentRotation(t *testing.T) {
+	a, _, _ := newTestService(t, func(c *Config) {
+		c.RotateRefreshTokens = true
+		c.RefreshTokenGracePeriod = time.Minute
+	})
+	original := signUp(t, a, "jane@example.com")
+
+	const requests = 10
+	var wg sync.WaitGroup
+	tokens := make([]string, requests)
+	errs := make([]error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, err := a.RefreshToken(context.Background(), original.RefreshToken)
+			errs[i] = err
+			if err == nil {
+				tokens[i] = response.RefreshToken
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range tokens {
+		if errs[i] != nil {
+			t.Fatalf("concurrent RefreshToken() error = %v", errs[i])
+		}
+		if tokens[i] != tokens[0] {
+			t.Fatalf("concurrent refreshes rotated the token more than once")
+		}
+	}
+
+	records, err := a.refreshTokens.List(context.Background(), original.User.ID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("%d active refresh tokens after concurrent refreshes, want 1", len(records))
+	}
+}
+
+func TestRefreshPreservesCustomClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		rotate bool
+	}{
+		{name: "without rotation"},
+		{name: "with rotation", rotate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enriched := 0
+			a, _, _ := newTestService(t, func(c *Config) {
+				c.RotateRefreshTokens = tt.rotate
+				c.RefreshTokenGracePeriod = 0
+				c.ClaimsEnricher = func(ctx context.Context, user *User) (map[string]interface{}, error) {
+					enriched++
+					return map[string]interface{}{"scope": "read write", "org": "acme", "user_id": "someone-else"}, nil
+				}
+			})
+			signUp(t, a, "jane@example.com")
+			response, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword})
+			if err != nil {
+				t.Fatalf("SignIn() error = %v", err)
+			}
+
+			// Refresh twice so rotated tokens carry the claims on as well
+			token := response.RefreshToken
+			for i := 0; i < 2; i++ {
+				refreshed, err := a.RefreshToken(context.Background(), token)
+				if err != nil {
+					t.Fatalf("RefreshToken() error = %v", err)
+				}
+				token = refreshed.RefreshToken
+
+				claims, err := a.ValidateToken(refreshed.AccessToken)
+				if err != nil {
+					t.Fatalf("ValidateToken() error = %v", err)
+				}
+				if claims.Extra["scope"] != "read write" || claims.Extra["org"] != "acme" {
+					t.Errorf("refresh %d extra claims = %v", i+1, claims.Extra)
+				}
+				if claims.UserID != response.User.ID {
+					t.Errorf("custom claims overrode user_id with %q", claims.UserID)
+				}
+			}
+
+			// Sign-up and sign-in ran the enricher; refreshes reuse its claims
+			if enriched != 2 {
+				t.Errorf("ClaimsEnricher called %d times, want 2", enriched)
+			}
+		})
+	}
+}
+
+func TestMaxSessionLifetime(t *testing.T) {
+	const lifetime = 30 * 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		max     time.Duration
+		elapsed []time.Duration // since sign-in, at each refresh
+		wantErr []bool
+	}{
+		{
+			name:    "within the lifetime",
+			max:     lifetime,
+			elapsed: []time.Duration{24 * time.Hour, 15 * 24 * time.Hour, 29 * 24 * time.Hour},
+			wantErr: []bool{false, false, false},
+		},
+		{
+			name:    "lifetime exceeded",
+			max:     lifetime,
+			elapsed: []time.Duration{24 * time.Hour, 29 * 24 * time.Hour, 31 * 24 * time.Hour},
+			wantErr: []bool{false, false, true},
+		},
+		{
+			name:    "disabled",
+			elapsed: []time.Duration{24 * time.Hour, 31 * 24 * time.Hour, 365 * 24 * time.Hour},
+			wantErr: []bool{false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, func(c *Config) {
+				c.MaxSessionLifetime = tt.max
+				c.RotateRefreshTokens = true
+				c.RefreshTokenGracePeriod = 0
+			})
+			start := time.Now()
+			now := start
+			a.now = func() time.Time { return now }
+			token := signUp(t, a, "jane@example.com").RefreshToken
+
+			// Rotation issues new refresh tokens, but the chain keeps the
+			// original login time
+			for i, elapsed := range tt.elapsed {
+				now = start.Add(elapsed)
+				response, err := a.RefreshToken(context.Background(), token)
+				if (err != nil) != tt.wantErr[i] {
+					t.Fatalf("RefreshToken() after %v error = %v, wantErr %v", elapsed, err, tt.wantErr[i])
+				}
+				if err != nil {
+					if !strings.Contains(err.Error(), "lifetime") {
+						t.Errorf("RefreshToken() error = %v, want lifetime exceeded", err)
+					}
+					return
+				}
+				token = response.RefreshToken
+			}
+		})
+	}
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		owner       string // whose token is revoked
+		revokedBy   string
+		tokenID     string // overrides the token's jti
+		wantErr     bool
+		wantRevoked bool
+	}{
+		{name: "own token", owner: "jane", revokedBy: "jane", wantRevoked: true},
+		{name: "another user's token", owner: "john", revokedBy: "jane", wantErr: true},
+		{name: "unknown token", owner: "jane", revokedBy: "jane", tokenID: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a, _, _ := newTestService(t, nil)
+			responses := map[string]*AuthResponse{
+				"jane": signUp(t, a, "jane@example.com"),
+				"john": signUp(t, a, "john@example.com"),
+			}
+			target := responses[tt.owner].RefreshToken
+			tokenID := tt.tokenID
+			if tokenID == "" {
+				tokenID, _ = tokenPayload(t, target)["jti"].(string)
+			}
+
+			err := a.RevokeRefreshToken(ctx, responses[tt.revokedBy].User.ID, tokenID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RevokeRefreshToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if _, err := a.RefreshToken(ctx, target); (err != nil) != tt.wantRevoked {
+				t.Errorf("RefreshToken() with the target error = %v, want revoked %v", err, tt.wantRevoked)
+			}
+			tokens, _ := a.ListRefreshTokens(ctx, responses[tt.owner].User.ID)
+			if listed := len(tokens) > 0; listed == tt.wantRevoked {
+				t.Errorf("revoked token listed = %v", listed)
+			}
+		})
+	}
+}
+
+func TestListRefreshTokens(t *testing.T) {
+	a, _, _ := newTestService(t, nil)
+	signUp(t, a, "jane@example.com")
+
+	// Sign in from two devices
+	for _, userAgent := range []string{"Laptop/1.0", "Phone/2.0"} {
+		ctx := WithClientIP(WithUserAgent(context.Background(), userAgent), "203.0.113.7")
+		if _, err := a.SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword}); err != nil {
+			t.Fatalf("SignIn() error = %v", err)
+		}
+		time.Sleep(10 * time.Millisecond) // distinct creation times
+	}
+	john := signUp(t, a, "john@example.com")
+
+	response, _ := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword})
+	tokens, err := a.ListRefreshTokens(context.Background(), response.User.ID)
+	if err != nil {
+		t.Fatalf("ListRefreshTokens() error = %v", err)
+	}
+
+	// Sign-up, two devices and the last sign-in; none of john's
+	if len(tokens) != 4 {
+		t.Fatalf("ListRefreshTokens() returned %d tokens, want 4", len(tokens))
+	}
+	for i, token := range tokens {
+		if token.UserID != response.User.ID || token.TokenID == "" || token.Claims != nil {
+			t.Errorf("token %d = %+v", i, token)
+		}
+		if i > 0 && token.CreatedAt.After(tokens[i-1].CreatedAt) {
+			t.Errorf("tokens are not listed newest first")
+		}
+	}
+	if tokens[1].UserAgent != "Phone/2.0" || tokens[2].UserAgent != "Laptop/1.0" || tokens[1].IP != "203.0.113.7" {
+		t.Errorf("device metadata = %+v, %+v", tokens[1], tokens[2])
+	}
+	if johns, _ := a.ListRefreshTokens(context.Background(), john.User.ID); len(johns) != 1 {
+		t.Errorf("john has %d tokens, want 1", len(johns))
+	}
+}
+
+func TestRefreshTokensHandlers(t *testing.T) {
+	h, a := newTestHandlers(t, nil)
+	jane := signUp(t, a, "jane@example.com")
+	john := signUp(t, a, "john@example.com")
+	janeTokenID, _ := tokenPayload(t, jane.RefreshToken)["jti"].(string)
+	johnTokenID, _ := tokenPayload(t, john.RefreshToken)["jti"].(string)
+
+	list := newTestContext(http.MethodGet, "/auth/refresh-tokens", "").withBearer(jane.AccessToken)
+	serve(t, list, h.ListRefreshTokensHandler, h.AuthMiddleware())
+	listed, _ := list.body(t)["refresh_tokens"].([]interface{})
+	if list.status() != http.StatusOK || len(listed) != 1 {
+		t.Fatalf("list status = %d, tokens = %v", list.status(), listed)
+	}
+	if tokenID := listed[0].(map[string]interface{})["token_id"]; tokenID != janeTokenID {
+		t.Errorf("listed token_id = %v, want %s", tokenID, janeTokenID)
+	}
+
+	tests := []struct {
+		name       string
+		tokenID    string
+		wantStatus int
+	}{
+		{name: "another user's token", tokenID: johnTokenID, wantStatus: http.StatusNotFound},
+		{name: "missing token ID", wantStatus: http.StatusBadRequest},
+		{name: "own token", tokenID: janeTokenID, wantStatus: http.StatusOK},
+		{name: "already revoked", tokenID: janeTokenID, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodPost, "/auth/refresh-tokens/revoke", `{"token_id": "`+tt.tokenID+`"}`).withBearer(jane.AccessToken)
+			serve(t, ctx, h.RevokeRefreshTokenHandler, h.AuthMiddleware())
+			if ctx.status() != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %v", ctx.status(), tt.wantStatus, ctx.body(t))
+			}
+		})
+	}
+
+	if _, err := a.RefreshToken(context.Background(), john.RefreshToken); err != nil {
+		t.Errorf("john's refresh token was revoked by jane: %v", err)
+	}
+}
+
+// unavailableUserStore fails user lookups by ID while down is set, like a
+// store that cannot be reached
+type unavailableUserStore struct {
+	*MemoryUserStore
+	down bool
+}
+
+func (s *unavailableUserStore) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	if s.down {
+		return nil, errors.New("connection refused")
+	}
+	return s.MemoryUserStore.GetUserByID(ctx, userID)
+}
+
+func TestRefreshTokenMissingUser(t *testing.T) {
+	tests := []struct {
+		name        string
+		breakStore  func(t *testing.T, users *unavailableUserStore, userID string)
+		wantErr     error
+		wantStatus  int
+		wantCode    string
+		wantRetry   bool
+		wantRevoked bool
+	}{
+		{
+			name: "deleted user",
+			breakStore: func(t *testing.T, users *unavailableUserStore, userID string) {
+				if err := users.DeleteUser(context.Background(), userID); err != nil {
+					t.Fatalf("DeleteUser() error = %v", err)
+				}
+			},
+			wantErr:     ErrUserDeleted,
+			wantStatus:  http.StatusUnauthorized,
+			wantCode:    "user_deleted",
+			wantRevoked: true,
+		},
+		{
+			name:       "store outage",
+			breakStore: func(t *testing.T, users *unavailableUserStore, userID string) { users.down = true },
+			wantErr:    ErrUserStoreUnavailable,
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   "store_unavailable",
+			wantRetry:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestConfig()
+			users := &unavailableUserStore{MemoryUserStore: NewMemoryUserStore()}
+			sessions := NewMemorySessionStore()
+			t.Cleanup(func() { sessions.Close() })
+			a := NewAuthService(config, users, sessions)
+			h := NewGenericAuthHandlers(a, config)
+			response := signUp(t, a, "jane@example.com")
+			signIn, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword})
+			if err != nil {
+				t.Fatalf("SignIn() error = %v", err)
+			}
+			tt.breakStore(t, users, response.User.ID)
+
+			if _, err := a.RefreshToken(context.Background(), response.RefreshToken); !errors.Is(err, tt.wantErr) {
+				t.Errorf("RefreshToken() error = %v, want %v", err, tt.wantErr)
+			}
+
+			ctx := newTestContext(http.MethodPost, "/auth/refresh", fmt.Sprintf(`{"refresh_token": %q}`, signIn.RefreshToken))
+			serve(t, ctx, h.RefreshTokenHandler)
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if code := ctx.body(t)["code"]; code != tt.wantCode {
+				t.Errorf("code = %v, want %s", code, tt.wantCode)
+			}
+			if retry := ctx.recorder.Header().Get("Retry-After") != ""; retry != tt.wantRetry {
+				t.Errorf("Retry-After = %q, want set %v", ctx.recorder.Header().Get("Retry-After"), tt.wantRetry)
+			}
+
+			// Retrying helps after an outage, never for a deleted user
+			users.down = false
+			if _, err := a.RefreshToken(context.Background(), signIn.RefreshToken); (err != nil) != tt.wantRevoked {
+				t.Errorf("RefreshToken() after the failure error = %v, want revoked %v", err, tt.wantRevoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RefreshClaims re-issues tokens, with a new session, from freshly loaded
+// user data so role or tenant changes apply without signing out, e.g. right
+// after an admin grants a role or after step-up authentication.
+//
+// When ctx carries the user's token claims (see ContextWithClaims), as in
+// requests authenticated by the auth middleware, their login time is kept
+// and their session, if bound, is invalidated. With
+// Config.RefreshClaimsRevokesTokens and EnableTokenVersioning the user's
+// token version is bumped first, so every older access token stops working;
+// the user's other devices recover by refreshing.
+func (a *AuthService) RefreshClaims(ctx context.Context, userID string) (*AuthResponse, error) {
+	response, email, err := a.refreshClaims(ctx, userID)
+	a.audit(ctx, AuditClaimsRefreshed, userID, email, err)
+	return response, err
+}
+
+func (a *AuthService) refreshClaims(ctx context.Context, userID string) (*AuthResponse, string, error) {
+	user, err := a.GetUser(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	authTime := time.Now()
+	var oldSessionID string
+	if claims, ok := ClaimsFromContext(ctx); ok && claims.UserID == userID {
+		if !claims.AuthTime.IsZero() {
+			authTime = claims.AuthTime
+		}
+		oldSessionID = claims.SessionID
+	}
+
+	if a.config.RefreshClaimsRevokesTokens && a.config.EnableTokenVersioning {
+		if _, err := a.IncrementTokenVersion(ctx, userID); err != nil {
+			return nil, user.Email, err
+		}
+	}
+
+	var extra map[string]interface{}
+	if a.config.ClaimsEnricher != nil {
+		if extra, err = a.config.ClaimsEnricher(ctx, user); err != nil {
+			return nil, user.Email, fmt.Errorf("failed to enrich claims: %w", err)
+		}
+	}
+
+	response, err := a.generateAuthResponseAt(ctx, user, authTime, extra)
+	if err != nil {
+		return nil, user.Email, err
+	}
+
+	if oldSessionID != "" && oldSessionID != response.SessionID {
+		if err := a.sessionManager.InvalidateSession(ctx, oldSessionID); err != nil {
+			logf(ctx, "Failed to invalidate rotated session of user %s: %v", userID, err)
+		}
+		a.forgetSession(oldSessionID)
+	}
+	return response, user.Email, nil
+}
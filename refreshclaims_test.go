@@ -0,0 +1,124 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// grantRole gives a user an extra role in the store, as an admin would
+func grantRole(t *testing.T, users *MemoryUserStore, userID, role string) {
+	t.Helper()
+
+	user, err := users.GetUserByID(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("GetUserByID() error = %v", err)
+	}
+	user.Roles = append(user.Roles, role)
+	if err := users.UpdateUser(context.Background(), user); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+}
+
+func TestRefreshClaims(t *testing.T) {
+	tests := []struct {
+		name         string
+		configure    func(*Config)
+		withClaims   bool
+		wantOldValid bool
+	}{
+		{name: "old token kept", wantOldValid: true},
+		{
+			name:      "old token revoked",
+			configure: func(c *Config) { c.EnableTokenVersioning, c.RefreshClaimsRevokesTokens = true, true },
+		},
+		{
+			name:         "revocation requires token versioning",
+			configure:    func(c *Config) { c.RefreshClaimsRevokesTokens = true },
+			wantOldValid: true,
+		},
+		{
+			name:       "bound session rotated",
+			configure:  func(c *Config) { c.BindTokenToSession = true },
+			withClaims: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, users, _ := newTestService(t, tt.configure)
+			response := signUp(t, a, "jane@example.com")
+			oldClaims, err := a.ValidateToken(response.AccessToken)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+			grantRole(t, users, response.User.ID, "admin")
+
+			ctx := context.Background()
+			if tt.withClaims {
+				ctx = ContextWithClaims(ctx, oldClaims)
+			}
+			refreshed, err := a.RefreshClaims(ctx, response.User.ID)
+			if err != nil {
+				t.Fatalf("RefreshClaims() error = %v", err)
+			}
+
+			claims, err := a.ValidateToken(refreshed.AccessToken)
+			if err != nil {
+				t.Fatalf("ValidateToken() of the new token error = %v", err)
+			}
+			if fmt.Sprint(claims.Roles) != "[admin]" {
+				t.Errorf("new token roles = %v, want [admin]", claims.Roles)
+			}
+			if tt.withClaims && !claims.AuthTime.Equal(oldClaims.AuthTime) {
+				t.Errorf("new token auth time = %v, want %v", claims.AuthTime, oldClaims.AuthTime)
+			}
+
+			if _, err := a.ValidateToken(response.AccessToken); (err == nil) != tt.wantOldValid {
+				t.Errorf("ValidateToken() of the old token error = %v, want valid %v", err, tt.wantOldValid)
+			}
+		})
+	}
+}
+
+func TestRefreshClaimsHandler(t *testing.T) {
+	a, users, _ := newTestService(t, nil)
+	h := NewGenericAuthHandlers(a, a.config)
+	response := signUp(t, a, "jane@example.com")
+	grantRole(t, users, response.User.ID, "admin")
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "authenticated", token: response.AccessToken, wantStatus: http.StatusOK},
+		{name: "unauthenticated", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodPost, "/auth/claims/refresh", "")
+			if tt.token != "" {
+				ctx = ctx.withBearer(tt.token)
+			}
+			serve(t, ctx, h.RefreshClaimsHandler, h.AuthMiddleware())
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			token, _ := ctx.body(t)["access_token"].(string)
+			claims, err := a.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+			if fmt.Sprint(claims.Roles) != "[admin]" {
+				t.Errorf("roles = %v, want [admin]", claims.Roles)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// RequestIDHeader is the header used to read and propagate request IDs
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// GetRequestID returns the request ID for the current request. It is read from
+// the X-Request-ID header when present and well-formed, otherwise generated.
+// The ID is stored in the HTTPContext and echoed in the response header.
+func GetRequestID(ctx HTTPContext) string {
+	if id, ok := ctx.Get("request_id").(string); ok && id != "" {
+		return id
+	}
+
+	id := ctx.GetHeader(RequestIDHeader)
+	if !isValidRequestID(id) {
+		id = generateRandomString(20)
+	}
+
+	ctx.Set("request_id", id)
+	ctx.SetHeader(RequestIDHeader, id)
+	return id
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logf logs a message prefixed with the request ID from ctx, if any
+func logf(ctx context.Context, format string, args ...interface{}) {
+	if id := RequestIDFromContext(ctx); id != "" {
+		log.Printf("[request_id=%s] %s", id, fmt.Sprintf(format, args...))
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// isValidRequestID accepts short IDs made of safe characters, so client-provided
+// values cannot inject content into logs
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package gotrust
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger to a buffer for the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	saved := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(saved) })
+	return &buf
+}
+
+func TestRequestIDInErrorsAndLogs(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		wantID string
+	}{
+		{name: "client request ID", header: "req-123", wantID: "req-123"},
+		{name: "generated request ID"},
+		{name: "malformed client request ID", header: "bad id\n[request_id=forged]"},
+		{name: "overlong client request ID", header: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, nil)
+			logs := captureLog(t)
+
+			ctx := newTestContext(http.MethodPost, "/auth/signin", `{"email": "nobody@example.com", "password": "wrong"}`)
+			if tt.header != "" {
+				ctx.request.Header.Set(RequestIDHeader, tt.header)
+			}
+			serve(t, ctx, h.SignInHandler)
+
+			requestID, _ := ctx.body(t)["request_id"].(string)
+			if requestID == "" {
+				t.Fatalf("error response carries no request_id")
+			}
+			if tt.wantID != "" && requestID != tt.wantID {
+				t.Errorf("request_id = %q, want %q", requestID, tt.wantID)
+			}
+			if tt.wantID == "" && requestID == tt.header {
+				t.Errorf("request_id = %q, want a generated ID", requestID)
+			}
+			if got := ctx.recorder.Header().Get(RequestIDHeader); got != requestID {
+				t.Errorf("%s header = %q, want %q", RequestIDHeader, got, requestID)
+			}
+			if !strings.Contains(logs.String(), "[request_id="+requestID+"]") {
+				t.Errorf("log does not carry request_id %q: %q", requestID, logs.String())
+			}
+		})
+	}
+}
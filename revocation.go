@@ -0,0 +1,96 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// issuedBeforeKey is the session store key of the revocation cutoff set by
+// RevokeTokensIssuedBefore
+const issuedBeforeKey = "tokens_revoked_before"
+
+// issuedBeforeRefreshInterval is how often the stored cutoff is reread, and
+// so how long cutoffs set on other instances take to apply
+const issuedBeforeRefreshInterval = 5 * time.Second
+
+// issuedBefore is the stored revocation cutoff
+type issuedBefore struct {
+	Cutoff time.Time `json:"cutoff"`
+}
+
+// issuedBeforeCache holds the cutoff last read from the session store
+type issuedBeforeCache struct {
+	mu       sync.Mutex
+	cutoff   time.Time
+	loadedAt time.Time
+}
+
+// RevokeTokensIssuedBefore rejects every access and refresh token issued
+// before cutoff, for all users, e.g. after a signing secret leaked. Tokens
+// carry their issue time in whole seconds, so the cutoff is truncated to the
+// second and tokens issued in the same second as cutoff are kept. The cutoff is kept in the session store; other
+// instances apply it within a few seconds. A zero cutoff removes it, leaving
+// Config.RevokeTokensIssuedBefore in effect.
+func (a *AuthService) RevokeTokensIssuedBefore(ctx context.Context, cutoff time.Time) error {
+	if cutoff.IsZero() {
+		if err := a.sessionStore.Delete(ctx, issuedBeforeKey); err != nil {
+			return fmt.Errorf("failed to clear token revocation cutoff: %w", err)
+		}
+	} else if err := a.sessionStore.Set(ctx, issuedBeforeKey, &issuedBefore{Cutoff: cutoff}, 0); err != nil {
+		return fmt.Errorf("failed to store token revocation cutoff: %w", err)
+	}
+
+	a.revokedBefore.mu.Lock()
+	a.revokedBefore.cutoff = cutoff
+	a.revokedBefore.loadedAt = time.Now()
+	a.revokedBefore.mu.Unlock()
+	return nil
+}
+
+// tokensRevokedBefore returns the effective revocation cutoff: the later of
+// Config.RevokeTokensIssuedBefore and the stored cutoff
+func (a *AuthService) tokensRevokedBefore(ctx context.Context) time.Time {
+	cache := &a.revokedBefore
+	cache.mu.Lock()
+	if time.Since(cache.loadedAt) > issuedBeforeRefreshInterval {
+		cutoff, err := a.loadIssuedBefore(ctx)
+		if err != nil {
+			// Keep the last known cutoff
+			logf(ctx, "Failed to read token revocation cutoff: %v", err)
+		} else {
+			cache.cutoff = cutoff
+		}
+		cache.loadedAt = time.Now()
+	}
+	cutoff := cache.cutoff
+	cache.mu.Unlock()
+
+	if a.config.RevokeTokensIssuedBefore.After(cutoff) {
+		return a.config.RevokeTokensIssuedBefore
+	}
+	return cutoff
+}
+
+func (a *AuthService) loadIssuedBefore(ctx context.Context) (time.Time, error) {
+	exists, err := a.sessionStore.Exists(ctx, issuedBeforeKey)
+	if err != nil || !exists {
+		return time.Time{}, err
+	}
+
+	var stored issuedBefore
+	if err := a.sessionStore.Get(ctx, issuedBeforeKey, &stored); err != nil {
+		return time.Time{}, err
+	}
+	return stored.Cutoff, nil
+}
+
+// checkIssuedAt rejects tokens issued before the second of the revocation
+// cutoff
+func (a *AuthService) checkIssuedAt(ctx context.Context, issuedAt time.Time) error {
+	if cutoff := a.tokensRevokedBefore(ctx).Truncate(time.Second); !cutoff.IsZero() && issuedAt.Before(cutoff) {
+		return fmt.Errorf("token has been revoked")
+	}
+	return nil
+}
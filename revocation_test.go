@@ -0,0 +1,125 @@
+package gotrust
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// tokenIssuedAt returns an access token for userID issued at issued
+func tokenIssuedAt(t *testing.T, a *AuthService, userID string, issued time.Time) string {
+	t.Helper()
+
+	token, err := a.jwtManager.generateTokenAt(TokenClaims{UserID: userID, AuthTime: issued}, issued)
+	if err != nil {
+		t.Fatalf("generateTokenAt() error = %v", err)
+	}
+	return token
+}
+
+func TestRevokeTokensIssuedBefore(t *testing.T) {
+	now := time.Now()
+	// Half a second into a second, to catch comparisons with whole-second
+	// issue times
+	cutoff := now.Add(-10 * time.Minute).Truncate(time.Second).Add(500 * time.Millisecond)
+
+	tests := []struct {
+		name   string
+		issued time.Time
+		// fromConfig sets the cutoff in Config instead of at runtime
+		fromConfig bool
+		wantErr    bool
+	}{
+		{name: "issued before the cutoff", issued: now.Add(-20 * time.Minute), wantErr: true},
+		{name: "issued after the cutoff", issued: now.Add(-5 * time.Minute)},
+		{name: "issued the second before the cutoff", issued: cutoff.Add(-time.Second), wantErr: true},
+		{name: "issued in the second of the cutoff", issued: cutoff},
+		{name: "issued now", issued: now},
+		{name: "issued before the config cutoff", issued: now.Add(-20 * time.Minute), fromConfig: true, wantErr: true},
+		{name: "issued after the config cutoff", issued: now.Add(-5 * time.Minute), fromConfig: true},
+		{name: "issued in the second of the config cutoff", issued: cutoff, fromConfig: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, func(c *Config) {
+				if tt.fromConfig {
+					c.RevokeTokensIssuedBefore = cutoff
+				}
+			})
+			ctx := context.Background()
+			userID := signUp(t, a, "jane@example.com").User.ID
+			token := tokenIssuedAt(t, a, userID, tt.issued)
+
+			if !tt.fromConfig {
+				if _, err := a.ValidateTokenContext(ctx, token); err != nil {
+					t.Fatalf("ValidateTokenContext() before the revocation error = %v", err)
+				}
+				if err := a.RevokeTokensIssuedBefore(ctx, cutoff); err != nil {
+					t.Fatalf("RevokeTokensIssuedBefore() error = %v", err)
+				}
+			}
+
+			if _, err := a.ValidateTokenContext(ctx, token); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTokenContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// Tokens issued after the revocation still pass
+			response, err := a.SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword})
+			if err != nil {
+				t.Fatalf("SignIn() error = %v", err)
+			}
+			if _, err := a.ValidateTokenContext(ctx, response.AccessToken); err != nil {
+				t.Errorf("ValidateTokenContext() of a new token error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRevokeTokensIssuedBeforeRefreshTokens(t *testing.T) {
+	a, _, _ := newTestService(t, nil)
+	ctx := context.Background()
+	response := signUp(t, a, "jane@example.com")
+
+	if err := a.RevokeTokensIssuedBefore(ctx, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("RevokeTokensIssuedBefore() error = %v", err)
+	}
+	if _, err := a.RefreshToken(ctx, response.RefreshToken); err == nil {
+		t.Error("RefreshToken() accepted a refresh token issued before the cutoff")
+	}
+
+	// A zero cutoff lifts the revocation
+	if err := a.RevokeTokensIssuedBefore(ctx, time.Time{}); err != nil {
+		t.Fatalf("RevokeTokensIssuedBefore() error = %v", err)
+	}
+	if _, err := a.ValidateTokenContext(ctx, response.AccessToken); err != nil {
+		t.Errorf("ValidateTokenContext() after clearing the cutoff error = %v", err)
+	}
+}
+
+func TestRevokeTokensIssuedBeforeOtherInstance(t *testing.T) {
+	config := newTestConfig()
+	users := NewMemoryUserStore()
+	sessions := NewMemorySessionStore()
+	defer sessions.Close()
+	a := NewAuthService(config, users, sessions)
+	other := NewAuthService(config, users, sessions)
+	ctx := context.Background()
+	response := signUp(t, a, "jane@example.com")
+
+	// The other instance has read the (empty) cutoff recently
+	if _, err := other.ValidateTokenContext(ctx, response.AccessToken); err != nil {
+		t.Fatalf("ValidateTokenContext() error = %v", err)
+	}
+	if err := a.RevokeTokensIssuedBefore(ctx, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("RevokeTokensIssuedBefore() error = %v", err)
+	}
+
+	// It applies the stored cutoff once its cached copy is stale
+	other.revokedBefore.mu.Lock()
+	other.revokedBefore.loadedAt = time.Now().Add(-issuedBeforeRefreshInterval - time.Second)
+	other.revokedBefore.mu.Unlock()
+	if _, err := other.ValidateTokenContext(ctx, response.AccessToken); err == nil {
+		t.Error("other instance accepted a token revoked by the cutoff")
+	}
+}
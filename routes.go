@@ -0,0 +1,74 @@
+package gotrust
+
+// RouteOptions customizes the routes registered by the adapters'
+// RegisterRoutes functions
+type RouteOptions struct {
+	// Middleware adds middleware to individual routes, keyed by the route
+	// path relative to the base path (e.g. "/signup"). It runs before the
+	// route's built-in middleware.
+	Middleware map[string][]HTTPMiddleware
+
+	// NormalizePaths makes the stdlib adapter match paths ignoring case and
+	// trailing slashes, e.g. /auth/SignIn/ for /auth/signin. Gin and Echo
+	// have their own router settings for this.
+	NormalizePaths bool
+}
+
+// routeOptionsRouter applies RouteOptions to the routes registered on it
+type routeOptionsRouter struct {
+	Router
+	middleware map[string][]HTTPMiddleware
+}
+
+// WithRouteOptions wraps a Router so routes registered on it get the extra
+// middleware configured for their path. Adapters call it in RegisterRoutes.
+func WithRouteOptions(router Router, opts ...RouteOptions) Router {
+	middleware := make(map[string][]HTTPMiddleware)
+	for _, opt := range opts {
+		for path, m := range opt.Middleware {
+			middleware[path] = append(middleware[path], m...)
+		}
+	}
+	if len(middleware) == 0 {
+		return router
+	}
+	wrapped := &routeOptionsRouter{Router: router, middleware: middleware}
+	if _, ok := router.(PatchRouter); ok {
+		return &routeOptionsPatchRouter{wrapped}
+	}
+	return wrapped
+}
+
+// routeOptionsPatchRouter is a routeOptionsRouter wrapping a PatchRouter
+type routeOptionsPatchRouter struct {
+	*routeOptionsRouter
+}
+
+func (r *routeOptionsPatchRouter) PATCH(path string, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	r.Router.(PatchRouter).PATCH(path, handler, r.with(path, middleware)...)
+}
+
+// with prepends the configured middleware of path to the built-in middleware
+func (r *routeOptionsRouter) with(path string, builtin []HTTPMiddleware) []HTTPMiddleware {
+	extra := r.middleware[path]
+	if len(extra) == 0 {
+		return builtin
+	}
+	return append(append([]HTTPMiddleware(nil), extra...), builtin...)
+}
+
+func (r *routeOptionsRouter) GET(path string, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	r.Router.GET(path, handler, r.with(path, middleware)...)
+}
+
+func (r *routeOptionsRouter) POST(path string, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	r.Router.POST(path, handler, r.with(path, middleware)...)
+}
+
+func (r *routeOptionsRouter) PUT(path string, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	r.Router.PUT(path, handler, r.with(path, middleware)...)
+}
+
+func (r *routeOptionsRouter) DELETE(path string, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	r.Router.DELETE(path, handler, r.with(path, middleware)...)
+}
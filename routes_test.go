@@ -0,0 +1,137 @@
+package gotrust
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// recordingRouter records the methods and paths registered on it
+type recordingRouter struct {
+	routes     []string
+	middleware map[string]int
+}
+
+func newRecordingRouter() *recordingRouter {
+	return &recordingRouter{middleware: make(map[string]int)}
+}
+
+func (r *recordingRouter) add(method, path string, middleware []HTTPMiddleware) {
+	r.routes = append(r.routes, method+" "+path)
+	r.middleware[method+" "+path] = len(middleware)
+}
+
+func (r *recordingRouter) GET(path string, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	r.add("GET", path, middleware)
+}
+
+func (r *recordingRouter) POST(path string, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	r.add("POST", path, middleware)
+}
+
+func (r *recordingRouter) PUT(path string, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	r.add("PUT", path, middleware)
+}
+
+func (r *recordingRouter) DELETE(path string, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	r.add("DELETE", path, middleware)
+}
+
+func (r *recordingRouter) Group(prefix string, middleware ...HTTPMiddleware) Router {
+	return r
+}
+
+// recordingPatchRouter also supports PATCH routes
+type recordingPatchRouter struct {
+	*recordingRouter
+}
+
+func (r *recordingPatchRouter) PATCH(path string, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	r.add("PATCH", path, middleware)
+}
+
+func TestWithRouteOptionsPatchRouter(t *testing.T) {
+	noop := func(next HTTPHandler) HTTPHandler { return next }
+	opts := RouteOptions{Middleware: map[string][]HTTPMiddleware{"/profile": {noop}}}
+
+	tests := []struct {
+		name      string
+		router    Router
+		opts      []RouteOptions
+		wantPatch bool
+	}{
+		{name: "router without PATCH", router: newRecordingRouter()},
+		{name: "router without PATCH and options", router: newRecordingRouter(), opts: []RouteOptions{opts}},
+		{name: "PATCH router", router: &recordingPatchRouter{newRecordingRouter()}, wantPatch: true},
+		{name: "PATCH router and options", router: &recordingPatchRouter{newRecordingRouter()}, opts: []RouteOptions{opts}, wantPatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := WithRouteOptions(tt.router, tt.opts...)
+			patch, ok := router.(PatchRouter)
+			if ok != tt.wantPatch {
+				t.Fatalf("wrapped router implements PatchRouter = %v, want %v", ok, tt.wantPatch)
+			}
+			if !ok {
+				return
+			}
+
+			patch.PATCH("/profile", nil, noop)
+			recorded := tt.router.(*recordingPatchRouter)
+			if want := 1 + len(tt.opts); recorded.middleware["PATCH /profile"] != want {
+				t.Errorf("PATCH /profile registered with %d middleware, want %d", recorded.middleware["PATCH /profile"], want)
+			}
+		})
+	}
+}
+
+func TestWithRouteOptionsMiddlewareOrder(t *testing.T) {
+	var order []string
+	named := func(name string) HTTPMiddleware {
+		return func(next HTTPHandler) HTTPHandler {
+			return func(ctx HTTPContext) error {
+				order = append(order, name)
+				return next(ctx)
+			}
+		}
+	}
+	handler := func(ctx HTTPContext) error { return nil }
+
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{name: "configured route", path: "/signup", want: []string{"first", "second", "builtin"}},
+		{name: "other route", path: "/signin", want: []string{"builtin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order = nil
+			chain := &chainRouter{}
+			router := WithRouteOptions(chain,
+				RouteOptions{Middleware: map[string][]HTTPMiddleware{"/signup": {named("first")}}},
+				RouteOptions{Middleware: map[string][]HTTPMiddleware{"/signup": {named("second")}}},
+			)
+			router.POST(tt.path, handler, named("builtin"))
+
+			serve(t, newTestContext(http.MethodPost, tt.path, ""), chain.handler, chain.middleware...)
+			if fmt.Sprint(order) != fmt.Sprint(tt.want) {
+				t.Errorf("middleware order = %v, want %v", order, tt.want)
+			}
+		})
+	}
+}
+
+// chainRouter keeps the handler and middleware of the last registered route
+type chainRouter struct {
+	recordingRouter
+	handler    HTTPHandler
+	middleware []HTTPMiddleware
+}
+
+func (r *chainRouter) POST(path string, handler HTTPHandler, middleware ...HTTPMiddleware) {
+	r.handler, r.middleware = handler, middleware
+}
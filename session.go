@@ -1,11 +1,16 @@
 package gotrust
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	mathrand "math/rand"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,6 +24,57 @@ type SessionStore interface {
 	Exists(ctx context.Context, keys ...string) (bool, error)
 }
 
+// AtomicSessionStore is implemented by stores that can set a key only if it
+// does not already exist, which GoTrust uses for short-lived locks
+type AtomicSessionStore interface {
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+}
+
+// TokenConsumer is implemented by stores that can read and delete a key in
+// one atomic step, so a single-use token redeemed concurrently is only
+// accepted once
+type TokenConsumer interface {
+	GetDel(ctx context.Context, key string, dest interface{}) error
+}
+
+// consumedClaimTTL is how long consumeKey's claim on a key outlives it when
+// the store lacks GetDel
+const consumedClaimTTL = time.Minute
+
+// consumeKey reads and deletes a single-use key. Stores without GetDel
+// claim the key with SetNX instead, so only one concurrent caller succeeds.
+func consumeKey(ctx context.Context, store SessionStore, key string, dest interface{}) error {
+	if consumer, ok := store.(TokenConsumer); ok {
+		return consumer.GetDel(ctx, key, dest)
+	}
+	
+	if err := store.Get(ctx, key, dest); err != nil {
+		return err
+	}
+	if atomicStore, ok := store.(AtomicSessionStore); ok {
+		claimed, err := atomicStore.SetNX(ctx, key+":consumed", true, consumedClaimTTL)
+		if err != nil {
+			return fmt.Errorf("failed to claim key: %w", err)
+		}
+		if !claimed {
+			return fmt.Errorf("key already consumed")
+		}
+	}
+	return store.Delete(ctx, key)
+}
+
+// CompareAndDeleter is implemented by stores that can delete a key only if it
+// still holds a given value, so a lock is released only by its owner
+type CompareAndDeleter interface {
+	CompareAndDelete(ctx context.Context, key string, value interface{}) (bool, error)
+}
+
+// PrefixDeleter is implemented by stores that can delete every key starting
+// with a prefix, used for maintenance such as wiping all sessions
+type PrefixDeleter interface {
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
+}
+
 // RedisSessionStore uses Redis for session storage
 type RedisSessionStore struct {
 	client *redis.Client
@@ -60,6 +116,15 @@ func (r *RedisSessionStore) Set(ctx context.Context, key string, value interface
 	return r.client.Set(ctx, key, data, expiration).Err()
 }
 
+func (r *RedisSessionStore) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal value: %w", err)
+	}
+	
+	return r.client.SetNX(ctx, key, data, expiration).Result()
+}
+
 func (r *RedisSessionStore) Get(ctx context.Context, key string, dest interface{}) error {
 	data, err := r.client.Get(ctx, key).Result()
 	if err == redis.Nil {
@@ -71,6 +136,39 @@ func (r *RedisSessionStore) Get(ctx context.Context, key string, dest interface{
 	return json.Unmarshal([]byte(data), dest)
 }
 
+// GetDel reads and deletes a key atomically (requires Redis 6.2)
+func (r *RedisSessionStore) GetDel(ctx context.Context, key string, dest interface{}) error {
+	data, err := r.client.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return fmt.Errorf("key not found")
+	} else if err != nil {
+		return err
+	}
+	
+	return json.Unmarshal([]byte(data), dest)
+}
+
+// compareAndDeleteScript deletes KEYS[1] if it holds ARGV[1]
+var compareAndDeleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// CompareAndDelete deletes a key if it still holds value
+func (r *RedisSessionStore) CompareAndDelete(ctx context.Context, key string, value interface{}) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal value: %w", err)
+	}
+	
+	deleted, err := compareAndDeleteScript.Run(ctx, r.client, []string{key}, string(data)).Int()
+	if err != nil {
+		return false, err
+	}
+	return deleted == 1, nil
+}
+
 func (r *RedisSessionStore) Delete(ctx context.Context, keys ...string) error {
 	return r.client.Del(ctx, keys...).Err()
 }
@@ -83,6 +181,40 @@ func (r *RedisSessionStore) Exists(ctx context.Context, keys ...string) (bool, e
 	return count > 0, nil
 }
 
+// redisScanBatch is the number of keys scanned and deleted per round trip
+const redisScanBatch = 500
+
+// DeletePrefix deletes all keys starting with prefix, scanning incrementally
+// with SCAN so Redis is never blocked the way KEYS would
+func (r *RedisSessionStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	pattern := redisGlobEscaper.Replace(prefix) + "*"
+	
+	deleted := 0
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, pattern, redisScanBatch).Result()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to scan keys: %w", err)
+		}
+		
+		if len(keys) > 0 {
+			n, err := r.client.Unlink(ctx, keys...).Result()
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete keys: %w", err)
+			}
+			deleted += int(n)
+		}
+		
+		cursor = next
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
+
+// redisGlobEscaper escapes glob metacharacters in SCAN MATCH patterns
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
 func (r *RedisSessionStore) Close() error {
 	return r.client.Close()
 }
@@ -91,16 +223,67 @@ func (r *RedisSessionStore) Close() error {
 type MemorySessionStore struct {
 	mu    sync.RWMutex
 	store map[string]memoryItem
+	
+	cleanupInterval time.Duration
+	cleanupJitter   time.Duration
+	now             func() time.Time
+	stop            chan struct{}
+	stopOnce        sync.Once
 }
 
 type memoryItem struct {
 	value     []byte
-	expiresAt time.Time
+	expiresAt time.Time // zero means the item never expires
+}
+
+func (i memoryItem) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && now.After(i.expiresAt)
+}
+
+// expiryFrom returns the expiry time for a TTL; like Redis, a TTL of zero or
+// less means no expiry
+func expiryFrom(now time.Time, expiration time.Duration) time.Time {
+	if expiration <= 0 {
+		return time.Time{}
+	}
+	return now.Add(expiration)
+}
+
+// MemorySessionStoreOptions configures a MemorySessionStore
+type MemorySessionStoreOptions struct {
+	// CleanupInterval is how often expired items are swept (default 1 minute)
+	CleanupInterval time.Duration
+	// CleanupJitter is the maximum random delay added to each sweep so that
+	// many instances don't sweep simultaneously (default 10% of the interval)
+	CleanupJitter time.Duration
+	// Now returns the current time (defaults to time.Now)
+	Now func() time.Time
 }
 
 func NewMemorySessionStore() *MemorySessionStore {
+	return NewMemorySessionStoreWithOptions(MemorySessionStoreOptions{})
+}
+
+// NewMemorySessionStoreWithOptions creates a memory store with a custom cleanup schedule and clock
+func NewMemorySessionStoreWithOptions(opts MemorySessionStoreOptions) *MemorySessionStore {
+	if opts.CleanupInterval <= 0 {
+		opts.CleanupInterval = 1 * time.Minute
+	}
+	if opts.CleanupJitter < 0 {
+		opts.CleanupJitter = 0
+	} else if opts.CleanupJitter == 0 {
+		opts.CleanupJitter = opts.CleanupInterval / 10
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	
 	store := &MemorySessionStore{
-		store: make(map[string]memoryItem),
+		store:           make(map[string]memoryItem),
+		cleanupInterval: opts.CleanupInterval,
+		cleanupJitter:   opts.CleanupJitter,
+		now:             opts.Now,
+		stop:            make(chan struct{}),
 	}
 	
 	// Start cleanup goroutine
@@ -120,12 +303,34 @@ func (m *MemorySessionStore) Set(ctx context.Context, key string, value interfac
 	
 	m.store[key] = memoryItem{
 		value:     data,
-		expiresAt: time.Now().Add(expiration),
+		expiresAt: expiryFrom(m.now(), expiration),
 	}
 	
 	return nil
 }
 
+func (m *MemorySessionStore) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal value: %w", err)
+	}
+	
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	now := m.now()
+	if item, exists := m.store[key]; exists && !item.expired(now) {
+		return false, nil
+	}
+	
+	m.store[key] = memoryItem{
+		value:     data,
+		expiresAt: expiryFrom(now, expiration),
+	}
+	
+	return true, nil
+}
+
 func (m *MemorySessionStore) Get(ctx context.Context, key string, dest interface{}) error {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -135,14 +340,49 @@ func (m *MemorySessionStore) Get(ctx context.Context, key string, dest interface
 		return fmt.Errorf("key not found")
 	}
 	
-	if time.Now().After(item.expiresAt) {
-		delete(m.store, key)
+	// Expired items are removed by the cleanup sweep
+	if item.expired(m.now()) {
 		return fmt.Errorf("key expired")
 	}
 	
 	return json.Unmarshal(item.value, dest)
 }
 
+// GetDel reads and deletes a key atomically
+func (m *MemorySessionStore) GetDel(ctx context.Context, key string, dest interface{}) error {
+	m.mu.Lock()
+	item, exists := m.store[key]
+	delete(m.store, key)
+	m.mu.Unlock()
+	
+	if !exists {
+		return fmt.Errorf("key not found")
+	}
+	if item.expired(m.now()) {
+		return fmt.Errorf("key expired")
+	}
+	
+	return json.Unmarshal(item.value, dest)
+}
+
+// CompareAndDelete deletes a key if it still holds value
+func (m *MemorySessionStore) CompareAndDelete(ctx context.Context, key string, value interface{}) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal value: %w", err)
+	}
+	
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	item, exists := m.store[key]
+	if !exists || item.expired(m.now()) || !bytes.Equal(item.value, data) {
+		return false, nil
+	}
+	delete(m.store, key)
+	return true, nil
+}
+
 func (m *MemorySessionStore) Delete(ctx context.Context, keys ...string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -160,7 +400,7 @@ func (m *MemorySessionStore) Exists(ctx context.Context, keys ...string) (bool,
 	
 	for _, key := range keys {
 		if item, exists := m.store[key]; exists {
-			if time.Now().After(item.expiresAt) {
+			if item.expired(m.now()) {
 				continue
 			}
 			return true, nil
@@ -170,19 +410,73 @@ func (m *MemorySessionStore) Exists(ctx context.Context, keys ...string) (bool,
 	return false, nil
 }
 
+// DeletePrefix deletes all keys starting with prefix
+func (m *MemorySessionStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	deleted := 0
+	for key := range m.store {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.store, key)
+			deleted++
+		}
+	}
+	
+	return deleted, nil
+}
+
+// Len returns the number of items currently held, including expired items
+// not yet swept
+func (m *MemorySessionStore) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	
+	return len(m.store)
+}
+
+// Close stops the cleanup goroutine
+func (m *MemorySessionStore) Close() error {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+	return nil
+}
+
 func (m *MemorySessionStore) cleanup() {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-	
-	for range ticker.C {
-		m.mu.Lock()
-		now := time.Now()
-		for key, item := range m.store {
-			if now.After(item.expiresAt) {
-				delete(m.store, key)
-			}
+	timer := time.NewTimer(m.nextCleanup())
+	defer timer.Stop()
+	
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-timer.C:
+		}
+		
+		m.sweep()
+		timer.Reset(m.nextCleanup())
+	}
+}
+
+// nextCleanup returns the delay until the next sweep, including jitter
+func (m *MemorySessionStore) nextCleanup() time.Duration {
+	if m.cleanupJitter <= 0 {
+		return m.cleanupInterval
+	}
+	return m.cleanupInterval + time.Duration(mathrand.Int63n(int64(m.cleanupJitter)))
+}
+
+// sweep removes expired items
+func (m *MemorySessionStore) sweep() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	now := m.now()
+	for key, item := range m.store {
+		if item.expired(now) {
+			delete(m.store, key)
 		}
-		m.mu.Unlock()
 	}
 }
 
@@ -190,6 +484,7 @@ func (m *MemorySessionStore) cleanup() {
 type SessionManager struct {
 	store SessionStore
 	prefix string
+	idFormat SessionIDFormat
 }
 
 func NewSessionManager(store SessionStore, prefix string) *SessionManager {
@@ -202,8 +497,21 @@ func NewSessionManager(store SessionStore, prefix string) *SessionManager {
 	}
 }
 
+// SetIDFormat sets the length, encoding and prefix of new session IDs. Formats
+// carrying fewer than MinSessionIDEntropy random bits are rejected.
+func (s *SessionManager) SetIDFormat(format SessionIDFormat) error {
+	if err := format.Validate(); err != nil {
+		return err
+	}
+	s.idFormat = format
+	return nil
+}
+
 func (s *SessionManager) CreateSession(ctx context.Context, userID, email string, duration time.Duration) (string, error) {
-	sessionID := generateRandomString(32)
+	sessionID, err := s.idFormat.generate()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
 	
 	sessionData := &SessionData{
 		UserID:    userID,
@@ -212,18 +520,23 @@ func (s *SessionManager) CreateSession(ctx context.Context, userID, email string
 		ExpiresAt: time.Now().Add(duration),
 	}
 	
-	key := fmt.Sprintf("%s:%s", s.prefix, sessionID)
+	key := s.sessionKey(sessionID)
 	if err := s.store.Set(ctx, key, sessionData, duration); err != nil {
 		return "", fmt.Errorf("failed to create session: %w", err)
 	}
 	
+	// Track session for bulk invalidation
+	if err := addToIndex(ctx, s.store, s.userIndexKey(userID), sessionID, duration, s.sessionKey); err != nil {
+		logf(ctx, "Failed to index session for user %s: %v", userID, err)
+	}
+	
 	return sessionID, nil
 }
 
 func (s *SessionManager) GetSession(ctx context.Context, sessionID string) (*SessionData, error) {
 	var sessionData SessionData
 	
-	key := fmt.Sprintf("%s:%s", s.prefix, sessionID)
+	key := s.sessionKey(sessionID)
 	if err := s.store.Get(ctx, key, &sessionData); err != nil {
 		return nil, fmt.Errorf("session not found: %w", err)
 	}
@@ -236,16 +549,175 @@ func (s *SessionManager) GetSession(ctx context.Context, sessionID string) (*Ses
 	return &sessionData, nil
 }
 
+// InvalidateAllSessions deletes every session and session index under the
+// manager's prefix. The store must implement PrefixDeleter.
+func (s *SessionManager) InvalidateAllSessions(ctx context.Context) (int, error) {
+	deleter, ok := s.store.(PrefixDeleter)
+	if !ok {
+		return 0, fmt.Errorf("session store does not support deleting by prefix")
+	}
+	return deleter.DeletePrefix(ctx, s.prefix+":")
+}
+
 func (s *SessionManager) InvalidateSession(ctx context.Context, sessionID string) error {
-	key := fmt.Sprintf("%s:%s", s.prefix, sessionID)
+	key := s.sessionKey(sessionID)
 	return s.store.Delete(ctx, key)
 }
 
-func (s *SessionManager) InvalidateUserSessions(ctx context.Context, userID string) error {
-	// This would require maintaining a user->sessions index
-	// For now, individual session invalidation is supported
-	log.Printf("Bulk session invalidation for user %s not implemented", userID)
-	return nil
+// InvalidateUserSessions deletes all sessions of a user and returns how many
+// active sessions were invalidated
+func (s *SessionManager) InvalidateUserSessions(ctx context.Context, userID string) (int, error) {
+	return invalidateIndex(ctx, s.store, s.userIndexKey(userID), s.sessionKey)
+}
+
+// ListUserSessions returns the active sessions of a user, newest first
+func (s *SessionManager) ListUserSessions(ctx context.Context, userID string) ([]*SessionData, error) {
+	var index userIndex
+	if err := s.store.Get(ctx, s.userIndexKey(userID), &index); err != nil {
+		return []*SessionData{}, nil
+	}
+
+	sessions := make([]*SessionData, 0, len(index.Members))
+	for _, sessionID := range index.Members {
+		session, err := s.GetSession(ctx, sessionID)
+		if err != nil {
+			continue // invalidated or expired
+		}
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+func (s *SessionManager) sessionKey(sessionID string) string {
+	return fmt.Sprintf("%s:%s", s.prefix, sessionID)
+}
+
+func (s *SessionManager) userIndexKey(userID string) string {
+	return fmt.Sprintf("%s:user:%s", s.prefix, userID)
+}
+
+// indexMu serializes read-modify-write updates of user indexes within this process
+var indexMu sync.Mutex
+
+// userIndex lists the IDs of items (sessions, refresh tokens) owned by a user
+type userIndex struct {
+	Members   []string  `json:"members"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// addToIndex adds member to the index at indexKey, pruning members whose
+// item no longer exists. The index lives as long as its longest-lived member.
+func addToIndex(ctx context.Context, store SessionStore, indexKey, member string, ttl time.Duration, itemKey func(string) string) error {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	
+	var index userIndex
+	if err := store.Get(ctx, indexKey, &index); err != nil {
+		index = userIndex{}
+	}
+	
+	members := make([]string, 0, len(index.Members)+1)
+	for _, m := range index.Members {
+		if m == member {
+			continue
+		}
+		if exists, err := store.Exists(ctx, itemKey(m)); err == nil && exists {
+			members = append(members, m)
+		}
+	}
+	index.Members = append(members, member)
+	
+	if expiresAt := time.Now().Add(ttl); expiresAt.After(index.ExpiresAt) {
+		index.ExpiresAt = expiresAt
+	}
+	
+	return store.Set(ctx, indexKey, &index, time.Until(index.ExpiresAt))
+}
+
+// removeFromIndex removes member from the index at indexKey
+func removeFromIndex(ctx context.Context, store SessionStore, indexKey, member string) error {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	
+	var index userIndex
+	if err := store.Get(ctx, indexKey, &index); err != nil {
+		return nil
+	}
+	
+	members := index.Members[:0]
+	for _, m := range index.Members {
+		if m != member {
+			members = append(members, m)
+		}
+	}
+	index.Members = members
+	
+	if len(index.Members) == 0 {
+		return store.Delete(ctx, indexKey)
+	}
+	return store.Set(ctx, indexKey, &index, time.Until(index.ExpiresAt))
+}
+
+// invalidateIndex deletes every item in the index at indexKey along with the
+// index itself, returning the number of items that were still active
+func invalidateIndex(ctx context.Context, store SessionStore, indexKey string, itemKey func(string) string) (int, error) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	
+	var index userIndex
+	if err := store.Get(ctx, indexKey, &index); err != nil {
+		return 0, nil
+	}
+	
+	count := 0
+	keys := make([]string, 0, len(index.Members)+1)
+	for _, m := range index.Members {
+		key := itemKey(m)
+		if exists, err := store.Exists(ctx, key); err == nil && exists {
+			count++
+		}
+		keys = append(keys, key)
+	}
+	keys = append(keys, indexKey)
+	
+	if err := store.Delete(ctx, keys...); err != nil {
+		return 0, fmt.Errorf("failed to invalidate: %w", err)
+	}
+	
+	return count, nil
+}
+
+var (
+	randomMu     sync.Mutex
+	randomSource io.Reader = rand.Reader
+)
+
+// SetRandomSource replaces the source of randomness used for generated IDs
+// and tokens (user, session and refresh token IDs, OAuth states), so tests
+// can produce predictable values. Password salts always use crypto/rand. Pass
+// nil to restore crypto/rand. Never use a predictable source in production.
+func SetRandomSource(source io.Reader) {
+	randomMu.Lock()
+	defer randomMu.Unlock()
+
+	if source == nil {
+		source = rand.Reader
+	}
+	randomSource = source
+}
+
+// readRandom fills b from the random source. Reads are serialized because
+// test sources are rarely safe for concurrent use.
+func readRandom(b []byte) error {
+	randomMu.Lock()
+	defer randomMu.Unlock()
+
+	_, err := io.ReadFull(randomSource, b)
+	return err
 }
 
 func generateRandomString(length int) string {
@@ -253,7 +725,7 @@ func generateRandomString(length int) string {
 	result := make([]byte, length)
 	randomBytes := make([]byte, length)
 	
-	if _, err := rand.Read(randomBytes); err != nil {
+	if err := readRandom(randomBytes); err != nil {
 		return fmt.Sprintf("%d", time.Now().UnixNano())
 	}
 	
@@ -261,4 +733,9 @@ func generateRandomString(length int) string {
 		result[i] = charset[int(randomBytes[i])%len(charset)]
 	}
 	return string(result)
+}
+
+// secureCompare reports whether two secrets are equal in constant time
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
 }
\ No newline at end of file
@@ -0,0 +1,181 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultRedisRetryInterval is how often a degraded FallbackSessionStore
+// retries connecting to Redis
+const DefaultRedisRetryInterval = 30 * time.Second
+
+// FallbackSessionStore uses Redis when it is reachable and otherwise an
+// in-memory store, retrying Redis in the background and switching over once
+// it becomes available. Data written while degraded is not migrated.
+type FallbackSessionStore struct {
+	mu            sync.RWMutex
+	current       SessionStore
+	degraded      bool
+	redisURL      string
+	retryInterval time.Duration
+	stop          chan struct{}
+	stopOnce      sync.Once
+}
+
+// NewSessionStoreWithFallback connects to Redis and, if that fails, returns a
+// store backed by memory that keeps retrying Redis in the background
+func NewSessionStoreWithFallback(redisURL string) *FallbackSessionStore {
+	return newFallbackSessionStore(redisURL, DefaultRedisRetryInterval)
+}
+
+func newFallbackSessionStore(redisURL string, retryInterval time.Duration) *FallbackSessionStore {
+	if retryInterval <= 0 {
+		retryInterval = DefaultRedisRetryInterval
+	}
+
+	f := &FallbackSessionStore{
+		redisURL:      redisURL,
+		retryInterval: retryInterval,
+		stop:          make(chan struct{}),
+	}
+
+	redisStore, err := NewRedisSessionStore(redisURL)
+	if err == nil {
+		f.current = redisStore
+		return f
+	}
+
+	log.Printf("WARNING: redis unavailable (%v), falling back to in-memory session store", err)
+	f.current = NewMemorySessionStore()
+	f.degraded = true
+	go f.retry()
+
+	return f
+}
+
+// NewSessionStore creates the session store described by the config: memory
+// when RedisURL is empty, Redis otherwise, with an in-memory fallback if
+// RedisFallbackToMemory is set
+func NewSessionStore(config *Config) (SessionStore, error) {
+	if config.RedisURL == "" {
+		return NewMemorySessionStore(), nil
+	}
+	if config.RedisFallbackToMemory {
+		return newFallbackSessionStore(config.RedisURL, config.RedisRetryInterval), nil
+	}
+	return NewRedisSessionStore(config.RedisURL)
+}
+
+// retry periodically tries to promote the store to Redis
+func (f *FallbackSessionStore) retry() {
+	ticker := time.NewTicker(f.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			redisStore, err := NewRedisSessionStore(f.redisURL)
+			if err != nil {
+				continue
+			}
+
+			f.mu.Lock()
+			select {
+			case <-f.stop:
+				// Closed while connecting
+				f.mu.Unlock()
+				redisStore.Close()
+				return
+			default:
+			}
+			previous := f.current
+			f.current = redisStore
+			f.degraded = false
+			f.mu.Unlock()
+
+			if memoryStore, ok := previous.(*MemorySessionStore); ok {
+				memoryStore.Close()
+			}
+			log.Printf("Redis available again, session store promoted to redis")
+			return
+		}
+	}
+}
+
+// Degraded reports whether the store is currently running in memory
+func (f *FallbackSessionStore) Degraded() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.degraded
+}
+
+func (f *FallbackSessionStore) store() SessionStore {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.current
+}
+
+func (f *FallbackSessionStore) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return f.store().Set(ctx, key, value, expiration)
+}
+
+func (f *FallbackSessionStore) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	atomicStore, ok := f.store().(AtomicSessionStore)
+	if !ok {
+		return false, fmt.Errorf("session store does not support SetNX")
+	}
+	return atomicStore.SetNX(ctx, key, value, expiration)
+}
+
+func (f *FallbackSessionStore) Get(ctx context.Context, key string, dest interface{}) error {
+	return f.store().Get(ctx, key, dest)
+}
+
+func (f *FallbackSessionStore) GetDel(ctx context.Context, key string, dest interface{}) error {
+	return consumeKey(ctx, f.store(), key, dest)
+}
+
+func (f *FallbackSessionStore) CompareAndDelete(ctx context.Context, key string, value interface{}) (bool, error) {
+	deleter, ok := f.store().(CompareAndDeleter)
+	if !ok {
+		return false, fmt.Errorf("session store does not support CompareAndDelete")
+	}
+	return deleter.CompareAndDelete(ctx, key, value)
+}
+
+func (f *FallbackSessionStore) Delete(ctx context.Context, keys ...string) error {
+	return f.store().Delete(ctx, keys...)
+}
+
+func (f *FallbackSessionStore) Exists(ctx context.Context, keys ...string) (bool, error) {
+	return f.store().Exists(ctx, keys...)
+}
+
+func (f *FallbackSessionStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	deleter, ok := f.store().(PrefixDeleter)
+	if !ok {
+		return 0, fmt.Errorf("session store does not support deleting by prefix")
+	}
+	return deleter.DeletePrefix(ctx, prefix)
+}
+
+// Close stops the background retry and closes the underlying store
+func (f *FallbackSessionStore) Close() error {
+	f.mu.Lock()
+	f.stopOnce.Do(func() { close(f.stop) })
+	current := f.current
+	f.mu.Unlock()
+
+	switch store := current.(type) {
+	case *RedisSessionStore:
+		return store.Close()
+	case *MemorySessionStore:
+		store.Close()
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package gotrust
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// unreachableRedisURL returns the URL of a local port nothing listens on
+func unreachableRedisURL(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve a port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return "redis://" + addr
+}
+
+func TestSessionStoreFallback(t *testing.T) {
+	redisURL := unreachableRedisURL(t)
+
+	tests := []struct {
+		name         string
+		redisURL     string
+		fallback     bool
+		wantErr      bool
+		wantDegraded bool
+	}{
+		{name: "no redis configured", fallback: true},
+		{name: "redis down without fallback", redisURL: redisURL, wantErr: true},
+		{name: "redis down with fallback", redisURL: redisURL, fallback: true, wantDegraded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestConfig()
+			config.RedisURL = tt.redisURL
+			config.RedisFallbackToMemory = tt.fallback
+
+			store, err := NewSessionStore(config)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewSessionStore() succeeded with redis down")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewSessionStore() error = %v", err)
+			}
+			if closer, ok := store.(interface{ Close() error }); ok {
+				defer closer.Close()
+			}
+
+			fallback, isFallback := store.(*FallbackSessionStore)
+			if isFallback != tt.wantDegraded || (isFallback && !fallback.Degraded()) {
+				t.Fatalf("NewSessionStore() = %T, want degraded %v", store, tt.wantDegraded)
+			}
+
+			// The store works, including the optional capabilities
+			ctx := context.Background()
+			if err := store.Set(ctx, "session:1", "value", time.Minute); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			var value string
+			if err := store.Get(ctx, "session:1", &value); err != nil || value != "value" {
+				t.Fatalf("Get() = %q, %v", value, err)
+			}
+			if ok, err := store.(AtomicSessionStore).SetNX(ctx, "session:1", "other", time.Minute); err != nil || ok {
+				t.Errorf("SetNX() of an existing key = %v, %v", ok, err)
+			}
+			if n, err := store.(PrefixDeleter).DeletePrefix(ctx, "session:"); err != nil || n != 1 {
+				t.Errorf("DeletePrefix() = %d, %v", n, err)
+			}
+		})
+	}
+}
+
+func TestFallbackSessionStoreClose(t *testing.T) {
+	store := newFallbackSessionStore(unreachableRedisURL(t), 10*time.Millisecond)
+
+	// Let the background retry fail at least once
+	time.Sleep(50 * time.Millisecond)
+	if !store.Degraded() {
+		t.Fatalf("store promoted to an unreachable redis")
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
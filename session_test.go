@@ -0,0 +1,327 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemorySessionStoreCompareAndDelete(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      interface{}
+		value       interface{}
+		wantDeleted bool
+	}{
+		{name: "matching value", stored: "owner-1", value: "owner-1", wantDeleted: true},
+		{name: "different value", stored: "owner-2", value: "owner-1"},
+		{name: "missing key", value: "owner-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemorySessionStore()
+			defer store.Close()
+			ctx := context.Background()
+
+			if tt.stored != nil {
+				if err := store.Set(ctx, "lock", tt.stored, 0); err != nil {
+					t.Fatalf("Set() error = %v", err)
+				}
+			}
+
+			deleted, err := store.CompareAndDelete(ctx, "lock", tt.value)
+			if err != nil {
+				t.Fatalf("CompareAndDelete() error = %v", err)
+			}
+			if deleted != tt.wantDeleted {
+				t.Errorf("CompareAndDelete() = %v, want %v", deleted, tt.wantDeleted)
+			}
+			if exists, _ := store.Exists(ctx, "lock"); exists != (tt.stored != nil && !tt.wantDeleted) {
+				t.Errorf("key exists = %v after CompareAndDelete()", exists)
+			}
+		})
+	}
+}
+
+// fakeClock is a settable clock safe for use by the cleanup goroutine
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestMemorySessionStoreCleanup(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	const interval = 10 * time.Millisecond
+	store := NewMemorySessionStoreWithOptions(MemorySessionStoreOptions{
+		CleanupInterval: interval,
+		CleanupJitter:   -1,
+		Now:             clock.Now,
+	})
+	defer store.Close()
+	ctx := context.Background()
+
+	store.Set(ctx, "short", "value", time.Minute)
+	store.Set(ctx, "long", "value", time.Hour)
+	store.Set(ctx, "forever", "value", 0)
+	if store.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", store.Len())
+	}
+
+	clock.Advance(2 * time.Minute)
+	deadline := time.Now().Add(50 * interval)
+	for store.Len() != 2 && time.Now().Before(deadline) {
+		time.Sleep(interval / 2)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("Len() = %d after the sweep, want 2", store.Len())
+	}
+	if exists, _ := store.Exists(ctx, "short"); exists {
+		t.Errorf("expired item was not swept")
+	}
+}
+
+func TestMemorySessionStoreCleanupJitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    MemorySessionStoreOptions
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{name: "defaults", wantMin: time.Minute, wantMax: time.Minute + 6*time.Second},
+		{name: "custom jitter", opts: MemorySessionStoreOptions{CleanupInterval: time.Second, CleanupJitter: 500 * time.Millisecond}, wantMin: time.Second, wantMax: 1500 * time.Millisecond},
+		{name: "jitter disabled", opts: MemorySessionStoreOptions{CleanupInterval: time.Second, CleanupJitter: -1}, wantMin: time.Second, wantMax: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemorySessionStoreWithOptions(tt.opts)
+			defer store.Close()
+
+			for i := 0; i < 100; i++ {
+				if d := store.nextCleanup(); d < tt.wantMin || d > tt.wantMax {
+					t.Fatalf("nextCleanup() = %v, want between %v and %v", d, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidateAllSessions(t *testing.T) {
+	a, _, store := newTestService(t, nil)
+	ctx := context.Background()
+
+	const users, sessionsPerUser = 50, 4
+	var sessionIDs []string
+	for i := 0; i < users; i++ {
+		userID := fmt.Sprintf("user-%d", i)
+		for j := 0; j < sessionsPerUser; j++ {
+			sessionID, err := a.sessionManager.CreateSession(ctx, userID, userID+"@example.com", time.Hour)
+			if err != nil {
+				t.Fatalf("CreateSession() error = %v", err)
+			}
+			sessionIDs = append(sessionIDs, sessionID)
+		}
+	}
+
+	response := signUp(t, a, "jane@example.com")
+	unrelated := []string{"sessions:backup", "sessionx:1", "verify:token", "token_version:user-1"}
+	for _, key := range unrelated {
+		if err := store.Set(ctx, key, "value", time.Hour); err != nil {
+			t.Fatalf("Set(%s) error = %v", key, err)
+		}
+	}
+
+	deleted, err := a.InvalidateAllSessions(ctx)
+	if err != nil {
+		t.Fatalf("InvalidateAllSessions() error = %v", err)
+	}
+	// Every session plus one index per user, including the signed up user
+	if want := users*sessionsPerUser + users + 2; deleted != want {
+		t.Errorf("InvalidateAllSessions() = %d, want %d", deleted, want)
+	}
+
+	for _, sessionID := range append(sessionIDs, response.SessionID) {
+		if _, err := a.GetSession(ctx, sessionID); err == nil {
+			t.Fatalf("session %s survived InvalidateAllSessions()", sessionID)
+		}
+	}
+	for _, key := range unrelated {
+		if exists, _ := store.Exists(ctx, key); !exists {
+			t.Errorf("unrelated key %s was deleted", key)
+		}
+	}
+
+	// Refresh tokens are not sessions
+	if _, err := a.RefreshToken(ctx, response.RefreshToken); err != nil {
+		t.Errorf("RefreshToken() after InvalidateAllSessions() error = %v", err)
+	}
+}
+
+func TestRedisGlobEscaper(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "session:", want: "session:"},
+		{prefix: "app*:session:", want: `app\*:session:`},
+		{prefix: "a?[b]\\:", want: `a\?\[b\]\\:`},
+	}
+
+	for _, tt := range tests {
+		if got := redisGlobEscaper.Replace(tt.prefix); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+// setNXStore exposes only the SessionStore and SetNX methods of a memory
+// store, hiding GetDel
+type setNXStore struct {
+	SessionStore
+	memory *MemorySessionStore
+}
+
+func (s *setNXStore) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return s.memory.SetNX(ctx, key, value, expiration)
+}
+
+func TestConsumeKeyConcurrent(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func(*MemorySessionStore) SessionStore
+	}{
+		{name: "GetDel", store: func(m *MemorySessionStore) SessionStore { return m }},
+		{name: "SetNX claim", store: func(m *MemorySessionStore) SessionStore { return &setNXStore{SessionStore: m, memory: m} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := NewMemorySessionStore()
+			defer memory.Close()
+			store := tt.store(memory)
+			ctx := context.Background()
+
+			for round := 0; round < 20; round++ {
+				key := fmt.Sprintf("token:%d", round)
+				if err := store.Set(ctx, key, "payload", time.Minute); err != nil {
+					t.Fatalf("Set() error = %v", err)
+				}
+
+				// Redeem the token from several goroutines released at once
+				const redeemers = 8
+				var wg sync.WaitGroup
+				var mu sync.Mutex
+				start := make(chan struct{})
+				succeeded := 0
+				for i := 0; i < redeemers; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						<-start
+						var value string
+						if err := consumeKey(ctx, store, key, &value); err == nil && value == "payload" {
+							mu.Lock()
+							succeeded++
+							mu.Unlock()
+						}
+					}()
+				}
+				close(start)
+				wg.Wait()
+
+				if succeeded != 1 {
+					t.Fatalf("round %d: %d redemptions succeeded, want exactly 1", round, succeeded)
+				}
+				if exists, _ := store.Exists(ctx, key); exists {
+					t.Fatalf("round %d: key still exists after being consumed", round)
+				}
+			}
+		})
+	}
+}
+
+// failingSessionStore rejects writes of keys with a prefix
+type failingSessionStore struct {
+	*MemorySessionStore
+	prefix string
+}
+
+func (s *failingSessionStore) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	if strings.HasPrefix(key, s.prefix) {
+		return fmt.Errorf("store unavailable")
+	}
+	return s.MemorySessionStore.Set(ctx, key, value, expiration)
+}
+
+func TestSessionCreationRequired(t *testing.T) {
+	tests := []struct {
+		name       string
+		required   bool
+		bind       bool
+		wantErr    bool
+		wantStatus int
+		wantLog    string
+	}{
+		{name: "best effort", wantStatus: http.StatusCreated, wantLog: "continuing without one"},
+		{name: "required", required: true, wantErr: true, wantStatus: http.StatusInternalServerError, wantLog: "failing sign-in"},
+		{name: "implied by BindTokenToSession", bind: true, wantErr: true, wantStatus: http.StatusInternalServerError, wantLog: "failing sign-in"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t)
+			config := newTestConfig()
+			config.SessionCreationRequired = tt.required
+			config.BindTokenToSession = tt.bind
+			sessions := &failingSessionStore{MemorySessionStore: NewMemorySessionStore(), prefix: "session:"}
+			t.Cleanup(func() { sessions.Close() })
+			a := NewAuthService(config, NewMemoryUserStore(), sessions)
+
+			response, err := a.SignUp(context.Background(), &SignUpRequest{Email: "jane@example.com", Password: testPassword})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SignUp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrSessionUnavailable) {
+				t.Errorf("SignUp() error = %v, want ErrSessionUnavailable", err)
+			}
+			if !tt.wantErr && (response.AccessToken == "" || response.SessionID != "") {
+				t.Errorf("SignUp() = %+v, want tokens without a session", response)
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("log = %q, want %q", logs.String(), tt.wantLog)
+			}
+
+			// The handlers report the failure without the store error
+			h := NewGenericAuthHandlers(a, config)
+			ctx := newTestContext(http.MethodPost, "/auth/signup", signUpBody("john@example.com", 0))
+			serve(t, ctx, h.SignUpHandler)
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantErr {
+				body := ctx.body(t)
+				if body["code"] != "session_unavailable" || strings.Contains(fmt.Sprint(body["error"]), "store unavailable") {
+					t.Errorf("body = %v", body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package gotrust
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Session ID encodings
+const (
+	SessionIDAlphanumeric = "alphanumeric" // [A-Za-z0-9], the default
+	SessionIDBase64URL    = "base64url"    // unpadded base64url
+	SessionIDHex          = "hex"          // lowercase hex
+)
+
+// DefaultSessionIDLength is the length of generated session IDs, excluding
+// the prefix
+const DefaultSessionIDLength = 32
+
+// MinSessionIDEntropy is the fewest random bits a session ID format may
+// carry
+const MinSessionIDEntropy = 128
+
+// sessionIDBitsPerChar is the entropy of one character of each encoding.
+// Alphanumeric characters carry slightly less than log2(62) bits because
+// they are picked from a byte modulo 62.
+var sessionIDBitsPerChar = map[string]float64{
+	SessionIDAlphanumeric: 5.6,
+	SessionIDBase64URL:    6,
+	SessionIDHex:          4,
+}
+
+// SessionIDFormat configures the session IDs a SessionManager generates. The
+// zero value produces 32 alphanumeric characters.
+type SessionIDFormat struct {
+	// Length is the number of random characters, excluding Prefix
+	// (default DefaultSessionIDLength)
+	Length int
+	// Encoding is SessionIDAlphanumeric (default), SessionIDBase64URL or
+	// SessionIDHex
+	Encoding string
+	// Prefix is prepended to every ID, e.g. "sid_" so IDs are easy to scrub
+	// from logs. It may contain letters, digits, '-', '_' and '.'.
+	Prefix string
+}
+
+func (f SessionIDFormat) length() int {
+	if f.Length > 0 {
+		return f.Length
+	}
+	return DefaultSessionIDLength
+}
+
+func (f SessionIDFormat) encoding() string {
+	if f.Encoding != "" {
+		return strings.ToLower(f.Encoding)
+	}
+	return SessionIDAlphanumeric
+}
+
+// Entropy returns the number of random bits in IDs of this format
+func (f SessionIDFormat) Entropy() float64 {
+	return float64(f.length()) * sessionIDBitsPerChar[f.encoding()]
+}
+
+// Validate checks the encoding and prefix and that IDs carry at least
+// MinSessionIDEntropy random bits
+func (f SessionIDFormat) Validate() error {
+	if f.Length < 0 {
+		return fmt.Errorf("session ID length must not be negative")
+	}
+	if _, ok := sessionIDBitsPerChar[f.encoding()]; !ok {
+		return fmt.Errorf("unknown session ID encoding %q", f.Encoding)
+	}
+	if entropy := f.Entropy(); entropy < MinSessionIDEntropy {
+		return fmt.Errorf("session IDs of %d %s characters carry %.0f random bits, need at least %d",
+			f.length(), f.encoding(), entropy, MinSessionIDEntropy)
+	}
+	for _, c := range f.Prefix {
+		if !isSessionIDPrefixChar(c) {
+			return fmt.Errorf("session ID prefix contains invalid character %q", c)
+		}
+	}
+	return nil
+}
+
+func isSessionIDPrefixChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '_' || c == '.'
+}
+
+// generate returns a new session ID. Unlike generateRandomString it fails
+// instead of falling back to a predictable value when randomness is
+// unavailable.
+func (f SessionIDFormat) generate() (string, error) {
+	length := f.length()
+	var id string
+	switch f.encoding() {
+	case SessionIDBase64URL:
+		b := make([]byte, (length*6+7)/8)
+		if err := readRandom(b); err != nil {
+			return "", err
+		}
+		id = base64.RawURLEncoding.EncodeToString(b)[:length]
+	case SessionIDHex:
+		b := make([]byte, (length+1)/2)
+		if err := readRandom(b); err != nil {
+			return "", err
+		}
+		id = hex.EncodeToString(b)[:length]
+	default:
+		const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+		b := make([]byte, length)
+		if err := readRandom(b); err != nil {
+			return "", err
+		}
+		for i := range b {
+			b[i] = charset[int(b[i])%len(charset)]
+		}
+		id = string(b)
+	}
+	return f.Prefix + id, nil
+}
@@ -0,0 +1,202 @@
+package gotrust
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// constantReader returns the same byte forever
+type constantReader byte
+
+func (r constantReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+// failingReader always fails, like an unavailable entropy source
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("entropy unavailable")
+}
+
+// useRandomSource replaces the random source for the rest of the test
+func useRandomSource(t *testing.T, source io.Reader) {
+	t.Helper()
+
+	SetRandomSource(source)
+	t.Cleanup(func() { SetRandomSource(nil) })
+}
+
+func TestSetRandomSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		format SessionIDFormat
+		want   string
+	}{
+		{name: "alphanumeric", want: strings.Repeat("a", DefaultSessionIDLength)},
+		{name: "hex", format: SessionIDFormat{Encoding: SessionIDHex, Length: 40}, want: strings.Repeat("0", 40)},
+		{name: "base64url with prefix", format: SessionIDFormat{Encoding: SessionIDBase64URL, Length: 32, Prefix: "sid_"}, want: "sid_" + strings.Repeat("A", 32)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useRandomSource(t, constantReader(0))
+			store := NewMemorySessionStore()
+			defer store.Close()
+			manager := NewSessionManager(store, "")
+			if err := manager.SetIDFormat(tt.format); err != nil {
+				t.Fatalf("SetIDFormat() error = %v", err)
+			}
+
+			sessionID, err := manager.CreateSession(context.Background(), "user-1", "jane@example.com", time.Hour)
+			if err != nil {
+				t.Fatalf("CreateSession() error = %v", err)
+			}
+			if sessionID != tt.want {
+				t.Errorf("CreateSession() = %q, want %q", sessionID, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetRandomSourceGeneratedIDs(t *testing.T) {
+	useRandomSource(t, bytes.NewReader(bytes.Repeat([]byte{1}, 64)))
+	if got, want := generateRandomString(16), strings.Repeat("b", 16); got != want {
+		t.Errorf("generateRandomString() = %q, want %q", got, want)
+	}
+
+	SetRandomSource(nil)
+	if a, b := generateRandomString(16), generateRandomString(16); a == b {
+		t.Errorf("generateRandomString() repeated %q after restoring crypto/rand", a)
+	}
+}
+
+func TestSessionIDWithoutEntropy(t *testing.T) {
+	useRandomSource(t, failingReader{})
+	store := NewMemorySessionStore()
+	defer store.Close()
+	manager := NewSessionManager(store, "")
+
+	// Session IDs never fall back to a predictable value
+	if sessionID, err := manager.CreateSession(context.Background(), "user-1", "jane@example.com", time.Hour); err == nil {
+		t.Errorf("CreateSession() = %q without a source of randomness", sessionID)
+	}
+}
+
+func TestSetRandomSourceConcurrent(t *testing.T) {
+	// bytes.Reader is not safe for concurrent use; reads must be serialized
+	useRandomSource(t, bytes.NewReader(make([]byte, 1<<16)))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			generateRandomString(32)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSessionIDFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     SessionIDFormat
+		wantLength int
+		charset    string
+	}{
+		{name: "default", wantLength: 32, charset: "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"},
+		{name: "base64url", format: SessionIDFormat{Encoding: SessionIDBase64URL, Length: 22}, wantLength: 22, charset: "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"},
+		{name: "odd length hex", format: SessionIDFormat{Encoding: SessionIDHex, Length: 33}, wantLength: 33, charset: "0123456789abcdef"},
+		{name: "encoding is case-insensitive", format: SessionIDFormat{Encoding: "HEX", Length: 48}, wantLength: 48, charset: "0123456789abcdef"},
+		{name: "prefix", format: SessionIDFormat{Prefix: "sid_", Length: 40}, wantLength: 40, charset: "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemorySessionStore()
+			defer store.Close()
+			manager := NewSessionManager(store, "")
+			if err := manager.SetIDFormat(tt.format); err != nil {
+				t.Fatalf("SetIDFormat() error = %v", err)
+			}
+
+			seen := make(map[string]bool)
+			for i := 0; i < 100; i++ {
+				sessionID, err := manager.CreateSession(context.Background(), "user-1", "jane@example.com", time.Hour)
+				if err != nil {
+					t.Fatalf("CreateSession() error = %v", err)
+				}
+				id, ok := strings.CutPrefix(sessionID, tt.format.Prefix)
+				if !ok || len(id) != tt.wantLength {
+					t.Fatalf("CreateSession() = %q, want prefix %q and %d characters", sessionID, tt.format.Prefix, tt.wantLength)
+				}
+				if i := strings.IndexFunc(id, func(c rune) bool { return !strings.ContainsRune(tt.charset, c) }); i >= 0 {
+					t.Fatalf("CreateSession() = %q contains %q", sessionID, id[i])
+				}
+				if seen[sessionID] {
+					t.Fatalf("CreateSession() repeated %q", sessionID)
+				}
+				seen[sessionID] = true
+
+				if _, err := manager.GetSession(context.Background(), sessionID); err != nil {
+					t.Fatalf("GetSession(%q) error = %v", sessionID, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionIDFormatEntropy(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  SessionIDFormat
+		wantErr bool
+	}{
+		{name: "default", format: SessionIDFormat{}},
+		{name: "128-bit base64url", format: SessionIDFormat{Encoding: SessionIDBase64URL, Length: 22}},
+		{name: "short base64url", format: SessionIDFormat{Encoding: SessionIDBase64URL, Length: 21}, wantErr: true},
+		{name: "128-bit hex", format: SessionIDFormat{Encoding: SessionIDHex, Length: 32}},
+		{name: "short hex", format: SessionIDFormat{Encoding: SessionIDHex, Length: 31}, wantErr: true},
+		{name: "short alphanumeric", format: SessionIDFormat{Length: 22}, wantErr: true},
+		{name: "prefix adds no entropy", format: SessionIDFormat{Encoding: SessionIDHex, Length: 16, Prefix: strings.Repeat("x", 32)}, wantErr: true},
+		{name: "unknown encoding", format: SessionIDFormat{Encoding: "base32"}, wantErr: true},
+		{name: "negative length", format: SessionIDFormat{Length: -1}, wantErr: true},
+		{name: "invalid prefix", format: SessionIDFormat{Prefix: "sid:"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.format.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.format.Entropy() < MinSessionIDEntropy {
+				t.Errorf("Entropy() = %v, want at least %d", tt.format.Entropy(), MinSessionIDEntropy)
+			}
+
+			// A rejected format leaves the default in place
+			store := NewMemorySessionStore()
+			defer store.Close()
+			manager := NewSessionManager(store, "")
+			if err := manager.SetIDFormat(tt.format); (err != nil) != tt.wantErr {
+				t.Fatalf("SetIDFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				sessionID, err := manager.CreateSession(context.Background(), "user-1", "jane@example.com", time.Hour)
+				if err != nil || len(sessionID) != DefaultSessionIDLength {
+					t.Errorf("CreateSession() = %q, %v, want a default ID", sessionID, err)
+				}
+			}
+		})
+	}
+}
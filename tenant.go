@@ -0,0 +1,67 @@
+package gotrust
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// TenantResolver determines the tenant a request is addressed to
+type TenantResolver func(ctx HTTPContext) string
+
+// resolveTenant returns the request's tenant using Config.TenantResolver, or
+// else the Config.TenantHeader header, or else the host's subdomain
+func (c *Config) resolveTenant(ctx HTTPContext) string {
+	if c.TenantResolver != nil {
+		return c.TenantResolver(ctx)
+	}
+	if c.TenantHeader != "" {
+		if tenant := ctx.GetHeader(c.TenantHeader); tenant != "" {
+			return tenant
+		}
+	}
+	return newRedirectData(ctx, "").Subdomain
+}
+
+// RequireTenant checks that the authenticated token belongs to the tenant
+// resolved from the request and returns that tenant. It must run after
+// AuthMiddleware.
+func (h *GenericAuthHandlers) RequireTenant(ctx HTTPContext) (string, error) {
+	claims, ok := GetClaims(ctx)
+	if !ok {
+		return "", fmt.Errorf("user not authenticated")
+	}
+
+	tenant := h.config.resolveTenant(ctx)
+	if tenant == "" {
+		return "", fmt.Errorf("tenant could not be determined from the request")
+	}
+	if claims.TenantID == "" {
+		return "", fmt.Errorf("token is not scoped to a tenant")
+	}
+	if claims.TenantID != tenant {
+		return "", fmt.Errorf("token belongs to a different tenant")
+	}
+
+	return tenant, nil
+}
+
+// TenantMiddleware rejects requests whose token tenant does not match the
+// tenant resolved from the request. It must be mounted after AuthMiddleware.
+func (h *GenericAuthHandlers) TenantMiddleware() HTTPMiddleware {
+	return func(next HTTPHandler) HTTPHandler {
+		return func(ctx HTTPContext) error {
+			if _, ok := GetClaims(ctx); !ok {
+				return h.errorJSON(ctx, http.StatusInternalServerError,
+					"TenantMiddleware must be mounted after AuthMiddleware: no authentication claims in context")
+			}
+
+			tenant, err := h.RequireTenant(ctx)
+			if err != nil {
+				return h.errorJSON(ctx, http.StatusForbidden, err.Error())
+			}
+
+			ctx.Set("tenant_id", tenant)
+			return next(ctx)
+		}
+	}
+}
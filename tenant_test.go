@@ -0,0 +1,91 @@
+package gotrust
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		tenant     string // of the token
+		host       string
+		header     string
+		resolver   TenantResolver
+		noAuth     bool
+		wantStatus int
+	}{
+		{name: "matching header", tenant: "acme", header: "acme", wantStatus: http.StatusOK},
+		{name: "matching subdomain", tenant: "acme", host: "acme.example.com", wantStatus: http.StatusOK},
+		{name: "header takes precedence over subdomain", tenant: "acme", host: "globex.example.com", header: "acme", wantStatus: http.StatusOK},
+		{
+			name:       "resolver takes precedence over header",
+			tenant:     "globex",
+			header:     "acme",
+			resolver:   func(ctx HTTPContext) string { return "globex" },
+			wantStatus: http.StatusOK,
+		},
+		{name: "mismatched tenant", tenant: "acme", header: "globex", wantStatus: http.StatusForbidden},
+		{name: "token without tenant", header: "acme", wantStatus: http.StatusForbidden},
+		{name: "no tenant in request", tenant: "acme", host: "example.com", wantStatus: http.StatusForbidden},
+		{name: "mounted without AuthMiddleware", tenant: "acme", header: "acme", noAuth: true, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, func(c *Config) { c.TenantResolver = tt.resolver })
+			token, err := a.jwtManager.GenerateToken(TokenClaims{UserID: "user-1", TenantID: tt.tenant})
+			if err != nil {
+				t.Fatalf("GenerateToken() error = %v", err)
+			}
+
+			ctx := newTestContext(http.MethodGet, "/projects", "").withBearer(token)
+			if tt.host != "" {
+				ctx.request.Host = tt.host
+			}
+			if tt.header != "" {
+				ctx.request.Header.Set("X-Tenant-ID", tt.header)
+			}
+			var gotTenant interface{}
+			handler := func(ctx HTTPContext) error {
+				gotTenant = ctx.Get("tenant_id")
+				return ctx.String(http.StatusOK, "ok")
+			}
+			middleware := []HTTPMiddleware{h.AuthMiddleware(), h.TenantMiddleware()}
+			if tt.noAuth {
+				middleware = middleware[1:]
+			}
+			serve(t, ctx, handler, middleware...)
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && gotTenant != tt.tenant {
+				t.Errorf("tenant_id = %v, want %s", gotTenant, tt.tenant)
+			}
+		})
+	}
+}
+
+func TestTenantClaim(t *testing.T) {
+	a, users, _ := newTestService(t, nil)
+	response := signUp(t, a, "jane@example.com")
+	user := response.User
+	user.TenantID = "acme"
+	if err := users.UpdateUser(context.Background(), user); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+
+	signedIn, err := a.SignIn(context.Background(), &SignInRequest{Email: "jane@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatalf("SignIn() error = %v", err)
+	}
+	claims, err := a.ValidateToken(signedIn.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if claims.TenantID != "acme" {
+		t.Errorf("TenantID = %q, want acme", claims.TenantID)
+	}
+}
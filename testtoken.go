@@ -0,0 +1,31 @@
+package gotrust
+
+import "time"
+
+// GenerateTestToken mints a valid access token for user without signing in,
+// for testing protected routes. No session or refresh token is created, so
+// it does not work with BindTokenToSession. Do not use it outside tests.
+func (a *AuthService) GenerateTestToken(user *User) (string, error) {
+	return a.jwtManager.generateTokenAt(a.testTokenClaims(user), time.Now())
+}
+
+// GenerateExpiredTestToken mints an access token for user that expired a
+// minute ago, for testing how routes handle expired tokens
+func (a *AuthService) GenerateExpiredTestToken(user *User) (string, error) {
+	issuedAt := time.Now().Add(-a.config.JWTExpiration - a.config.TokenLeeway - time.Minute)
+	return a.jwtManager.generateTokenAt(a.testTokenClaims(user), issuedAt)
+}
+
+// testTokenClaims returns the access token claims a sign-in would grant
+func (a *AuthService) testTokenClaims(user *User) TokenClaims {
+	return TokenClaims{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Name:     user.Name,
+		Provider: user.Provider,
+		Subject:  a.config.subject(user),
+		AuthTime: time.Now(),
+		Roles:    user.Roles,
+		TenantID: user.TenantID,
+	}
+}
@@ -0,0 +1,49 @@
+package gotrust
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGenerateTestToken(t *testing.T) {
+	user := &User{ID: "user-1", Email: "jane@example.com", Name: "Jane", Roles: []string{"admin"}, TenantID: "acme"}
+
+	tests := []struct {
+		name       string
+		leeway     time.Duration
+		generate   func(a *AuthService) (string, error)
+		wantStatus int
+	}{
+		{name: "test token", generate: func(a *AuthService) (string, error) { return a.GenerateTestToken(user) }, wantStatus: http.StatusOK},
+		{name: "expired test token", generate: func(a *AuthService) (string, error) { return a.GenerateExpiredTestToken(user) }, wantStatus: http.StatusUnauthorized},
+		{name: "expired test token beyond the leeway", leeway: time.Hour, generate: func(a *AuthService) (string, error) { return a.GenerateExpiredTestToken(user) }, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a := newTestHandlers(t, func(c *Config) { c.TokenLeeway = tt.leeway })
+			token, err := tt.generate(a)
+			if err != nil {
+				t.Fatalf("generate error = %v", err)
+			}
+
+			var claims *TokenClaims
+			ctx := newTestContext(http.MethodGet, "/protected", "").withBearer(token)
+			serve(t, ctx, func(ctx HTTPContext) error {
+				claims, _ = GetClaims(ctx)
+				return ctx.String(http.StatusOK, "ok")
+			}, h.AuthMiddleware())
+
+			if ctx.status() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if claims.UserID != user.ID || claims.Email != user.Email || claims.TenantID != "acme" || len(claims.Roles) != 1 {
+				t.Errorf("claims = %+v, want those of %+v", claims, user)
+			}
+		})
+	}
+}
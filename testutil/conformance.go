@@ -0,0 +1,270 @@
+// Package testutil provides helpers for testing GoTrust framework adapters.
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mayurrawte/gotrust"
+)
+
+// ContextFactory creates an adapter's HTTPContext for a request and response
+// writer
+type ContextFactory func(w http.ResponseWriter, r *http.Request) gotrust.HTTPContext
+
+// RunHTTPContextConformance checks that an adapter's HTTPContext implements
+// every method as the auth handlers expect. Call it from the adapter's tests:
+//
+//	func TestContextConformance(t *testing.T) {
+//		testutil.RunHTTPContextConformance(t, func(w http.ResponseWriter, r *http.Request) gotrust.HTTPContext {
+//			return stdlib.NewStdContext(w, r)
+//		})
+//	}
+func RunHTTPContextConformance(t *testing.T, factory ContextFactory) {
+	t.Helper()
+
+	t.Run("Request", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/auth/user", nil)
+		ctx := factory(httptest.NewRecorder(), r)
+
+		if ctx.Request() == nil || ctx.Request().URL.Path != "/auth/user" {
+			t.Errorf("Request() does not return the request")
+		}
+		if ctx.Context() == nil {
+			t.Errorf("Context() returned nil")
+		}
+	})
+
+	t.Run("GetHeader", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer token")
+		ctx := factory(httptest.NewRecorder(), r)
+
+		if got := ctx.GetHeader("Authorization"); got != "Bearer token" {
+			t.Errorf("GetHeader() = %q, want %q", got, "Bearer token")
+		}
+		if got := ctx.GetHeader("authorization"); got != "Bearer token" {
+			t.Errorf("GetHeader() is case sensitive, got %q", got)
+		}
+		if got := ctx.GetHeader("X-Missing"); got != "" {
+			t.Errorf("GetHeader() of a missing header = %q, want empty", got)
+		}
+	})
+
+	t.Run("GetQueryParam", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/?code=abc&state=xyz", nil)
+		ctx := factory(httptest.NewRecorder(), r)
+
+		if got := ctx.GetQueryParam("code"); got != "abc" {
+			t.Errorf("GetQueryParam(code) = %q, want %q", got, "abc")
+		}
+		if got := ctx.GetQueryParam("missing"); got != "" {
+			t.Errorf("GetQueryParam() of a missing param = %q, want empty", got)
+		}
+	})
+
+	t.Run("GetFormValue", func(t *testing.T) {
+		form := url.Values{"email": {"user@example.com"}}
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ctx := factory(httptest.NewRecorder(), r)
+
+		if got := ctx.GetFormValue("email"); got != "user@example.com" {
+			t.Errorf("GetFormValue(email) = %q, want %q", got, "user@example.com")
+		}
+	})
+
+	t.Run("Bind", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email":"user@example.com","password":"secret"}`))
+		r.Header.Set("Content-Type", "application/json")
+		ctx := factory(httptest.NewRecorder(), r)
+
+		var req gotrust.SignInRequest
+		if err := ctx.Bind(&req); err != nil {
+			t.Fatalf("Bind() error = %v", err)
+		}
+		if req.Email != "user@example.com" || req.Password != "secret" {
+			t.Errorf("Bind() decoded %+v", req)
+		}
+	})
+
+	t.Run("BindInvalid", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email":`))
+		r.Header.Set("Content-Type", "application/json")
+		ctx := factory(httptest.NewRecorder(), r)
+
+		var req gotrust.SignInRequest
+		if err := ctx.Bind(&req); err == nil {
+			t.Errorf("Bind() of malformed JSON returned no error")
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx := factory(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		ctx.SetHeader("X-Request-ID", "req-1")
+		if err := ctx.JSON(http.StatusCreated, map[string]string{"status": "ok"}); err != nil {
+			t.Fatalf("JSON() error = %v", err)
+		}
+
+		if w.Code != http.StatusCreated {
+			t.Errorf("JSON() status = %d, want %d", w.Code, http.StatusCreated)
+		}
+		if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+			t.Errorf("JSON() Content-Type = %q", got)
+		}
+		if got := w.Header().Get("X-Request-ID"); got != "req-1" {
+			t.Errorf("SetHeader() header not sent, got %q", got)
+		}
+
+		var body map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["status"] != "ok" {
+			t.Errorf("JSON() body = %q", w.Body.String())
+		}
+	})
+
+	t.Run("String", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx := factory(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if err := ctx.String(http.StatusTeapot, "hello"); err != nil {
+			t.Fatalf("String() error = %v", err)
+		}
+		if w.Code != http.StatusTeapot || w.Body.String() != "hello" {
+			t.Errorf("String() wrote %d %q", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("SetStatus", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx := factory(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		ctx.SetStatus(http.StatusAccepted)
+		if err := ctx.JSON(http.StatusAccepted, map[string]string{}); err != nil {
+			t.Fatalf("JSON() error = %v", err)
+		}
+		if w.Code != http.StatusAccepted {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusAccepted)
+		}
+	})
+
+	t.Run("Redirect", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx := factory(w, httptest.NewRequest(http.MethodGet, "/auth/google", nil))
+
+		if err := ctx.Redirect(http.StatusTemporaryRedirect, "https://accounts.example.com/auth"); err != nil {
+			t.Fatalf("Redirect() error = %v", err)
+		}
+		if w.Code != http.StatusTemporaryRedirect {
+			t.Errorf("Redirect() status = %d, want %d", w.Code, http.StatusTemporaryRedirect)
+		}
+		if got := w.Header().Get("Location"); got != "https://accounts.example.com/auth" {
+			t.Errorf("Redirect() Location = %q", got)
+		}
+	})
+
+	t.Run("GetCookie", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: "session_id", Value: "abc"})
+		ctx := factory(httptest.NewRecorder(), r)
+
+		cookie, err := ctx.GetCookie("session_id")
+		if err != nil || cookie == nil || cookie.Value != "abc" {
+			t.Errorf("GetCookie() = %v, %v", cookie, err)
+		}
+		if _, err := ctx.GetCookie("missing"); err == nil {
+			t.Errorf("GetCookie() of a missing cookie returned no error")
+		}
+	})
+
+	t.Run("SetCookie", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx := factory(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		ctx.SetCookie(&http.Cookie{
+			Name:     "session_id",
+			Value:    "abc",
+			Path:     "/",
+			MaxAge:   60,
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		if err := ctx.String(http.StatusOK, ""); err != nil {
+			t.Fatalf("String() error = %v", err)
+		}
+
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("SetCookie() set %d cookies, want 1", len(cookies))
+		}
+		cookie := cookies[0]
+		if cookie.Name != "session_id" || cookie.Value != "abc" || cookie.Path != "/" {
+			t.Errorf("SetCookie() set %v", cookie)
+		}
+		if !cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+			t.Errorf("SetCookie() lost attributes: %v", cookie)
+		}
+	})
+
+	t.Run("SetCookie Partitioned", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx := factory(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		// GoTrust marks partitioned auth cookies in Unparsed (see
+		// gotrust.CookieHeader)
+		ctx.SetCookie(&http.Cookie{
+			Name:     "session_id",
+			Value:    "abc",
+			Path:     "/",
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteNoneMode,
+			Unparsed: []string{"Partitioned"},
+		})
+		if err := ctx.String(http.StatusOK, ""); err != nil {
+			t.Fatalf("String() error = %v", err)
+		}
+
+		header := w.Result().Header.Values("Set-Cookie")
+		if len(header) != 1 {
+			t.Fatalf("SetCookie() set %d cookies, want 1", len(header))
+		}
+		if !strings.HasSuffix(header[0], "; Partitioned") {
+			t.Errorf("Set-Cookie = %q, want the Partitioned attribute", header[0])
+		}
+		if !strings.Contains(header[0], "SameSite=None") || !strings.Contains(header[0], "Secure") {
+			t.Errorf("Set-Cookie = %q lost attributes", header[0])
+		}
+	})
+
+	t.Run("SetGet", func(t *testing.T) {
+		ctx := factory(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		ctx.Set("user_id", "user-1")
+		if got, _ := ctx.Get("user_id").(string); got != "user-1" {
+			t.Errorf("Get() = %v, want %q", ctx.Get("user_id"), "user-1")
+		}
+		if got := ctx.Get("missing"); got != nil {
+			t.Errorf("Get() of a missing key = %v, want nil", got)
+		}
+	})
+
+	t.Run("Claims", func(t *testing.T) {
+		ctx := factory(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		gotrust.SetClaims(ctx, &gotrust.TokenClaims{UserID: "user-1"})
+		claims, ok := gotrust.GetClaims(ctx)
+		if !ok || claims.UserID != "user-1" {
+			t.Errorf("GetClaims() = %v, %v", claims, ok)
+		}
+		if claims, ok := gotrust.ClaimsFromContext(ctx.Request().Context()); !ok || claims.UserID != "user-1" {
+			t.Errorf("claims not attached to the request context")
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package testutil
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mayurrawte/gotrust"
+)
+
+// NewAuthenticatedRequest returns a request carrying a valid access token
+// for user, for testing protected routes with any adapter
+func NewAuthenticatedRequest(t *testing.T, authService *gotrust.AuthService, user *gotrust.User, method, target string, body io.Reader) *http.Request {
+	t.Helper()
+
+	token, err := authService.GenerateTestToken(user)
+	if err != nil {
+		t.Fatalf("failed to generate test token: %v", err)
+	}
+	return newBearerRequest(method, target, body, token)
+}
+
+// NewExpiredTokenRequest returns a request carrying an expired access token
+// for user
+func NewExpiredTokenRequest(t *testing.T, authService *gotrust.AuthService, user *gotrust.User, method, target string, body io.Reader) *http.Request {
+	t.Helper()
+
+	token, err := authService.GenerateExpiredTestToken(user)
+	if err != nil {
+		t.Fatalf("failed to generate expired test token: %v", err)
+	}
+	return newBearerRequest(method, target, body, token)
+}
+
+func newBearerRequest(method, target string, body io.Reader, token string) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	return r
+}
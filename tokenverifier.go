@@ -0,0 +1,72 @@
+package gotrust
+
+import (
+	"fmt"
+	"time"
+)
+
+// TokenVerifierConfig configures a TokenVerifier. At least one of Secret,
+// SigningKeys, PublicKey and JWKSURL must be set.
+type TokenVerifierConfig struct {
+	// Secret is the HMAC secret tokens are signed with (JWT_SECRET)
+	Secret string
+	// SigningKeys are HMAC secrets by key ID (JWT_SIGNING_KEYS)
+	SigningKeys map[string]string
+	// PublicKey verifies asymmetrically signed tokens: an *rsa.PublicKey,
+	// *ecdsa.PublicKey or ed25519.PublicKey
+	PublicKey interface{}
+	// JWKSURL serves the public keys of asymmetrically signed tokens, chosen
+	// by their "kid" header; it takes precedence over PublicKey
+	JWKSURL string
+
+	// Issuer and Audience, when set, must match the token's iss and aud
+	Issuer   string
+	Audience string
+
+	// Leeway tolerates clock skew when checking exp, nbf and iat
+	Leeway time.Duration
+	// EncryptionKey decrypts encrypted tokens (TOKEN_ENCRYPTION_KEY)
+	EncryptionKey string
+	// AccessTokenType is the expected "typ" header, defaulting to
+	// DefaultAccessTokenType
+	AccessTokenType string
+}
+
+// TokenVerifier validates GoTrust access tokens in services that do not run
+// an AuthService. It checks the signature, expiry, token type, issuer and
+// audience only: revoked sessions and token versions live in the stores and
+// are not seen, so keep access tokens short-lived.
+type TokenVerifier struct {
+	jwtManager *JWTManager
+}
+
+// NewTokenVerifier creates a TokenVerifier
+func NewTokenVerifier(config TokenVerifierConfig) (*TokenVerifier, error) {
+	if config.Secret == "" && len(config.SigningKeys) == 0 && config.PublicKey == nil && config.JWKSURL == "" {
+		return nil, fmt.Errorf("token verifier needs a secret, signing keys, a public key or a JWKS URL")
+	}
+
+	jwtManager := NewJWTManager(config.Secret, config.Issuer, 0)
+	jwtManager.checkIssuer = config.Issuer != ""
+	jwtManager.SetAudience(config.Audience)
+	jwtManager.SetTokenTypes(config.AccessTokenType, "")
+	jwtManager.SetLeeway(config.Leeway)
+	jwtManager.SetEncryptionKey(config.EncryptionKey)
+	jwtManager.publicKey = config.PublicKey
+	if len(config.SigningKeys) > 0 {
+		jwtManager.signingKeys = make(map[string][]byte, len(config.SigningKeys))
+		for kid, secret := range config.SigningKeys {
+			jwtManager.signingKeys[kid] = []byte(secret)
+		}
+	}
+	if config.JWKSURL != "" {
+		jwtManager.SetKeySet(NewRemoteKeySet(config.JWKSURL, 0))
+	}
+
+	return &TokenVerifier{jwtManager: jwtManager}, nil
+}
+
+// Verify validates an access token and returns its claims
+func (v *TokenVerifier) Verify(token string) (*TokenClaims, error) {
+	return v.jwtManager.ValidateToken(token)
+}
@@ -0,0 +1,98 @@
+package gotrust
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenVerifier(t *testing.T) {
+	a, _, _ := newTestService(t, func(c *Config) {
+		c.JWTIssuer = "auth.example.com"
+		c.JWTAudience = "api"
+	})
+	response := signUp(t, a, "jane@example.com")
+
+	encrypting, _, _ := newTestService(t, func(c *Config) { c.TokenEncryptionKey = "encryption-secret" })
+	encrypted := signUp(t, encrypting, "jane@example.com").AccessToken
+
+	tests := []struct {
+		name    string
+		config  TokenVerifierConfig
+		token   string
+		wantErr bool
+	}{
+		{name: "matching issuer and audience", config: TokenVerifierConfig{Secret: testSecret, Issuer: "auth.example.com", Audience: "api"}, token: response.AccessToken},
+		{name: "secret only", config: TokenVerifierConfig{Secret: testSecret}, token: response.AccessToken},
+		{name: "issuer mismatch", config: TokenVerifierConfig{Secret: testSecret, Issuer: "other.example.com"}, token: response.AccessToken, wantErr: true},
+		{name: "audience mismatch", config: TokenVerifierConfig{Secret: testSecret, Audience: "billing"}, token: response.AccessToken, wantErr: true},
+		{name: "wrong secret", config: TokenVerifierConfig{Secret: "other-secret"}, token: response.AccessToken, wantErr: true},
+		{name: "refresh token", config: TokenVerifierConfig{Secret: testSecret}, token: response.RefreshToken, wantErr: true},
+		{name: "encrypted token", config: TokenVerifierConfig{Secret: testSecret, EncryptionKey: "encryption-secret"}, token: encrypted},
+		{name: "encrypted token without the key", config: TokenVerifierConfig{Secret: testSecret}, token: encrypted, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := NewTokenVerifier(tt.config)
+			if err != nil {
+				t.Fatalf("NewTokenVerifier() error = %v", err)
+			}
+
+			claims, err := verifier.Verify(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && claims.Email != "jane@example.com" {
+				t.Errorf("Verify() = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestTokenVerifierPublicKey(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	otherPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	token := signedWith(t, jwt.SigningMethodEdDSA, private, "key-1")
+
+	tests := []struct {
+		name      string
+		publicKey ed25519.PublicKey
+		issuer    string
+		wantErr   bool
+	}{
+		{name: "matching key", publicKey: public, issuer: "central"},
+		{name: "other key", publicKey: otherPublic, wantErr: true},
+		{name: "issuer mismatch", publicKey: public, issuer: "elsewhere", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := NewTokenVerifier(TokenVerifierConfig{PublicKey: tt.publicKey, Issuer: tt.issuer})
+			if err != nil {
+				t.Fatalf("NewTokenVerifier() error = %v", err)
+			}
+			claims, err := verifier.Verify(token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && claims.UserID != "user-1" {
+				t.Errorf("Verify() user = %q, want user-1", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestNewTokenVerifierRequiresKey(t *testing.T) {
+	if _, err := NewTokenVerifier(TokenVerifierConfig{Issuer: "auth.example.com"}); err == nil {
+		t.Error("NewTokenVerifier() without a key succeeded")
+	}
+}
@@ -0,0 +1,69 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// tokenVersionMu serializes token version increments within this process
+var tokenVersionMu sync.Mutex
+
+// tokenVersion is the stored per-user token version
+type tokenVersion struct {
+	Version int64 `json:"version"`
+}
+
+func tokenVersionKey(userID string) string {
+	return fmt.Sprintf("token_version:%s", userID)
+}
+
+// TokenVersion returns the current token version of a user. Users whose
+// version was never incremented are at version 0.
+func (a *AuthService) TokenVersion(ctx context.Context, userID string) (int64, error) {
+	exists, err := a.sessionStore.Exists(ctx, tokenVersionKey(userID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read token version: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version tokenVersion
+	if err := a.sessionStore.Get(ctx, tokenVersionKey(userID), &version); err != nil {
+		return 0, fmt.Errorf("failed to read token version: %w", err)
+	}
+	return version.Version, nil
+}
+
+// IncrementTokenVersion bumps a user's token version, invalidating every
+// access token issued before the call when Config.EnableTokenVersioning is
+// set. Call it after security-sensitive changes such as a password change.
+func (a *AuthService) IncrementTokenVersion(ctx context.Context, userID string) (int64, error) {
+	tokenVersionMu.Lock()
+	defer tokenVersionMu.Unlock()
+
+	current, err := a.TokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	next := &tokenVersion{Version: current + 1}
+	if err := a.sessionStore.Set(ctx, tokenVersionKey(userID), next, 0); err != nil {
+		return 0, fmt.Errorf("failed to store token version: %w", err)
+	}
+	a.forgetUser(userID)
+	return next.Version, nil
+}
+
+// checkTokenVersion rejects tokens issued before the user's current version
+func (a *AuthService) checkTokenVersion(ctx context.Context, claims *TokenClaims) error {
+	current, err := a.currentTokenVersion(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if claims.TokenVersion != current {
+		return fmt.Errorf("token has been revoked")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package gotrust
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTokenVersioning(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		wantRevoked bool
+	}{
+		{name: "disabled by default"},
+		{name: "enabled", enabled: true, wantRevoked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestService(t, func(c *Config) { c.EnableTokenVersioning = tt.enabled })
+			ctx := context.Background()
+			response := signUp(t, a, "jane@example.com")
+			other := signUp(t, a, "john@example.com")
+
+			if _, err := a.ValidateTokenContext(ctx, response.AccessToken); err != nil {
+				t.Fatalf("ValidateTokenContext() before increment error = %v", err)
+			}
+
+			version, err := a.IncrementTokenVersion(ctx, response.User.ID)
+			if err != nil || version != 1 {
+				t.Fatalf("IncrementTokenVersion() = %d, %v, want 1", version, err)
+			}
+			if current, err := a.TokenVersion(ctx, response.User.ID); err != nil || current != 1 {
+				t.Errorf("TokenVersion() = %d, %v, want 1", current, err)
+			}
+
+			_, err = a.ValidateTokenContext(ctx, response.AccessToken)
+			if revoked := err != nil; revoked != tt.wantRevoked {
+				t.Errorf("token issued before increment revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+			if _, err := a.ValidateTokenContext(ctx, other.AccessToken); err != nil {
+				t.Errorf("another user's token rejected: %v", err)
+			}
+
+			// Tokens issued after the increment carry the new version
+			refreshed, err := a.RefreshToken(ctx, response.RefreshToken)
+			if err != nil {
+				t.Fatalf("RefreshToken() error = %v", err)
+			}
+			if _, err := a.ValidateTokenContext(ctx, refreshed.AccessToken); err != nil {
+				t.Errorf("token issued after increment rejected: %v", err)
+			}
+			tv, _ := tokenPayload(t, refreshed.AccessToken)["tv"].(float64)
+			wantTV := 0.0
+			if tt.enabled {
+				wantTV = 1
+			}
+			if tv != wantTV {
+				t.Errorf("tv claim = %v, want %v", tv, wantTV)
+			}
+		})
+	}
+}
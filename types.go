@@ -1,37 +1,101 @@
 package gotrust
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // User represents a user in the system
 type User struct {
 	ID        string    `json:"id"`
 	Email     string    `json:"email"`
+	EmailVerified bool  `json:"email_verified"`
+	// SecondaryEmails are additional verified addresses the user can sign in
+	// with. Email stays the primary address.
+	SecondaryEmails []string `json:"secondary_emails,omitempty"`
 	Name      string    `json:"name,omitempty"`
 	AvatarURL string    `json:"avatar_url,omitempty"`
 	Provider  string    `json:"provider,omitempty"`
+	LinkedProviders []string `json:"linked_providers,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	IsGuest   bool      `json:"is_guest,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// HasEmail reports whether email is the user's primary or one of their
+// secondary addresses, ignoring case
+func (u *User) HasEmail(email string) bool {
+	if strings.EqualFold(u.Email, email) {
+		return true
+	}
+	for _, e := range u.SecondaryEmails {
+		if strings.EqualFold(e, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasProvider reports whether the user signed up with or has linked the provider
+func (u *User) HasProvider(provider string) bool {
+	if u.Provider == provider {
+		return true
+	}
+	for _, p := range u.LinkedProviders {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
 // AuthResponse is returned after successful authentication
 type AuthResponse struct {
 	User        *User  `json:"user"`
 	AccessToken string `json:"access_token"`
+	// TokenType is the Authorization header scheme of the access token
+	TokenType   string `json:"token_type"`
+	// Algorithm and KeyID describe how the access token is signed, when
+	// Config.ExposeTokenMetadata is set; KeyID only with key rotation
+	Algorithm   string `json:"alg,omitempty"`
+	KeyID       string `json:"kid,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	ExpiresIn   int64  `json:"expires_in"`
+	SessionID   string `json:"-"` // delivered via the session cookie, never in the body
+	// IsNewUser is set when the request created the account (sign-up or a
+	// first OAuth sign-in), e.g. to start onboarding
+	IsNewUser   bool   `json:"is_new_user,omitempty"`
 }
 
 // SignUpRequest for email/password registration
 type SignUpRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
+	// PasswordConfirmation must equal Password when
+	// Config.RequirePasswordConfirmation is set
+	PasswordConfirmation string `json:"password_confirmation,omitempty"`
 	Name     string `json:"name,omitempty"`
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
 // SignInRequest for email/password login
 type SignInRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
+	CaptchaToken string `json:"captcha_token,omitempty"`
+}
+
+// UserInfo contains the standard OpenID Connect claims for a user
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+	UpdatedAt     int64  `json:"updated_at,omitempty"`
 }
 
 // OAuthProvider represents an OAuth provider
@@ -40,13 +104,32 @@ type OAuthProvider string
 const (
 	ProviderGoogle OAuthProvider = "google"
 	ProviderGitHub OAuthProvider = "github"
+	ProviderGitLab OAuthProvider = "gitlab"
+	ProviderDiscord OAuthProvider = "discord"
 	ProviderLocal  OAuthProvider = "local"
 )
 
+// OAuthProviders lists the OAuth providers GoTrust supports
+func OAuthProviders() []OAuthProvider {
+	return []OAuthProvider{ProviderGoogle, ProviderGitHub, ProviderGitLab, ProviderDiscord}
+}
+
+// ParseOAuthProvider returns the OAuth provider with the given route name,
+// or ErrUnknownProvider
+func ParseOAuthProvider(name string) (OAuthProvider, error) {
+	for _, provider := range OAuthProviders() {
+		if string(provider) == name {
+			return provider, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+}
+
 // OAuthUserInfo contains user information from OAuth providers
 type OAuthUserInfo struct {
 	ID        string `json:"id"`
 	Email     string `json:"email"`
+	EmailVerified bool `json:"email_verified"`
 	Name      string `json:"name"`
 	AvatarURL string `json:"avatar_url"`
 	Provider  string `json:"provider"`
@@ -58,6 +141,28 @@ type TokenClaims struct {
 	Email    string `json:"email"`
 	Name     string `json:"name,omitempty"`
 	Provider string `json:"provider,omitempty"`
+	Subject  string `json:"sub,omitempty"` // defaults to UserID when empty
+	AuthTime time.Time `json:"auth_time"` // when the user last authenticated interactively
+	Roles    []string `json:"roles,omitempty"`
+	SessionID string  `json:"sid,omitempty"` // set when tokens are bound to sessions
+	TokenVersion int64 `json:"tv,omitempty"` // set when token versioning is enabled
+	TenantID string   `json:"tenant_id,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"` // set when Config.EmailVerificationMode is enabled
+	VerifyBy time.Time   `json:"verify_by,omitempty"` // grace mode deadline to verify the email
+	IssuedAt time.Time   `json:"iat,omitempty"`
+	Extra    map[string]interface{} `json:"extra,omitempty"` // custom claims, preserved across refreshes
+}
+
+// HasRole reports whether the token grants any of the given roles
+func (c *TokenClaims) HasRole(roles ...string) bool {
+	for _, have := range c.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // SessionData represents session information
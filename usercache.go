@@ -0,0 +1,183 @@
+package gotrust
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CachedUserStore wraps a UserStore with an in-memory LRU cache of
+// GetUserByID results. Entries expire after the TTL and are invalidated when
+// the user is updated through the store. PasswordUpdater, UserDeleter and
+// ClaimsProvider pass through and are used only if the wrapped store
+// implements them.
+type CachedUserStore struct {
+	UserStore
+
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // front is most recently used
+	now     func() time.Time
+}
+
+type cachedUser struct {
+	userID    string
+	user      *User
+	expiresAt time.Time
+}
+
+// NewCachedUserStore caches up to size users for ttl
+func NewCachedUserStore(store UserStore, size int, ttl time.Duration) *CachedUserStore {
+	if size <= 0 {
+		size = 1000
+	}
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	return &CachedUserStore{
+		UserStore: store,
+		size:      size,
+		ttl:       ttl,
+		entries:   make(map[string]*list.Element),
+		order:     list.New(),
+		now:       time.Now,
+	}
+}
+
+func (c *CachedUserStore) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	if user, ok := c.get(userID); ok {
+		return user, nil
+	}
+
+	user, err := c.UserStore.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.put(userID, user)
+	return copyUser(user), nil
+}
+
+func (c *CachedUserStore) UpdateUser(ctx context.Context, user *User) error {
+	err := c.UserStore.UpdateUser(ctx, user)
+	c.Invalidate(user.ID)
+	return err
+}
+
+// UpdatePassword passes through to the wrapped store if it implements
+// PasswordUpdater
+func (c *CachedUserStore) UpdatePassword(ctx context.Context, userID, hashedPassword string) error {
+	updater, ok := c.UserStore.(PasswordUpdater)
+	if !ok {
+		return fmt.Errorf("user store does not support updating passwords")
+	}
+	err := updater.UpdatePassword(ctx, userID, hashedPassword)
+	c.Invalidate(userID)
+	return err
+}
+
+// DeleteUser passes through to the wrapped store if it implements
+// UserDeleter
+func (c *CachedUserStore) DeleteUser(ctx context.Context, userID string) error {
+	deleter, ok := c.UserStore.(UserDeleter)
+	if !ok {
+		return fmt.Errorf("user store does not support deleting users")
+	}
+	err := deleter.DeleteUser(ctx, userID)
+	c.Invalidate(userID)
+	return err
+}
+
+// Claims passes through to the wrapped store if it implements ClaimsProvider
+func (c *CachedUserStore) Claims(ctx context.Context, userID string) (map[string]interface{}, error) {
+	provider, ok := c.UserStore.(ClaimsProvider)
+	if !ok {
+		return nil, nil
+	}
+	return provider.Claims(ctx, userID)
+}
+
+func (c *CachedUserStore) wrappedUserStore() UserStore {
+	return c.UserStore
+}
+
+// Invalidate removes a user from the cache. Call it after changing a user
+// without going through this store.
+func (c *CachedUserStore) Invalidate(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[userID]; ok {
+		c.order.Remove(element)
+		delete(c.entries, userID)
+	}
+}
+
+// Len returns the number of cached users
+func (c *CachedUserStore) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *CachedUserStore) get(userID string) (*User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[userID]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cachedUser)
+	if c.now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, userID)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return copyUser(entry.user), true
+}
+
+func (c *CachedUserStore) put(userID string, user *User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cachedUser{
+		userID:    userID,
+		user:      copyUser(user),
+		expiresAt: c.now().Add(c.ttl),
+	}
+
+	if element, ok := c.entries[userID]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[userID] = c.order.PushFront(entry)
+
+	// Evict the least recently used users
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedUser).userID)
+	}
+}
+
+// copyUser returns a copy of the user so callers cannot modify cached entries
+func copyUser(user *User) *User {
+	if user == nil {
+		return nil
+	}
+	clone := *user
+	clone.SecondaryEmails = append([]string(nil), user.SecondaryEmails...)
+	clone.LinkedProviders = append([]string(nil), user.LinkedProviders...)
+	clone.Roles = append([]string(nil), user.Roles...)
+	return &clone
+}
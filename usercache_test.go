@@ -0,0 +1,201 @@
+package gotrust
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingUserStore counts GetUserByID calls reaching the wrapped store
+type countingUserStore struct {
+	*MemoryUserStore
+	gets int
+}
+
+func (s *countingUserStore) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	s.gets++
+	return s.MemoryUserStore.GetUserByID(ctx, userID)
+}
+
+func TestCachedUserStore(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		between  func(t *testing.T, cache *CachedUserStore, now *time.Time)
+		wantGets int
+		wantName string
+	}{
+		{
+			name:     "cache hit",
+			between:  func(t *testing.T, cache *CachedUserStore, now *time.Time) {},
+			wantGets: 1,
+			wantName: "Jane",
+		},
+		{
+			name: "within TTL",
+			between: func(t *testing.T, cache *CachedUserStore, now *time.Time) {
+				*now = now.Add(59 * time.Second)
+			},
+			wantGets: 1,
+			wantName: "Jane",
+		},
+		{
+			name: "TTL expiry",
+			between: func(t *testing.T, cache *CachedUserStore, now *time.Time) {
+				*now = now.Add(61 * time.Second)
+			},
+			wantGets: 2,
+			wantName: "Jane",
+		},
+		{
+			name: "invalidated by UpdateUser",
+			between: func(t *testing.T, cache *CachedUserStore, now *time.Time) {
+				if err := cache.UpdateUser(ctx, &User{ID: "user-1", Email: "jane@example.com", Name: "Jane Doe"}); err != nil {
+					t.Fatalf("UpdateUser() error = %v", err)
+				}
+			},
+			wantGets: 2,
+			wantName: "Jane Doe",
+		},
+		{
+			name: "invalidated by UpdatePassword",
+			between: func(t *testing.T, cache *CachedUserStore, now *time.Time) {
+				if err := cache.UpdatePassword(ctx, "user-1", "new-hash"); err != nil {
+					t.Fatalf("UpdatePassword() error = %v", err)
+				}
+			},
+			wantGets: 2,
+			wantName: "Jane",
+		},
+		{
+			name: "invalidated by DeleteUser",
+			between: func(t *testing.T, cache *CachedUserStore, now *time.Time) {
+				if err := cache.DeleteUser(ctx, "user-1"); err != nil {
+					t.Fatalf("DeleteUser() error = %v", err)
+				}
+			},
+			wantGets: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &countingUserStore{MemoryUserStore: NewMemoryUserStore()}
+			if err := store.CreateUser(ctx, &User{ID: "user-1", Email: "jane@example.com", Name: "Jane"}, "hash"); err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+			now := time.Now()
+			cache := NewCachedUserStore(store, 10, time.Minute)
+			cache.now = func() time.Time { return now }
+
+			if _, err := cache.GetUserByID(ctx, "user-1"); err != nil {
+				t.Fatalf("GetUserByID() error = %v", err)
+			}
+			tt.between(t, cache, &now)
+			user, err := cache.GetUserByID(ctx, "user-1")
+
+			if store.gets != tt.wantGets {
+				t.Errorf("%d reads reached the store, want %d", store.gets, tt.wantGets)
+			}
+			if tt.wantName == "" {
+				if err == nil {
+					t.Errorf("GetUserByID() of a deleted user = %+v", user)
+				}
+				return
+			}
+			if err != nil || user.Name != tt.wantName {
+				t.Errorf("GetUserByID() = %+v, %v, want name %q", user, err, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestCachedUserStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	store := &countingUserStore{MemoryUserStore: NewMemoryUserStore()}
+	for _, id := range []string{"user-1", "user-2", "user-3"} {
+		if err := store.CreateUser(ctx, &User{ID: id, Email: id + "@example.com"}, "hash"); err != nil {
+			t.Fatalf("CreateUser() error = %v", err)
+		}
+	}
+	cache := NewCachedUserStore(store, 2, time.Minute)
+
+	for _, id := range []string{"user-1", "user-2", "user-1", "user-3"} {
+		if _, err := cache.GetUserByID(ctx, id); err != nil {
+			t.Fatalf("GetUserByID(%s) error = %v", id, err)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", cache.Len())
+	}
+
+	// user-2 was the least recently used
+	store.gets = 0
+	cache.GetUserByID(ctx, "user-1")
+	cache.GetUserByID(ctx, "user-3")
+	if store.gets != 0 {
+		t.Errorf("recently used users were evicted")
+	}
+	cache.GetUserByID(ctx, "user-2")
+	if store.gets != 1 {
+		t.Errorf("the least recently used user was not evicted")
+	}
+}
+
+func TestCachedUserStoreReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryUserStore()
+	if err := store.CreateUser(ctx, &User{ID: "user-1", Email: "jane@example.com", Roles: []string{"viewer"}}, "hash"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	cache := NewCachedUserStore(store, 10, time.Minute)
+
+	user, _ := cache.GetUserByID(ctx, "user-1")
+	user.Roles[0] = "admin"
+	user.Name = "Changed"
+
+	cached, _ := cache.GetUserByID(ctx, "user-1")
+	if cached.Roles[0] != "viewer" || cached.Name != "" {
+		t.Errorf("modifying a returned user changed the cache: %+v", cached)
+	}
+}
+
+// bareUserStore implements only UserStore, none of the optional interfaces
+type bareUserStore struct {
+	UserStore
+}
+
+func TestCachedUserStoreOptionalInterfaces(t *testing.T) {
+	tests := []struct {
+		name         string
+		store        UserStore
+		wantOptional bool
+		wantClaims   bool
+	}{
+		{name: "bare store", store: bareUserStore{NewMemoryUserStore()}},
+		{name: "memory store", store: NewMemoryUserStore(), wantOptional: true},
+		{
+			name:         "claims provider",
+			store:        &orgUserStore{MemoryUserStore: NewMemoryUserStore(), orgClaims: &orgClaims{}},
+			wantOptional: true,
+			wantClaims:   true,
+		},
+		{name: "cached bare store", store: NewCachedUserStore(bareUserStore{NewMemoryUserStore()}, 10, time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewCachedUserStore(tt.store, 10, time.Minute)
+			if _, ok := userStoreAs[PasswordUpdater](cache); ok != tt.wantOptional {
+				t.Errorf("PasswordUpdater available = %v, want %v", ok, tt.wantOptional)
+			}
+			if _, ok := userStoreAs[UserDeleter](cache); ok != tt.wantOptional {
+				t.Errorf("UserDeleter available = %v, want %v", ok, tt.wantOptional)
+			}
+			if _, ok := userStoreAs[ClaimsProvider](cache); ok != tt.wantClaims {
+				t.Errorf("ClaimsProvider available = %v, want %v", ok, tt.wantClaims)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MemoryUserStore is a UserStore keeping users in memory, for development
+// and tests. Emails, including secondary ones, are unique ignoring case.
+type MemoryUserStore struct {
+	mu        sync.RWMutex
+	users     map[string]*User  // by ID
+	emails    map[string]string // lowercased email to user ID
+	passwords map[string]string // by user ID
+}
+
+// NewMemoryUserStore creates an empty in-memory user store
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users:     make(map[string]*User),
+		emails:    make(map[string]string),
+		passwords: make(map[string]string),
+	}
+}
+
+// CreateUser stores a copy of the user, assigning an ID if it has none. It
+// fails with ErrUserExists if one of the user's emails is taken.
+func (s *MemoryUserStore) CreateUser(ctx context.Context, user *User, hashedPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.ID == "" {
+		user.ID = generateRandomString(16)
+	}
+	if _, exists := s.users[user.ID]; exists {
+		return fmt.Errorf("user with ID %s already exists", user.ID)
+	}
+	if err := s.checkEmailsFree(user); err != nil {
+		return err
+	}
+
+	s.users[user.ID] = copyUser(user)
+	s.indexEmails(user)
+	if hashedPassword != "" {
+		s.passwords[user.ID] = hashedPassword
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) GetUserByEmail(ctx context.Context, email string) (*User, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userID, ok := s.emails[strings.ToLower(email)]
+	if !ok {
+		return nil, "", ErrUserNotFound
+	}
+	return copyUser(s.users[userID]), s.passwords[userID], nil
+}
+
+func (s *MemoryUserStore) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return copyUser(user), nil
+}
+
+// UpdateUser replaces the stored user with the same ID. It fails with
+// ErrUserExists if the user's emails now include one of another user's.
+func (s *MemoryUserStore) UpdateUser(ctx context.Context, user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.users[user.ID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if err := s.checkEmailsFree(user); err != nil {
+		return err
+	}
+
+	s.unindexEmails(existing)
+	s.users[user.ID] = copyUser(user)
+	s.indexEmails(user)
+	return nil
+}
+
+func (s *MemoryUserStore) UserExists(ctx context.Context, email string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.emails[strings.ToLower(email)]
+	return exists, nil
+}
+
+// UpdatePassword implements PasswordUpdater
+func (s *MemoryUserStore) UpdatePassword(ctx context.Context, userID, hashedPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return ErrUserNotFound
+	}
+	s.passwords[userID] = hashedPassword
+	return nil
+}
+
+// DeleteUser removes a user and frees their emails
+func (s *MemoryUserStore) DeleteUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	s.unindexEmails(user)
+	delete(s.users, userID)
+	delete(s.passwords, userID)
+	return nil
+}
+
+// Len returns the number of stored users
+func (s *MemoryUserStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users)
+}
+
+// checkEmailsFree reports an error if one of the user's emails belongs to
+// another user
+func (s *MemoryUserStore) checkEmailsFree(user *User) error {
+	for _, email := range userEmails(user) {
+		if owner, ok := s.emails[strings.ToLower(email)]; ok && owner != user.ID {
+			return fmt.Errorf("%w: %s", ErrUserExists, email)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) indexEmails(user *User) {
+	for _, email := range userEmails(user) {
+		s.emails[strings.ToLower(email)] = user.ID
+	}
+}
+
+func (s *MemoryUserStore) unindexEmails(user *User) {
+	for _, email := range userEmails(user) {
+		delete(s.emails, strings.ToLower(email))
+	}
+}
+
+// userEmails returns the user's primary and secondary emails
+func userEmails(user *User) []string {
+	emails := make([]string, 0, 1+len(user.SecondaryEmails))
+	if user.Email != "" {
+		emails = append(emails, user.Email)
+	}
+	return append(emails, user.SecondaryEmails...)
+}
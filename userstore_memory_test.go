@@ -0,0 +1,223 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Compile-time checks for the optional extensions
+var (
+	_ UserStore       = (*MemoryUserStore)(nil)
+	_ PasswordUpdater = (*MemoryUserStore)(nil)
+	_ UserDeleter     = (*MemoryUserStore)(nil)
+)
+
+func TestMemoryUserStoreCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    *User
+		wantErr error
+	}{
+		{name: "new user", user: &User{Email: "john@example.com"}},
+		{name: "duplicate email", user: &User{Email: "jane@example.com"}, wantErr: ErrUserExists},
+		{name: "duplicate email in another case", user: &User{Email: "JANE@Example.com"}, wantErr: ErrUserExists},
+		{name: "email taken as a secondary email", user: &User{Email: "jane@work.example.com"}, wantErr: ErrUserExists},
+		{name: "secondary email taken", user: &User{Email: "john@example.com", SecondaryEmails: []string{"jane@example.com"}}, wantErr: ErrUserExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryUserStore()
+			if err := store.CreateUser(ctx, &User{ID: "jane", Email: "jane@example.com", SecondaryEmails: []string{"jane@work.example.com"}}, "hash-1"); err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+
+			err := store.CreateUser(ctx, tt.user, "hash-2")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateUser() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if store.Len() != 1 {
+					t.Errorf("Len() = %d after a failed create, want 1", store.Len())
+				}
+				return
+			}
+			if tt.user.ID == "" {
+				t.Fatal("CreateUser() did not assign an ID")
+			}
+
+			user, hash, err := store.GetUserByEmail(ctx, tt.user.Email)
+			if err != nil || user.ID != tt.user.ID || hash != "hash-2" {
+				t.Errorf("GetUserByEmail() = %+v, %q, %v", user, hash, err)
+			}
+		})
+	}
+}
+
+func TestMemoryUserStoreLookups(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryUserStore()
+	if err := store.CreateUser(ctx, &User{ID: "jane", Email: "jane@example.com", Name: "Jane"}, "hash-1"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		email      string
+		wantExists bool
+	}{
+		{name: "exact email", email: "jane@example.com", wantExists: true},
+		{name: "other case", email: "Jane@EXAMPLE.com", wantExists: true},
+		{name: "unknown email", email: "john@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exists, err := store.UserExists(ctx, tt.email)
+			if err != nil || exists != tt.wantExists {
+				t.Errorf("UserExists() = %v, %v, want %v", exists, err, tt.wantExists)
+			}
+			_, _, err = store.GetUserByEmail(ctx, tt.email)
+			if tt.wantExists != (err == nil) || (!tt.wantExists && !errors.Is(err, ErrUserNotFound)) {
+				t.Errorf("GetUserByEmail() error = %v, want found %v", err, tt.wantExists)
+			}
+		})
+	}
+
+	if _, err := store.GetUserByID(ctx, "john"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByID() of a missing user error = %v, want ErrUserNotFound", err)
+	}
+
+	// Returned users are copies the caller cannot change the store through
+	user, err := store.GetUserByID(ctx, "jane")
+	if err != nil {
+		t.Fatalf("GetUserByID() error = %v", err)
+	}
+	user.Name = "Changed"
+	if stored, _ := store.GetUserByID(ctx, "jane"); stored.Name != "Jane" {
+		t.Errorf("stored name = %q after changing a returned user", stored.Name)
+	}
+}
+
+func TestMemoryUserStoreUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		update    User
+		wantErr   error
+		wantEmail string
+		freed     string
+	}{
+		{name: "change name", update: User{ID: "jane", Email: "jane@example.com", Name: "Jane Doe"}, wantEmail: "jane@example.com"},
+		{name: "change email", update: User{ID: "jane", Email: "jane@example.org"}, wantEmail: "jane@example.org", freed: "jane@example.com"},
+		{name: "take another user's email", update: User{ID: "jane", Email: "john@example.com"}, wantErr: ErrUserExists, wantEmail: "jane@example.com"},
+		{name: "unknown user", update: User{ID: "nobody", Email: "nobody@example.com"}, wantErr: ErrUserNotFound, wantEmail: "jane@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryUserStore()
+			for _, user := range []*User{{ID: "jane", Email: "jane@example.com"}, {ID: "john", Email: "john@example.com"}} {
+				if err := store.CreateUser(ctx, user, "hash"); err != nil {
+					t.Fatalf("CreateUser() error = %v", err)
+				}
+			}
+
+			update := tt.update
+			if err := store.UpdateUser(ctx, &update); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateUser() error = %v, want %v", err, tt.wantErr)
+			}
+
+			user, _, err := store.GetUserByEmail(ctx, tt.wantEmail)
+			if err != nil || user.ID != "jane" {
+				t.Errorf("GetUserByEmail(%q) = %+v, %v", tt.wantEmail, user, err)
+			}
+			if tt.freed != "" {
+				if exists, _ := store.UserExists(ctx, tt.freed); exists {
+					t.Errorf("old email %q is still taken", tt.freed)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryUserStorePasswordAndDelete(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryUserStore()
+	if err := store.CreateUser(ctx, &User{ID: "jane", Email: "jane@example.com"}, "hash-1"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	if err := store.UpdatePassword(ctx, "jane", "hash-2"); err != nil {
+		t.Fatalf("UpdatePassword() error = %v", err)
+	}
+	if _, hash, _ := store.GetUserByEmail(ctx, "jane@example.com"); hash != "hash-2" {
+		t.Errorf("hash = %q after UpdatePassword, want hash-2", hash)
+	}
+	if err := store.UpdatePassword(ctx, "john", "hash"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("UpdatePassword() of a missing user error = %v, want ErrUserNotFound", err)
+	}
+
+	if err := store.DeleteUser(ctx, "jane"); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	if err := store.DeleteUser(ctx, "jane"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("second DeleteUser() error = %v, want ErrUserNotFound", err)
+	}
+	if exists, _ := store.UserExists(ctx, "jane@example.com"); exists || store.Len() != 0 {
+		t.Errorf("UserExists() = %v, Len() = %d after delete", exists, store.Len())
+	}
+
+	// The email is free to register again
+	if err := store.CreateUser(ctx, &User{Email: "jane@example.com"}, "hash-3"); err != nil {
+		t.Errorf("CreateUser() with a freed email error = %v", err)
+	}
+}
+
+func TestMemoryUserStoreConcurrent(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryUserStore()
+
+	// Many goroutines race to register the same emails; each is created
+	// exactly once. Run with -race to check the locking.
+	const emails, attempts = 10, 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := make(map[string]int)
+	for i := 0; i < emails; i++ {
+		for j := 0; j < attempts; j++ {
+			wg.Add(1)
+			go func(email string) {
+				defer wg.Done()
+				err := store.CreateUser(ctx, &User{Email: email}, "hash")
+				if err == nil {
+					mu.Lock()
+					created[email]++
+					mu.Unlock()
+				} else if !errors.Is(err, ErrUserExists) {
+					t.Errorf("CreateUser() error = %v", err)
+				}
+
+				if user, _, err := store.GetUserByEmail(ctx, email); err == nil {
+					user.Name = "racer"
+					_ = store.UpdateUser(ctx, user)
+				}
+				_, _ = store.UserExists(ctx, email)
+			}(fmt.Sprintf("user%d@example.com", i))
+		}
+	}
+	wg.Wait()
+
+	if store.Len() != emails || len(created) != emails {
+		t.Fatalf("Len() = %d, created %d emails, want %d", store.Len(), len(created), emails)
+	}
+	for email, n := range created {
+		if n != 1 {
+			t.Errorf("%s created %d times", email, n)
+		}
+	}
+}
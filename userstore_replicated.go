@@ -0,0 +1,172 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicatedUserStore sends writes to a primary UserStore and spreads reads
+// across read replicas round-robin. Reads for a user written through this
+// store within the read-your-writes window go to the primary, so callers see
+// their own changes despite replication lag. PasswordUpdater, UserDeleter
+// and ClaimsProvider pass through to the primary and are used only if it
+// implements them.
+type ReplicatedUserStore struct {
+	primary        UserStore
+	replicas       []UserStore
+	readYourWrites time.Duration
+	next           uint64
+
+	mu     sync.Mutex
+	recent map[string]time.Time // "id:" and "email:" keys to the end of their window
+	now    func() time.Time
+}
+
+// recentWritesSweepSize is the number of tracked writes above which expired
+// ones are swept on the next write
+const recentWritesSweepSize = 1024
+
+// NewReplicatedUserStore routes reads to replicas, or to the primary when
+// there are none. A readYourWrites of 0 always reads from replicas.
+func NewReplicatedUserStore(primary UserStore, replicas []UserStore, readYourWrites time.Duration) *ReplicatedUserStore {
+	return &ReplicatedUserStore{
+		primary:        primary,
+		replicas:       replicas,
+		readYourWrites: readYourWrites,
+		recent:         make(map[string]time.Time),
+		now:            time.Now,
+	}
+}
+
+func (s *ReplicatedUserStore) CreateUser(ctx context.Context, user *User, hashedPassword string) error {
+	err := s.primary.CreateUser(ctx, user, hashedPassword)
+	if err == nil {
+		s.wrote(user.ID, userEmails(user)...)
+	}
+	return err
+}
+
+func (s *ReplicatedUserStore) UpdateUser(ctx context.Context, user *User) error {
+	err := s.primary.UpdateUser(ctx, user)
+	s.wrote(user.ID, userEmails(user)...)
+	return err
+}
+
+// UpdatePassword passes through to the primary if it implements
+// PasswordUpdater
+func (s *ReplicatedUserStore) UpdatePassword(ctx context.Context, userID, hashedPassword string) error {
+	updater, ok := s.primary.(PasswordUpdater)
+	if !ok {
+		return fmt.Errorf("user store does not support updating passwords")
+	}
+	err := updater.UpdatePassword(ctx, userID, hashedPassword)
+	s.wroteUserID(ctx, userID)
+	return err
+}
+
+// DeleteUser passes through to the primary if it implements UserDeleter
+func (s *ReplicatedUserStore) DeleteUser(ctx context.Context, userID string) error {
+	deleter, ok := s.primary.(UserDeleter)
+	if !ok {
+		return fmt.Errorf("user store does not support deleting users")
+	}
+	s.wroteUserID(ctx, userID)
+	return deleter.DeleteUser(ctx, userID)
+}
+
+// Claims passes through to the primary if it implements ClaimsProvider
+func (s *ReplicatedUserStore) Claims(ctx context.Context, userID string) (map[string]interface{}, error) {
+	provider, ok := s.primary.(ClaimsProvider)
+	if !ok {
+		return nil, nil
+	}
+	return provider.Claims(ctx, userID)
+}
+
+func (s *ReplicatedUserStore) wrappedUserStore() UserStore {
+	return s.primary
+}
+
+func (s *ReplicatedUserStore) GetUserByEmail(ctx context.Context, email string) (*User, string, error) {
+	return s.reader("email:"+strings.ToLower(email)).GetUserByEmail(ctx, email)
+}
+
+func (s *ReplicatedUserStore) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	return s.reader("id:"+userID).GetUserByID(ctx, userID)
+}
+
+func (s *ReplicatedUserStore) UserExists(ctx context.Context, email string) (bool, error) {
+	return s.reader("email:"+strings.ToLower(email)).UserExists(ctx, email)
+}
+
+// reader returns the store to read the key from
+func (s *ReplicatedUserStore) reader(key string) UserStore {
+	if len(s.replicas) == 0 || s.recentlyWritten(key) {
+		return s.primary
+	}
+	i := atomic.AddUint64(&s.next, 1) - 1
+	return s.replicas[i%uint64(len(s.replicas))]
+}
+
+func (s *ReplicatedUserStore) recentlyWritten(key string) bool {
+	if s.readYourWrites <= 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.recent[key]
+	if !ok {
+		return false
+	}
+	if s.now().After(until) {
+		delete(s.recent, key)
+		return false
+	}
+	return true
+}
+
+// wroteUserID records a write to a user known only by ID, looking up their
+// emails on the primary so reads by email see it too
+func (s *ReplicatedUserStore) wroteUserID(ctx context.Context, userID string) {
+	if s.readYourWrites <= 0 {
+		return
+	}
+	var emails []string
+	if user, err := s.primary.GetUserByID(ctx, userID); err == nil {
+		emails = userEmails(user)
+	}
+	s.wrote(userID, emails...)
+}
+
+// wrote starts the read-your-writes window of a user
+func (s *ReplicatedUserStore) wrote(userID string, emails ...string) {
+	if s.readYourWrites <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if len(s.recent) > recentWritesSweepSize {
+		for key, until := range s.recent {
+			if now.After(until) {
+				delete(s.recent, key)
+			}
+		}
+	}
+
+	until := now.Add(s.readYourWrites)
+	if userID != "" {
+		s.recent["id:"+userID] = until
+	}
+	for _, email := range emails {
+		s.recent["email:"+strings.ToLower(email)] = until
+	}
+}
@@ -0,0 +1,242 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// recordingUserStore counts the calls reaching an in-memory user store
+type recordingUserStore struct {
+	*MemoryUserStore
+	calls map[string]int
+}
+
+func newRecordingUserStore() *recordingUserStore {
+	return &recordingUserStore{MemoryUserStore: NewMemoryUserStore(), calls: make(map[string]int)}
+}
+
+func (s *recordingUserStore) CreateUser(ctx context.Context, user *User, hashedPassword string) error {
+	s.calls["CreateUser"]++
+	return s.MemoryUserStore.CreateUser(ctx, user, hashedPassword)
+}
+
+func (s *recordingUserStore) GetUserByEmail(ctx context.Context, email string) (*User, string, error) {
+	s.calls["GetUserByEmail"]++
+	return s.MemoryUserStore.GetUserByEmail(ctx, email)
+}
+
+func (s *recordingUserStore) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	s.calls["GetUserByID"]++
+	return s.MemoryUserStore.GetUserByID(ctx, userID)
+}
+
+func (s *recordingUserStore) UpdateUser(ctx context.Context, user *User) error {
+	s.calls["UpdateUser"]++
+	return s.MemoryUserStore.UpdateUser(ctx, user)
+}
+
+func (s *recordingUserStore) UserExists(ctx context.Context, email string) (bool, error) {
+	s.calls["UserExists"]++
+	return s.MemoryUserStore.UserExists(ctx, email)
+}
+
+func (s *recordingUserStore) UpdatePassword(ctx context.Context, userID, hashedPassword string) error {
+	s.calls["UpdatePassword"]++
+	return s.MemoryUserStore.UpdatePassword(ctx, userID, hashedPassword)
+}
+
+func (s *recordingUserStore) DeleteUser(ctx context.Context, userID string) error {
+	s.calls["DeleteUser"]++
+	return s.MemoryUserStore.DeleteUser(ctx, userID)
+}
+
+// reads returns the number of read calls the store received
+func (s *recordingUserStore) reads() int {
+	return s.calls["GetUserByEmail"] + s.calls["GetUserByID"] + s.calls["UserExists"]
+}
+
+var _ UserStore = (*ReplicatedUserStore)(nil)
+
+func TestReplicatedUserStoreWrites(t *testing.T) {
+	ctx := context.Background()
+	primary := newRecordingUserStore()
+	replicas := []*recordingUserStore{newRecordingUserStore(), newRecordingUserStore()}
+	store := NewReplicatedUserStore(primary, []UserStore{replicas[0], replicas[1]}, 0)
+
+	user := &User{ID: "jane", Email: "jane@example.com"}
+	if err := store.CreateUser(ctx, user, "hash-1"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	user.Name = "Jane"
+	if err := store.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if err := store.UpdatePassword(ctx, "jane", "hash-2"); err != nil {
+		t.Fatalf("UpdatePassword() error = %v", err)
+	}
+	if err := store.DeleteUser(ctx, "jane"); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+
+	for _, method := range []string{"CreateUser", "UpdateUser", "UpdatePassword", "DeleteUser"} {
+		if primary.calls[method] != 1 {
+			t.Errorf("primary %s calls = %d, want 1", method, primary.calls[method])
+		}
+		for i, replica := range replicas {
+			if replica.calls[method] != 0 {
+				t.Errorf("replica %d received %d %s calls", i, replica.calls[method], method)
+			}
+		}
+	}
+}
+
+func TestReplicatedUserStoreReads(t *testing.T) {
+	tests := []struct {
+		name         string
+		replicas     int
+		wantPrimary  int
+		wantReplicas []int
+	}{
+		{name: "round robin", replicas: 3, wantReplicas: []int{2, 2, 2}},
+		{name: "uneven", replicas: 4, wantReplicas: []int{2, 2, 1, 1}},
+		{name: "no replicas", wantPrimary: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			primary := newRecordingUserStore()
+			var replicas []*recordingUserStore
+			var stores []UserStore
+			for i := 0; i < tt.replicas; i++ {
+				replica := newRecordingUserStore()
+				replicas = append(replicas, replica)
+				stores = append(stores, replica)
+			}
+			store := NewReplicatedUserStore(primary, stores, time.Minute)
+
+			for i := 0; i < 2; i++ {
+				store.GetUserByEmail(ctx, "jane@example.com")
+				store.GetUserByID(ctx, "jane")
+				store.UserExists(ctx, "jane@example.com")
+			}
+
+			if primary.reads() != tt.wantPrimary {
+				t.Errorf("primary reads = %d, want %d", primary.reads(), tt.wantPrimary)
+			}
+			for i, replica := range replicas {
+				if replica.reads() != tt.wantReplicas[i] {
+					t.Errorf("replica %d reads = %d, want %d", i, replica.reads(), tt.wantReplicas[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReplicatedUserStoreReadYourWrites(t *testing.T) {
+	const window = 5 * time.Second
+
+	tests := []struct {
+		name           string
+		readYourWrites time.Duration
+		write          func(t *testing.T, store *ReplicatedUserStore)
+		advance        time.Duration
+		wantPrimary    bool
+	}{
+		{name: "create within the window", readYourWrites: window, write: createJane, wantPrimary: true},
+		{name: "create after the window", readYourWrites: window, write: createJane, advance: window + time.Second},
+		{name: "window disabled", write: createJane},
+		{
+			name:           "password update within the window",
+			readYourWrites: window,
+			write: func(t *testing.T, store *ReplicatedUserStore) {
+				// Written directly to the primary, outside the tracked window
+				if err := store.primary.CreateUser(context.Background(), &User{ID: "jane", Email: "jane@example.com"}, "hash-1"); err != nil {
+					t.Fatalf("CreateUser() error = %v", err)
+				}
+				if err := store.UpdatePassword(context.Background(), "jane", "hash-2"); err != nil {
+					t.Fatalf("UpdatePassword() error = %v", err)
+				}
+			},
+			wantPrimary: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			// The replica lags behind and has none of the primary's writes
+			primary, replica := newRecordingUserStore(), newRecordingUserStore()
+			store := NewReplicatedUserStore(primary, []UserStore{replica}, tt.readYourWrites)
+			now := time.Now()
+			store.now = func() time.Time { return now }
+
+			tt.write(t, store)
+			now = now.Add(tt.advance)
+
+			_, errByID := store.GetUserByID(ctx, "jane")
+			_, _, errByEmail := store.GetUserByEmail(ctx, "JANE@example.com")
+			exists, _ := store.UserExists(ctx, "jane@example.com")
+
+			for _, err := range []error{errByID, errByEmail} {
+				if tt.wantPrimary && err != nil {
+					t.Errorf("read within the window error = %v, want the primary's user", err)
+				}
+				if !tt.wantPrimary && !errors.Is(err, ErrUserNotFound) {
+					t.Errorf("read error = %v, want the lagging replica's ErrUserNotFound", err)
+				}
+			}
+			if exists != tt.wantPrimary {
+				t.Errorf("UserExists() = %v, want %v", exists, tt.wantPrimary)
+			}
+			if got := replica.reads() == 0; got != tt.wantPrimary {
+				t.Errorf("replica reads = %d, want reads from the primary %v", replica.reads(), tt.wantPrimary)
+			}
+		})
+	}
+}
+
+// createJane creates a user through the replicated store
+func createJane(t *testing.T, store *ReplicatedUserStore) {
+	t.Helper()
+
+	if err := store.CreateUser(context.Background(), &User{ID: "jane", Email: "jane@example.com"}, "hash-1"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+}
+
+func TestReplicatedUserStoreOptionalInterfaces(t *testing.T) {
+	tests := []struct {
+		name         string
+		primary      UserStore
+		wantOptional bool
+		wantClaims   bool
+	}{
+		{name: "bare primary", primary: bareUserStore{NewMemoryUserStore()}},
+		{name: "memory primary", primary: NewMemoryUserStore(), wantOptional: true},
+		{
+			name:         "claims provider primary",
+			primary:      &orgUserStore{MemoryUserStore: NewMemoryUserStore(), orgClaims: &orgClaims{}},
+			wantOptional: true,
+			wantClaims:   true,
+		},
+		{name: "cached bare primary", primary: NewCachedUserStore(bareUserStore{NewMemoryUserStore()}, 10, time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewReplicatedUserStore(tt.primary, []UserStore{NewMemoryUserStore()}, 0)
+			if _, ok := userStoreAs[PasswordUpdater](store); ok != tt.wantOptional {
+				t.Errorf("PasswordUpdater available = %v, want %v", ok, tt.wantOptional)
+			}
+			if _, ok := userStoreAs[UserDeleter](store); ok != tt.wantOptional {
+				t.Errorf("UserDeleter available = %v, want %v", ok, tt.wantOptional)
+			}
+			if _, ok := userStoreAs[ClaimsProvider](store); ok != tt.wantClaims {
+				t.Errorf("ClaimsProvider available = %v, want %v", ok, tt.wantClaims)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package gotrust
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// validationCache caches the store lookups made while validating access
+// tokens (session existence and token versions) for a short TTL. Reads do
+// not take a lock. Changes made by this process are applied immediately;
+// changes made by other instances take effect once entries expire.
+type validationCache struct {
+	ttl     time.Duration
+	entries sync.Map // key -> *validationEntry
+	stores  uint64
+	now     func() time.Time
+}
+
+type validationEntry struct {
+	userID    string
+	version   int64
+	exists    bool
+	expiresAt time.Time
+}
+
+// validationCacheSweepInterval is the number of stores between sweeps of
+// expired entries
+const validationCacheSweepInterval = 1024
+
+func newValidationCache(ttl time.Duration) *validationCache {
+	return &validationCache{ttl: ttl, now: time.Now}
+}
+
+func (c *validationCache) get(key string) (*validationEntry, bool) {
+	value, ok := c.entries.Load(key)
+	if !ok {
+		return nil, false
+	}
+	entry := value.(*validationEntry)
+	if c.now().After(entry.expiresAt) {
+		c.entries.Delete(key)
+		return nil, false
+	}
+	return entry, true
+}
+
+func (c *validationCache) put(key string, entry *validationEntry) {
+	now := c.now()
+	entry.expiresAt = now.Add(c.ttl)
+	c.entries.Store(key, entry)
+
+	if atomic.AddUint64(&c.stores, 1)%validationCacheSweepInterval == 0 {
+		c.entries.Range(func(key, value interface{}) bool {
+			if now.After(value.(*validationEntry).expiresAt) {
+				c.entries.Delete(key)
+			}
+			return true
+		})
+	}
+}
+
+// forgetUser drops the cached token version and sessions of a user
+func (c *validationCache) forgetUser(userID string) {
+	c.entries.Delete(tokenVersionKey(userID))
+	c.entries.Range(func(key, value interface{}) bool {
+		if value.(*validationEntry).userID == userID {
+			c.entries.Delete(key)
+		}
+		return true
+	})
+}
+
+// sessionCacheKey is the cache key of a session's existence
+func sessionCacheKey(sessionID string) string {
+	return "session:" + sessionID
+}
+
+// sessionActive reports whether a token's session still exists, caching the
+// answer, including a missing session, when the cache is enabled
+func (a *AuthService) sessionActive(ctx context.Context, claims *TokenClaims) bool {
+	key := sessionCacheKey(claims.SessionID)
+	if a.validationCache != nil {
+		if entry, ok := a.validationCache.get(key); ok {
+			return entry.exists
+		}
+	}
+
+	_, err := a.sessionManager.GetSession(ctx, claims.SessionID)
+	if a.validationCache != nil {
+		a.validationCache.put(key, &validationEntry{userID: claims.UserID, exists: err == nil})
+	}
+	return err == nil
+}
+
+// currentTokenVersion returns a user's token version through the cache, when
+// enabled
+func (a *AuthService) currentTokenVersion(ctx context.Context, userID string) (int64, error) {
+	key := tokenVersionKey(userID)
+	if a.validationCache != nil {
+		if entry, ok := a.validationCache.get(key); ok {
+			return entry.version, nil
+		}
+	}
+
+	version, err := a.TokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if a.validationCache != nil {
+		a.validationCache.put(key, &validationEntry{userID: userID, version: version})
+	}
+	return version, nil
+}
+
+// forgetSession drops a session from the validation cache
+func (a *AuthService) forgetSession(sessionID string) {
+	if a.validationCache != nil {
+		a.validationCache.entries.Delete(sessionCacheKey(sessionID))
+	}
+}
+
+// forgetUser drops a user's entries from the validation cache
+func (a *AuthService) forgetUser(userID string) {
+	if a.validationCache != nil {
+		a.validationCache.forgetUser(userID)
+	}
+}
@@ -0,0 +1,206 @@
+package gotrust
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingSessionStore counts the reads reaching a session store
+type countingSessionStore struct {
+	*MemorySessionStore
+	reads atomic.Int64
+}
+
+func (s *countingSessionStore) Get(ctx context.Context, key string, dest interface{}) error {
+	s.reads.Add(1)
+	return s.MemorySessionStore.Get(ctx, key, dest)
+}
+
+func (s *countingSessionStore) Exists(ctx context.Context, keys ...string) (bool, error) {
+	s.reads.Add(1)
+	return s.MemorySessionStore.Exists(ctx, keys...)
+}
+
+// newValidationCacheServices creates two AuthServices sharing stores, like
+// two instances of an app, with session binding and token versioning on
+func newValidationCacheServices(t testing.TB, ttl time.Duration) (*AuthService, *AuthService, *countingSessionStore) {
+	t.Helper()
+
+	config := newTestConfig()
+	config.BindTokenToSession = true
+	config.EnableTokenVersioning = true
+	config.ValidationCacheTTL = ttl
+	users := NewMemoryUserStore()
+	sessions := &countingSessionStore{MemorySessionStore: NewMemorySessionStore()}
+	t.Cleanup(func() { sessions.Close() })
+	return NewAuthService(config, users, sessions), NewAuthService(config, users, sessions), sessions
+}
+
+func TestValidationCacheStoreReads(t *testing.T) {
+	const validations = 10
+
+	tests := []struct {
+		name         string
+		ttl          time.Duration
+		wantMinReads int64
+		wantMaxReads int64
+	}{
+		{name: "cache disabled", wantMinReads: validations, wantMaxReads: 3 * validations},
+		{name: "cache enabled", ttl: time.Minute, wantMaxReads: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, sessions := newValidationCacheServices(t, tt.ttl)
+			ctx := context.Background()
+			token := signUp(t, a, "jane@example.com").AccessToken
+
+			sessions.reads.Store(0)
+			for i := 0; i < validations; i++ {
+				if _, err := a.ValidateTokenContext(ctx, token); err != nil {
+					t.Fatalf("ValidateTokenContext() error = %v", err)
+				}
+			}
+
+			reads := sessions.reads.Load()
+			if reads < tt.wantMinReads || reads > tt.wantMaxReads {
+				t.Errorf("store reads = %d, want between %d and %d", reads, tt.wantMinReads, tt.wantMaxReads)
+			}
+		})
+	}
+}
+
+func TestValidationCacheRevocation(t *testing.T) {
+	const ttl = 5 * time.Second
+
+	tests := []struct {
+		name string
+		// revoke revokes the token's session or version through service
+		revoke     func(t *testing.T, service *AuthService, response *AuthResponse)
+		otherNode  bool
+		wantCached bool
+	}{
+		{
+			name: "logout on this instance",
+			revoke: func(t *testing.T, service *AuthService, response *AuthResponse) {
+				if err := service.Logout(context.Background(), response.SessionID); err != nil {
+					t.Fatalf("Logout() error = %v", err)
+				}
+			},
+		},
+		{
+			name: "logout on another instance",
+			revoke: func(t *testing.T, service *AuthService, response *AuthResponse) {
+				if err := service.Logout(context.Background(), response.SessionID); err != nil {
+					t.Fatalf("Logout() error = %v", err)
+				}
+			},
+			otherNode:  true,
+			wantCached: true,
+		},
+		{
+			name: "token version bump on this instance",
+			revoke: func(t *testing.T, service *AuthService, response *AuthResponse) {
+				if _, err := service.IncrementTokenVersion(context.Background(), response.User.ID); err != nil {
+					t.Fatalf("IncrementTokenVersion() error = %v", err)
+				}
+			},
+		},
+		{
+			name: "token version bump on another instance",
+			revoke: func(t *testing.T, service *AuthService, response *AuthResponse) {
+				if _, err := service.IncrementTokenVersion(context.Background(), response.User.ID); err != nil {
+					t.Fatalf("IncrementTokenVersion() error = %v", err)
+				}
+			},
+			otherNode:  true,
+			wantCached: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, other, _ := newValidationCacheServices(t, ttl)
+			ctx := context.Background()
+			now := time.Now()
+			a.validationCache.now = func() time.Time { return now }
+			response := signUp(t, a, "jane@example.com")
+
+			if _, err := a.ValidateTokenContext(ctx, response.AccessToken); err != nil {
+				t.Fatalf("ValidateTokenContext() error = %v", err)
+			}
+			revoker := a
+			if tt.otherNode {
+				revoker = other
+			}
+			tt.revoke(t, revoker, response)
+
+			// Other instances may serve the cached answer until it expires
+			_, err := a.ValidateTokenContext(ctx, response.AccessToken)
+			if accepted := err == nil; accepted != tt.wantCached {
+				t.Errorf("ValidateTokenContext() right after revocation accepted = %v, want %v", accepted, tt.wantCached)
+			}
+
+			now = now.Add(ttl + time.Second)
+			if _, err := a.ValidateTokenContext(ctx, response.AccessToken); err == nil {
+				t.Errorf("ValidateTokenContext() accepted a revoked token after the TTL")
+			}
+		})
+	}
+}
+
+func TestValidationCacheNegative(t *testing.T) {
+	a, _, sessions := newValidationCacheServices(t, time.Minute)
+	ctx := context.Background()
+	response := signUp(t, a, "jane@example.com")
+	if err := a.Logout(ctx, response.SessionID); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+
+	// A missing session is cached too, so replayed revoked tokens do not
+	// reach the store each time
+	sessions.reads.Store(0)
+	for i := 0; i < 5; i++ {
+		if _, err := a.ValidateTokenContext(ctx, response.AccessToken); err == nil {
+			t.Fatalf("ValidateTokenContext() accepted a token of an ended session")
+		}
+	}
+	if reads := sessions.reads.Load(); reads > 3 {
+		t.Errorf("store reads = %d for a cached missing session", reads)
+	}
+}
+
+func BenchmarkValidateToken(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{name: "uncached"},
+		{name: "cached", ttl: 5 * time.Second},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			a, _, sessions := newValidationCacheServices(b, bm.ttl)
+			ctx := context.Background()
+			response, err := a.SignUp(ctx, &SignUpRequest{Email: "jane@example.com", Password: testPassword})
+			if err != nil {
+				b.Fatalf("SignUp() error = %v", err)
+			}
+
+			sessions.reads.Store(0)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := a.ValidateTokenContext(ctx, response.AccessToken); err != nil {
+						b.Errorf("ValidateTokenContext() error = %v", err)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(sessions.reads.Load())/float64(b.N), "store-reads/op")
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package gotrust
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// VerificationSender delivers email verification tokens, typically as a link
+// to a frontend page that posts the token to /auth/verify-email
+type VerificationSender interface {
+	SendVerification(ctx context.Context, user *User, token string) error
+}
+
+// emailVerification is a pending email verification
+type emailVerification struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+const verificationPrefix = "verify"
+
+// Email verification modes for Config.EmailVerificationMode
+const (
+	EmailVerificationBlock = "block"
+	EmailVerificationGrace = "grace"
+	EmailVerificationSoft  = "soft"
+)
+
+// emailVerificationMode returns the configured mode, "" when disabled
+func (c *Config) emailVerificationMode() string {
+	switch c.EmailVerificationMode {
+	case EmailVerificationBlock, EmailVerificationGrace, EmailVerificationSoft:
+		return c.EmailVerificationMode
+	}
+	if c.RequireEmailVerification {
+		return EmailVerificationBlock
+	}
+	return ""
+}
+
+// checkEmailVerification applies Config.EmailVerificationMode to a sign-in,
+// returning the email_verified claim and, in grace mode, the deadline to
+// verify by. Guests and users without an email are exempt.
+func (a *AuthService) checkEmailVerification(user *User) (*bool, time.Time, error) {
+	mode := a.config.emailVerificationMode()
+	if mode == "" || user.IsGuest || user.Email == "" {
+		return nil, time.Time{}, nil
+	}
+
+	verified := user.EmailVerified
+	if verified {
+		return &verified, time.Time{}, nil
+	}
+
+	switch mode {
+	case EmailVerificationBlock:
+		return nil, time.Time{}, ErrEmailNotVerified
+	case EmailVerificationGrace:
+		deadline := user.CreatedAt.Add(a.config.EmailVerificationGracePeriod)
+		if time.Now().After(deadline) {
+			return nil, time.Time{}, fmt.Errorf("%w: the verification grace period has ended", ErrEmailNotVerified)
+		}
+		return &verified, deadline, nil
+	}
+	return &verified, time.Time{}, nil
+}
+
+// SendVerification issues a fresh verification token for the user's email
+// and delivers it with Config.VerificationSender
+func (a *AuthService) SendVerification(ctx context.Context, user *User) error {
+	sender := a.config.VerificationSender
+	if sender == nil {
+		return fmt.Errorf("email verification is not configured")
+	}
+
+	expiration := a.config.VerificationTokenExpiration
+	verification := &emailVerification{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(expiration),
+	}
+
+	token := generateRandomString(32)
+	key := fmt.Sprintf("%s:%s", verificationPrefix, token)
+	if err := a.sessionStore.Set(ctx, key, verification, expiration); err != nil {
+		return fmt.Errorf("failed to store verification token: %w", err)
+	}
+
+	if err := sender.SendVerification(ctx, user, token); err != nil {
+		a.sessionStore.Delete(ctx, key)
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyEmail marks the email a verification token was issued for as verified
+func (a *AuthService) VerifyEmail(ctx context.Context, token string) (*User, error) {
+	key := fmt.Sprintf("%s:%s", verificationPrefix, token)
+
+	// Tokens are single use
+	var verification emailVerification
+	if err := consumeKey(ctx, a.sessionStore, key, &verification); err != nil {
+		return nil, fmt.Errorf("verification token not found or expired")
+	}
+
+	if time.Now().After(verification.ExpiresAt) {
+		return nil, fmt.Errorf("verification token expired")
+	}
+
+	user, err := a.userStore.GetUserByID(ctx, verification.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	// The token only verifies the address it was sent to
+	if user.Email != verification.Email {
+		return nil, fmt.Errorf("verification token does not match the current email")
+	}
+
+	if !user.EmailVerified {
+		user.EmailVerified = true
+		user.UpdatedAt = time.Now()
+		if err := a.userStore.UpdateUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to verify email: %w", err)
+		}
+	}
+
+	return user, nil
+}
+
+// ResendVerification sends a new verification token to an existing,
+// unverified user. Sends are limited to one per
+// Config.VerificationResendInterval per user. To avoid revealing which emails
+// are registered, unknown, already verified and rate-limited emails are
+// silently ignored.
+func (a *AuthService) ResendVerification(ctx context.Context, email string) error {
+	user, _, err := a.userStore.GetUserByEmail(ctx, email)
+	if err != nil || user.EmailVerified {
+		return nil
+	}
+
+	allowed, err := a.allowVerificationResend(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return nil
+	}
+
+	return a.SendVerification(ctx, user)
+}
+
+// allowVerificationResend enforces the resend interval for a user
+func (a *AuthService) allowVerificationResend(ctx context.Context, userID string) (bool, error) {
+	interval := a.config.VerificationResendInterval
+	if interval <= 0 {
+		return true, nil
+	}
+
+	key := fmt.Sprintf("%s:resend:%s", verificationPrefix, userID)
+	if atomicStore, ok := a.sessionStore.(AtomicSessionStore); ok {
+		acquired, err := atomicStore.SetNX(ctx, key, true, interval)
+		if err != nil {
+			return false, fmt.Errorf("failed to check verification rate limit: %w", err)
+		}
+		return acquired, nil
+	}
+
+	exists, err := a.sessionStore.Exists(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to check verification rate limit: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+	if err := a.sessionStore.Set(ctx, key, true, interval); err != nil {
+		return false, fmt.Errorf("failed to check verification rate limit: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,262 @@
+package gotrust
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSender records the verification tokens it is asked to send
+type recordingSender struct {
+	mu     sync.Mutex
+	tokens map[string][]string // by email
+}
+
+func (s *recordingSender) SendVerification(ctx context.Context, user *User, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokens == nil {
+		s.tokens = make(map[string][]string)
+	}
+	s.tokens[user.Email] = append(s.tokens[user.Email], token)
+	return nil
+}
+
+func (s *recordingSender) sent(email string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[email]
+}
+
+func TestVerifyEmail(t *testing.T) {
+	sender := &recordingSender{}
+	a, _, _ := newTestService(t, func(c *Config) { c.VerificationSender = sender })
+	signUp(t, a, "jane@example.com")
+
+	tokens := sender.sent("jane@example.com")
+	if len(tokens) != 1 {
+		t.Fatalf("sign-up sent %d verification emails, want 1", len(tokens))
+	}
+
+	user, err := a.VerifyEmail(context.Background(), tokens[0])
+	if err != nil {
+		t.Fatalf("VerifyEmail() error = %v", err)
+	}
+	if !user.EmailVerified {
+		t.Errorf("VerifyEmail() did not mark the email verified")
+	}
+	if _, err := a.VerifyEmail(context.Background(), tokens[0]); err == nil {
+		t.Errorf("VerifyEmail() accepted a used token")
+	}
+}
+
+func TestResendVerificationHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		verified bool
+		interval time.Duration
+		resends  int
+		wantSent int // including the email sent on sign-up
+	}{
+		{name: "unverified user", email: "jane@example.com", resends: 1, wantSent: 2},
+		{name: "rate limited", email: "jane@example.com", interval: time.Minute, resends: 3, wantSent: 2},
+		{name: "already verified", email: "jane@example.com", verified: true, resends: 1, wantSent: 1},
+		{name: "nonexistent email", email: "nobody@example.com", resends: 1},
+	}
+
+	// Every outcome reads the same, so responses do not reveal which emails
+	// are registered
+	var firstMessage string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &recordingSender{}
+			h, a := newTestHandlers(t, func(c *Config) {
+				c.VerificationSender = sender
+				c.VerificationResendInterval = tt.interval
+			})
+			signUp(t, a, "jane@example.com")
+			if tt.verified {
+				if _, err := a.VerifyEmail(context.Background(), sender.sent("jane@example.com")[0]); err != nil {
+					t.Fatalf("VerifyEmail() error = %v", err)
+				}
+			}
+
+			for i := 0; i < tt.resends; i++ {
+				ctx := newTestContext(http.MethodPost, "/auth/resend-verification", `{"email": "`+tt.email+`"}`)
+				serve(t, ctx, h.ResendVerificationHandler)
+				if ctx.status() != http.StatusOK {
+					t.Fatalf("status = %d, want %d", ctx.status(), http.StatusOK)
+				}
+				message, _ := ctx.body(t)["message"].(string)
+				if firstMessage == "" {
+					firstMessage = message
+				} else if message != firstMessage {
+					t.Errorf("message = %q, want %q", message, firstMessage)
+				}
+			}
+
+			if sent := len(sender.sent(tt.email)); sent != tt.wantSent {
+				t.Errorf("%d verification emails sent, want %d", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestVerifyEmailConcurrent(t *testing.T) {
+	sender := &recordingSender{}
+	a, _, _ := newTestService(t, func(c *Config) { c.VerificationSender = sender })
+	signUp(t, a, "jane@example.com")
+	token := sender.sent("jane@example.com")[0]
+
+	// Two clicks on the same link race to redeem it
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	start := make(chan struct{})
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, errs[i] = a.VerifyEmail(context.Background(), token)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if (errs[0] == nil) == (errs[1] == nil) {
+		t.Errorf("VerifyEmail() errors = %v, want exactly one redemption to succeed", errs)
+	}
+}
+
+func TestEmailVerificationModes(t *testing.T) {
+	const gracePeriod = 7 * 24 * time.Hour
+
+	tests := []struct {
+		name         string
+		mode         string
+		require      bool
+		verified     bool
+		age          time.Duration // time since sign-up
+		wantErr      bool
+		wantClaim    *bool
+		wantDeadline bool
+	}{
+		{name: "disabled", verified: false},
+		{name: "block unverified", mode: EmailVerificationBlock, wantErr: true},
+		{name: "block verified", mode: EmailVerificationBlock, verified: true, wantClaim: boolPtr(true)},
+		{name: "RequireEmailVerification blocks", require: true, wantErr: true},
+		{name: "grace within the period", mode: EmailVerificationGrace, age: time.Hour, wantClaim: boolPtr(false), wantDeadline: true},
+		{name: "grace after the period", mode: EmailVerificationGrace, age: gracePeriod + time.Hour, wantErr: true},
+		{name: "grace verified", mode: EmailVerificationGrace, verified: true, age: gracePeriod + time.Hour, wantClaim: boolPtr(true)},
+		{name: "soft unverified", mode: EmailVerificationSoft, age: gracePeriod + time.Hour, wantClaim: boolPtr(false)},
+		{name: "soft verified", mode: EmailVerificationSoft, verified: true, wantClaim: boolPtr(true)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a, users, _ := newTestService(t, nil)
+			user := signUp(t, a, "jane@example.com").User
+
+			// Age and verify the account, then turn the mode on
+			stored, _ := users.GetUserByID(ctx, user.ID)
+			stored.CreatedAt = time.Now().Add(-tt.age)
+			stored.EmailVerified = tt.verified
+			if err := users.UpdateUser(ctx, stored); err != nil {
+				t.Fatalf("UpdateUser() error = %v", err)
+			}
+			a.config.EmailVerificationMode = tt.mode
+			a.config.RequireEmailVerification = tt.require
+			a.config.EmailVerificationGracePeriod = gracePeriod
+
+			response, err := a.SignIn(ctx, &SignInRequest{Email: "jane@example.com", Password: testPassword})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SignIn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrEmailNotVerified) {
+					t.Errorf("SignIn() error = %v, want ErrEmailNotVerified", err)
+				}
+				return
+			}
+
+			claims, err := a.ValidateToken(response.AccessToken)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+			if derefBool(claims.EmailVerified) != derefBool(tt.wantClaim) {
+				t.Errorf("email_verified = %v, want %v", derefBool(claims.EmailVerified), derefBool(tt.wantClaim))
+			}
+			wantDeadline := stored.CreatedAt.Add(gracePeriod)
+			if got := !claims.VerifyBy.IsZero(); got != tt.wantDeadline {
+				t.Errorf("verify_by = %v, want set %v", claims.VerifyBy, tt.wantDeadline)
+			} else if got && claims.VerifyBy.Unix() != wantDeadline.Unix() {
+				t.Errorf("verify_by = %v, want %v", claims.VerifyBy, wantDeadline)
+			}
+		})
+	}
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	h, a := newTestHandlers(t, nil)
+	tokenWith := func(verified *bool) string {
+		token, err := a.jwtManager.GenerateToken(TokenClaims{UserID: "user-1", EmailVerified: verified})
+		if err != nil {
+			t.Fatalf("GenerateToken() error = %v", err)
+		}
+		return token
+	}
+	ok := func(ctx HTTPContext) error { return ctx.String(http.StatusOK, "ok") }
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "verified", token: tokenWith(boolPtr(true)), wantStatus: http.StatusOK},
+		{name: "unverified", token: tokenWith(boolPtr(false)), wantStatus: http.StatusForbidden},
+		{name: "verification disabled", token: tokenWith(nil), wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodGet, "/billing", "").withBearer(tt.token)
+			serve(t, ctx, ok, h.AuthMiddleware(), h.RequireVerifiedEmail())
+
+			if ctx.status() != tt.wantStatus {
+				t.Errorf("status = %d, want %d", ctx.status(), tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusForbidden && ctx.body(t)["code"] != "email_not_verified" {
+				t.Errorf("code = %v, want email_not_verified", ctx.body(t)["code"])
+			}
+		})
+	}
+}
+
+func TestSignInHandlerEmailNotVerified(t *testing.T) {
+	h, a := newTestHandlers(t, nil)
+	signUp(t, a, "jane@example.com")
+	a.config.EmailVerificationMode = EmailVerificationBlock
+
+	ctx := newTestContext(http.MethodPost, "/auth/signin", signUpBody("jane@example.com", 0))
+	serve(t, ctx, h.SignInHandler)
+
+	if ctx.status() != http.StatusForbidden || ctx.body(t)["code"] != "email_not_verified" {
+		t.Errorf("status = %d, body = %v, want 403 email_not_verified", ctx.status(), ctx.body(t))
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+// derefBool returns "unset" for nil, else the value
+func derefBool(b *bool) interface{} {
+	if b == nil {
+		return "unset"
+	}
+	return *b
+}
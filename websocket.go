@@ -0,0 +1,54 @@
+package gotrust
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AuthenticateWebSocket validates the access token of a WebSocket upgrade
+// request, for use inside the upgrade handler before accepting the connection.
+//
+// Browsers cannot set an Authorization header on WebSocket connections, so the
+// token is read from the Sec-WebSocket-Protocol header, where it follows the
+// Config.WebSocketTokenProtocol entry (e.g. `new WebSocket(url, ["access_token", token])`),
+// or else from the Config.WebSocketTokenQueryParam query parameter. When the
+// subprotocol form is used, the server must select Config.WebSocketTokenProtocol
+// as the connection's subprotocol, never the token itself.
+//
+// On success the claims are also stored in the context (see GetClaims).
+func (h *GenericAuthHandlers) AuthenticateWebSocket(ctx HTTPContext) (*TokenClaims, error) {
+	tokenString := h.webSocketToken(ctx)
+	if tokenString == "" {
+		return nil, fmt.Errorf("websocket access token is required")
+	}
+
+	claims, err := h.authService.ValidateTokenContext(h.requestContext(ctx), tokenString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	SetClaims(ctx, claims)
+	return claims, nil
+}
+
+// webSocketToken extracts the access token from the upgrade request
+func (h *GenericAuthHandlers) webSocketToken(ctx HTTPContext) string {
+	if marker := h.config.WebSocketTokenProtocol; marker != "" {
+		var protocols []string
+		for _, header := range strings.Split(ctx.GetHeader("Sec-WebSocket-Protocol"), ",") {
+			protocols = append(protocols, strings.TrimSpace(header))
+		}
+
+		for i := 0; i < len(protocols)-1; i++ {
+			if protocols[i] == marker && protocols[i+1] != "" {
+				return protocols[i+1]
+			}
+		}
+	}
+
+	if param := h.config.WebSocketTokenQueryParam; param != "" {
+		return ctx.GetQueryParam(param)
+	}
+
+	return ""
+}
@@ -0,0 +1,56 @@
+package gotrust
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAuthenticateWebSocket(t *testing.T) {
+	h, a := newTestHandlers(t, func(c *Config) {
+		c.WebSocketTokenProtocol = "access_token"
+		c.WebSocketTokenQueryParam = "token"
+	})
+	response := signUp(t, a, "jane@example.com")
+
+	tests := []struct {
+		name     string
+		target   string
+		protocol string
+		wantErr  bool
+	}{
+		{name: "token in the subprotocol header", target: "/ws", protocol: "chat.v1, access_token, " + response.AccessToken},
+		{name: "token in the query", target: "/ws?token=" + response.AccessToken},
+		{name: "subprotocol marker without a token", target: "/ws", protocol: "chat.v1, access_token", wantErr: true},
+		{name: "token without the marker", target: "/ws", protocol: response.AccessToken, wantErr: true},
+		{name: "invalid token", target: "/ws", protocol: "access_token, not-a-token", wantErr: true},
+		{name: "no token", target: "/ws", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestContext(http.MethodGet, tt.target, "")
+			ctx.request.Header.Set("Connection", "Upgrade")
+			ctx.request.Header.Set("Upgrade", "websocket")
+			if tt.protocol != "" {
+				ctx.request.Header.Set("Sec-WebSocket-Protocol", tt.protocol)
+			}
+
+			claims, err := h.AuthenticateWebSocket(ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("AuthenticateWebSocket() = %+v, want error", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AuthenticateWebSocket() error = %v", err)
+			}
+			if claims.UserID != response.User.ID {
+				t.Errorf("AuthenticateWebSocket() user = %q, want %q", claims.UserID, response.User.ID)
+			}
+			if stored, ok := GetClaims(ctx); !ok || stored.UserID != response.User.ID {
+				t.Errorf("claims were not stored in the context")
+			}
+		})
+	}
+}